@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
+)
+
+const backendsLong = `Print what each popup backend honors of a popup, one backend a line.
+
+The backends open popups through very different mechanisms, and only
+tmux-popup takes everything exec's flags can ask for:
+
+  TITLE          --title is shown
+  ENV            the environment reaches the payload
+  PLACE          --x and --y are taken as cells and percentages, and --anchor
+  POSITIONS X/Y  the position specifiers --x and --y take (C, R, P, M, W, S)
+  SIZE           how much of --width and --height is taken: "full", "cells"
+                 (no percentages), "one axis" (one or the other) or "none"
+  CLIENT         the popup opens on the one client PINENTRY_USER_DATA names
+  EXIT STATUS    the command's exit status is known with no output stream
+                 to wait for
+
+wezterm's row is the split of a known pane; with no pane to split it opens a
+window that takes no geometry at all.
+
+A popup asking its backend for something it does not honor is what the
+"unsupported" configuration key decides about: "warn" (the default) logs it
+and opens the popup anyway, "fail" fails before anything is opened, and
+"ignore" says nothing.`
+
+func backendsCmd(parent *cobra.Command) {
+	var flagJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "backends",
+		Short: "Print what each popup backend supports",
+		Long:  backendsLong,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RenderBackends(cmd.OutOrStdout(), flagJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&flagJSON, "json", false, "print the matrix as a JSON array")
+
+	parent.AddCommand(cmd)
+}
@@ -10,14 +10,22 @@ import (
 )
 
 // configLongFmt documents the resolved-config shape so users can write --format
-// templates without reading the source. Its three %s are filled, in order, with
-// the config schema tree (cli.ConfigSchemaHelp), the supported backend names
-// (cli.BackendNameList) and the template-helper docs (cli.TemplateFuncHelp), so
-// no field, backend or helper can go missing here.
+// templates without reading the source. Its four %s are filled, in order, with
+// the --output formats (cli.ConfigFormatList), the config schema tree
+// (cli.ConfigSchemaHelp), the supported backend names (cli.BackendNameList)
+// and the template-helper docs (cli.TemplateFuncHelp), so no format, field,
+// backend or helper can go missing here.
 const configLongFmt = `config loads every layer (defaults < file < environment), applies any
-explicitly-set flags on top, and prints the fully-resolved configuration. With
-no flags it prints indented JSON; with --format it renders a Go text/template
-against the config value instead.
+explicitly-set flags on top, and prints the fully-resolved configuration: as
+indented JSON by default, in the format --output names (%s)
+the way a config file in it would hold it, or through the Go text/template
+given as --format. "config explain" prints which layer set each value.
+
+The config file is --config, else $RUN_IN_POPUP_CONF, else whichever of
+config.json, config.yaml and config.toml is in run-in-popup/ under the user
+config directory ($XDG_CONFIG_HOME, ~/.config by default). Its extension picks
+the format, JSON for any other, and that directory holding more than one of the
+three is an error rather than a guess at which was meant.
 
 The value passed to --format has this shape (Go field name, type, JSON key);
 nesting is shown as a tree so deep configs stay readable:
@@ -25,28 +33,34 @@ nesting is shown as a tree so deep configs stay readable:
 %s
 Valid Backend values are %s;
 empty auto-detects from the environment. Durations print as nanosecond counts
-in JSON; the environment layer accepts Go duration strings
-(RUN_IN_POPUP_TIMEOUTS_OVERALL=2m).
+in JSON and as Go duration strings in YAML and TOML; the environment layer
+accepts the strings (RUN_IN_POPUP_TIMEOUTS_OVERALL=2m), and the presets as the
+JSON object the file would hold. A preset whose geometry is malformed fails
+every command loading the configuration, not just the exec --preset that would
+have used it.
 
 Use the Go field names in --format (e.g. {{.PinentryPath}}, or
-{{.Timeouts.Overall}} for a nested field); the default JSON output uses the
-lower-case keys shown in parentheses. The template also sees these helper
+{{.Timeouts.Overall}} for a nested field); --output uses the lower-case keys
+shown in parentheses. The template also sees these helper
 functions:
 
 %s`
 
 const configExample = `  run-in-popup config
+  run-in-popup config --output toml > ~/.config/run-in-popup/config.toml
   run-in-popup config --format '{{.PinentryPath}}'
-  run-in-popup config --format '{{ json .Timeouts }}'`
+  run-in-popup config --format '{{ json .Timeouts }}'
+  run-in-popup config explain`
 
 func configCmd(parent *cobra.Command, flagConfig *string) {
-	var flagFormat string
+	var flagOutput, flagFormat string
 
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Print the resolved configuration",
 		Long: fmt.Sprintf(
 			configLongFmt,
+			cli.ConfigFormatList(),
 			cli.ConfigSchemaHelp(),
 			cli.BackendNameList(),
 			cli.TemplateFuncHelp(),
@@ -55,27 +69,120 @@ func configCmd(parent *cobra.Command, flagConfig *string) {
 		Args:              cobra.NoArgs,
 		ValidArgsFunction: cobra.NoFileCompletions,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runConfig(cmd, args, *flagConfig, flagFormat)
+			return runConfig(cmd, args, *flagConfig, flagOutput, flagFormat)
 		},
 	}
 
+	cmd.Flags().StringVarP(
+		&flagOutput,
+		"output",
+		"o",
+		"",
+		"config file format to print the resolved config in: "+cli.ConfigFormatList()+
+			" (default json)",
+	)
 	cmd.Flags().StringVarP(
 		&flagFormat,
 		"format",
 		"f",
 		"",
-		"Go text/template rendered against the resolved config instead of JSON",
+		"Go text/template rendered against the resolved config instead of encoding it",
 	)
 
+	cmd.MarkFlagsMutuallyExclusive("output", "format")
+
+	configExplainCmd(cmd, flagConfig)
 	parent.AddCommand(cmd)
 }
 
-func runConfig(cmd *cobra.Command, _ []string, flagConfig, flagFormat string) error {
+func runConfig(
+	cmd *cobra.Command,
+	_ []string,
+	flagConfig, flagOutput, flagFormat string,
+) error {
 	cfg, err := runinpopup.LoadConfig(flagConfig)
 	if err != nil {
 		return err
 	}
-	// Presentation (JSON / template rendering) lives in runinpopup/cli; ./cmd
-	// only wires it to stdout. cmd.Println would route to stderr.
-	return cli.RenderConfig(cmd.OutOrStdout(), cfg, flagFormat)
+	// Presentation (encoding / template rendering) lives in runinpopup/cli;
+	// ./cmd only wires it to stdout. cmd.Println would route to stderr.
+	return cli.RenderConfig(
+		cmd.OutOrStdout(),
+		cfg,
+		runinpopup.ConfigFormat(flagOutput),
+		flagFormat,
+	)
+}
+
+const configExplainLong = `explain loads the configuration as every command does and
+prints, for each key, its value and the layer that supplied it: "default",
+"file" and the file's path, "env" and the variable's name, or "flag" and the
+flag's. Layers apply defaults < file < environment < flags, so the source
+shown is the highest layer that set the key; the ones below it are overridden.
+
+Each preset is a line of its own, since a layer replaces a preset whole: the
+source shown is the layer whose preset of that name is the one in effect.
+
+--backend and --pinentry are the flags pinentry takes, and shown as the flag
+layer, for what a pinentry run given them would see; exec, json and the widgets
+take --backend alone.`
+
+const configExplainExample = `  run-in-popup config explain
+  run-in-popup config explain --backend zellij`
+
+// configFlagNames names, by key, the flag config explain credits a key of its
+// flag layer to.
+var configFlagNames = map[string]string{
+	"backend":       "--backend",
+	"pinentry_path": "--pinentry",
+}
+
+func configExplainCmd(parent *cobra.Command, flagConfig *string) {
+	var flagBackend, flagPinentry string
+
+	cmd := &cobra.Command{
+		Use:               "explain",
+		Short:             "Print each configured value and the layer that set it",
+		Long:              configExplainLong,
+		Example:           configExplainExample,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigExplain(
+				cmd,
+				*flagConfig,
+				pinentryFlagOverrides(cmd, flagBackend, flagPinentry),
+			)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&flagBackend,
+		"backend",
+		"",
+		fmt.Sprintf("popup backend to explain as flagged, %s", cli.BackendNameList()),
+	)
+	cmd.Flags().StringVar(
+		&flagPinentry,
+		"pinentry",
+		"",
+		"pinentry binary to explain as flagged",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func runConfigExplain(
+	cmd *cobra.Command,
+	flagConfig string,
+	overrides runinpopup.PartialConfig,
+) error {
+	cfg, provenance, err := runinpopup.LoadConfigExplained(flagConfig)
+	if err != nil {
+		return err
+	}
+	cfg = provenance.Overlay(cfg, overrides, func(key string) runinpopup.ConfigSource {
+		return runinpopup.ConfigSource{Layer: runinpopup.LayerFlag, Name: configFlagNames[key]}
+	})
+	return cli.RenderConfigExplain(cmd.OutOrStdout(), cfg, provenance)
 }
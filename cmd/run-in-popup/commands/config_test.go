@@ -40,6 +40,22 @@ func TestHelp_namesEveryBackend(t *testing.T) {
 			name: "exec documents its --backend flag",
 			text: func(t *testing.T) string { return backendFlagUsage(t, "exec") },
 		},
+		{
+			name: "json documents its --backend flag",
+			text: func(t *testing.T) string { return backendFlagUsage(t, "json") },
+		},
+		{
+			name: "choose documents its --backend flag",
+			text: func(t *testing.T) string { return backendFlagUsage(t, "choose") },
+		},
+		{
+			name: "doctor documents its --backend flag",
+			text: func(t *testing.T) string { return backendFlagUsage(t, "doctor") },
+		},
+		{
+			name: "env documents its --backend flag",
+			text: func(t *testing.T) string { return backendFlagUsage(t, "env") },
+		},
 		{
 			name: "pinentry documents its --backend flag",
 			text: func(t *testing.T) string { return backendFlagUsage(t, "pinentry") },
@@ -66,10 +82,15 @@ func backendFlagUsage(t *testing.T, command string) string {
 }
 
 // The config help is where a --format author reads the schema from, so every
-// documented field has to survive the way the command assembles its Long text.
+// documented field has to survive the way the command assembles its Long text,
+// and so does every format --output takes.
 func TestConfigHelp_showsTheSchemaAndTemplateHelpers(t *testing.T) {
 	long := findCommand(t, "config").Long
-	for _, want := range []string{cli.ConfigSchemaHelp(), cli.TemplateFuncHelp()} {
+	for _, want := range []string{
+		cli.ConfigFormatList(),
+		cli.ConfigSchemaHelp(),
+		cli.TemplateFuncHelp(),
+	} {
 		if !strings.Contains(long, want) {
 			t.Errorf("config help is missing:\n%s\ngot:\n%s", want, long)
 		}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ngicks/go-common/contextkey"
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/runworkspace"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
+)
+
+const doctorLong = `Check, link by link, what a popup needs to open, and print a checklist.
+
+A popup that never appears leaves nothing behind but a startup timeout. doctor
+resolves the configuration, PINENTRY_USER_DATA and the backend exactly as
+pinentry and exec do, then checks each link those two would go through: the
+multiplexer binary and its version, the server the session meta names, the
+client and session the popup is meant for, the work directory and a FIFO in
+the temporary directory, the configured pinentry, and finally a real popup
+that reports the terminal it ran on.
+
+Run it from where the popup fails — for a pinentry, with the PINENTRY_USER_DATA
+gpg-agent is given. A "warn" is a link that holds but likely shows the popup
+where nobody looks; a "fail" is one no popup gets past, and makes doctor exit
+non-zero. --no-popup leaves out the one check that opens something.`
+
+const doctorExample = `  run-in-popup doctor
+  run-in-popup doctor --json | jq '.[] | select(.status != "ok")'
+  PINENTRY_USER_DATA="TMUX_POPUP:$(which tmux):::${TMUX}" run-in-popup doctor --no-popup`
+
+const doctorWorkspacePrefix = "run-in-popup-doctor-"
+
+func doctorCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flagBackend string
+		flagJSON    bool
+		flagNoPopup bool
+	)
+
+	cmd := &cobra.Command{
+		Use:     "doctor",
+		Short:   "Check everything a popup needs, and say which link is broken",
+		Long:    doctorLong,
+		Example: doctorExample,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := runinpopup.LoadConfig(*flagConfig)
+			if err != nil {
+				return err
+			}
+			checks := doctorChecks(cmd.Context(), runtimeInputs{
+				Config:    cfg,
+				Overrides: execFlagOverrides(cmd, flagBackend),
+			}, os.Environ(), !flagNoPopup)
+			return printChecks(cmd.OutOrStdout(), checks, flagJSON)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&flagBackend,
+		"backend",
+		"",
+		fmt.Sprintf("popup backend, %s (default: auto-detected)", cli.BackendNameList()),
+	)
+	cmd.Flags().BoolVar(&flagJSON, "json", false, "print the checks as a JSON array")
+	cmd.Flags().BoolVar(&flagNoPopup, "no-popup", false, "skip the check opening a real popup")
+
+	parent.AddCommand(cmd)
+}
+
+// doctorChecks runs every check in the order a launch meets the links. The
+// popup is only tried when nothing before it failed: it would fail the same
+// way, after a startup timeout instead of at once.
+func doctorChecks(
+	ctx context.Context,
+	inputs runtimeInputs,
+	environ []string,
+	popup bool,
+) []runinpopup.Check {
+	var checks []runinpopup.Check
+	rt, err := resolveRuntime(ctx, inputs, environ)
+	if err != nil {
+		checks = append(checks, runinpopup.CheckResult("backend", "", err))
+	} else {
+		detail := rt.Backend.Name()
+		if rt.UserData.Kind != "" {
+			detail += ", for PINENTRY_USER_DATA kind " + rt.UserData.Kind
+		}
+		checks = append(checks, runinpopup.CheckResult("backend", detail, nil))
+		checks = append(checks, backend.Diagnose(
+			ctx, rt.Backend.Name(), backendOptions(rt.UserData, environ),
+		)...)
+	}
+	cfg := inputs.Overrides.Apply(inputs.Config)
+
+	logger := contextkey.ValueSlogLoggerFallback(ctx, slog.Default())
+	workspace, err := runworkspace.Open(doctorWorkspacePrefix, false, logger)
+	if err != nil {
+		checks = append(checks, runinpopup.CheckResult("workspace", "", err))
+	} else {
+		defer workspace.Close()
+		checks = append(checks, runinpopup.DiagnoseWorkspace(workspace.Options.Dir))
+	}
+	checks = append(checks,
+		runinpopup.DiagnoseFifo(),
+		runinpopup.DiagnosePinentry(cfg.PinentryPath),
+	)
+
+	switch {
+	case !popup:
+		checks = append(checks, runinpopup.Check{
+			Name: "popup", Status: runinpopup.CheckSkip, Detail: "--no-popup",
+		})
+	case failed(checks) > 0 || workspace == nil:
+		checks = append(checks, runinpopup.Check{
+			Name: "popup", Status: runinpopup.CheckSkip, Detail: "an earlier check failed",
+		})
+	default:
+		launcher := &runinpopup.PopupLauncher{
+			Backend:        rt.Backend,
+			Logger:         logger,
+			Workspace:      workspace.Options,
+			StartupTimeout: cfg.Timeouts.TTYRead,
+			// Whatever the backend makes of the title, the round trip is the
+			// same, and a warning about it is not what the user asked after.
+			Unsupported: runinpopup.UnsupportedIgnore,
+		}
+		checks = append(checks, launcher.DiagnoseRoundTrip(ctx))
+	}
+	return checks
+}
+
+func failed(checks []runinpopup.Check) int {
+	n := 0
+	for _, c := range checks {
+		if c.Status == runinpopup.CheckFail {
+			n++
+		}
+	}
+	return n
+}
+
+// printChecks prints the checklist, or with asJSON the checks as a JSON array,
+// and returns an error when one failed: the output is the same either way, and
+// a script reads the verdict from the exit status.
+func printChecks(w io.Writer, checks []runinpopup.Check, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, c := range checks {
+			fmt.Fprintf(tw, "[%s]\t%s\t%s\n", c.Status, c.Name, c.Detail)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if n := failed(checks); n > 0 {
+		return fmt.Errorf("%d of %d checks failed", n, len(checks))
+	}
+	return nil
+}
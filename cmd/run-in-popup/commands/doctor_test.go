@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+)
+
+func TestDoctorChecks(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cfg := runinpopup.DefaultConfig()
+	cfg.PinentryPath = "sh"
+	backendFlag := func(name string) runinpopup.PartialConfig {
+		return runinpopup.PartialConfig{Backend: &name}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		overrides runinpopup.PartialConfig
+		environ   []string
+		popup     bool
+		want      string
+	}{
+		{
+			// pty opens its popup in-process, so the whole chain runs for real.
+			name:      "every link holds",
+			overrides: backendFlag("pty"),
+			popup:     true,
+			want:      "backend:ok workspace:ok fifo:ok pinentry:ok popup:ok",
+		},
+		{
+			name:      "--no-popup",
+			overrides: backendFlag("pty"),
+			want:      "backend:ok workspace:ok fifo:ok pinentry:ok popup:skip",
+		},
+		{
+			name:    "no backend",
+			environ: []string{"PATH=/nonexistent"},
+			popup:   true,
+			want:    "backend:fail workspace:ok fifo:ok pinentry:ok popup:skip",
+		},
+		{
+			name:      "a broken backend",
+			overrides: backendFlag("zellij"),
+			environ:   []string{"PINENTRY_USER_DATA=ZELLIJ_POPUP:/nonexistent/zellij:work"},
+			popup:     true,
+			want: "backend:ok binary:fail workspace:ok fifo:ok pinentry:ok" +
+				" popup:skip",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checks := doctorChecks(t.Context(), runtimeInputs{
+				Config:    cfg,
+				Overrides: tc.overrides,
+			}, tc.environ, tc.popup)
+			var got []string
+			for _, c := range checks {
+				got = append(got, c.Name+":"+string(c.Status))
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("doctorChecks = %s, want %s\n%+v", strings.Join(got, " "), tc.want, checks)
+			}
+		})
+	}
+}
+
+func TestPrintChecks(t *testing.T) {
+	checks := []runinpopup.Check{
+		{Name: "binary", Status: runinpopup.CheckOK, Detail: "/usr/bin/tmux"},
+		{Name: "session meta", Status: runinpopup.CheckFail, Detail: "the server socket is gone"},
+	}
+
+	var text bytes.Buffer
+	err := printChecks(&text, checks, false)
+	if err == nil || err.Error() != "1 of 2 checks failed" {
+		t.Errorf("printChecks = %v, want the failure counted", err)
+	}
+	want := "[ok]    binary        /usr/bin/tmux\n" +
+		"[fail]  session meta  the server socket is gone\n"
+	if text.String() != want {
+		t.Errorf("printChecks printed\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	if err := printChecks(&out, checks[:1], true); err != nil {
+		t.Errorf("printChecks = %v with nothing failed", err)
+	}
+	var back []runinpopup.Check
+	if err := json.Unmarshal(out.Bytes(), &back); err != nil {
+		t.Fatalf("--json printed no JSON: %v\n%s", err, out.String())
+	}
+	if len(back) != 1 || back[0] != checks[0] {
+		t.Errorf("--json round-trips to %+v", back)
+	}
+}
@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
+)
+
+const envLong = `Print the shell statement exporting PINENTRY_USER_DATA for the multiplexer
+this shell runs in, for a shell's startup file to eval:
+
+  eval "$(run-in-popup env)"                 # bash, zsh
+  run-in-popup env --shell fish | source     # fish
+
+The value is the one a hand-written wrapper would export: the backend's kind,
+the multiplexer binary, and the session, client and socket the popup opens on.
+What the environment does not say is asked of the multiplexer itself, so tmux
+is queried for the client and session of the calling shell.
+
+The backend is --backend, else the configured one, else whatever the
+environment reveals. A PINENTRY_USER_DATA already exported does not pick it:
+that is the value being rebuilt, and it may have been inherited from a shell
+outside the multiplexer.
+
+The session recorded is the one the shell started in; a shell moved to another
+tmux session by the user keeps exporting the old one. Append "_DYNAMIC" to the
+kind to have pinentry look the session up when it runs instead.`
+
+// Shells env knows how to quote for. bash and zsh share one syntax; fish has
+// its own.
+const (
+	envShellBash = "bash"
+	envShellZsh  = "zsh"
+	envShellFish = "fish"
+)
+
+func envCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flagBackend string
+		flagShell   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print the PINENTRY_USER_DATA export for the multiplexer this shell runs in",
+		Long:  envLong,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEnv(cmd, *flagConfig, flagBackend, flagShell, os.Environ())
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&flagBackend,
+		"backend",
+		"",
+		fmt.Sprintf("popup backend, %s (default: auto-detected)", cli.BackendNameList()),
+	)
+	cmd.Flags().StringVar(
+		&flagShell,
+		"shell",
+		"",
+		"shell syntax to print, bash, zsh or fish (default: $SHELL's, else bash)",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+func runEnv(
+	cmd *cobra.Command,
+	flagConfig, flagBackend, flagShell string,
+	environ []string,
+) error {
+	shell := flagShell
+	if shell == "" {
+		shell = envDefaultShell(lookupEnviron(environ, "SHELL"))
+	}
+
+	cfg, err := runinpopup.LoadConfig(flagConfig)
+	if err != nil {
+		return err
+	}
+	cfg = execFlagOverrides(cmd, flagBackend).Apply(cfg)
+
+	name := cfg.Backend
+	if name == "" {
+		if name, err = backend.DetectName(environHints(environ)); err != nil {
+			return err
+		}
+	}
+
+	data, err := backend.UserDataHere(cmd.Context(), name, backend.Here{
+		TMUX:              lookupEnviron(environ, "TMUX"),
+		ZellijSessionName: lookupEnviron(environ, "ZELLIJ_SESSION_NAME"),
+		STY:               lookupEnviron(environ, "STY"),
+		ScreenDir:         lookupEnviron(environ, "SCREENDIR"),
+		NVIM:              lookupEnviron(environ, "NVIM"),
+		WeztermPane:       lookupEnviron(environ, "WEZTERM_PANE"),
+		WeztermUnixSocket: lookupEnviron(environ, "WEZTERM_UNIX_SOCKET"),
+		KittyWindowId:     lookupEnviron(environ, "KITTY_WINDOW_ID"),
+		KittyListenOn:     lookupEnviron(environ, "KITTY_LISTEN_ON"),
+	})
+	if err != nil {
+		return err
+	}
+
+	statement, err := envExport(shell, "PINENTRY_USER_DATA", data.String())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), statement)
+	return err
+}
+
+// envDefaultShell is the syntax for the login shell named by $SHELL. Anything
+// that is not fish reads the bash syntax: sh, dash and ksh all take export
+// NAME='value' as bash does.
+func envDefaultShell(shellPath string) string {
+	if filepath.Base(shellPath) == envShellFish {
+		return envShellFish
+	}
+	return envShellBash
+}
+
+// envExport is the statement exporting name as value in shell's syntax. The
+// value is single-quoted in both: it holds socket paths and tmux's "$1"
+// session ids, which double quotes would expand.
+func envExport(shell, name, value string) (string, error) {
+	switch shell {
+	case envShellBash, envShellZsh:
+		// A POSIX single-quoted string cannot hold a quote at all; it is closed,
+		// an escaped one added, and reopened.
+		return "export " + name + "='" + strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+	case envShellFish:
+		// fish single quotes take \' and \\ as escapes and nothing else.
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+		return "set -gx " + name + " '" + quoted + "'", nil
+	default:
+		return "", fmt.Errorf(
+			"unknown shell %q: valid values are %s, %s, %s",
+			shell, envShellBash, envShellZsh, envShellFish,
+		)
+	}
+}
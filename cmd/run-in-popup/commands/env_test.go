@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvExport(t *testing.T) {
+	const value = `TMUX_POPUP:/usr/bin/tmux:$1:it's:C:\dir`
+	for _, tc := range []struct {
+		shell   string
+		want    string
+		wantErr string
+	}{
+		{
+			shell: "bash",
+			want:  `export PINENTRY_USER_DATA='TMUX_POPUP:/usr/bin/tmux:$1:it'\''s:C:\dir'`,
+		},
+		{
+			shell: "zsh",
+			want:  `export PINENTRY_USER_DATA='TMUX_POPUP:/usr/bin/tmux:$1:it'\''s:C:\dir'`,
+		},
+		{
+			shell: "fish",
+			want:  `set -gx PINENTRY_USER_DATA 'TMUX_POPUP:/usr/bin/tmux:$1:it\'s:C:\\dir'`,
+		},
+		{
+			shell:   "csh",
+			wantErr: `unknown shell "csh"`,
+		},
+	} {
+		t.Run(tc.shell, func(t *testing.T) {
+			got, err := envExport(tc.shell, "PINENTRY_USER_DATA", value)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("envExport = %q, %v, want an error containing %q",
+						got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("envExport: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("envExport =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+// The backend follows the same precedence as every popup command, minus the
+// PINENTRY_USER_DATA being rebuilt, and the syntax follows the login shell.
+func TestRunEnv(t *testing.T) {
+	const nvim = "NVIM=/run/user/1000/nvim.1.0"
+	for _, tc := range []struct {
+		name    string
+		flags   map[string]string
+		environ []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "detected",
+			environ: []string{nvim, "SHELL=/bin/zsh"},
+			want:    "export PINENTRY_USER_DATA='NVIM_POPUP::::/run/user/1000/nvim.1.0'\n",
+		},
+		{
+			name:    "the login shell's syntax",
+			environ: []string{nvim, "SHELL=/usr/local/bin/fish"},
+			want:    "set -gx PINENTRY_USER_DATA 'NVIM_POPUP::::/run/user/1000/nvim.1.0'\n",
+		},
+		{
+			name:    "--shell over $SHELL",
+			flags:   map[string]string{"shell": "bash"},
+			environ: []string{nvim, "SHELL=/usr/local/bin/fish"},
+			want:    "export PINENTRY_USER_DATA='NVIM_POPUP::::/run/user/1000/nvim.1.0'\n",
+		},
+		{
+			name:    "an exported value picks nothing",
+			environ: []string{nvim, "PINENTRY_USER_DATA=TMUX_POPUP:/usr/bin/tmux:$1"},
+			want:    "export PINENTRY_USER_DATA='NVIM_POPUP::::/run/user/1000/nvim.1.0'\n",
+		},
+		{
+			name:    "--backend",
+			flags:   map[string]string{"backend": "pty"},
+			environ: []string{nvim},
+			wantErr: "backend pty opens on no multiplexer",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := findCommand(t, "env")
+			cmd.SetContext(t.Context())
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			for name, value := range tc.flags {
+				if err := cmd.Flags().Set(name, value); err != nil {
+					t.Fatalf("setting --%s: %v", name, err)
+				}
+			}
+			backendFlag, _ := cmd.Flags().GetString("backend")
+			shellFlag, _ := cmd.Flags().GetString("shell")
+
+			err := runEnv(
+				cmd,
+				filepath.Join(t.TempDir(), "none.json"),
+				backendFlag,
+				shellFlag,
+				tc.environ,
+			)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("runEnv = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runEnv: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("runEnv printed %q, want %q", out.String(), tc.want)
+			}
+		})
+	}
+}
+
+// kitty's --to address reaches the value as $KITTY_LISTEN_ON gave it, scheme
+// and all; the colon in it is what the keyed encoding is for.
+func TestRunEnv_kittySocket(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "kitty"), nil, 0o755); err != nil {
+		t.Fatalf("writing the fake kitty: %v", err)
+	}
+	t.Setenv("PATH", bin)
+	cmd := findCommand(t, "env")
+	cmd.SetContext(t.Context())
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+
+	err := runEnv(
+		cmd,
+		filepath.Join(t.TempDir(), "none.json"),
+		"kitty",
+		"bash",
+		[]string{"KITTY_WINDOW_ID=7", "KITTY_LISTEN_ON=unix:/tmp/kitty-1"},
+	)
+	if err != nil {
+		t.Fatalf("runEnv: %v", err)
+	}
+	want := "export PINENTRY_USER_DATA='RIP1;kind=KITTY_POPUP;bin=" + bin + "/kitty" +
+		";session=7;socket=unix:/tmp/kitty-1'\n"
+	if out.String() != want {
+		t.Errorf("runEnv printed %q, want %q", out.String(), want)
+	}
+}
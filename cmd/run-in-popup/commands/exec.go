@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/ngicks/go-common/contextkey"
 	"github.com/spf13/cobra"
@@ -37,33 +40,74 @@ A pipeline through the popup therefore says so in the command:
 exec exits 0 once the bridge is over: the popup opened and both output streams
 ended. It exits 1 when the popup could not be opened, never reached the command,
 or a stream could not be relayed. The command's own exit status is not passed on
-— only some popup mechanisms carry it back at all, so reporting it would mean a
-different answer per backend — and a caller that needs it has to have the
-command report it in what it writes.
+unless --propagate-status asks for it, because only some popup mechanisms carry
+it back by themselves. With the flag the command reports its status over a FIFO
+of its own, the same way on every backend, and exec exits with it once the
+bridge is over — 1 still meaning the bridge failed if the command never got to
+report one.
+
+  run-in-popup exec --propagate-status -- make test
 
 --x, --y, --width and --height place and size the popup, in the vocabulary tmux
 takes: a bare number is terminal cells and "N%" a percentage of the terminal.
 --x and --y are the popup's top-left corner on every backend. --x and --y
 additionally take tmux's position specifiers — C the centre of the terminal, R
 its right side, P the bottom left of the pane, M the mouse position, W the
-window position on the status line, S the line above or below it — which the
-zellij backend rejects, having no equivalent for them. Whatever is left unset is
-the backend's own placement.
+window position on the status line, S the line above or below it. The zellij
+backend has none of its own, and works out where C, R for --x and S for --y
+(the bottom edge) put the pane, refusing the rest. The nvim backend floats
+the popup over the editor, sized to half of it and centred by default, and
+takes C, and R for --x, but none of the other specifiers. The wezterm backend
+splits a pane rather than floating one, so it takes no position at all and one
+size: --height splits below and --width to the right. The screen and kitty
+backends open a window that is not theirs to place or size, and refuse all
+four. The pty backend runs the command on a terminal nobody displays, sized in
+cells by --width and --height, 80x24 otherwise, with no position to take.
+Whatever is left unset is the backend's own placement.
 
   run-in-popup exec --width 80% --height 20 -- htop
 
 tmux's display-popup places a popup by its bottom edge, so the tmux-popup
-backend adds the height to a numeric --y itself and needs --height in the same
-unit to do it: a numeric or percentage --y without one, or with one in the other
-unit, fails the launch. The line below opens a 20-row popup whose top-left
-corner is column 0, row 5 — on that backend as on any other.
+backend adds the height to a numeric --y itself, resolving the two to cells
+against the client's size when they are in different units or --height is left
+to tmux's half of the terminal. The line below opens a 20-row popup whose
+top-left corner is column 0, row 5 — on that backend as on any other.
 
   run-in-popup exec --x 0 --y 5 --height 20 -- htop
 
---backend wins over the configured backend, which in turn wins over
-auto-detection from PINENTRY_USER_DATA, then $TMUX (which selects tmux-popup;
-tmux floating panes stay an explicit choice), then $ZELLIJ. Everything after
-"--" is the command and is passed through unchanged.`
+--anchor places the popup by name instead of by --x and --y: top-left, top,
+top-right, left, center, right, bottom-left, bottom or bottom-right. --margin
+keeps it that far from the edges it is anchored to, in cells or "N%" of the
+terminal. Every backend that places a popup measures what it places it on and
+works out the corner itself, zellij included, so an anchor is the one way to say
+"top right, two cells in" that means the same everywhere. A popup is anchored
+at half the terminal along an axis with no size given, and --anchor cannot be
+combined with --x or --y.
+
+  run-in-popup exec --anchor top-right --margin 2 --width 60 --height 20 -- htop
+
+--width and --height also take fit, which sizes the popup to what the command
+shows. The command is run once beforehand, with no terminal and
+RUN_IN_POPUP_FIT naming a FIFO: it writes "<width> <height>" there, in cells,
+and exits. Run again in the popup it finds the variable unset and does its
+work. The popup is opened that size plus its frame, within the fit bounds of
+the configuration, and a command that exits without reporting fails exec.
+
+  run-in-popup exec --width fit --height fit -- ./confirm-deploy.sh
+
+--preset NAME takes the backend, title, geometry and environment the flags of
+the run leave unset from the preset of that name in the configuration, so a
+recurring use is placed the same way every time. --x or --y replaces a preset's
+anchor and margin, and --anchor its x and y, rather than combining with them.
+
+  run-in-popup exec --preset review -- tig
+
+--backend wins over a preset's backend, which wins over the configured backend,
+which in turn wins over auto-detection from PINENTRY_USER_DATA, then $TMUX
+(which selects tmux-popup; tmux floating panes stay an explicit choice), then
+$ZELLIJ, then $STY, then $NVIM, then $WEZTERM_PANE, then $KITTY_WINDOW_ID
+(which selects kitty; OS windows stay an explicit choice).
+Everything after "--" is the command and is passed through unchanged.`
 
 // execWorkspacePrefix names the directory holding one run's stream FIFOs, and
 // its debug log when the run has one.
@@ -74,12 +118,13 @@ const execExample = `  run-in-popup exec -- htop
   run-in-popup exec --width 80% --height 20 -- htop
   file=$(find . -type f | run-in-popup exec -- sh -c 'fzf <&3 >&4')`
 
-// execGeometry is where and how big the popup is, as typed. The four values
-// travel together rather than one by one: they are same-typed neighbours, and a
-// pair of them swapped at a call site would compile and place the popup
-// somewhere else.
+// execGeometry is where and how big the popup is, as typed. The values travel
+// together rather than one by one: they are same-typed neighbours, and a pair
+// of them swapped at a call site would compile and place the popup somewhere
+// else.
 type execGeometry struct {
 	x, y, width, height string
+	anchor, margin      string
 }
 
 func execCmd(parent *cobra.Command, flagConfig *string) {
@@ -87,6 +132,8 @@ func execCmd(parent *cobra.Command, flagConfig *string) {
 		flagBackend  string
 		flagTitle    string
 		flagGeometry execGeometry
+		flagStatus   bool
+		flagPreset   string
 	)
 
 	cmd := &cobra.Command{
@@ -96,7 +143,9 @@ func execCmd(parent *cobra.Command, flagConfig *string) {
 		Example: execExample,
 		Args:    cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runExec(cmd, args, *flagConfig, flagBackend, flagTitle, flagGeometry)
+			return runExec(
+				cmd, args, *flagConfig, flagBackend, flagTitle, flagPreset, flagGeometry, flagStatus,
+			)
 		},
 	}
 
@@ -111,46 +160,79 @@ func execCmd(parent *cobra.Command, flagConfig *string) {
 		"title",
 		"",
 		"popup title (default: the backend's own;"+
-			" tmux-floating-pane has no title flag and ignores it)",
+			" run-in-popup backends lists the ones showing none)",
+	)
+	execGeometryFlags(cmd, &flagGeometry)
+	cmd.Flags().StringVar(
+		&flagPreset,
+		"preset",
+		"",
+		"configured preset supplying the backend, title, geometry and environment"+
+			" the flags leave unset",
+	)
+	cmd.Flags().BoolVar(
+		&flagStatus,
+		"propagate-status",
+		false,
+		"exit with the command's own exit status once the bridge is over",
 	)
+
+	parent.AddCommand(cmd)
+}
+
+// execGeometryFlags registers --x, --y, --width, --height, --anchor and
+// --margin into g, for every command that opens a popup a user asks to place.
+func execGeometryFlags(cmd *cobra.Command, g *execGeometry) {
 	cmd.Flags().StringVar(
-		&flagGeometry.x,
+		&g.x,
 		"x",
 		"",
 		`popup x position: cells, "N%" or a tmux position specifier`+
-			" C/R/P/M/W/S, which zellij rejects (default: the backend's own)",
+			" C/R/P/M/W/S, see run-in-popup backends (default: the backend's own)",
 	)
 	cmd.Flags().StringVar(
-		&flagGeometry.y,
+		&g.y,
 		"y",
 		"",
-		"popup y position, same syntax as --x"+
-			" (tmux-popup needs --height in the same unit as a numeric --y)",
+		"popup y position, same syntax as --x",
 	)
 	cmd.Flags().StringVarP(
-		&flagGeometry.width,
+		&g.width,
 		"width",
 		"w",
 		"",
-		`popup width: cells or "N%" (default: the backend's own)`,
+		`popup width: cells, "N%" or fit to size it to its content`+
+			" (default: the backend's own)",
 	)
 	// No shorthand: cobra hands -h to --help, so --height cannot have the one its
 	// tmux flag would suggest.
 	cmd.Flags().StringVar(
-		&flagGeometry.height,
+		&g.height,
 		"height",
 		"",
 		"popup height, same syntax as --width",
 	)
-
-	parent.AddCommand(cmd)
+	cmd.Flags().StringVar(
+		&g.anchor,
+		"anchor",
+		"",
+		"place the popup by name instead of --x/--y: top-left, top, top-right, left,"+
+			" center, right, bottom-left, bottom or bottom-right",
+	)
+	cmd.Flags().StringVar(
+		&g.margin,
+		"margin",
+		"",
+		`distance from the edges --anchor puts the popup against: cells or "N%"`,
+	)
 }
 
 func runExec(
 	cmd *cobra.Command,
 	args []string,
-	flagConfig, flagBackend, flagTitle string,
+	flagConfig, flagBackend, flagTitle, flagPreset string,
 	flagGeometry execGeometry,
+	propagateStatus bool,
 ) (err error) {
 	ctx := cmd.Context()
 
@@ -164,9 +246,25 @@ func runExec(
 		return err
 	}
 
-	rt, err := resolveRuntime(runtimeInputs{
+	overrides := execFlagOverrides(cmd, flagBackend)
+	var env map[string]string
+	if flagPreset != "" {
+		preset, ok := cfg.Presets[flagPreset]
+		if !ok {
+			return unknownPresetError(flagPreset, cfg.Presets)
+		}
+		flagTitle, flagGeometry = applyPreset(cmd, preset, flagTitle, flagGeometry)
+		// Under --backend, like everything else in it; over the configured and
+		// detected backend, since the preset was asked for by name in this run.
+		if overrides.Backend == nil && preset.Backend != "" {
+			overrides.Backend = &preset.Backend
+		}
+		env = preset.Env
+	}
+
+	rt, err := resolveRuntime(ctx, runtimeInputs{
 		Config:    cfg,
-		Overrides: execFlagOverrides(cmd, flagBackend),
+		Overrides: overrides,
 	}, os.Environ())
 	if err != nil {
 		return err
@@ -189,17 +287,22 @@ func runExec(
 	}()
 
 	popup := &runinpopup.PopupLauncher{
-		Backend:   rt.Backend,
-		Logger:    workspace.Logger,
-		Workspace: workspace.Options,
+		Backend:     rt.Backend,
+		Logger:      workspace.Logger,
+		Workspace:   workspace.Options,
+		Unsupported: runinpopup.UnsupportedPolicy(rt.Config.Unsupported),
+		Fit:         rt.Config.Fit,
 	}
 	// The launch closes every endpoint it is handed once that stream ends, and
 	// these three are this process's own, handed to it by whoever ran it — so they
 	// go in behind ends that ignore being closed.
+	spec := execSpec(flagTitle, flagGeometry, command)
+	spec.Env = env
 	return execBridge(
 		ctx,
 		popup,
-		execSpec(flagTitle, flagGeometry, command),
+		spec,
+		propagateStatus,
 		io.NopCloser(os.Stdin),
 		unclosableWriter{os.Stdout},
 		unclosableWriter{os.Stderr},
@@ -217,18 +320,73 @@ func execSpec(title string, geometry execGeometry, command []string) runinpopup.
 		Y:       geometry.y,
 		Width:   geometry.width,
 		Height:  geometry.height,
+		Anchor:  geometry.anchor,
+		Margin:  geometry.margin,
 		Command: command,
 	}
 }
 
+// applyPreset lays the flags of one run over the preset it names: a flag given
+// on the command line wins, and one left alone takes the preset's value.
+//
+// Placement is taken whole from one side, because --x and --y cannot be
+// combined with --anchor: a run placing the popup either way drops the way the
+// preset places it, rather than failing on a combination nobody typed.
+func applyPreset(
+	cmd *cobra.Command,
+	preset runinpopup.PresetConfig,
+	title string,
+	g execGeometry,
+) (string, execGeometry) {
+	flags := cmd.Flags()
+	pick := func(name, flag, fromPreset string) string {
+		if flags.Changed(name) {
+			return flag
+		}
+		return fromPreset
+	}
+	if flags.Changed("x") || flags.Changed("y") {
+		preset.Anchor, preset.Margin = "", ""
+	}
+	if flags.Changed("anchor") {
+		preset.X, preset.Y = "", ""
+	}
+	return pick("title", title, preset.Title), execGeometry{
+		x:      pick("x", g.x, preset.X),
+		y:      pick("y", g.y, preset.Y),
+		width:  pick("width", g.width, preset.Width),
+		height: pick("height", g.height, preset.Height),
+		anchor: pick("anchor", g.anchor, preset.Anchor),
+		margin: pick("margin", g.margin, preset.Margin),
+	}
+}
+
+// unknownPresetError names the presets there are, since the likely cause of a
+// miss is a typo of one of them.
+func unknownPresetError(name string, presets map[string]runinpopup.PresetConfig) error {
+	if len(presets) == 0 {
+		return fmt.Errorf("unknown preset %q: the configuration has none", name)
+	}
+	return fmt.Errorf(
+		"unknown preset %q: the configuration has %s",
+		name, strings.Join(slices.Sorted(maps.Keys(presets)), ", "),
+	)
+}
+
 // execBridge runs spec in a popup with this process's three streams reaching it
 // beside its own, and returns once what the command wrote to fd 4 and fd 5 has
 // arrived. The input relay is not waited on: it sits in a read on this process's
 // stdin, which the popup being over says nothing about.
+//
+// With propagateStatus a bridge that went through returns the command's own
+// failure as an *ExitStatusError. Its status is reported before the command's
+// streams end, so one missing once they have is a command that never finished —
+// a popup dismissed under it — and that is the bridge failing, not the command.
 func execBridge(
 	ctx context.Context,
 	popup *runinpopup.PopupLauncher,
 	spec runinpopup.PopupSpec,
+	propagateStatus bool,
 	stdin io.ReadCloser,
 	stdout, stderr io.WriteCloser,
 ) error {
@@ -238,12 +396,35 @@ func execBridge(
 		Stderr: stderr,
 		// The popup's terminal is the command's, so what the user runs draws there
 		// as it would anywhere; the caller's streams are the side channel.
-		KeepStdio: true,
+		KeepStdio:  true,
+		ExitStatus: propagateStatus,
 	})
 	if err != nil {
 		return err
 	}
-	return command.WaitStreams()
+	if err := command.WaitStreams(); err != nil || !propagateStatus {
+		return err
+	}
+	code, ok := command.ExitCode()
+	if !ok {
+		return errors.New("the command ended without reporting an exit status")
+	}
+	if code != 0 {
+		return &ExitStatusError{Code: code}
+	}
+	return nil
+}
+
+// ExitStatusError is a command run in a popup that exited non-zero, with the
+// status this process is to exit with in its stead. It is not a failure of
+// run-in-popup's own: main exits with Code and says nothing, the command having
+// had the popup to say whatever it had to.
+type ExitStatusError struct {
+	Code int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("the command exited with status %d", e.Code)
 }
 
 // unclosableWriter hands a writer out to something that closes what it is given;
@@ -261,8 +442,8 @@ func execCommandArgs(cmd *cobra.Command, args []string) ([]string, error) {
 		args = args[dash:]
 	}
 	if len(args) == 0 {
-		return nil, errors.New(
-			`no command to run: pass one after "--", e.g. run-in-popup exec -- make test`,
+		return nil, fmt.Errorf(
+			`no command to run: pass one after "--", e.g. %s -- make test`, cmd.CommandPath(),
 		)
 	}
 	return args, nil
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"os"
 	"os/exec"
 	"slices"
 	"strings"
@@ -50,6 +51,12 @@ func (b *popupShell) Launch(
 		script = "true"
 	}
 	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	// The popup's environment is the command's on top of whatever the
+	// multiplexer's own is, which here is this process's.
+	cmd.Env = os.Environ()
+	for k, v := range spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	// A dismissed popup takes everything running inside it along; killing the
 	// shell alone would leave the command it started holding the streams open.
@@ -146,6 +153,7 @@ printf 'and this too\n' >&2
 printf 'out two\n' >&4
 printf 'err two\n' >&5
 exit 3`),
+		false,
 		noStdin(), stdout, stderr,
 	)
 	if err != nil {
@@ -162,6 +170,45 @@ exit 3`),
 	}
 }
 
+// Asked for, the command's status is exec's to exit with: a failure comes back as
+// the status itself, a success as no error at all, and the bridge still relays
+// everything either way.
+func TestExecBridge_propagateStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		script   string
+		wantCode int
+	}{
+		{name: "success", script: "printf out >&4", wantCode: 0},
+		{name: "failure", script: "printf out >&4; exit 3", wantCode: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := newPopupOutput()
+
+			err := execBridge(
+				t.Context(),
+				popupLauncher(&popupShell{}),
+				shellSpec(tc.script),
+				true,
+				noStdin(), stdout, newPopupOutput(),
+			)
+			if tc.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("execBridge: %v", err)
+				}
+			} else {
+				statusErr, ok := errors.AsType[*ExitStatusError](err)
+				if !ok || statusErr.Code != tc.wantCode {
+					t.Fatalf("execBridge = %v, want exit status %d", err, tc.wantCode)
+				}
+			}
+			if got, want := stdout.String(), "out"; got != want {
+				t.Errorf("stdout = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
 // The third stream goes the other way: what a caller pipes into exec is what the
 // command reads, so a pipeline works through the popup.
 func TestExecBridge_relaysStdin(t *testing.T) {
@@ -171,6 +218,7 @@ func TestExecBridge_relaysStdin(t *testing.T) {
 		t.Context(),
 		popupLauncher(&popupShell{}),
 		shellSpec("cat <&3 >&4"),
+		false,
 		io.NopCloser(strings.NewReader("piped in by the caller")),
 		stdout, newPopupOutput(),
 	)
@@ -198,6 +246,7 @@ func TestExecBridge_returnsWhileTheCallerStdinStaysOpen(t *testing.T) {
 			t.Context(),
 			popupLauncher(&popupShell{}),
 			shellSpec("printf 'done without reading stdin' >&4"),
+			false,
 			stdin, stdout, newPopupOutput(),
 		)
 	}()
@@ -224,6 +273,7 @@ func TestExecBridge_outputOutgrowsAPipeBuffer(t *testing.T) {
 		t.Context(),
 		popupLauncher(&popupShell{}),
 		shellSpec("seq 1 40000 >&4"),
+		false,
 		noStdin(), stdout, newPopupOutput(),
 	)
 	if err != nil {
@@ -250,6 +300,7 @@ func TestExecBridge_leavesTheProcessStreamsOpen(t *testing.T) {
 		t.Context(),
 		popupLauncher(&popupShell{}),
 		shellSpec("printf 'from the popup' >&4"),
+		false,
 		noStdin(), unclosableWriter{stdout}, newPopupOutput(),
 	)
 	if err != nil {
@@ -280,6 +331,7 @@ func TestExecBridge_popupDismissedWhileTheCommandRuns(t *testing.T) {
 			ctx,
 			popupLauncher(&popupShell{}),
 			shellSpec("printf started >&4; sleep 30"),
+			false,
 			noStdin(), stdout, newPopupOutput(),
 		)
 	}()
@@ -309,6 +361,7 @@ func TestExecBridge_popupThatCannotBeOpened(t *testing.T) {
 		t.Context(),
 		popupLauncher(&popupShell{launchErr: launchErr}),
 		shellSpec("true"),
+		false,
 		noStdin(), newPopupOutput(), newPopupOutput(),
 	)
 	if !errors.Is(err, launchErr) || !strings.Contains(err.Error(), "popup failed") {
@@ -327,6 +380,7 @@ func TestExecBridge_popupThatNeverRunsTheCommand(t *testing.T) {
 		t.Context(),
 		launcher,
 		shellSpec("true"),
+		false,
 		noStdin(), newPopupOutput(), newPopupOutput(),
 	)
 	elapsed := time.Since(start)
@@ -359,6 +413,9 @@ func parseExecFlags(
 	cmd.Flags().StringVar(&flagGeometry.y, "y", "", "")
 	cmd.Flags().StringVarP(&flagGeometry.width, "width", "w", "", "")
 	cmd.Flags().StringVar(&flagGeometry.height, "height", "", "")
+	cmd.Flags().StringVar(&flagGeometry.anchor, "anchor", "", "")
+	cmd.Flags().StringVar(&flagGeometry.margin, "margin", "", "")
+	cmd.Flags().String("preset", "", "")
 	if err := cmd.ParseFlags(argv); err != nil {
 		t.Fatalf("ParseFlags(%q): %v", argv, err)
 	}
@@ -482,6 +539,84 @@ func TestExecFlagOverrides(t *testing.T) {
 	}
 }
 
+// A preset fills in what the run's flags leave unset, and gives way to what they
+// set; its placement gives way whole.
+func TestApplyPreset(t *testing.T) {
+	preset := runinpopup.PresetConfig{
+		Title:  "review",
+		Width:  "40%",
+		Height: "fit",
+		Anchor: "right",
+		Margin: "1",
+	}
+	for _, tc := range []struct {
+		name      string
+		argv      []string
+		wantTitle string
+		want      execGeometry
+	}{
+		{
+			name:      "no flags take the preset as it is",
+			argv:      []string{"--", "tig"},
+			wantTitle: "review",
+			want:      execGeometry{width: "40%", height: "fit", anchor: "right", margin: "1"},
+		},
+		{
+			name:      "a flag wins over its field",
+			argv:      []string{"--title", "log", "-w", "80", "--", "tig"},
+			wantTitle: "log",
+			want:      execGeometry{width: "80", height: "fit", anchor: "right", margin: "1"},
+		},
+		{
+			name:      "an explicitly empty flag is a value too",
+			argv:      []string{"--height=", "--", "tig"},
+			wantTitle: "review",
+			want:      execGeometry{width: "40%", anchor: "right", margin: "1"},
+		},
+		{
+			name:      "a position replaces the preset's anchor and margin",
+			argv:      []string{"--x", "0", "--", "tig"},
+			wantTitle: "review",
+			want:      execGeometry{x: "0", width: "40%", height: "fit"},
+		},
+		{
+			name:      "an anchor keeps the margin that goes with one",
+			argv:      []string{"--anchor", "top", "--", "tig"},
+			wantTitle: "review",
+			want:      execGeometry{width: "40%", height: "fit", anchor: "top", margin: "1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, _, title, geometry := parseExecFlags(t, tc.argv)
+
+			gotTitle, got := applyPreset(cmd, preset, title, geometry)
+			if gotTitle != tc.wantTitle || got != tc.want {
+				t.Errorf("applyPreset = %q, %+v; want %q, %+v", gotTitle, got, tc.wantTitle, tc.want)
+			}
+		})
+	}
+
+	// An anchor over a preset placed by position drops the position.
+	cmd, _, title, geometry := parseExecFlags(t, []string{"--anchor", "bottom", "--", "tig"})
+	_, got := applyPreset(cmd, runinpopup.PresetConfig{X: "5", Y: "5"}, title, geometry)
+	if want := (execGeometry{anchor: "bottom"}); got != want {
+		t.Errorf("applyPreset = %+v, want %+v", got, want)
+	}
+}
+
+func TestUnknownPresetError(t *testing.T) {
+	err := unknownPresetError("reveiw", map[string]runinpopup.PresetConfig{
+		"review": {}, "build": {},
+	})
+	if want := `unknown preset "reveiw": the configuration has build, review`; err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+	err = unknownPresetError("review", nil)
+	if !strings.Contains(err.Error(), "has none") {
+		t.Errorf("err = %q, want it to say there are no presets", err)
+	}
+}
+
 // What the flags describe is the popup, so they reach the spec it is opened
 // with — as typed, since only the library says what a geometry value means.
 func TestExecSpec(t *testing.T) {
@@ -508,6 +643,14 @@ func TestExecSpec(t *testing.T) {
 				Command: []string{"htop"},
 			},
 		},
+		{
+			name: "an anchor and its margin",
+			argv: []string{"--anchor", "top-right", "--margin", "2", "--", "htop"},
+			want: runinpopup.PopupSpec{
+				Anchor: "top-right", Margin: "2",
+				Command: []string{"htop"},
+			},
+		},
 		{
 			name: "width takes the shorthand -h cannot",
 			argv: []string{"-w", "80%", "--", "htop"},
@@ -525,8 +668,10 @@ func TestExecSpec(t *testing.T) {
 			if got.Title != tc.want.Title {
 				t.Errorf("Title = %q, want %q", got.Title, tc.want.Title)
 			}
-			gotGeometry := [4]string{got.X, got.Y, got.Width, got.Height}
-			wantGeometry := [4]string{tc.want.X, tc.want.Y, tc.want.Width, tc.want.Height}
+			gotGeometry := [6]string{got.X, got.Y, got.Width, got.Height, got.Anchor, got.Margin}
+			wantGeometry := [6]string{
+				tc.want.X, tc.want.Y, tc.want.Width, tc.want.Height, tc.want.Anchor, tc.want.Margin,
+			}
 			if gotGeometry != wantGeometry {
 				t.Errorf("geometry = %q, want %q", gotGeometry, wantGeometry)
 			}
@@ -559,8 +704,25 @@ func TestExecCommand_geometryShorthands(t *testing.T) {
 	}
 }
 
+// The command's status is opt-in: exec's own 0 and 1 are about the bridge, and
+// a script relying on that must not start seeing the command's instead.
+func TestExecCommand_propagateStatusIsOptIn(t *testing.T) {
+	cmd, _, err := rootCmd().Find([]string{"exec"})
+	if err != nil {
+		t.Fatalf("Find(exec): %v", err)
+	}
+	flag := cmd.Flags().Lookup("propagate-status")
+	if flag == nil {
+		t.Fatal("exec has no --propagate-status")
+	}
+	if flag.DefValue != "false" {
+		t.Errorf("--propagate-status defaults to %s, want false", flag.DefValue)
+	}
+}
+
 // exec runs the user's command in the popup itself, so nothing internal stands
-// behind it: every leaf the root carries is one a user is meant to type.
+// behind it: every leaf the root carries is one a user is meant to type, bar the
+// widget the choose, confirm and input popups run and the host pinentry starts.
 func TestExecCommandIsWired(t *testing.T) {
 	root := rootCmd()
 
@@ -569,7 +731,7 @@ func TestExecCommandIsWired(t *testing.T) {
 		t.Fatalf("Find(exec) = %v, %v; want the leaf itself", cmd.Name(), err)
 	}
 	for _, c := range root.Commands() {
-		if c.Hidden {
+		if c.Hidden && c.Name() != widgetPayloadName && c.Name() != pinentryHostName {
 			t.Errorf("%s is hidden, so it is a leaf nobody can be told about", c.Name())
 		}
 	}
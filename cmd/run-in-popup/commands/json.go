@@ -0,0 +1,283 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+
+	"github.com/ngicks/go-common/contextkey"
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/runworkspace"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
+)
+
+const jsonLong = `json runs a command in a terminal-multiplexer popup and talks JSON with it. The
+command's stdin and stdout are the exchange: every JSON value piped into json
+reaches the command as one line on its stdin, and every value the command writes
+to its stdout is printed here on a line of its own — NDJSON, whatever the
+command's own spacing was. Its stderr stays on the popup's terminal, which is
+where it shows the user anything.
+
+  printf '%s\n' '{"q":1}' '{"q":2}' | run-in-popup json -- jq -c '{a: .q}'
+
+The command's stdin ends when json's does, so a command reading its input to
+the end still gets to answer. Input that is not JSON ends it early, and fails
+json once the command is done.
+
+--input hands the command one value up front instead, in $RUN_IN_POPUP_INPUT,
+and leaves its stdin on the popup's terminal for the user to type at; json's
+own stdin is not read at all. Some backends put a popup's environment on the
+multiplexer's command line, so the value is no place for a secret.
+
+  run-in-popup json --input '["a","b"]' -- \
+    sh -c 'printf %s "$RUN_IN_POPUP_INPUT" | jq -r ".[]" | fzf | jq -R .'
+
+json exits 0 once the command's output has ended. It exits 1 when the popup
+could not be opened, the command wrote something that is not JSON, the popup
+failed before the command answered anything, or the input was not JSON.
+
+--backend and the geometry flags are exec's; see run-in-popup exec --help.
+Everything after "--" is the command and is passed through unchanged.`
+
+// jsonWorkspacePrefix names the directory holding one run's FIFOs, and its
+// debug log when the run has one.
+const jsonWorkspacePrefix = "run-in-popup-json-"
+
+// jsonInputEnv is the variable --input's value reaches the command in.
+const jsonInputEnv = "RUN_IN_POPUP_INPUT"
+
+const jsonExample = `  printf '%s\n' '{"q":1}' '{"q":2}' | run-in-popup json -- jq -c '{a: .q}'
+  run-in-popup json --input '{"prompt":"name?"}' -- ./ask.sh`
+
+func jsonCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flagBackend  string
+		flagTitle    string
+		flagGeometry execGeometry
+		flagInput    string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "json [flags] -- command [arg...]",
+		Short:   "Run a command in a popup, streaming JSON lines to and from it",
+		Long:    jsonLong,
+		Example: jsonExample,
+		Args:    cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input, err := jsonInput(flagInput, cmd.Flags().Changed("input"))
+			if err != nil {
+				return err
+			}
+			return runJson(cmd, args, *flagConfig, flagBackend, flagTitle, flagGeometry, input)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&flagBackend,
+		"backend",
+		"",
+		fmt.Sprintf("popup backend, %s (default: auto-detected)", cli.BackendNameList()),
+	)
+	cmd.Flags().StringVar(
+		&flagTitle,
+		"title",
+		"",
+		"popup title (default: the backend's own;"+
+			" run-in-popup backends lists the ones showing none)",
+	)
+	execGeometryFlags(cmd, &flagGeometry)
+	cmd.Flags().StringVar(
+		&flagInput,
+		"input",
+		"",
+		"a JSON value handed to the command in $"+jsonInputEnv+
+			" instead of streaming stdin to it",
+	)
+
+	parent.AddCommand(cmd)
+}
+
+// jsonInput checks --input, set or not: a value that is not JSON fails here,
+// before any popup is opened for it. nil means the flag was not given and the
+// input streams.
+func jsonInput(value string, set bool) (*json.RawMessage, error) {
+	if !set {
+		return nil, nil
+	}
+	var v json.RawMessage
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return nil, fmt.Errorf("--input is not a JSON value: %w", err)
+	}
+	return &v, nil
+}
+
+func runJson(
+	cmd *cobra.Command,
+	args []string,
+	flagConfig, flagBackend, flagTitle string,
+	flagGeometry execGeometry,
+	input *json.RawMessage,
+) (err error) {
+	ctx := cmd.Context()
+
+	command, err := execCommandArgs(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := runinpopup.LoadConfig(flagConfig)
+	if err != nil {
+		return err
+	}
+
+	rt, err := resolveRuntime(ctx, runtimeInputs{
+		Config:    cfg,
+		Overrides: execFlagOverrides(cmd, flagBackend),
+	}, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	workspace, err := runworkspace.Open(
+		jsonWorkspacePrefix,
+		rt.UserData.Debug(),
+		contextkey.ValueSlogLoggerFallback(ctx, slog.Default()),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := workspace.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	popup := &runinpopup.PopupLauncher{
+		Backend:     rt.Backend,
+		Logger:      workspace.Logger,
+		Workspace:   workspace.Options,
+		Unsupported: runinpopup.UnsupportedPolicy(rt.Config.Unsupported),
+		Fit:         rt.Config.Fit,
+	}
+	return jsonBridge(
+		ctx,
+		popup,
+		execSpec(flagTitle, flagGeometry, command),
+		input,
+		os.Stdin,
+		os.Stdout,
+	)
+}
+
+// jsonBridge runs spec in a popup as a JSON exchange: values decoded off stdin
+// are sent to it — or, with a non-nil input, that one value is handed over in
+// its environment and stdin is left alone — and what it answers is written to
+// stdout as NDJSON. It returns once the answers have ended.
+//
+// The input is not waited on, for the reason exec's is not: it sits in a read
+// on this process's stdin, which the command being done says nothing about.
+func jsonBridge(
+	ctx context.Context,
+	popup *runinpopup.PopupLauncher,
+	spec runinpopup.PopupSpec,
+	input *json.RawMessage,
+	stdin io.Reader,
+	stdout io.Writer,
+) error {
+	launcher := &runinpopup.JsonIpcLauncher[json.RawMessage, json.RawMessage]{
+		Popup:       popup,
+		PartialSpec: spec,
+	}
+	var v json.RawMessage
+	if input != nil {
+		v = *input
+		launcher.AddPayload = func(v json.RawMessage, spec runinpopup.PopupSpec) runinpopup.PopupSpec {
+			spec.Env = maps.Clone(spec.Env)
+			if spec.Env == nil {
+				spec.Env = map[string]string{}
+			}
+			spec.Env[jsonInputEnv] = string(v)
+			return spec
+		}
+	}
+
+	conn, err := launcher.Exec(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	inputErr := make(chan error, 1)
+	if input == nil {
+		go func() {
+			inputErr <- jsonSend(ctx, conn, stdin)
+			// Recorded first, so an exchange ending on the EOF this sends already
+			// has the reason it was sent.
+			_ = conn.CloseSend()
+		}()
+	}
+
+	// Drained to the end whatever happens to stdout: the command's output is
+	// relayed through Results, and a command nobody takes values from ends up
+	// blocked on its own stdout.
+	var writeErr error
+	for v := range conn.Results() {
+		if writeErr == nil {
+			writeErr = writeJsonLine(stdout, v)
+		}
+	}
+	if err := conn.Wait(); err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("writing the command's output: %w", writeErr)
+	}
+	select {
+	case err := <-inputErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// jsonSend sends every value decoded off r until it ends. Only the input failing
+// is reported: a send failing means the command is gone, and with it the
+// exchange, which Wait reports on its own — a command that stops reading before
+// its input ends, head-style, is not a failure at all.
+func jsonSend(
+	ctx context.Context,
+	conn *runinpopup.JsonIpcConn[json.RawMessage, json.RawMessage],
+	r io.Reader,
+) error {
+	dec := json.NewDecoder(r)
+	for {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading the input: %w", err)
+		}
+		if err := conn.Send(ctx, v); err != nil {
+			return nil
+		}
+	}
+}
+
+// writeJsonLine writes v compacted onto a line of its own.
+func writeJsonLine(w io.Writer, v json.RawMessage) error {
+	var b bytes.Buffer
+	if err := json.Compact(&b, v); err != nil {
+		return err
+	}
+	b.WriteByte('\n')
+	_, err := w.Write(b.Bytes())
+	return err
+}
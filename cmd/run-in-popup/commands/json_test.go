@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJsonInput(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		value   string
+		set     bool
+		want    string
+		wantErr bool
+	}{
+		{name: "unset streams", value: "", set: false},
+		{name: "object", value: `{"a":1}`, set: true, want: `{"a":1}`},
+		{name: "string", value: `"plain"`, set: true, want: `"plain"`},
+		{name: "empty", value: "", set: true, wantErr: true},
+		{name: "not JSON", value: "plain", set: true, wantErr: true},
+		{name: "two values", value: `1 2`, set: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := jsonInput(tc.value, tc.set)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("jsonInput(%q) = %s, want an error", tc.value, *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jsonInput(%q): %v", tc.value, err)
+			}
+			if !tc.set {
+				if got != nil {
+					t.Fatalf("jsonInput = %s, want nil for an unset flag", *got)
+				}
+				return
+			}
+			if got == nil || string(*got) != tc.want {
+				t.Errorf("jsonInput(%q) = %v, want %s", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+// Values go to the command a line each and come back a line each, compacted
+// whatever the command's own spacing was.
+func TestJsonBridge_streams(t *testing.T) {
+	var stdout bytes.Buffer
+	err := jsonBridge(
+		t.Context(),
+		popupLauncher(&popupShell{}),
+		shellSpec(`while read -r line; do printf '{\n  "got": %s\n}\n' "$line"; done`),
+		nil,
+		strings.NewReader(`{"q": 1}
+ [1, 2]  "three"`),
+		&stdout,
+	)
+	if err != nil {
+		t.Fatalf("jsonBridge: %v", err)
+	}
+	want := `{"got":{"q":1}}` + "\n" + `{"got":[1,2]}` + "\n" + `{"got":"three"}` + "\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+// The command's stdin ends when the caller's does, so a command reading to the
+// end still answers.
+func TestJsonBridge_inputEnds(t *testing.T) {
+	var stdout bytes.Buffer
+	err := jsonBridge(
+		t.Context(),
+		popupLauncher(&popupShell{}),
+		shellSpec(`printf '{"lines":%d}\n' "$(wc -l)"`),
+		nil,
+		strings.NewReader("1\n2\n3\n"),
+		&stdout,
+	)
+	if err != nil {
+		t.Fatalf("jsonBridge: %v", err)
+	}
+	if got, want := stdout.String(), `{"lines":3}`+"\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}
+
+// --input goes to the command's environment, and the caller's stdin is left
+// unread for whoever else has it.
+func TestJsonBridge_input(t *testing.T) {
+	var stdout bytes.Buffer
+	input := json.RawMessage(`{"prompt":"name?"}`)
+	stdin := strings.NewReader(`"not for the command"`)
+	err := jsonBridge(
+		t.Context(),
+		popupLauncher(&popupShell{}),
+		shellSpec(`printf '%s\n' "$RUN_IN_POPUP_INPUT"`),
+		&input,
+		stdin,
+		&stdout,
+	)
+	if err != nil {
+		t.Fatalf("jsonBridge: %v", err)
+	}
+	if got, want := stdout.String(), string(input)+"\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if stdin.Len() == 0 {
+		t.Error("stdin was read although --input was given")
+	}
+}
+
+func TestJsonBridge_failures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		script  string
+		stdin   string
+		wantErr string
+	}{
+		{
+			name:    "output that is not JSON",
+			script:  `echo '{"ok":true}'; echo 'not json'`,
+			wantErr: "invalid character",
+		},
+		{
+			name:    "input that is not JSON",
+			script:  `cat >/dev/null; echo '{"ok":true}'`,
+			stdin:   `{"ok":true} nope`,
+			wantErr: "reading the input",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := jsonBridge(
+				t.Context(),
+				popupLauncher(&popupShell{}),
+				shellSpec(tc.script),
+				nil,
+				strings.NewReader(tc.stdin),
+				&stdout,
+			)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("jsonBridge = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,15 +1,24 @@
 package commands
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 
 	"github.com/ngicks/go-common/contextkey"
 	"github.com/spf13/cobra"
 
 	"github.com/ngicks/run-in-tmux-popup/internal/runworkspace"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
 )
 
@@ -23,19 +32,53 @@ PINENTRY_USER_DATA, whose fields locate the multiplexer:
 
   KIND:multiplexer_path:session_id:client_id:session_meta
 
-KIND is "TMUX_POPUP", "TMUX_FLOATING_PANE" or "ZELLIJ_POPUP"; a "_DEBUG" suffix
-additionally writes a debug log to log.txt in the temporary directory and keeps
-that directory around.
+KIND is "TMUX_POPUP", "TMUX_FLOATING_PANE", "ZELLIJ_POPUP", "SCREEN_POPUP",
+"NVIM_POPUP", "WEZTERM_POPUP", "KITTY_POPUP" or "KITTY_OS_WINDOW". A
+"_DYNAMIC" suffix on the tmux kinds and "ZELLIJ_POPUP" leaves session_id and
+client_id empty and looks them up at each prompt instead: tmux's most recently
+active client, or zellij's only running session. A "_DEBUG" suffix, after it
+when both are given, additionally writes a debug log to log.txt in the
+temporary directory and keeps that directory around.
 
 --backend wins over the configured backend, which in turn wins over
 auto-detection from PINENTRY_USER_DATA, then $TMUX (which selects tmux-popup;
-tmux floating panes stay an explicit choice), then $ZELLIJ. Arguments after "--"
-are passed to the pinentry binary unchanged.`
+tmux floating panes stay an explicit choice), then $ZELLIJ, then $STY, then
+$NVIM, then $WEZTERM_PANE, then $KITTY_WINDOW_ID (which selects kitty; OS
+windows stay an explicit choice). The headless pty backend is only ever
+selected explicitly.
+
+With timeouts.linger set, the popup outlives the prompt by that long, and the
+next prompt of the same session draws in it instead of opening another: a
+background process started by the first prompt keeps it, found again through a
+socket under $XDG_RUNTIME_DIR. Without $XDG_RUNTIME_DIR every prompt opens a
+popup of its own.
+
+With fallback set, a popup that cannot be opened, or never reports its
+terminal, is not the end of the prompt: each entry is tried in turn, another
+backend's popup, "tty" for the pinentry on the terminal gpg-agent named, or
+"exec:PATH" for another pinentry entirely, a graphical one say.
+
+Arguments after "--" are passed to the pinentry binary unchanged.`
 
 // pinentryWorkspacePrefix names the directory holding one prompt's handshake
 // FIFOs, and its debug log when the run has one.
 const pinentryWorkspacePrefix = "run-in-popup-pinentry-"
 
+// pinentryHostName is the hidden subcommand keeping a lingering popup, started
+// in the background by the first prompt that wants one.
+const pinentryHostName = "__pinentry-host"
+
+// pinentryHostWorkspacePrefix names the host's directory, which holds the
+// handshake FIFOs of every popup it opens and its debug log.
+const pinentryHostWorkspacePrefix = "run-in-popup-pinentry-host-"
+
+// The fallback entries that are not backend names: pinentry_path on the
+// terminal gpg-agent named, and a pinentry of the user's choosing.
+const (
+	pinentryFallbackTTY  = "tty"
+	pinentryFallbackExec = "exec:"
+)
+
 const pinentryExample = `  run-in-popup pinentry
   run-in-popup pinentry --backend zellij
   run-in-popup pinentry --backend tmux-floating-pane
@@ -96,12 +139,22 @@ func runPinentry(
 		return err
 	}
 
-	rt, err := resolveRuntime(runtimeInputs{
+	overrides := pinentryFlagOverrides(cmd, flagBackend, flagPinentry)
+	rt, runtimeErr := resolveRuntime(ctx, runtimeInputs{
 		Config:    cfg,
-		Overrides: pinentryFlagOverrides(cmd, flagBackend, flagPinentry),
+		Overrides: overrides,
 	}, os.Environ())
-	if err != nil {
-		return err
+	if runtimeErr != nil {
+		// No backend at all is one more way of having no popup: with a fallback
+		// configured the chain starts at its first hop instead.
+		merged := overrides.Apply(cfg)
+		if len(merged.Fallback) == 0 {
+			return runtimeErr
+		}
+		rt = commandRuntime{
+			Config:   merged,
+			UserData: runinpopup.ParsePinentryUserData(os.Getenv("PINENTRY_USER_DATA")),
+		}
 	}
 
 	workspace, err := runworkspace.Open(
@@ -120,20 +173,210 @@ func runPinentry(
 		}
 	}()
 	workspace.Logger.Info("PINENTRY_USER_DATA", slog.Any("data", rt.UserData))
+	if runtimeErr != nil {
+		workspace.Logger.Warn("no popup backend; trying the fallback", slog.Any("err", runtimeErr))
+	}
+
+	fallback, err := pinentryFallback(rt, os.Environ(), workspace.Logger)
+	if err != nil {
+		return err
+	}
 
 	pinentry := &runinpopup.PinentryLauncher{
 		Popup: &runinpopup.PopupLauncher{
-			Backend:   rt.Backend,
-			Logger:    workspace.Logger,
-			Workspace: workspace.Options,
+			Backend:     rt.Backend,
+			Logger:      workspace.Logger,
+			Workspace:   workspace.Options,
+			Unsupported: runinpopup.UnsupportedPolicy(rt.Config.Unsupported),
 		},
 		PinentryPath: rt.Config.PinentryPath,
 		PinentryArgs: args,
 		Timeouts:     rt.Config.Timeouts,
+		Fallback:     fallback,
+	}
+	if rt.Backend != nil && rt.Config.Timeouts.Linger > 0 {
+		socket := pinentryHostSocket(os.Environ(), rt.Backend.Name(), rt.UserData)
+		if socket == "" {
+			workspace.Logger.Warn("$XDG_RUNTIME_DIR is not set; the popup will not linger")
+		} else {
+			var backend *string
+			if cmd.Flags().Changed("backend") {
+				backend = &flagBackend
+			}
+			pinentry.Linger = &runinpopup.PinentryLinger{
+				Socket:    socket,
+				StartHost: pinentryHostStarter(socket, flagConfig, backend),
+			}
+		}
 	}
 	return pinentry.Call(ctx)
 }
 
+// pinentryFallback builds the hops of rt.Config.Fallback. A name that is not a
+// backend at all is a mistake in the configuration and fails the prompt; a
+// backend that cannot be built here — its multiplexer is nowhere in the
+// environment, say — is only one hop fewer, since a fallback is there for
+// exactly the environments that lack something.
+func pinentryFallback(
+	rt commandRuntime,
+	environ []string,
+	logger *slog.Logger,
+) ([]runinpopup.PinentryFallback, error) {
+	var hops []runinpopup.PinentryFallback
+	for _, entry := range rt.Config.Fallback {
+		path, isExec := strings.CutPrefix(entry, pinentryFallbackExec)
+		switch {
+		case entry == pinentryFallbackTTY:
+			hops = append(hops, runinpopup.PinentryFallback{PinentryPath: rt.Config.PinentryPath})
+		case isExec:
+			if path == "" {
+				return nil, fmt.Errorf("fallback %q names no pinentry to run", entry)
+			}
+			hops = append(hops, runinpopup.PinentryFallback{PinentryPath: path})
+		case !slices.Contains(backend.Names(), entry):
+			return nil, fmt.Errorf(
+				"unknown fallback %q: valid values are %s, %q and %q followed by a path",
+				entry, strings.Join(backend.Names(), ", "), pinentryFallbackTTY, pinentryFallbackExec,
+			)
+		case rt.Backend != nil && entry == rt.Backend.Name():
+			// Tried already, as the popup the chain falls back from.
+		default:
+			b, err := backend.New(entry, backendOptions(rt.UserData, environ))
+			if err != nil {
+				logger.Warn("skipping a fallback", slog.String("backend", entry), slog.Any("err", err))
+				continue
+			}
+			hops = append(hops, runinpopup.PinentryFallback{Backend: b})
+		}
+	}
+	return hops, nil
+}
+
+// pinentryHostSocket is where the host keeping a lingering popup for this
+// session listens, or "" without a $XDG_RUNTIME_DIR to put it in. The name
+// hashes everything the runtime is resolved from, so two prompts share a host
+// exactly when they would have opened their popups in the same place: a prompt
+// for another tmux client, or another multiplexer, gets a host of its own.
+//
+// userData is the runtime's, hashed as resolved rather than as the variable
+// holds it: a "_DYNAMIC" kind reads the same for every client, and only the
+// session and client ResolveFocus found tell one prompt's popup from another's.
+func pinentryHostSocket(
+	environ []string,
+	backendName string,
+	userData runinpopup.PinentryUserData,
+) string {
+	runtimeDir := lookupEnviron(environ, "XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return ""
+	}
+	h := sha256.New()
+	h.Write([]byte(backendName))
+	h.Write([]byte{0})
+	h.Write([]byte(userData.String()))
+	for _, key := range []string{"TMUX", "ZELLIJ", "STY", "NVIM", "WEZTERM_PANE", "KITTY_WINDOW_ID"} {
+		h.Write([]byte{0})
+		h.Write([]byte(lookupEnviron(environ, key)))
+	}
+	name := hex.EncodeToString(h.Sum(nil)[:8]) + ".sock"
+	return filepath.Join(runtimeDir, "run-in-popup", name)
+}
+
+// pinentryHostStarter starts this executable as the host serving socket, handed
+// the flags that decide which popup it opens. The environment is inherited as
+// it is, PINENTRY_USER_DATA included, so the host resolves the same runtime the
+// prompt did.
+//
+// The host is detached — a session of its own, no stdio, not waited for —
+// because gpg-agent waits for the prompt to exit, and with it everything holding
+// the prompt's stdout, before it asks for the next passphrase.
+func pinentryHostStarter(socket, config string, backend *string) func(context.Context) error {
+	return func(context.Context) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		args := []string{pinentryHostName, "--socket", socket}
+		if config != "" {
+			args = append(args, "--config", config)
+		}
+		if backend != nil {
+			args = append(args, "--backend", *backend)
+		}
+		host := exec.Command(exe, args...)
+		host.Dir = "/"
+		host.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := host.Start(); err != nil {
+			return err
+		}
+		return host.Process.Release()
+	}
+}
+
+// pinentryHostCmd is the host itself. It is hidden: the prompt that needs one
+// starts it, and one typed at a shell would only sit there until it gives up.
+func pinentryHostCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flagBackend string
+		flagSocket  string
+	)
+	cmd := &cobra.Command{
+		Use:    pinentryHostName,
+		Short:  "Keep a pinentry popup open for the prompts after it (started by pinentry)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPinentryHost(cmd, *flagConfig, flagBackend, flagSocket)
+		},
+	}
+	cmd.Flags().StringVar(&flagBackend, "backend", "", "popup backend")
+	cmd.Flags().StringVar(&flagSocket, "socket", "", "rendezvous socket to serve")
+	_ = cmd.MarkFlagRequired("socket")
+	parent.AddCommand(cmd)
+}
+
+func runPinentryHost(cmd *cobra.Command, flagConfig, flagBackend, socket string) (err error) {
+	ctx := cmd.Context()
+
+	cfg, err := runinpopup.LoadConfig(flagConfig)
+	if err != nil {
+		return err
+	}
+	rt, err := resolveRuntime(ctx, runtimeInputs{
+		Config:    cfg,
+		Overrides: execFlagOverrides(cmd, flagBackend),
+	}, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	workspace, err := runworkspace.Open(
+		pinentryHostWorkspacePrefix,
+		rt.UserData.Debug(),
+		contextkey.ValueSlogLoggerFallback(ctx, slog.Default()),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := workspace.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	host := &runinpopup.PopupHost{
+		Popup: &runinpopup.PopupLauncher{
+			Backend:     rt.Backend,
+			Logger:      workspace.Logger,
+			Workspace:   workspace.Options,
+			Unsupported: runinpopup.UnsupportedPolicy(rt.Config.Unsupported),
+		},
+		Socket:   socket,
+		Timeouts: rt.Config.Timeouts,
+	}
+	return host.Serve(ctx)
+}
+
 // pinentryFlagOverrides turns explicitly-set flags into the topmost config
 // layer: a flag left alone stays absent from the partial, so the file and
 // environment layers keep their say.
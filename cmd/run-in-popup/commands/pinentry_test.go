@@ -1,11 +1,17 @@
 package commands
 
 import (
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
 )
 
 // parsePinentryFlags mirrors what pinentryCmd builds — the two flags bound to
@@ -87,12 +93,13 @@ func TestPinentryFlagOverrides_apply(t *testing.T) {
 	base := runinpopup.Config{PinentryPath: "/from/config", Backend: "tmux-popup"}
 
 	cmd, backend, pinentry := parsePinentryFlags(t, nil)
-	if got := pinentryFlagOverrides(cmd, backend, pinentry).Apply(base); got != base {
+	got := pinentryFlagOverrides(cmd, backend, pinentry).Apply(base)
+	if !reflect.DeepEqual(got, base) {
 		t.Errorf("Apply = %+v, want the lower layer untouched: %+v", got, base)
 	}
 
 	cmd, backend, pinentry = parsePinentryFlags(t, []string{"--backend="})
-	got := pinentryFlagOverrides(cmd, backend, pinentry).Apply(base)
+	got = pinentryFlagOverrides(cmd, backend, pinentry).Apply(base)
 	if got.Backend != "" {
 		t.Errorf("Backend = %q, want the explicit empty flag to win", got.Backend)
 	}
@@ -118,3 +125,133 @@ func fmtStringPtr(p *string) string {
 	}
 	return "&" + *p
 }
+
+// Prompts share a host exactly when they would have opened their popup in the
+// same place, and the socket lives under $XDG_RUNTIME_DIR or nowhere.
+func TestPinentryHostSocket(t *testing.T) {
+	session := []string{"XDG_RUNTIME_DIR=/run/user/1000"}
+	data := runinpopup.ParsePinentryUserData(
+		"TMUX_POPUP:/usr/bin/tmux:$1:/dev/pts/3:/tmp/tmux-1000/default,1,0",
+	)
+	socket := pinentryHostSocket(session, "tmux-popup", data)
+	if dir := filepath.Dir(socket); dir != "/run/user/1000/run-in-popup" {
+		t.Errorf("socket %q is not in the runtime directory", socket)
+	}
+	if again := pinentryHostSocket(slices.Clone(session), "tmux-popup", data); again != socket {
+		t.Errorf("the same session got %q, then %q", socket, again)
+	}
+
+	otherClient := data
+	otherClient.ClientId = "/dev/pts/4"
+	for _, tc := range []struct {
+		name     string
+		environ  []string
+		backend  string
+		userData runinpopup.PinentryUserData
+	}{
+		{name: "another backend", environ: session, backend: "tmux-floating-pane", userData: data},
+		{name: "another client", environ: session, backend: "tmux-popup", userData: otherClient},
+		{
+			name:     "another environment",
+			environ:  append(slices.Clone(session), "STY=1234.pts-0.host"),
+			backend:  "tmux-popup",
+			userData: data,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pinentryHostSocket(tc.environ, tc.backend, tc.userData); got == socket {
+				t.Errorf("%s shares the socket %q", tc.name, got)
+			}
+		})
+	}
+
+	// A "_DYNAMIC" value is the same for every client; where ResolveFocus put
+	// each prompt is what keeps their hosts apart.
+	t.Run("a _DYNAMIC kind resolved to two clients", func(t *testing.T) {
+		dynamic := runinpopup.ParsePinentryUserData("TMUX_POPUP_DYNAMIC:/usr/bin/tmux")
+		first, second := dynamic, dynamic
+		first.SessionId, first.ClientId = "$1", "/dev/pts/3"
+		second.SessionId, second.ClientId = "$2", "/dev/pts/4"
+		a := pinentryHostSocket(session, "tmux-popup", first)
+		if b := pinentryHostSocket(session, "tmux-popup", second); a == b {
+			t.Errorf("both clients share the socket %q", a)
+		}
+		if again := pinentryHostSocket(session, "tmux-popup", first); again != a {
+			t.Errorf("the same client got %q, then %q", a, again)
+		}
+	})
+
+	if got := pinentryHostSocket(nil, "tmux-popup", data); got != "" {
+		t.Errorf("without $XDG_RUNTIME_DIR the socket is %q, want none", got)
+	}
+}
+
+func TestPinentryFallback(t *testing.T) {
+	tmux := []string{"TMUX=/tmp/tmux-1000/default,1,0"}
+	primary, err := backend.New(
+		backend.NameTmuxPopup,
+		backendOptions(runinpopup.PinentryUserData{}, tmux),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := commandRuntime{
+		Config:  runinpopup.Config{PinentryPath: "/usr/bin/pinentry-curses"},
+		Backend: primary,
+	}
+	logger := slog.New(slog.DiscardHandler)
+
+	for _, tc := range []struct {
+		name     string
+		environ  []string
+		fallback []string
+		// want names each hop: a backend by its name, a direct hop by its path.
+		want    []string
+		wantErr string
+	}{
+		{name: "none"},
+		{
+			name:     "the primary is skipped",
+			environ:  tmux,
+			fallback: []string{"tmux-popup", "tmux-floating-pane", "tty", "exec:/usr/bin/pinentry-qt"},
+			want: []string{
+				"tmux-floating-pane", "/usr/bin/pinentry-curses", "/usr/bin/pinentry-qt",
+			},
+		},
+		{
+			// Outside tmux there is no other tmux popup to fall back to, but the
+			// rest of the chain still is.
+			name:     "a backend that cannot be built is skipped",
+			fallback: []string{"tmux-floating-pane", "tty"},
+			want:     []string{"/usr/bin/pinentry-curses"},
+		},
+		{name: "unknown", fallback: []string{"tty", "xterm"}, wantErr: `unknown fallback "xterm"`},
+		{name: "exec without a path", fallback: []string{"exec:"}, wantErr: "names no pinentry"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := rt
+			rt.Config.Fallback = tc.fallback
+			hops, err := pinentryFallback(rt, tc.environ, logger)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("pinentryFallback = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pinentryFallback: %v", err)
+			}
+			var got []string
+			for _, hop := range hops {
+				if hop.Backend != nil {
+					got = append(got, hop.Backend.Name())
+				} else {
+					got = append(got, hop.PinentryPath)
+				}
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("hops = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
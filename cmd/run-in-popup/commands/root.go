@@ -48,13 +48,27 @@ func rootCmd() *cobra.Command {
 
 	logConfig = loggerfactory.RegisterFlags(cmd)
 	cmd.Flags().BoolVar(&flagVersion, "version", false, "alias for the version subcommand")
-	cmd.PersistentFlags().
-		StringVar(&flagConfig, "config", "", "config file path; overrides the default location")
+	cmd.PersistentFlags().StringVar(
+		&flagConfig,
+		"config",
+		"",
+		"config file path (.json, .yaml or .toml); overrides the default location",
+	)
 
 	versionCmd(cmd)
 	configCmd(cmd, &flagConfig)
 	pinentryCmd(cmd, &flagConfig)
+	pinentryHostCmd(cmd, &flagConfig)
+	envCmd(cmd, &flagConfig)
+	setupCmd(cmd)
+	doctorCmd(cmd, &flagConfig)
+	backendsCmd(cmd)
 	execCmd(cmd, &flagConfig)
+	jsonCmd(cmd, &flagConfig)
+	chooseCmd(cmd, &flagConfig)
+	confirmCmd(cmd, &flagConfig)
+	inputCmd(cmd, &flagConfig)
+	widgetPayloadCmd(cmd)
 
 	return cmd
 }
@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/gpgsetup"
+	"github.com/ngicks/run-in-tmux-popup/internal/linediff"
+)
+
+const setupGpgLong = `Install run-in-popup as gpg-agent's pinentry.
+
+gpg-agent runs a single pinentry program, so it is pointed at a wrapper script
+that sends a PINENTRY_USER_DATA naming a popup kind to "run-in-popup pinentry",
+one holding "TTY" to --tty-pinentry, and everything else — a desktop session
+that exports nothing — to --pinentry. The script is generated from the kinds
+run-in-popup itself detects backends by, so re-run this command after an
+upgrade instead of editing it.
+
+The wrapper is written to --wrapper with mode 0755, a relative path taken
+from the working directory, and the pinentry-program line of --gpg-agent-conf
+is set to its absolute path: an existing line is rewritten in place
+and any later one dropped, and the rest of the file is left as it is. Running
+the command twice changes nothing the second time.
+
+gpg-agent reads its configuration when it starts; --reload runs
+"gpgconf --reload gpg-agent" so the running agent picks the change up.
+--dry-run prints what would change as a unified diff and writes nothing.`
+
+const setupGpgExample = `  run-in-popup setup gpg --dry-run
+  run-in-popup setup gpg --reload
+  run-in-popup setup gpg --wrapper ~/bin/pinentry-popup --pinentry pinentry-gnome3`
+
+func setupCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "setup",
+		Short: "Install run-in-popup into the programs that call it",
+		Args:  cobra.NoArgs,
+	}
+	setupGpgCmd(cmd)
+	parent.AddCommand(cmd)
+}
+
+// setupGpgOptions is one run of setup gpg with every default filled in.
+type setupGpgOptions struct {
+	Wrapper        string
+	AgentConf      string
+	WrapperOptions gpgsetup.WrapperOptions
+	Reload         bool
+	DryRun         bool
+}
+
+func setupGpgCmd(parent *cobra.Command) {
+	var opts setupGpgOptions
+
+	cmd := &cobra.Command{
+		Use:     "gpg",
+		Short:   "Point gpg-agent at run-in-popup through a generated wrapper script",
+		Long:    setupGpgLong,
+		Example: setupGpgExample,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupGpgDefaults(&opts, os.Environ()); err != nil {
+				return err
+			}
+			return runSetupGpg(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&opts.Wrapper,
+		"wrapper",
+		"",
+		"path to write the wrapper script to (default: ~/.local/bin/pinentry-run-in-popup)",
+	)
+	cmd.Flags().StringVar(
+		&opts.AgentConf,
+		"gpg-agent-conf",
+		"",
+		"gpg-agent.conf to set pinentry-program in (default: $GNUPGHOME's, else ~/.gnupg's)",
+	)
+	cmd.Flags().StringVar(
+		&opts.WrapperOptions.TTYPinentry,
+		"tty-pinentry",
+		"pinentry-curses",
+		`pinentry the wrapper runs when PINENTRY_USER_DATA holds "TTY"`,
+	)
+	cmd.Flags().StringVar(
+		&opts.WrapperOptions.Pinentry,
+		"pinentry",
+		"pinentry",
+		"pinentry the wrapper runs when PINENTRY_USER_DATA names no popup",
+	)
+	cmd.Flags().BoolVar(&opts.Reload, "reload", false, "run gpgconf --reload gpg-agent afterwards")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "print a diff of the changes, write nothing")
+
+	parent.AddCommand(cmd)
+}
+
+// setupGpgDefaults fills in the paths left to their defaults. The wrapper calls
+// this very binary back, by the path it was started from: a symlink someone
+// installed stays the one an upgrade replaces.
+//
+// A --wrapper given relative is made absolute against the working directory
+// here, before a dry run diffs it: gpg-agent does not resolve a relative
+// pinentry-program against anything useful, and fails only at the next prompt.
+func setupGpgDefaults(opts *setupGpgOptions, environ []string) error {
+	if opts.Wrapper != "" {
+		wrapper, err := filepath.Abs(opts.Wrapper)
+		if err != nil {
+			return fmt.Errorf("resolving --wrapper: %w", err)
+		}
+		opts.Wrapper = wrapper
+	}
+	if opts.WrapperOptions.RunInPopup == "" {
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("locating run-in-popup itself: %w", err)
+		}
+		opts.WrapperOptions.RunInPopup = self
+	}
+	if opts.Wrapper != "" && opts.AgentConf != "" {
+		return nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	if opts.Wrapper == "" {
+		opts.Wrapper = filepath.Join(home, ".local", "bin", "pinentry-run-in-popup")
+	}
+	if opts.AgentConf == "" {
+		gnupgHome := lookupEnviron(environ, "GNUPGHOME")
+		if gnupgHome == "" {
+			gnupgHome = filepath.Join(home, ".gnupg")
+		}
+		opts.AgentConf = filepath.Join(gnupgHome, "gpg-agent.conf")
+	}
+	return nil
+}
+
+func runSetupGpg(ctx context.Context, out io.Writer, opts setupGpgOptions) error {
+	oldWrapper, err := readIfExists(opts.Wrapper)
+	if err != nil {
+		return err
+	}
+	oldConf, err := readIfExists(opts.AgentConf)
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		path, old, new string
+		write          func(path, content string) error
+	}{
+		{opts.Wrapper, oldWrapper, gpgsetup.Wrapper(opts.WrapperOptions), writeWrapper},
+		{opts.AgentConf, oldConf, gpgsetup.SetPinentryProgram(oldConf, opts.Wrapper), writeAgentConf},
+	}
+
+	if opts.DryRun {
+		changed := false
+		for _, f := range files {
+			oldName := f.path
+			if f.old == "" {
+				oldName = os.DevNull
+			}
+			if diff := linediff.Unified(oldName, f.path, f.old, f.new); diff != "" {
+				changed = true
+				fmt.Fprint(out, diff)
+			}
+		}
+		if !changed {
+			fmt.Fprintln(out, "nothing to change")
+		}
+		if opts.Reload {
+			fmt.Fprintln(out, "would run: gpgconf --reload gpg-agent")
+		}
+		return nil
+	}
+
+	for _, f := range files {
+		// The wrapper is written even when unchanged: that is what restores its
+		// mode, should it have lost the executable bit.
+		if err := f.write(f.path, f.new); err != nil {
+			return err
+		}
+		if f.old == f.new {
+			fmt.Fprintf(out, "%s is up to date\n", f.path)
+		} else {
+			fmt.Fprintf(out, "wrote %s\n", f.path)
+		}
+	}
+
+	if opts.Reload {
+		reload := exec.CommandContext(ctx, "gpgconf", "--reload", "gpg-agent")
+		if output, err := reload.CombinedOutput(); err != nil {
+			return fmt.Errorf("gpgconf --reload gpg-agent: %w: %s", err, output)
+		}
+		fmt.Fprintln(out, "reloaded gpg-agent")
+	}
+	return nil
+}
+
+// readIfExists reads path, a file not yet there reading as empty.
+func readIfExists(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(b), err
+}
+
+func writeWrapper(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		return err
+	}
+	// WriteFile applies the mode only to a file it creates.
+	return os.Chmod(path, 0o755)
+}
+
+// writeAgentConf writes gpg-agent.conf, creating the directory as gpg would:
+// readable by its owner alone.
+func writeAgentConf(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0o600)
+}
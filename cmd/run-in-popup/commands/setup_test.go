@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/gpgsetup"
+)
+
+func TestRunSetupGpg(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gpgconf := "#!/bin/sh\necho \"$@\" >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "gpgconf"), []byte(gpgconf), 0o755); err != nil {
+		t.Fatalf("writing the fake gpgconf: %v", err)
+	}
+	t.Setenv("PATH", bin)
+
+	opts := setupGpgOptions{
+		Wrapper:   filepath.Join(dir, "local", "bin", "pinentry-run-in-popup"),
+		AgentConf: filepath.Join(dir, "gnupg", "gpg-agent.conf"),
+		WrapperOptions: gpgsetup.WrapperOptions{
+			RunInPopup:  "/usr/local/bin/run-in-popup",
+			TTYPinentry: "pinentry-curses",
+			Pinentry:    "pinentry",
+		},
+		Reload: true,
+	}
+	run := func(opts setupGpgOptions) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := runSetupGpg(t.Context(), &out, opts); err != nil {
+			t.Fatalf("runSetupGpg: %v", err)
+		}
+		return out.String()
+	}
+
+	t.Run("a dry run writes nothing", func(t *testing.T) {
+		dry := opts
+		dry.DryRun = true
+		out := run(dry)
+		for _, want := range []string{
+			"--- /dev/null\n+++ " + opts.Wrapper + "\n",
+			"+pinentry-program " + opts.Wrapper + "\n",
+			"would run: gpgconf --reload gpg-agent",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("the dry run does not print %q:\n%s", want, out)
+			}
+		}
+		if _, err := os.Stat(opts.Wrapper); err == nil {
+			t.Errorf("the dry run wrote %s", opts.Wrapper)
+		}
+		if _, err := os.Stat(calls); err == nil {
+			t.Error("the dry run ran gpgconf")
+		}
+	})
+
+	t.Run("installs", func(t *testing.T) {
+		out := run(opts)
+		want := "wrote " + opts.Wrapper + "\nwrote " + opts.AgentConf + "\nreloaded gpg-agent\n"
+		if out != want {
+			t.Errorf("printed %q, want %q", out, want)
+		}
+		info, err := os.Stat(opts.Wrapper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o755 {
+			t.Errorf("the wrapper has mode %v, want 0755", info.Mode().Perm())
+		}
+		conf, err := os.ReadFile(opts.AgentConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(conf) != "pinentry-program "+opts.Wrapper+"\n" {
+			t.Errorf("gpg-agent.conf = %q", conf)
+		}
+		if got, _ := os.ReadFile(calls); string(got) != "--reload gpg-agent\n" {
+			t.Errorf("gpgconf ran with %q", got)
+		}
+	})
+
+	t.Run("a second run changes nothing", func(t *testing.T) {
+		if err := os.Chmod(opts.Wrapper, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		again := opts
+		again.Reload = false
+		want := opts.Wrapper + " is up to date\n" + opts.AgentConf + " is up to date\n"
+		if out := run(again); out != want {
+			t.Errorf("printed %q, want %q", out, want)
+		}
+		if info, _ := os.Stat(opts.Wrapper); info.Mode().Perm() != 0o755 {
+			t.Errorf("the wrapper has mode %v, want 0755 back", info.Mode().Perm())
+		}
+		again.DryRun = true
+		if out := run(again); out != "nothing to change\n" {
+			t.Errorf("the dry run printed %q", out)
+		}
+	})
+}
+
+func TestSetupGpgDefaults(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	for _, tc := range []struct {
+		name    string
+		environ []string
+		want    string
+	}{
+		{name: "~/.gnupg", want: "/home/me/.gnupg/gpg-agent.conf"},
+		{
+			name:    "$GNUPGHOME",
+			environ: []string{"GNUPGHOME=/srv/gnupg"},
+			want:    "/srv/gnupg/gpg-agent.conf",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts setupGpgOptions
+			if err := setupGpgDefaults(&opts, tc.environ); err != nil {
+				t.Fatalf("setupGpgDefaults: %v", err)
+			}
+			if opts.AgentConf != tc.want {
+				t.Errorf("AgentConf = %q, want %q", opts.AgentConf, tc.want)
+			}
+			if want := "/home/me/.local/bin/pinentry-run-in-popup"; opts.Wrapper != want {
+				t.Errorf("Wrapper = %q, want %q", opts.Wrapper, want)
+			}
+			if opts.WrapperOptions.RunInPopup == "" {
+				t.Error("the wrapper calls no run-in-popup back")
+			}
+		})
+	}
+}
+
+// A relative --wrapper reaches pinentry-program as the absolute path gpg-agent
+// needs, the dry run's diff included.
+func TestSetupGpgDefaults_relativeWrapper(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	opts := setupGpgOptions{
+		Wrapper:   filepath.Join("bin", "pinentry-popup"),
+		AgentConf: filepath.Join(dir, "gpg-agent.conf"),
+		DryRun:    true,
+	}
+	if err := setupGpgDefaults(&opts, nil); err != nil {
+		t.Fatalf("setupGpgDefaults: %v", err)
+	}
+	want := filepath.Join(dir, "bin", "pinentry-popup")
+	if opts.Wrapper != want {
+		t.Errorf("Wrapper = %q, want %q", opts.Wrapper, want)
+	}
+	var out bytes.Buffer
+	if err := runSetupGpg(t.Context(), &out, opts); err != nil {
+		t.Fatalf("runSetupGpg: %v", err)
+	}
+	if line := "+pinentry-program " + want + "\n"; !strings.Contains(out.String(), line) {
+		t.Errorf("dry run:\n%s\nwant the line %q", out.String(), line)
+	}
+}
@@ -0,0 +1,404 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/template"
+
+	"github.com/ngicks/go-common/contextkey"
+	"github.com/spf13/cobra"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/runworkspace"
+	"github.com/ngicks/run-in-tmux-popup/internal/templateutil"
+	"github.com/ngicks/run-in-tmux-popup/internal/widget"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/cli"
+)
+
+// widgetCanceledStatus is what a widget dismissed without an answer exits with,
+// the status fzf gives an Esc too. It is apart from 1 so a script can tell a
+// user saying no to the whole thing from run-in-popup failing.
+const widgetCanceledStatus = 130
+
+// widgetPayloadName is the hidden subcommand the popup runs: the widget itself,
+// drawn on the popup's terminal.
+const widgetPayloadName = "__widget"
+
+// widgetWorkspacePrefix names the directory holding one widget run's FIFOs, and
+// its debug log when the run has one.
+const widgetWorkspacePrefix = "run-in-popup-widget-"
+
+// widgetCommonLong is the part of every widget's help that is about the popup
+// and the answer rather than the widget.
+const widgetCommonLong = `
+The answer is printed on stdout followed by a newline; --format renders a Go
+text/template against it instead, with these fields:
+
+  .Value      string  the item chosen, the text typed, or "yes" / "no"
+  .Index      int     the item chosen, counted from 0 (choose only)
+  .Confirmed  bool    the answer to confirm
+
+and these helper functions:
+
+%s
+Esc or Ctrl-C dismisses the widget without an answer: nothing is printed and
+the exit status is 130. It is 1 when the popup could not be opened or closed
+before an answer. --backend and the geometry flags are exec's; see
+run-in-popup exec --help. --width fit and --height fit size the popup to the
+widget, which knows what it draws without being asked.`
+
+const chooseLong = `choose opens a popup listing its arguments, one per line, and prints the one
+picked. With no arguments the list is read from stdin, a line an item, empty
+lines skipped.
+
+Up/Down, Ctrl-P/Ctrl-N or k/j move, Enter picks, and q, Esc or Ctrl-C
+dismisses.
+`
+
+const chooseExample = `  run-in-popup choose main develop release
+  git branch --format='%(refname:short)' | run-in-popup choose --prompt checkout:
+  find . -type f | run-in-popup choose --format '{{.Index}}'`
+
+const confirmLong = `confirm opens a popup asking a yes/no question and prints "yes" or "no".
+y and n answer, Enter gives the default (no, unless --default), and Esc or
+Ctrl-C dismisses.
+
+The answer is printed rather than exited with, so a no is not mistaken for a
+failure:
+
+  [ "$(run-in-popup confirm 'Delete it?')" = yes ] && rm -rf build
+`
+
+const confirmExample = `  run-in-popup confirm 'Push to origin?'
+  run-in-popup confirm --default 'Continue?'`
+
+const inputLong = `input opens a popup reading one line of text and prints it. Backspace deletes,
+Ctrl-U clears the line, Enter is done, and Esc, Ctrl-C or Ctrl-D on an empty
+line dismisses. --password draws nothing of what is typed.
+`
+
+const inputExample = `  run-in-popup input --prompt 'Commit message: '
+  run-in-popup input --password --prompt 'Token: '`
+
+// widgetFlags are the flags every widget takes: where the popup goes and how
+// the answer is printed.
+type widgetFlags struct {
+	backend  string
+	title    string
+	geometry execGeometry
+	format   string
+}
+
+func registerWidgetFlags(cmd *cobra.Command, f *widgetFlags) {
+	cmd.Flags().StringVar(
+		&f.backend,
+		"backend",
+		"",
+		fmt.Sprintf("popup backend, %s (default: auto-detected)", cli.BackendNameList()),
+	)
+	cmd.Flags().StringVar(
+		&f.title,
+		"title",
+		"",
+		"popup title (default: the backend's own;"+
+			" run-in-popup backends lists the ones showing none)",
+	)
+	execGeometryFlags(cmd, &f.geometry)
+	cmd.Flags().StringVarP(
+		&f.format,
+		"format",
+		"f",
+		"",
+		"Go text/template rendered against the answer instead of printing its value",
+	)
+}
+
+func widgetLong(long string) string {
+	return long + fmt.Sprintf(widgetCommonLong, templateutil.FuncHelp())
+}
+
+func chooseCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flags      widgetFlags
+		flagPrompt string
+	)
+	cmd := &cobra.Command{
+		Use:     "choose [flags] [item...]",
+		Short:   "Pick one of a list in a popup",
+		Long:    widgetLong(chooseLong),
+		Example: chooseExample,
+		Args:    cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			items := args
+			if len(items) == 0 {
+				var err error
+				if items, err = readItems(cmd.InOrStdin()); err != nil {
+					return err
+				}
+			}
+			if len(items) == 0 {
+				return errors.New("nothing to choose from: pass the items as arguments or on stdin")
+			}
+			req := widget.Request{Kind: widget.KindChoose, Prompt: flagPrompt, Items: items}
+			return runWidget(cmd, *flagConfig, flags, req)
+		},
+	}
+	registerWidgetFlags(cmd, &flags)
+	cmd.Flags().StringVar(&flagPrompt, "prompt", "", "line shown above the list")
+	parent.AddCommand(cmd)
+}
+
+// readItems reads choose's list off r, a line an item.
+func readItems(r io.Reader) ([]string, error) {
+	var items []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			items = append(items, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading the items: %w", err)
+	}
+	return items, nil
+}
+
+func confirmCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flags       widgetFlags
+		flagDefault bool
+	)
+	cmd := &cobra.Command{
+		Use:     "confirm [flags] question",
+		Short:   "Ask a yes/no question in a popup",
+		Long:    widgetLong(confirmLong),
+		Example: confirmExample,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := widget.Request{Kind: widget.KindConfirm, Prompt: args[0], Default: flagDefault}
+			return runWidget(cmd, *flagConfig, flags, req)
+		},
+	}
+	registerWidgetFlags(cmd, &flags)
+	cmd.Flags().BoolVar(&flagDefault, "default", false, "answer yes to a bare Enter")
+	parent.AddCommand(cmd)
+}
+
+func inputCmd(parent *cobra.Command, flagConfig *string) {
+	var (
+		flags        widgetFlags
+		flagPrompt   string
+		flagValue    string
+		flagPassword bool
+	)
+	cmd := &cobra.Command{
+		Use:     "input [flags]",
+		Short:   "Read a line of text in a popup",
+		Long:    widgetLong(inputLong),
+		Example: inputExample,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := widget.Request{
+				Kind:     widget.KindInput,
+				Prompt:   flagPrompt,
+				Value:    flagValue,
+				Password: flagPassword,
+			}
+			return runWidget(cmd, *flagConfig, flags, req)
+		},
+	}
+	registerWidgetFlags(cmd, &flags)
+	cmd.Flags().StringVar(&flagPrompt, "prompt", "", "text shown before what is typed")
+	cmd.Flags().StringVar(&flagValue, "value", "", "text the line starts out with")
+	cmd.Flags().BoolVar(&flagPassword, "password", false, "draw nothing of what is typed")
+	parent.AddCommand(cmd)
+}
+
+func runWidget(cmd *cobra.Command, flagConfig string, flags widgetFlags, req widget.Request) (
+	err error,
+) {
+	ctx := cmd.Context()
+
+	// A template that cannot parse fails before anyone is asked anything.
+	render, err := widgetRenderer(flags.format)
+	if err != nil {
+		return err
+	}
+	payload, err := widgetPayload()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := runinpopup.LoadConfig(flagConfig)
+	if err != nil {
+		return err
+	}
+	rt, err := resolveRuntime(ctx, runtimeInputs{
+		Config:    cfg,
+		Overrides: execFlagOverrides(cmd, flags.backend),
+	}, os.Environ())
+	if err != nil {
+		return err
+	}
+
+	workspace, err := runworkspace.Open(
+		widgetWorkspacePrefix,
+		rt.UserData.Debug(),
+		contextkey.ValueSlogLoggerFallback(ctx, slog.Default()),
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := workspace.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	popup := &runinpopup.PopupLauncher{
+		Backend:     rt.Backend,
+		Logger:      workspace.Logger,
+		Workspace:   workspace.Options,
+		Unsupported: runinpopup.UnsupportedPolicy(rt.Config.Unsupported),
+		Fit:         rt.Config.Fit,
+	}
+	res, err := widgetCall(ctx, popup, widgetSpec(flags, payload, req), req)
+	if err != nil {
+		return err
+	}
+	if res.Canceled {
+		return &ExitStatusError{Code: widgetCanceledStatus}
+	}
+	return render(cmd.OutOrStdout(), res)
+}
+
+// widgetPayload is the popup's command: this very binary, as the widget.
+func widgetPayload() ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("finding this executable to run in the popup: %w", err)
+	}
+	return []string{exe, widgetPayloadName}, nil
+}
+
+// widgetSpec is the popup the widget req asks for runs in. A size of fit is the
+// widget's own to give, from the request alone: the payload run headless to ask
+// would wait for a request that is only ever sent to the popup.
+func widgetSpec(flags widgetFlags, payload []string, req widget.Request) runinpopup.PopupSpec {
+	spec := execSpec(flags.title, flags.geometry, payload)
+	spec.SizeHint = func(context.Context) (int, int, error) {
+		width, height := widget.Size(req)
+		return width, height, nil
+	}
+	return spec
+}
+
+// widgetCall asks req of the widget spec runs, and returns its answer.
+//
+// The request is sent over the payload's stdin rather than put on its command
+// line, which every backend would pass through its multiplexer's: a list of
+// files easily outgrows what a tmux command may carry. That leaves the widget
+// no stdin to read keys from, which is what OpenTTY is for.
+func widgetCall(
+	ctx context.Context,
+	popup *runinpopup.PopupLauncher,
+	spec runinpopup.PopupSpec,
+	req widget.Request,
+) (widget.Result, error) {
+	launcher := &runinpopup.JsonIpcLauncher[widget.Request, widget.Result]{
+		Popup:       popup,
+		PartialSpec: spec,
+	}
+	conn, err := launcher.Exec(ctx, widget.Request{})
+	if err != nil {
+		return widget.Result{}, err
+	}
+	go func() {
+		// A failed send is the payload gone, which Wait reports.
+		if conn.Send(ctx, req) == nil {
+			_ = conn.CloseSend()
+		}
+	}()
+
+	var (
+		res      widget.Result
+		answered bool
+	)
+	for v := range conn.Results() {
+		if !answered {
+			res, answered = v, true
+		}
+	}
+	if err := conn.Wait(); err != nil {
+		return widget.Result{}, err
+	}
+	if !answered {
+		return widget.Result{}, errors.New("the popup closed without an answer")
+	}
+	return res, nil
+}
+
+// widgetRenderer parses --format up front and returns what prints an answer
+// with it: the value alone without one, the template against the whole
+// answer with one, and either way a trailing newline.
+func widgetRenderer(format string) (func(io.Writer, widget.Result) error, error) {
+	if format == "" {
+		return func(w io.Writer, res widget.Result) error {
+			_, err := fmt.Fprintln(w, res.Value)
+			return err
+		}, nil
+	}
+	tmpl, err := template.New("widget").Funcs(templateutil.FuncMap()).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("--format: %w", err)
+	}
+	return func(w io.Writer, res widget.Result) error {
+		if err := tmpl.Execute(w, res); err != nil {
+			return fmt.Errorf("--format: %w", err)
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}, nil
+}
+
+// widgetPayloadCmd is the widget itself, run in the popup by the subcommands
+// above. It is hidden: it reads a request off stdin and draws on the controlling
+// terminal, which makes no sense typed at a shell.
+func widgetPayloadCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:    widgetPayloadName,
+		Short:  "Draw a widget on the controlling terminal (run by choose, confirm and input)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runWidgetPayload(cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+	parent.AddCommand(cmd)
+}
+
+func runWidgetPayload(stdin io.Reader, stdout io.Writer) error {
+	var req widget.Request
+	if err := json.NewDecoder(stdin).Decode(&req); err != nil {
+		return fmt.Errorf("reading the widget request: %w", err)
+	}
+	tty, err := widget.OpenTTY()
+	if err != nil {
+		return err
+	}
+	res, err := widget.Run(req, tty.Terminal())
+	if cerr := tty.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(stdout).Encode(res)
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/internal/widget"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+// widgetPayloadEnv turns the test binary into the widget payload, the way
+// "run-in-popup __widget" is one.
+const widgetPayloadEnv = "RUN_IN_POPUP_TEST_WIDGET_PAYLOAD"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(widgetPayloadEnv) != "" {
+		if err := runWidgetPayload(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// The request reaches the payload whole on its stdin, and its first answer is
+// the widget's.
+func TestWidgetCall(t *testing.T) {
+	got := filepath.Join(t.TempDir(), "request")
+	res, err := widgetCall(
+		t.Context(),
+		popupLauncher(&popupShell{}),
+		runinpopup.PopupSpec{Command: []string{
+			"sh", "-c",
+			`read -r req; printf '%s' "$req" >"$1"` +
+				`; echo '{"value":"b","index":1}'; echo '{"value":"ignored"}'`,
+			"sh", got,
+		}},
+		widget.Request{Kind: widget.KindChoose, Items: []string{"a", "b"}},
+	)
+	if err != nil {
+		t.Fatalf("widgetCall: %v", err)
+	}
+	if want := (widget.Result{Value: "b", Index: 1}); res != want {
+		t.Errorf("widgetCall = %+v, want %+v", res, want)
+	}
+	req, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatalf("reading what the payload was sent: %v", err)
+	}
+	if want := `{"kind":"choose","items":["a","b"]}`; string(req) != want {
+		t.Errorf("the payload was sent %s, want %s", req, want)
+	}
+}
+
+func TestWidgetCall_failures(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		backend *popupShell
+		script  string
+		wantErr string
+	}{
+		{
+			name:    "popup that cannot be opened",
+			backend: &popupShell{launchErr: errors.New("no server running")},
+			wantErr: "no server running",
+		},
+		{
+			name:    "no answer",
+			backend: &popupShell{},
+			script:  "cat >/dev/null",
+			wantErr: "without an answer",
+		},
+		{
+			name:    "not an answer",
+			backend: &popupShell{},
+			script:  "echo nope",
+			wantErr: "invalid character",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := widgetCall(
+				t.Context(),
+				popupLauncher(tc.backend),
+				shellSpec(tc.script),
+				widget.Request{Kind: widget.KindConfirm},
+			)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("widgetCall = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWidgetRenderer(t *testing.T) {
+	res := widget.Result{Value: "beta", Index: 1}
+	for _, tc := range []struct {
+		name, format, want string
+	}{
+		{name: "value", want: "beta\n"},
+		{name: "field", format: "{{.Index}}", want: "1\n"},
+		{name: "helper", format: "{{json .Value}}", want: "\"beta\"\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			render, err := widgetRenderer(tc.format)
+			if err != nil {
+				t.Fatalf("widgetRenderer: %v", err)
+			}
+			var out bytes.Buffer
+			if err := render(&out, res); err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("rendered %q, want %q", out.String(), tc.want)
+			}
+		})
+	}
+	_, err := widgetRenderer("{{.Index")
+	if err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("widgetRenderer(malformed) = %v, want a --format error", err)
+	}
+}
+
+func TestReadItems(t *testing.T) {
+	items, err := readItems(strings.NewReader("one\n\ntwo words\nthree"))
+	if err != nil {
+		t.Fatalf("readItems: %v", err)
+	}
+	if want := []string{"one", "two words", "three"}; !slices.Equal(items, want) {
+		t.Errorf("readItems = %q, want %q", items, want)
+	}
+}
+
+// The widget payload end to end on a real terminal: the request goes in over
+// stdin, the list is drawn on the pty, the keys a user would press go in at its
+// master side, and the choice comes back through the exchange.
+func TestWidgetPayload_onPty(t *testing.T) {
+	b, err := backend.NewPty(backend.Options{})
+	if err != nil {
+		t.Fatalf("NewPty: %v", err)
+	}
+	popup := &runinpopup.PopupLauncher{Backend: b}
+	spec := runinpopup.PopupSpec{
+		Command: []string{os.Args[0]},
+		Env:     map[string]string{widgetPayloadEnv: "1"},
+	}
+
+	type answer struct {
+		res widget.Result
+		err error
+	}
+	answered := make(chan answer, 1)
+	go func() {
+		res, err := widgetCall(t.Context(), popup, spec, widget.Request{
+			Kind:   widget.KindChoose,
+			Prompt: "pick:",
+			Items:  []string{"alpha", "beta", "gamma"},
+		})
+		answered <- answer{res, err}
+	}()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	term, err := b.Next(ctx)
+	if err != nil {
+		a := <-answered
+		t.Skipf("no pty popup was opened: %v; widgetCall reported %v", err, a.err)
+	}
+	if err := term.WaitFor(ctx, "gamma"); err != nil {
+		t.Fatalf("%v; the popup shows %q", err, term.Screen())
+	}
+	if _, err := term.Write([]byte("\x1b[Bj\x1b[A\r")); err != nil {
+		t.Fatalf("typing at the popup: %v", err)
+	}
+
+	select {
+	case a := <-answered:
+		if a.err != nil {
+			t.Fatalf("widgetCall: %v; the popup shows %q", a.err, term.Screen())
+		}
+		if want := (widget.Result{Value: "beta", Index: 1}); a.res != want {
+			t.Errorf("widgetCall = %+v, want %+v", a.res, want)
+		}
+	case <-ctx.Done():
+		t.Fatalf("the widget never answered; the popup shows %q", term.Screen())
+	}
+}
+
+// A widget's popup fits it by what the request says it draws, never by running
+// the payload to ask.
+func TestWidgetSpec(t *testing.T) {
+	req := widget.Request{Kind: widget.KindChoose, Prompt: "pick:", Items: []string{"main", "dev"}}
+	flags := widgetFlags{
+		title:    "branches",
+		geometry: execGeometry{width: runinpopup.SizeFit, height: runinpopup.SizeFit},
+	}
+	spec := widgetSpec(flags, []string{"run-in-popup", widgetPayloadName}, req)
+
+	if spec.Title != "branches" || spec.Width != "fit" || spec.Height != "fit" {
+		t.Errorf("spec = %+v, want the flags' title and geometry", spec)
+	}
+	if spec.SizeHint == nil {
+		t.Fatal("SizeHint = nil, want the widget's own size")
+	}
+	width, height, err := spec.SizeHint(t.Context())
+	wantWidth, wantHeight := widget.Size(req)
+	if err != nil || width != wantWidth || height != wantHeight {
+		t.Errorf("SizeHint = %d, %d, %v; want %d, %d, nil",
+			width, height, err, wantWidth, wantHeight)
+	}
+}
@@ -2,6 +2,8 @@ package commands
 
 import (
 	"cmp"
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
@@ -32,37 +34,42 @@ type commandRuntime struct {
 // empty flag value clears a configured backend and so asks for detection
 // again.
 //
+// A "_DYNAMIC" PINENTRY_USER_DATA kind has its session and client looked up
+// here, from the multiplexer the backend runs on, and the runtime's UserData
+// carries what was found: every later reader of it — a fallback backend, the
+// debug log — sees where the popup actually went.
+//
 // environ holds "KEY=VALUE" entries, the form os.Environ returns: every ambient
 // value the resolution consumes arrives through it, so the precedence is
 // testable without touching the process environment.
-func resolveRuntime(inputs runtimeInputs, environ []string) (commandRuntime, error) {
+func resolveRuntime(
+	ctx context.Context,
+	inputs runtimeInputs,
+	environ []string,
+) (commandRuntime, error) {
 	cfg := inputs.Overrides.Apply(inputs.Config)
 	userData := runinpopup.ParsePinentryUserData(lookupEnviron(environ, "PINENTRY_USER_DATA"))
-	tmuxEnv := lookupEnviron(environ, "TMUX")
 
 	backendName := cfg.Backend
 	if backendName == "" {
 		var err error
-		backendName, err = backend.DetectName(
-			userData.Kind,
-			tmuxEnv,
-			lookupEnviron(environ, "ZELLIJ"),
-		)
+		hints := environHints(environ)
+		hints.UserDataKind = userData.Kind
+		backendName, err = backend.DetectName(hints)
 		if err != nil {
 			return commandRuntime{}, err
 		}
 	}
 
-	popupBackend, err := backend.New(backendName, backend.Options{
-		BinaryPath:  userData.Path,
-		SessionId:   userData.SessionId,
-		ClientId:    userData.ClientId,
-		SessionMeta: userData.SessionMeta,
-		TMUX:        tmuxEnv,
-		// $SHELL rather than the library's "sh": the popup payload is the user's
-		// login shell in every released version of this tool.
-		Shell: cmp.Or(lookupEnviron(environ, "SHELL"), "bash"),
-	})
+	if userData.Dynamic() {
+		focus, err := backend.ResolveFocus(ctx, backendName, backendOptions(userData, environ))
+		if err != nil {
+			return commandRuntime{}, fmt.Errorf("resolving %s: %w", userData.Kind, err)
+		}
+		userData.SessionId, userData.ClientId = focus.SessionId, focus.ClientId
+	}
+
+	popupBackend, err := backend.New(backendName, backendOptions(userData, environ))
 	if err != nil {
 		return commandRuntime{}, err
 	}
@@ -70,6 +77,41 @@ func resolveRuntime(inputs runtimeInputs, environ []string) (commandRuntime, err
 	return commandRuntime{Config: cfg, UserData: userData, Backend: popupBackend}, nil
 }
 
+// backendOptions is what every backend is built from: where PINENTRY_USER_DATA
+// says the multiplexer is, and the ambient variables that say it otherwise.
+// Each backend reads the fields it understands and ignores the rest, so the
+// same options serve whichever backend is picked, a fallback's included.
+func backendOptions(userData runinpopup.PinentryUserData, environ []string) backend.Options {
+	return backend.Options{
+		BinaryPath:    userData.Path,
+		SessionId:     userData.SessionId,
+		ClientId:      userData.ClientId,
+		SessionMeta:   userData.SessionMeta,
+		TMUX:          lookupEnviron(environ, "TMUX"),
+		STY:           lookupEnviron(environ, "STY"),
+		NVIM:          lookupEnviron(environ, "NVIM"),
+		WeztermPane:   lookupEnviron(environ, "WEZTERM_PANE"),
+		KittyWindowId: lookupEnviron(environ, "KITTY_WINDOW_ID"),
+		// $SHELL rather than the library's "sh": the popup payload is the user's
+		// login shell in every released version of this tool.
+		Shell: cmp.Or(lookupEnviron(environ, "SHELL"), "bash"),
+	}
+}
+
+// environHints reads the detection hints out of environ. UserDataKind is left
+// to the caller: whether a PINENTRY_USER_DATA already set may pick the backend
+// depends on what the backend is picked for.
+func environHints(environ []string) backend.Hints {
+	return backend.Hints{
+		TMUX:          lookupEnviron(environ, "TMUX"),
+		Zellij:        lookupEnviron(environ, "ZELLIJ"),
+		STY:           lookupEnviron(environ, "STY"),
+		NVIM:          lookupEnviron(environ, "NVIM"),
+		WeztermPane:   lookupEnviron(environ, "WEZTERM_PANE"),
+		KittyWindowId: lookupEnviron(environ, "KITTY_WINDOW_ID"),
+	}
+}
+
 // lookupEnviron reads one variable out of "KEY=VALUE" entries. The first entry
 // wins, as in os.Getenv, so a duplicated variable resolves the same way here as
 // it would when read from the process environment.
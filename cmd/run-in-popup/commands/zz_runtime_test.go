@@ -1,7 +1,10 @@
 package commands
 
 import (
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
@@ -12,10 +15,13 @@ import (
 // a reworded backend error cannot change the CLI's output unnoticed.
 const (
 	errUnknownBackend = `unknown popup backend "tmux":` +
-		` valid values are tmux-popup, tmux-floating-pane, zellij`
+		` valid values are tmux-popup, tmux-floating-pane, zellij, screen, nvim, wezterm,` +
+		` kitty, kitty-os-window, pty`
 	errNothingDetected = `cannot detect the popup backend:` +
-		` neither PINENTRY_USER_DATA, $TMUX nor $ZELLIJ names one;` +
-		` select it explicitly, valid values are tmux-popup, tmux-floating-pane, zellij`
+		` neither PINENTRY_USER_DATA, $TMUX, $ZELLIJ, $STY, $NVIM, $WEZTERM_PANE nor` +
+		` $KITTY_WINDOW_ID names one; select it explicitly, valid values are` +
+		` tmux-popup, tmux-floating-pane, zellij, screen, nvim, wezterm, kitty,` +
+		` kitty-os-window, pty`
 	errMalformedSessionMeta = `tmux session meta is malformed:` +
 		` it must be something like "/run/user/1000/tmux-1000/default,111,0" but is ""`
 )
@@ -24,6 +30,10 @@ func TestResolveRuntime(t *testing.T) {
 	const (
 		tmuxEnv    = "TMUX=/run/user/1000/tmux-1000/default,111,0"
 		zellijEnv  = "ZELLIJ=0"
+		weztermEnv = "WEZTERM_PANE=3"
+		kittyEnv   = "KITTY_WINDOW_ID=1"
+		styEnv     = "STY=1234.main"
+		nvimEnv    = "NVIM=/run/user/1000/nvim.1.0"
 		tmuxData   = "PINENTRY_USER_DATA=TMUX_POPUP:/usr/bin/tmux:$1:%1:/tmp/tmux-1000/default,111,0"
 		zellijData = "PINENTRY_USER_DATA=ZELLIJ_POPUP:/usr/bin/zellij:session-id"
 
@@ -82,10 +92,40 @@ func TestResolveRuntime(t *testing.T) {
 			wantBackend: backend.NameTmuxPopup,
 		},
 		{
-			name:        "$ZELLIJ is the last hint left",
-			environ:     []string{zellijEnv},
+			name:        "$ZELLIJ wins over $WEZTERM_PANE",
+			environ:     []string{weztermEnv, zellijEnv},
 			wantBackend: backend.NameZellij,
 		},
+		{
+			name:        "$ZELLIJ wins over $STY",
+			environ:     []string{styEnv, zellijEnv},
+			wantBackend: backend.NameZellij,
+		},
+		{
+			name:        "$STY wins over $WEZTERM_PANE",
+			environ:     []string{weztermEnv, styEnv},
+			wantBackend: backend.NameScreen,
+		},
+		{
+			name:        "$TMUX wins over $NVIM",
+			environ:     []string{nvimEnv, tmuxEnv},
+			wantBackend: backend.NameTmuxPopup,
+		},
+		{
+			name:        "$NVIM wins over $WEZTERM_PANE",
+			environ:     []string{weztermEnv, nvimEnv},
+			wantBackend: backend.NameNvim,
+		},
+		{
+			name:        "$WEZTERM_PANE wins over $KITTY_WINDOW_ID",
+			environ:     []string{kittyEnv, weztermEnv},
+			wantBackend: backend.NameWezterm,
+		},
+		{
+			name:        "$KITTY_WINDOW_ID is the last hint left",
+			environ:     []string{kittyEnv},
+			wantBackend: backend.NameKitty,
+		},
 		{
 			name:    "a name no backend answers to",
 			config:  runinpopup.Config{Backend: "tmux"},
@@ -107,6 +147,7 @@ func TestResolveRuntime(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			rt, err := resolveRuntime(
+				t.Context(),
 				runtimeInputs{Config: tc.config, Overrides: tc.overrides},
 				tc.environ,
 			)
@@ -136,6 +177,7 @@ func TestResolveRuntime(t *testing.T) {
 // merged configuration and the parsed user data.
 func TestResolveRuntime_carriesMergedConfigAndUserData(t *testing.T) {
 	rt, err := resolveRuntime(
+		t.Context(),
 		runtimeInputs{
 			Config: runinpopup.Config{PinentryPath: "/from/config"},
 			Overrides: runinpopup.PartialConfig{
@@ -173,6 +215,40 @@ func TestResolveRuntime_carriesMergedConfigAndUserData(t *testing.T) {
 	}
 }
 
+// A dynamic kind is looked up where it stands: the session and client come from
+// the tmux server it names, and the runtime carries them on.
+func TestResolveRuntime_dynamicUserData(t *testing.T) {
+	tmux := filepath.Join(t.TempDir(), "tmux")
+	script := "#!/bin/sh\n[ \"$1\" = list-clients ] || exit 1\n" +
+		"printf '%s\\n' '/dev/pts/3\t/dev/pts/3\t$1\twork\t100'" +
+		" '/dev/pts/6\t/dev/pts/6\t$2\tplay\t900'\n"
+	if err := os.WriteFile(tmux, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake tmux: %v", err)
+	}
+	data := "PINENTRY_USER_DATA=TMUX_POPUP_DYNAMIC_DEBUG:" + tmux + ":::/tmp/tmux-1000/default,1,0"
+
+	rt, err := resolveRuntime(t.Context(), runtimeInputs{}, []string{data})
+	if err != nil {
+		t.Fatalf("resolveRuntime: %v", err)
+	}
+	if got := rt.Backend.Name(); got != backend.NameTmuxPopup {
+		t.Errorf("backend = %q, want %q", got, backend.NameTmuxPopup)
+	}
+	if rt.UserData.SessionId != "$2" || rt.UserData.ClientId != "/dev/pts/6" {
+		t.Errorf("UserData = %+v, want the most recently active client and its session", rt.UserData)
+	}
+	if !rt.UserData.Debug() {
+		t.Error("the debug suffix after the dynamic one was lost")
+	}
+
+	_, err = resolveRuntime(t.Context(), runtimeInputs{}, []string{
+		"PINENTRY_USER_DATA=SCREEN_POPUP_DYNAMIC",
+	})
+	if err == nil || !strings.Contains(err.Error(), "resolving SCREEN_POPUP_DYNAMIC: ") {
+		t.Errorf("resolveRuntime = %v, want the kind that could not be resolved named", err)
+	}
+}
+
 func TestLookupEnviron(t *testing.T) {
 	environ := []string{
 		"malformed-entry-without-a-separator",
@@ -29,9 +29,13 @@ func main() {
 	if err == nil {
 		return
 	}
-	// Every failure ends the same way: cobra silences what a leaf returns, so
-	// this is where it is said, and no command asks for a status of its own —
-	// what runs inside a popup keeps its status to itself.
+	// A command run in a popup that failed on its own is exec's status to pass on,
+	// not a failure to explain: whatever it had to say, it said in the popup.
+	if statusErr, ok := errors.AsType[*commands.ExitStatusError](err); ok {
+		os.Exit(statusErr.Code)
+	}
+	// Every other failure ends the same way: cobra silences what a leaf returns,
+	// so this is where it is said.
 	fmt.Fprintln(os.Stderr, "error:", err)
 	os.Exit(1)
 }
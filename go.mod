@@ -3,10 +3,12 @@ module github.com/ngicks/run-in-tmux-popup
 go 1.26.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/caarlos0/env/v11 v11.4.1
 	github.com/ngicks/go-common/contextkey v0.3.0
 	github.com/ngicks/go-common/iopipe v0.0.1
 	github.com/spf13/cobra v1.10.2
+	go.yaml.in/yaml/v3 v3.0.4
 	golang.org/x/sync v0.22.0
 )
 
@@ -0,0 +1,116 @@
+// Package gpgsetup builds the two files that put run-in-popup behind gpg-agent:
+// the wrapper script gpg-agent runs as its pinentry, and the gpg-agent.conf
+// line pointing at it.
+//
+// gpg-agent runs one pinentry program with no say in which, so the wrapper
+// decides per prompt, from PINENTRY_USER_DATA, between a popup and a plain
+// pinentry. Its patterns are generated from the kinds backend.DetectName
+// recognises rather than written once into the README for users to copy: a
+// copied script silently sends a new backend's kind to the graphical pinentry.
+package gpgsetup
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+// WrapperOptions are the programs a wrapper script dispatches to.
+type WrapperOptions struct {
+	// RunInPopup is the run-in-popup binary, by absolute path: gpg-agent starts
+	// the wrapper with a PATH of its own, not the user's.
+	RunInPopup string
+	// TTYPinentry runs when PINENTRY_USER_DATA asks for a terminal prompt with
+	// "TTY", a value of the user's own rather than a kind.
+	TTYPinentry string
+	// Pinentry runs for everything else, a PINENTRY_USER_DATA left unset
+	// included: the prompt of a desktop session, which has no multiplexer.
+	Pinentry string
+}
+
+// Wrapper renders the wrapper script. Every kind matches as a substring, so a
+// "_DYNAMIC" or "_DEBUG" suffix, or the versioned "RIP1;kind=" encoding, goes
+// to the popup just as the bare kind does. The kinds are matched before "TTY",
+// which "KITTY_POPUP" holds.
+func Wrapper(opts WrapperOptions) string {
+	kinds := backend.UserDataKinds()
+	patterns := make([]string, len(kinds))
+	for i, kind := range kinds {
+		patterns[i] = "*" + kind + "*"
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Generated by run-in-popup setup gpg. Run it again instead of editing this\n")
+	b.WriteString("# file: its patterns follow the PINENTRY_USER_DATA kinds run-in-popup knows.\n")
+	b.WriteString("\nset -Ceu\n\n")
+	b.WriteString("case \"${PINENTRY_USER_DATA-}\" in\n")
+	fmt.Fprintf(&b, "%s)\n", strings.Join(patterns, " | "))
+	fmt.Fprintf(&b, "  exec %s pinentry -- \"$@\"\n", quote(opts.RunInPopup))
+	b.WriteString("  ;;\n")
+	b.WriteString("*TTY*)\n")
+	fmt.Fprintf(&b, "  exec %s \"$@\"\n", quote(opts.TTYPinentry))
+	b.WriteString("  ;;\n")
+	b.WriteString("esac\n\n")
+	fmt.Fprintf(&b, "exec %s \"$@\"\n", quote(opts.Pinentry))
+	return b.String()
+}
+
+// quote single-quotes s for sh when it holds anything a shell would act on,
+// and leaves a plain word such as "pinentry-curses" as it is.
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyz"+
+		"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789/._-+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// pinentryProgramOption is the gpg-agent.conf option naming the pinentry.
+const pinentryProgramOption = "pinentry-program"
+
+// SetPinentryProgram returns conf, a gpg-agent.conf, with pinentry-program set
+// to program. The first active pinentry-program line is rewritten in place, so
+// the comments and options around it are kept; any later one is dropped, as
+// gpg-agent would have obeyed it instead. Without one the option is appended.
+// Running it on its own output changes nothing.
+func SetPinentryProgram(conf, program string) string {
+	want := pinentryProgramOption + " " + program
+	lines := strings.SplitAfter(conf, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var (
+		out strings.Builder
+		set bool
+	)
+	for _, line := range lines {
+		if !isPinentryProgram(line) {
+			out.WriteString(line)
+			continue
+		}
+		if !set {
+			out.WriteString(want + "\n")
+			set = true
+		}
+	}
+	if !set {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteString("\n")
+		}
+		out.WriteString(want + "\n")
+	}
+	return out.String()
+}
+
+// isPinentryProgram reports whether line sets pinentry-program. gpg-agent
+// skips leading whitespace and takes the option name up to the first blank;
+// a '#' in front comments it out.
+func isPinentryProgram(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	name, _, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+	name, _, _ = strings.Cut(name, "\t")
+	return name == pinentryProgramOption
+}
@@ -0,0 +1,113 @@
+package gpgsetup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+// The script is run rather than read: every kind, however it is suffixed or
+// encoded, has to reach the popup, and nothing else may.
+func TestWrapper(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"run-in-popup", "pinentry-curses", "pinentry qt"} {
+		fake := "#!/bin/sh\necho " + strings.ReplaceAll(name, " ", "-") + " \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fake), 0o755); err != nil {
+			t.Fatalf("writing the fake %s: %v", name, err)
+		}
+	}
+	wrapper := filepath.Join(dir, "wrapper")
+	script := Wrapper(WrapperOptions{
+		RunInPopup:  filepath.Join(dir, "run-in-popup"),
+		TTYPinentry: filepath.Join(dir, "pinentry-curses"),
+		Pinentry:    filepath.Join(dir, "pinentry qt"),
+	})
+	if err := os.WriteFile(wrapper, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the wrapper: %v", err)
+	}
+
+	run := func(userData string) string {
+		t.Helper()
+		cmd := exec.Command(wrapper, "--display", ":0")
+		cmd.Env = []string{"PINENTRY_USER_DATA=" + userData}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("running the wrapper for %q: %v\n%s", userData, err, script)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	const popup = "run-in-popup pinentry -- --display :0"
+	for _, kind := range backend.UserDataKinds() {
+		for _, userData := range []string{
+			kind + ":/usr/bin/x:1",
+			kind + "_DYNAMIC_DEBUG:/usr/bin/x",
+			"RIP1;kind=" + kind,
+		} {
+			if got := run(userData); got != popup {
+				t.Errorf("%q ran %q, want %q", userData, got, popup)
+			}
+		}
+	}
+	if got, want := run("TTY"), "pinentry-curses --display :0"; got != want {
+		t.Errorf("TTY ran %q, want %q", got, want)
+	}
+	if got, want := run(""), "pinentry-qt --display :0"; got != want {
+		t.Errorf("no kind ran %q, want %q", got, want)
+	}
+}
+
+func TestSetPinentryProgram(t *testing.T) {
+	const program = "/home/me/.local/bin/pinentry-run-in-popup"
+	for _, tc := range []struct {
+		name string
+		conf string
+		want string
+	}{
+		{
+			name: "no file yet",
+			conf: "",
+			want: "pinentry-program " + program + "\n",
+		},
+		{
+			name: "appended after the rest",
+			conf: "default-cache-ttl 600",
+			want: "default-cache-ttl 600\npinentry-program " + program + "\n",
+		},
+		{
+			name: "rewritten in place",
+			conf: "# pinentry-program /usr/bin/pinentry-gtk\n" +
+				"default-cache-ttl 600\n" +
+				"  pinentry-program\t/usr/bin/pinentry-qt\n" +
+				"max-cache-ttl 7200\n",
+			want: "# pinentry-program /usr/bin/pinentry-gtk\n" +
+				"default-cache-ttl 600\n" +
+				"pinentry-program " + program + "\n" +
+				"max-cache-ttl 7200\n",
+		},
+		{
+			name: "a later duplicate dropped",
+			conf: "pinentry-program /a\nenable-ssh-support\npinentry-program /b\n",
+			want: "pinentry-program " + program + "\nenable-ssh-support\n",
+		},
+		{
+			name: "a similar option kept",
+			conf: "pinentry-program-x /a\n",
+			want: "pinentry-program-x /a\npinentry-program " + program + "\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SetPinentryProgram(tc.conf, program)
+			if got != tc.want {
+				t.Errorf("SetPinentryProgram =\n%s\nwant\n%s", got, tc.want)
+			}
+			if again := SetPinentryProgram(got, program); again != got {
+				t.Errorf("a second run changed it again:\n%s", again)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package linediff renders the difference between two small texts as a unified
+// diff, for commands that show what they would write before writing it.
+//
+// It compares whole lines with a plain longest-common-subsequence table, which
+// is quadratic in the line count: fine for a config file or a script, not for
+// anything a user would diff with a real tool.
+package linediff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is how many unchanged lines surround a change, as diff -u has it.
+const context = 3
+
+// edit is one line of the edit script: kept (' '), removed ('-') or added
+// ('+').
+type edit struct {
+	op   byte
+	line string
+}
+
+// Unified returns the unified diff turning old into new, headed by oldName and
+// newName, or "" when they are the same. A last line without a newline is
+// marked as diff marks it, so the two texts can be told apart by it alone.
+func Unified(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	edits := editScript(splitLines(old), splitLines(new))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldAt and newAt are, for each edit, the 0-based line it sits at in either
+	// text: where a hunk starting there begins.
+	oldAt, newAt := make([]int, len(edits)+1), make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if e.op != '+' {
+			oldAt[i+1]++
+		}
+		if e.op != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		// Extend the hunk over every change close enough that the context
+		// between them would overlap.
+		end := i + 1
+		for j := end; j < len(edits) && j <= end+2*context; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		stop := min(len(edits), end+context)
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldAt[start], oldAt[stop]-oldAt[start]),
+			hunkRange(newAt[start], newAt[stop]-newAt[start]),
+		)
+		for _, e := range edits[start:stop] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// hunkRange is one side of a hunk header. An empty side names the line before
+// it, which is how diff -u places a pure insertion or deletion.
+func hunkRange(at, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", at)
+	}
+	return fmt.Sprintf("%d,%d", at+1, count)
+}
+
+// splitLines splits s after each newline, keeping it, so a last line without
+// one stays distinguishable from one with.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript is the shortest edit script from a to b, removals before the
+// additions replacing them.
+func editScript(a, b []string) []edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,82 @@
+package widget
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// TTY is the controlling terminal, put into raw mode for a widget to run on.
+type TTY struct {
+	f     *os.File
+	saved syscall.Termios
+}
+
+// OpenTTY opens the controlling terminal and makes it raw: every key arrives as
+// it is typed, nothing is echoed, and Ctrl-C is a key rather than a signal.
+// Close puts it back the way it was.
+//
+// It opens /dev/tty rather than using stdin or stdout, which a widget payload
+// has given over to the exchange.
+func OpenTTY() (*TTY, error) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	t := &TTY{f: f}
+	if err := ioctl(f, syscall.TCGETS, unsafe.Pointer(&t.saved)); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("reading the terminal's mode: %w", err)
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("making the terminal raw: %w", err)
+	}
+	return t, nil
+}
+
+// Terminal is the widget's view of t, sized to it.
+func (t *TTY) Terminal() Terminal {
+	var size struct{ rows, cols, x, y uint16 }
+	rows := 0
+	if ioctl(t.f, syscall.TIOCGWINSZ, unsafe.Pointer(&size)) == nil {
+		rows = int(size.rows)
+	}
+	return Terminal{Keys: t.f, Screen: t.f, Rows: rows}
+}
+
+// Close restores the terminal's mode and closes it.
+func (t *TTY) Close() error {
+	err := ioctl(t.f, syscall.TCSETS, unsafe.Pointer(&t.saved))
+	if cerr := t.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
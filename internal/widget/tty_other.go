@@ -0,0 +1,19 @@
+//go:build !linux
+
+package widget
+
+import "errors"
+
+// TTY is the controlling terminal, put into raw mode for a widget to run on.
+type TTY struct{}
+
+// OpenTTY fails: only Linux's termios ioctls are implemented.
+func OpenTTY() (*TTY, error) {
+	return nil, errors.New("widgets are only implemented on linux")
+}
+
+// Terminal is the widget's view of t.
+func (t *TTY) Terminal() Terminal { return Terminal{} }
+
+// Close does nothing; no TTY is ever opened.
+func (t *TTY) Close() error { return nil }
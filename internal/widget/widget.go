@@ -0,0 +1,383 @@
+// Package widget draws the pickers behind run-in-popup's choose, confirm and
+// input subcommands: a list to move through, a yes/no question and a line of
+// text, each on a terminal of its own and each answered with one Result.
+//
+// The widgets are the payload half of a JsonIpcLauncher exchange: the caller
+// opens a popup running "run-in-popup __widget", sends it a Request, and reads
+// the Result back. What is drawn and what is typed go through the popup's
+// terminal directly (see OpenTTY), because the payload's stdin and stdout are the
+// exchange's. Everything else here is plain reads and writes, so a widget can be
+// driven with canned keystrokes and its screen read back as text.
+package widget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The kinds of widget a Request asks for.
+const (
+	KindChoose  = "choose"
+	KindConfirm = "confirm"
+	KindInput   = "input"
+)
+
+// Request is what a widget is asked: which one, and what it shows.
+type Request struct {
+	Kind string `json:"kind"`
+	// Prompt is the line shown above the list, before the question, or before
+	// the text being typed.
+	Prompt string `json:"prompt,omitempty"`
+	// Items are choose's entries, in the order shown. At least one is required.
+	Items []string `json:"items,omitempty"`
+	// Default is confirm's answer to a bare Enter.
+	Default bool `json:"default,omitempty"`
+	// Value is the text input starts out with.
+	Value string `json:"value,omitempty"`
+	// Password keeps input from showing what is typed.
+	Password bool `json:"password,omitempty"`
+}
+
+// Result is a widget's answer. Value is what the subcommands print by default:
+// the item chosen, the text typed, or "yes" or "no".
+type Result struct {
+	// Canceled is a widget dismissed with Esc or Ctrl-C, whose other fields mean
+	// nothing.
+	Canceled bool   `json:"canceled,omitempty"`
+	Value    string `json:"value"`
+	// Index is choose's item, counted from 0 in Request.Items.
+	Index int `json:"index"`
+	// Confirmed is confirm's answer.
+	Confirmed bool `json:"confirmed"`
+}
+
+// Terminal is what a widget runs on: keystrokes in, drawing out. Rows bounds how
+// much of a list is shown at once; 0 shows all of it.
+type Terminal struct {
+	Keys   io.Reader
+	Screen io.Writer
+	Rows   int
+}
+
+// Run shows the widget req asks for on t and returns its answer once it is
+// given, or canceled. Keys ending before either is an error: nobody is left to
+// answer.
+func Run(req Request, t Terminal) (Result, error) {
+	keys := &keyReader{r: t.Keys}
+	switch req.Kind {
+	case KindChoose:
+		if len(req.Items) == 0 {
+			return Result{}, errors.New("choose: nothing to choose from")
+		}
+		return choose(req, keys, t)
+	case KindConfirm:
+		return confirm(req, keys, t.Screen)
+	case KindInput:
+		return input(req, keys, t.Screen)
+	default:
+		return Result{}, fmt.Errorf("unknown widget %q", req.Kind)
+	}
+}
+
+// inputRoom is the cells input leaves past its prompt and starting text for
+// what is typed: the line is drawn on one row, and a terminal only as wide as
+// what is there at the start would have no room for the rest.
+const inputRoom = 40
+
+// Size is how much of a terminal the widget req asks for draws on, in cells:
+// the width of its widest line and how many lines it has. A rune is taken to be
+// a cell, which a wide one is not, and text is measured as it is drawn, with
+// its control characters dropped. It is what a popup sized to fit a widget is
+// sized by, and it needs no terminal: a widget is all request.
+func Size(req Request) (width, height int) {
+	prompt := cells(req.Prompt)
+	switch req.Kind {
+	case KindChoose:
+		width = prompt
+		for _, item := range req.Items {
+			width = max(width, len("> ")+cells(item))
+		}
+		// The prompt takes a row of its own.
+		return width, 1 + len(req.Items)
+	case KindConfirm:
+		// The choices and the answer follow the question on its row.
+		return prompt + len(" [y/N] ") + len("yes"), 1
+	case KindInput:
+		value := cells(req.Value)
+		if req.Password {
+			value = 0
+		}
+		return prompt + value + inputRoom, 1
+	}
+	return 0, 0
+}
+
+// cells is how wide s is drawn.
+func cells(s string) int {
+	return utf8.RuneCountInString(printable(s))
+}
+
+// Control sequences the widgets draw with. The terminal is raw, so a line ends
+// in "\r\n": nothing turns "\n" into a carriage return too.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	clearLine   = "\r\x1b[K"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	reverse     = "\x1b[7m"
+	plain       = "\x1b[0m"
+	newline     = "\r\n"
+)
+
+func choose(req Request, keys *keyReader, t Terminal) (Result, error) {
+	// The prompt takes a row of its own.
+	window := len(req.Items)
+	if t.Rows > 0 {
+		window = min(window, max(t.Rows-1, 1))
+	}
+	cursor, top := 0, 0
+
+	fmt.Fprint(t.Screen, hideCursor)
+	defer fmt.Fprint(t.Screen, showCursor)
+	for {
+		top = min(max(top, cursor-window+1), cursor)
+		drawList(t.Screen, req, cursor, top, window)
+
+		k, err := keys.next()
+		if err != nil {
+			return Result{}, answerErr(err)
+		}
+		switch k.code {
+		case keyUp:
+			cursor = max(cursor-1, 0)
+		case keyDown:
+			cursor = min(cursor+1, len(req.Items)-1)
+		case keyRune:
+			switch k.r {
+			case 'k':
+				cursor = max(cursor-1, 0)
+			case 'j':
+				cursor = min(cursor+1, len(req.Items)-1)
+			case 'q':
+				return Result{Canceled: true}, nil
+			}
+		case keyEnter:
+			fmt.Fprint(t.Screen, clearScreen)
+			return Result{Value: req.Items[cursor], Index: cursor}, nil
+		case keyCancel, keyEOF:
+			return Result{Canceled: true}, nil
+		}
+	}
+}
+
+func drawList(w io.Writer, req Request, cursor, top, window int) {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	b.WriteString(printable(req.Prompt))
+	for i := top; i < top+window; i++ {
+		b.WriteString(newline)
+		if i == cursor {
+			b.WriteString(reverse + "> " + printable(req.Items[i]) + plain)
+		} else {
+			b.WriteString("  " + printable(req.Items[i]))
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+func confirm(req Request, keys *keyReader, w io.Writer) (Result, error) {
+	choices := "[y/N]"
+	if req.Default {
+		choices = "[Y/n]"
+	}
+	fmt.Fprintf(w, "%s %s ", printable(req.Prompt), choices)
+	for {
+		k, err := keys.next()
+		if err != nil {
+			return Result{}, answerErr(err)
+		}
+		answer := req.Default
+		switch {
+		case k.code == keyRune && (k.r == 'y' || k.r == 'Y'):
+			answer = true
+		case k.code == keyRune && (k.r == 'n' || k.r == 'N'):
+			answer = false
+		case k.code == keyEnter:
+		case k.code == keyCancel, k.code == keyEOF:
+			fmt.Fprint(w, newline)
+			return Result{Canceled: true}, nil
+		default:
+			continue
+		}
+		res := Result{Value: "no", Confirmed: answer}
+		if answer {
+			res.Value = "yes"
+		}
+		fmt.Fprint(w, res.Value+newline)
+		return res, nil
+	}
+}
+
+func input(req Request, keys *keyReader, w io.Writer) (Result, error) {
+	text := []rune(req.Value)
+	for {
+		shown := string(text)
+		if req.Password {
+			shown = ""
+		}
+		fmt.Fprint(w, clearLine+printable(req.Prompt)+printable(shown))
+
+		k, err := keys.next()
+		if err != nil {
+			return Result{}, answerErr(err)
+		}
+		switch k.code {
+		case keyRune:
+			text = append(text, k.r)
+		case keyBackspace:
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case keyKillLine:
+			text = text[:0]
+		case keyEnter:
+			fmt.Fprint(w, newline)
+			return Result{Value: string(text)}, nil
+		case keyEOF:
+			// Ctrl-D is a shell's end of input: on an empty line there is
+			// nothing to give, and on a non-empty one it is left alone.
+			if len(text) > 0 {
+				continue
+			}
+			fallthrough
+		case keyCancel:
+			fmt.Fprint(w, newline)
+			return Result{Canceled: true}, nil
+		}
+	}
+}
+
+// answerErr is the keys ending before the widget was answered.
+func answerErr(err error) error {
+	if errors.Is(err, io.EOF) {
+		return errors.New("the terminal closed before the widget was answered")
+	}
+	return fmt.Errorf("reading the terminal: %w", err)
+}
+
+// printable drops control characters from s, so an item or a prompt can draw
+// text and nothing else: a stray escape sequence in a file name would otherwise
+// get to redraw the screen.
+func printable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+type keyCode int
+
+const (
+	keyOther keyCode = iota
+	keyRune
+	keyEnter
+	keyBackspace
+	keyKillLine
+	keyUp
+	keyDown
+	// keyCancel is Esc and Ctrl-C: raw mode turns off the signal Ctrl-C would
+	// otherwise send, which leaves it to mean what it means everywhere else.
+	keyCancel
+	keyEOF
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// keyReader splits what the terminal sends into keys. A raw terminal hands over
+// what was typed as it arrives, an escape sequence whole, so a read ending in a
+// lone ESC is the Esc key rather than the start of something still on its way.
+type keyReader struct {
+	r       io.Reader
+	buf     [256]byte
+	pending []byte
+}
+
+func (k *keyReader) next() (key, error) {
+	for len(k.pending) == 0 {
+		n, err := k.r.Read(k.buf[:])
+		k.pending = k.buf[:n]
+		if n == 0 && err != nil {
+			return key{}, err
+		}
+	}
+	p := k.pending
+	switch c := p[0]; {
+	case c == 0x1b:
+		if len(p) >= 3 && (p[1] == '[' || p[1] == 'O') {
+			return k.csi()
+		}
+		k.pending = p[1:]
+		return key{code: keyCancel}, nil
+	case c == '\r' || c == '\n':
+		k.pending = p[1:]
+		return key{code: keyEnter}, nil
+	case c == 0x7f || c == 0x08:
+		k.pending = p[1:]
+		return key{code: keyBackspace}, nil
+	case c == 0x03:
+		k.pending = p[1:]
+		return key{code: keyCancel}, nil
+	case c == 0x04:
+		k.pending = p[1:]
+		return key{code: keyEOF}, nil
+	case c == 0x15:
+		k.pending = p[1:]
+		return key{code: keyKillLine}, nil
+	case c == 0x0e:
+		k.pending = p[1:]
+		return key{code: keyDown}, nil
+	case c == 0x10:
+		k.pending = p[1:]
+		return key{code: keyUp}, nil
+	case c < 0x20:
+		k.pending = p[1:]
+		return key{code: keyOther}, nil
+	}
+	r, size := utf8.DecodeRune(p)
+	k.pending = p[size:]
+	if r == utf8.RuneError {
+		return key{code: keyOther}, nil
+	}
+	return key{code: keyRune, r: r}, nil
+}
+
+// csi takes an escape sequence off pending: ESC, '[' or 'O', parameters, and a
+// final byte naming it. Only the arrows mean anything to a widget.
+func (k *keyReader) csi() (key, error) {
+	p := k.pending
+	end := 2
+	for end < len(p) && (p[end] < 0x40 || p[end] > 0x7e) {
+		end++
+	}
+	if end == len(p) {
+		k.pending = nil
+		return key{code: keyOther}, nil
+	}
+	k.pending = p[end+1:]
+	switch p[end] {
+	case 'A':
+		return key{code: keyUp}, nil
+	case 'B':
+		return key{code: keyDown}, nil
+	}
+	return key{code: keyOther}, nil
+}
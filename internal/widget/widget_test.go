@@ -0,0 +1,187 @@
+package widget
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, req Request, keys string, rows int) (Result, string, error) {
+	t.Helper()
+	var screen bytes.Buffer
+	term := Terminal{Keys: strings.NewReader(keys), Screen: &screen, Rows: rows}
+	res, err := Run(req, term)
+	return res, screen.String(), err
+}
+
+func TestRun(t *testing.T) {
+	var (
+		list       = Request{Kind: KindChoose, Items: []string{"alpha", "beta", "gamma"}}
+		question   = Request{Kind: KindConfirm}
+		yesDefault = Request{Kind: KindConfirm, Default: true}
+		line       = Request{Kind: KindInput}
+	)
+	for _, tc := range []struct {
+		name string
+		req  Request
+		keys string
+		want Result
+	}{
+		{name: "choose first", req: list, keys: "\r", want: Result{Value: "alpha"}},
+		{
+			name: "choose by arrows",
+			req:  list,
+			keys: "\x1b[B\x1b[B\x1b[B\x1b[A\r",
+			want: Result{Value: "beta", Index: 1},
+		},
+		{name: "choose by j and k", req: list, keys: "jjk\r", want: Result{Value: "beta", Index: 1}},
+		{
+			name: "choose by ctrl-n",
+			req:  list,
+			keys: "\x0e\x0e\r",
+			want: Result{Value: "gamma", Index: 2},
+		},
+		{name: "choose escaped", req: list, keys: "j\x1b", want: Result{Canceled: true}},
+		{name: "choose quit", req: list, keys: "q", want: Result{Canceled: true}},
+		{name: "confirm yes", req: question, keys: "y", want: Result{Value: "yes", Confirmed: true}},
+		{name: "confirm no", req: yesDefault, keys: "xN", want: Result{Value: "no"}},
+		{name: "confirm default no", req: question, keys: "\r", want: Result{Value: "no"}},
+		{
+			name: "confirm default yes",
+			req:  yesDefault,
+			keys: "\r",
+			want: Result{Value: "yes", Confirmed: true},
+		},
+		{name: "confirm ctrl-c", req: question, keys: "\x03", want: Result{Canceled: true}},
+		{name: "input", req: line, keys: "héllo\r", want: Result{Value: "héllo"}},
+		{
+			name: "input edited",
+			req:  Request{Kind: KindInput, Value: "ab"},
+			keys: "\x7fc\r",
+			want: Result{Value: "ac"},
+		},
+		{name: "input killed", req: line, keys: "abc\x15d\r", want: Result{Value: "d"}},
+		{name: "input ctrl-d with text", req: line, keys: "a\x04\r", want: Result{Value: "a"}},
+		{name: "input ctrl-d empty", req: line, keys: "\x04", want: Result{Canceled: true}},
+		{name: "input ignores arrows", req: line, keys: "a\x1b[Db\r", want: Result{Value: "ab"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := run(t, tc.req, tc.keys, 0)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Run = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRun_errors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		req     Request
+		keys    string
+		wantErr string
+	}{
+		{name: "unknown", req: Request{Kind: "dance"}, wantErr: `unknown widget "dance"`},
+		{name: "no items", req: Request{Kind: KindChoose}, wantErr: "nothing to choose from"},
+		{name: "keys end", req: Request{Kind: KindInput}, keys: "abc", wantErr: "closed before"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := run(t, tc.req, tc.keys, 0)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Run = %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// A list longer than the terminal scrolls: the prompt keeps its row, and the
+// cursor never leaves what is shown.
+func TestRun_chooseScrolls(t *testing.T) {
+	req := Request{Kind: KindChoose, Prompt: "pick", Items: []string{"a1", "a2", "a3", "a4", "a5"}}
+	res, screen, err := run(t, req, "jjj\r", 3)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Value != "a4" {
+		t.Fatalf("Run = %+v, want a4", res)
+	}
+	frames := strings.Split(screen, clearScreen)
+	// The last frame is the one cleared on the way out; the one before is the
+	// list as it was when Enter was pressed.
+	last := frames[len(frames)-2]
+	want := "pick" + newline + "  a3" + newline + reverse + "> a4" + plain
+	if last != want {
+		t.Errorf("last frame = %q, want %q", last, want)
+	}
+}
+
+// What is typed as a password is never drawn, and neither is a control sequence
+// smuggled in an item.
+func TestRun_drawsNothingItShouldNot(t *testing.T) {
+	_, screen, err := run(t, Request{Kind: KindInput, Prompt: "pin: ", Password: true}, "s3cret\r", 0)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.Contains(screen, "s3") {
+		t.Errorf("the password was drawn: %q", screen)
+	}
+
+	req := Request{Kind: KindChoose, Items: []string{"evil\x1b]0;title\x07"}}
+	_, screen, err = run(t, req, "\r", 0)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.Contains(screen, "\x1b]") || strings.Contains(screen, "\x07") {
+		t.Errorf("the item's control sequence was drawn: %q", screen)
+	}
+}
+
+func TestSize(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		req           Request
+		width, height int
+	}{
+		{
+			name:  "choose is as wide as its widest item, marker included",
+			req:   Request{Kind: KindChoose, Prompt: "pick:", Items: []string{"main", "release/1.0"}},
+			width: 13, height: 3,
+		},
+		{
+			name:  "choose is as wide as a prompt wider than its items",
+			req:   Request{Kind: KindChoose, Prompt: "check out which branch?", Items: []string{"a"}},
+			width: 23, height: 2,
+		},
+		{
+			name:  "an item is measured as drawn",
+			req:   Request{Kind: KindChoose, Items: []string{"\x1b[2Jé"}},
+			width: 6, height: 2,
+		},
+		{
+			name:  "confirm is its question, the choices and the answer",
+			req:   Request{Kind: KindConfirm, Prompt: "Push?"},
+			width: 15, height: 1,
+		},
+		{
+			name:  "input leaves room to type",
+			req:   Request{Kind: KindInput, Prompt: "name: ", Value: "abc"},
+			width: 49, height: 1,
+		},
+		{
+			name:  "a password's starting text is never drawn",
+			req:   Request{Kind: KindInput, Prompt: "token: ", Value: "secret", Password: true},
+			width: 47, height: 1,
+		},
+		{name: "an unknown widget draws nothing", req: Request{Kind: "slider"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			width, height := Size(tc.req)
+			if width != tc.width || height != tc.height {
+				t.Errorf("Size = %d x %d, want %d x %d", width, height, tc.width, tc.height)
+			}
+		})
+	}
+}
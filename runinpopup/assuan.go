@@ -2,34 +2,191 @@ package runinpopup
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
-// assuanTTYOption is the line gpg-agent sends to name the terminal pinentry
-// should draw on. Only this exact spelling is a match: Assuan commands are
-// case-sensitive and unindented, so a line that merely looks like it is one of
-// the payload's own and must reach pinentry untouched.
-const assuanTTYOption = "OPTION ttyname="
+// Assuan is the line protocol gpg-agent and pinentry speak: one command or
+// response a line, a verb and then its arguments, with '%', CR and LF inside an
+// argument percent-escaped so a line stays one line. Data travels in "D" lines,
+// a value split over as many as it takes and closed by "END" — which is also
+// how a pinentry's "INQUIRE" is answered, the one time gpg-agent sends data
+// rather than commands.
+//
+// Only what the proxy needs is coded here: the percent-escaping of an
+// argument, both ways, and enough of a line to tell a command from data and an
+// OPTION's name from its value. D lines are neither decoded nor encoded. The
+// relay only writes OPTIONs of its own, so a run of them is recognized, from
+// the first D to its END or CAN, and forwarded as it came, INQUIRE answers
+// included.
+
+// The verbs the relay tells apart. END and CAN close a run of D lines, the one
+// with the data complete and the other with it abandoned.
+const (
+	assuanVerbOption = "OPTION"
+	assuanVerbData   = "D"
+	assuanVerbEnd    = "END"
+	assuanVerbCancel = "CAN"
+)
+
+// assuanLine is one line split at its first space. Verbs are matched exactly:
+// Assuan verbs are upper-case and unindented, so a line that merely looks like
+// one is the payload's own and is left alone.
+type assuanLine struct {
+	verb string
+	// args is the rest of the line as sent, still escaped.
+	args string
+}
+
+func parseAssuanLine(line string) assuanLine {
+	verb, args, _ := strings.Cut(line, " ")
+	return assuanLine{verb: verb, args: args}
+}
+
+// assuanEscape percent-escapes what cannot appear in an Assuan argument as it
+// is: the escape character itself and the two that would end the line.
+func assuanEscape(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		switch c := s[i]; c {
+		case '%', '\r', '\n':
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// assuanUnescape reverses assuanEscape, decoding any %XX: a sender may escape
+// more than it has to.
+func assuanUnescape(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("assuan: truncated escape at the end of %q", s)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("assuan: malformed escape %q", s[i:i+3])
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// assuanOption is an OPTION command's argument: "name=value", "name value" or
+// a bare "name", any of them optionally spelled "--name".
+type assuanOption struct {
+	name string
+	// value is decoded; hasValue tells "name=" from a bare "name".
+	value    string
+	hasValue bool
+}
+
+// parseAssuanOption splits an OPTION's argument and decodes its value. A value
+// with a malformed escape is an error: what it was meant to say is anyone's
+// guess.
+func parseAssuanOption(args string) (assuanOption, error) {
+	args = strings.TrimPrefix(args, "--")
+	end := strings.IndexAny(args, "= ")
+	if end < 0 {
+		return assuanOption{name: args}, nil
+	}
+	value := strings.TrimLeft(args[end:], " ")
+	value, _ = strings.CutPrefix(value, "=")
+	value, err := assuanUnescape(strings.TrimLeft(value, " "))
+	if err != nil {
+		return assuanOption{}, err
+	}
+	return assuanOption{name: args[:end], value: value, hasValue: true}, nil
+}
+
+// assuanOptionLine is the OPTION command setting name to value.
+func assuanOptionLine(name, value string) string {
+	return assuanVerbOption + " " + name + "=" + assuanEscape(value)
+}
 
-// rewriteAssuanTTY copies the Assuan stream from r to w, replacing the terminal
-// gpg-agent named with tty.
+// popupTerminal is what a popup reports about the terminal it runs on: where
+// it is, and how a program drawing there has to talk to it. Only TTY is always
+// known; an empty field is one the popup had no value for.
+type popupTerminal struct {
+	TTY string
+	// Term is the popup's $TERM.
+	Term string
+	// LCCtype and LCMessages are the popup's character set and message locale,
+	// as the C library resolves them from $LC_ALL, $LC_CTYPE or $LC_MESSAGES,
+	// and $LANG.
+	LCCtype, LCMessages string
+}
+
+// options is the OPTION each of t's fields overrides, empty fields left out.
+func (t popupTerminal) options() map[string]string {
+	opts := map[string]string{}
+	for name, value := range map[string]string{
+		"ttyname":     t.TTY,
+		"ttytype":     t.Term,
+		"lc-ctype":    t.LCCtype,
+		"lc-messages": t.LCMessages,
+	} {
+		if value != "" {
+			opts[name] = value
+		}
+	}
+	return opts
+}
+
+// rewriteAssuanOptions copies the Assuan stream from r to w, replacing what
+// gpg-agent said about its terminal with what the popup reported about its own.
+//
+// gpg-agent describes whichever terminal it happened to inherit: its name, its
+// $TERM and its locale. The prompt belongs in the popup instead, and a popup in
+// another terminal emulator, or a multiplexer with a $TERM of its own, draws
+// garbage when pinentry believes the agent's. So each of the four OPTIONs
+// naming one of those is rewritten to the popup's value, when the popup
+// reported one and gpg-agent's, decoded, is another; an OPTION the popup had
+// nothing for, and every other line, is forwarded as it came. An OPTION with no
+// value at all is not one gpg-agent would send and is left alone too, as is
+// one whose value does not decode, which is no value to judge.
+//
+// Data is never read as commands. pinentry asks for it with an INQUIRE on its
+// output, which the relay does not see, and gpg-agent answers on the stream the
+// relay does: D lines, closed by END or CAN. From the first D line to the line
+// closing the run, everything is forwarded as it came, whatever it looks like.
 //
-// gpg-agent names whichever terminal it happened to inherit; the prompt belongs
-// in the popup instead, and this one line is the whole difference between the
-// two. Everything else is forwarded as it came, except that line endings are
-// normalized to "\n" — the scan strips a "\r" a sender may add, and pinentry
-// wants the line without it.
+// Line endings are normalized to "\n": the scan strips a "\r" a sender may add,
+// and pinentry wants the line without it.
 //
 // It returns nil when the stream ends, and otherwise the error that ended it:
 // the reader's, the writer's, or [io.ErrClosedPipe] when the caller closed r to
 // end the relay.
-func rewriteAssuanTTY(r io.Reader, w io.Writer, tty string) error {
+func rewriteAssuanOptions(r io.Reader, w io.Writer, term popupTerminal) error {
+	overrides := term.options()
+	inData := false
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, assuanTTYOption) {
-			line = assuanTTYOption + tty
+		switch l := parseAssuanLine(line); {
+		case l.verb == assuanVerbData:
+			inData = true
+		case inData:
+			inData = l.verb != assuanVerbEnd && l.verb != assuanVerbCancel
+		case l.verb == assuanVerbOption:
+			opt, err := parseAssuanOption(l.args)
+			if value, ok := overrides[opt.name]; err == nil && ok && opt.hasValue &&
+				value != opt.value {
+				line = assuanOptionLine(opt.name, value)
+			}
 		}
 		if _, err := w.Write([]byte(line + "\n")); err != nil {
 			return err
@@ -9,10 +9,14 @@ import (
 	"testing"
 )
 
+// ttyOnly is a popup that reported its tty and nothing else about its terminal,
+// the way a payload announcing only "$(tty)" does.
+var ttyOnly = popupTerminal{TTY: popupTTY}
+
 // The transcripts are pinned byte for byte: what this produces is the exact
 // stream a pinentry child reads, and gpg-agent's half of the protocol is not
 // ours to reinterpret.
-func TestRewriteAssuanTTY(t *testing.T) {
+func TestRewriteAssuanOptions(t *testing.T) {
 	for _, tc := range []struct {
 		name string
 		in   string
@@ -35,6 +39,18 @@ func TestRewriteAssuanTTY(t *testing.T) {
 			want: "OPTION ttyname\n OPTION ttyname=/dev/pts/9\noption ttyname=/dev/pts/9\n" +
 				"OPTION ttynameX=/dev/pts/9\nSETPROMPT PIN:\n\nD  padded  data \nBYE\n",
 		},
+		{
+			name: "an escaped value is compared decoded",
+			in:   "OPTION ttyname=%2Fdev%2Fpts%2F42\nOPTION ttyname=/dev/pts/9%\n",
+			want: "OPTION ttyname=%2Fdev%2Fpts%2F42\nOPTION ttyname=/dev/pts/9%\n",
+		},
+		{
+			name: "data is no command until its run is closed",
+			in: "D OPTION ttyname=/dev/pts/9\nOPTION ttyname=/dev/pts/9\nEND\n" +
+				"OPTION ttyname=/dev/pts/9\nD x\nCAN\nOPTION ttyname=/dev/pts/9\n",
+			want: "D OPTION ttyname=/dev/pts/9\nOPTION ttyname=/dev/pts/9\nEND\n" +
+				"OPTION ttyname=" + popupTTY + "\nD x\nCAN\nOPTION ttyname=" + popupTTY + "\n",
+		},
 		{
 			name: "a crlf line ending is normalized",
 			in:   "OPTION grab\r\nBYE\r\n",
@@ -53,8 +69,8 @@ func TestRewriteAssuanTTY(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var out bytes.Buffer
-			if err := rewriteAssuanTTY(strings.NewReader(tc.in), &out, popupTTY); err != nil {
-				t.Fatalf("rewriteAssuanTTY: %v", err)
+			if err := rewriteAssuanOptions(strings.NewReader(tc.in), &out, ttyOnly); err != nil {
+				t.Fatalf("rewriteAssuanOptions: %v", err)
 			}
 			if got := out.String(); got != tc.want {
 				t.Errorf("forwarded:\n%q\nwant:\n%q", got, tc.want)
@@ -66,13 +82,13 @@ func TestRewriteAssuanTTY(t *testing.T) {
 // A line longer than the scanner's buffer is not a line pinentry could act on,
 // and guessing where to split it would invent a command nobody sent: the relay
 // ends instead, with what came before it already delivered.
-func TestRewriteAssuanTTY_overlongLine(t *testing.T) {
+func TestRewriteAssuanOptions_overlongLine(t *testing.T) {
 	var out bytes.Buffer
 	in := strings.NewReader(
 		"GETPIN\n" + strings.Repeat("D", bufio.MaxScanTokenSize+1) + "\nBYE\n",
 	)
 
-	err := rewriteAssuanTTY(in, &out, popupTTY)
+	err := rewriteAssuanOptions(in, &out, ttyOnly)
 
 	if !errors.Is(err, bufio.ErrTooLong) {
 		t.Fatalf("err = %v, want the overlong line reported", err)
@@ -82,14 +98,14 @@ func TestRewriteAssuanTTY_overlongLine(t *testing.T) {
 	}
 }
 
-func TestRewriteAssuanTTY_readFailure(t *testing.T) {
+func TestRewriteAssuanOptions_readFailure(t *testing.T) {
 	readErr := errors.New("the assuan input went away")
 	var out bytes.Buffer
 
-	err := rewriteAssuanTTY(
+	err := rewriteAssuanOptions(
 		io.MultiReader(strings.NewReader("GETPIN\n"), errReader{readErr}),
 		&out,
-		popupTTY,
+		ttyOnly,
 	)
 
 	if !errors.Is(err, readErr) {
@@ -100,13 +116,13 @@ func TestRewriteAssuanTTY_readFailure(t *testing.T) {
 	}
 }
 
-func TestRewriteAssuanTTY_writeFailure(t *testing.T) {
+func TestRewriteAssuanOptions_writeFailure(t *testing.T) {
 	writeErr := errors.New("pinentry is gone")
 
-	err := rewriteAssuanTTY(
+	err := rewriteAssuanOptions(
 		strings.NewReader("OPTION ttyname=/dev/pts/9\nBYE\n"),
 		errWriter{writeErr},
-		popupTTY,
+		ttyOnly,
 	)
 
 	if !errors.Is(err, writeErr) {
@@ -114,6 +130,143 @@ func TestRewriteAssuanTTY_writeFailure(t *testing.T) {
 	}
 }
 
+// Each option the popup reported a value for is the popup's; the ones it had
+// nothing for stay gpg-agent's, in whichever spelling gpg-agent used.
+func TestRewriteAssuanOptions_terminal(t *testing.T) {
+	term := popupTerminal{
+		TTY:        popupTTY,
+		Term:       "tmux-256color",
+		LCCtype:    "ja_JP.UTF-8",
+		LCMessages: "",
+	}
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "everything gpg-agent describes its terminal with",
+			in: "OPTION ttyname=/dev/pts/9\nOPTION ttytype=xterm\n" +
+				"OPTION lc-ctype=C\nOPTION lc-messages=de_DE.UTF-8\nGETPIN\n",
+			want: "OPTION ttyname=" + popupTTY + "\nOPTION ttytype=tmux-256color\n" +
+				"OPTION lc-ctype=ja_JP.UTF-8\nOPTION lc-messages=de_DE.UTF-8\nGETPIN\n",
+		},
+		{
+			name: "the other spellings of an option",
+			in:   "OPTION --ttytype=xterm\nOPTION ttyname /dev/pts/9\nOPTION lc-ctype = C\n",
+			want: "OPTION ttytype=tmux-256color\nOPTION ttyname=" + popupTTY +
+				"\nOPTION lc-ctype=ja_JP.UTF-8\n",
+		},
+		{
+			name: "options that say nothing about the terminal",
+			in:   "OPTION display=:0\nOPTION allow-external-password-cache\n",
+			want: "OPTION display=:0\nOPTION allow-external-password-cache\n",
+		},
+		{
+			name: "data lines answering an inquiry",
+			in:   "D OPTION ttytype=xterm\nEND\n",
+			want: "D OPTION ttytype=xterm\nEND\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := rewriteAssuanOptions(strings.NewReader(tc.in), &out, term); err != nil {
+				t.Fatalf("rewriteAssuanOptions: %v", err)
+			}
+			if got := out.String(); got != tc.want {
+				t.Errorf("forwarded:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+// A value the popup reported is escaped on the way in, so nothing it contains
+// can end the OPTION line and start a command of its own.
+func TestRewriteAssuanOptions_escapesTheValue(t *testing.T) {
+	var out bytes.Buffer
+	term := popupTerminal{TTY: popupTTY, Term: "100%\rGETPIN"}
+	err := rewriteAssuanOptions(strings.NewReader("OPTION ttytype=xterm\n"), &out, term)
+	if err != nil {
+		t.Fatalf("rewriteAssuanOptions: %v", err)
+	}
+	if got, want := out.String(), "OPTION ttytype=100%25%0DGETPIN\n"; got != want {
+		t.Errorf("forwarded %q, want %q", got, want)
+	}
+}
+
+func TestAssuanEscape(t *testing.T) {
+	for _, tc := range []struct {
+		raw, escaped string
+	}{
+		{raw: "", escaped: ""},
+		{raw: "plain text", escaped: "plain text"},
+		{raw: "100%", escaped: "100%25"},
+		{raw: "two\r\nlines", escaped: "two%0D%0Alines"},
+		{raw: "ünïcode", escaped: "ünïcode"},
+	} {
+		if got := assuanEscape(tc.raw); got != tc.escaped {
+			t.Errorf("assuanEscape(%q) = %q, want %q", tc.raw, got, tc.escaped)
+		}
+		got, err := assuanUnescape(tc.escaped)
+		if err != nil || got != tc.raw {
+			t.Errorf("assuanUnescape(%q) = %q, %v; want %q", tc.escaped, got, err, tc.raw)
+		}
+	}
+}
+
+func TestAssuanUnescape(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "over%2Descaped", want: "over-escaped"},
+		{in: "lower%0acase", want: "lower\ncase"},
+		{in: "%", wantErr: true},
+		{in: "ends%2", wantErr: true},
+		{in: "not%zzhex", wantErr: true},
+	} {
+		got, err := assuanUnescape(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("assuanUnescape(%q) = %q, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("assuanUnescape(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseAssuanOption(t *testing.T) {
+	for _, tc := range []struct {
+		args    string
+		want    assuanOption
+		wantErr bool
+	}{
+		{args: "ttyname=/dev/pts/1", want: assuanOption{"ttyname", "/dev/pts/1", true}},
+		{args: "ttyname /dev/pts/1", want: assuanOption{"ttyname", "/dev/pts/1", true}},
+		{args: "ttyname = /dev/pts/1", want: assuanOption{"ttyname", "/dev/pts/1", true}},
+		{args: "--ttyname=/dev/pts/1", want: assuanOption{"ttyname", "/dev/pts/1", true}},
+		{args: "ttyname=", want: assuanOption{"ttyname", "", true}},
+		{args: "grab", want: assuanOption{"grab", "", false}},
+		{args: "display=:0=x", want: assuanOption{"display", ":0=x", true}},
+		{args: "ttytype=xterm%2D256color", want: assuanOption{"ttytype", "xterm-256color", true}},
+		{args: "ttytype=xterm%2", wantErr: true},
+	} {
+		got, err := parseAssuanOption(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseAssuanOption(%q) = %+v, want an error", tc.args, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("parseAssuanOption(%q) = %+v, %v; want %+v", tc.args, got, err, tc.want)
+		}
+	}
+}
+
 type errReader struct{ err error }
 
 func (r errReader) Read([]byte) (int, error) { return 0, r.err }
@@ -26,11 +26,12 @@ type PopupSpec struct {
 	// X and Y are the popup's top-left corner on every backend. Backends whose
 	// mechanism says the same thing get the values as they were written; tmux's
 	// display-popup, which places a popup by its bottom edge instead, has the
-	// height added to Y on its way to the command line. That translation needs a
-	// height to add: on the tmux-popup backend a numeric or percentage Y with no
-	// Height, or with a Height in the other unit, fails the launch rather than
-	// putting the popup somewhere the caller did not ask for. Either way tmux
-	// still clamps a popup that would fall outside the terminal.
+	// height added to Y on its way to the command line. Y and Height in one unit
+	// add up as they are; in different ones, or with no Height, the tmux-popup
+	// backend resolves both to cells against the size of the client the popup
+	// opens on, and only a client it could not measure fails the launch rather
+	// than putting the popup somewhere the caller did not ask for. Either way
+	// tmux still clamps a popup that would fall outside the terminal.
 	//
 	// X and Y additionally take tmux's single-letter position specifiers, which
 	// reach tmux untranslated:
@@ -43,13 +44,30 @@ type PopupSpec struct {
 	//	S  the line above or below the status line (Y only)
 	//
 	// Which axis a specifier suits is tmux's own rule and tmux's to enforce: all
-	// six are accepted here for both. zellij has no equivalent for any of them —
-	// its backend refuses a specifier rather than guessing at one — while cells
-	// and percentages reach every backend.
+	// six are accepted here for both. zellij has no specifiers of its own: its
+	// backend works out where C, R (X only) and S (Y only, the bottom edge) put a
+	// pane of the requested size, and refuses the rest rather than guessing at
+	// them, while cells and percentages reach every backend that places a popup.
+	//
+	// Width and Height additionally take SizeFit, which sizes the popup to its
+	// content: see SizeHint.
 	//
 	// A malformed value fails the launch before a popup is opened, so a typo
 	// costs nothing but the error naming it.
 	X, Y, Width, Height string
+	// Anchor places the popup by name instead of by X and Y: one of the nine
+	// compass points top-left, top, top-right, left, center, right, bottom-left,
+	// bottom and bottom-right. Margin keeps it that far from the edges the anchor
+	// puts it against, in cells or "N%" of the terminal along each axis, and is
+	// not applied along an axis it is centred on.
+	//
+	// An anchor means the same on every backend that places a popup: each works
+	// out the corner from the size of what the popup is placed on, which it
+	// measures, and from Width and Height — half the terminal along an axis left
+	// unsized, the size the popup is then given. It is an alternative to X and
+	// Y, not an addition: a spec setting both, or a Margin with no Anchor, fails
+	// the launch as malformed.
+	Anchor, Margin string
 	// Command is the argv executed inside the popup. Backends whose popup
 	// mechanism only accepts a shell command line quote and join it.
 	Command []string
@@ -58,6 +76,19 @@ type PopupSpec struct {
 	// precedence over Command; backends that run argv directly wrap it in a
 	// shell.
 	Script string
+	// SizeHint reports the size, in cells, of what the payload shows, for a
+	// Width or Height of SizeFit; the launch adds the popup's frame and clamps
+	// the result to PopupLauncher.Fit. A caller that knows what its payload
+	// will draw — the widgets do, from the request they send — says so here.
+	//
+	// nil asks the payload itself. It is run once before the popup is opened,
+	// headless: no terminal, stdin at its end, its output discarded and EnvFit
+	// naming a FIFO it writes "<width> <height>" to and exits. Whatever it
+	// still does after reporting is cut short. A payload that exits without
+	// reporting fails the launch, as does one that does not report within the
+	// launcher's StartupTimeout, so only a payload written to be sized to fit
+	// should be asked to be.
+	SizeHint func(ctx context.Context) (width, height int, err error)
 }
 
 // LaunchSpec is what a backend opens a popup for: one completed launch, built
@@ -65,15 +96,17 @@ type PopupSpec struct {
 // whatever attaches the payload's streams is already in it — so a backend
 // translates it into its mechanism's argv and starts it, nothing else.
 type LaunchSpec struct {
-	// Title, Env, X, Y, Width, Height, Command and Script carry the same meaning
-	// as their PopupSpec counterparts. Each value has been validated on its own by
-	// the time a backend sees it, so what is left is what only the backend knows:
+	// Title, Env, X, Y, Width, Height, Anchor, Margin, Command and Script carry
+	// the same meaning as their PopupSpec counterparts. Each value has been
+	// validated on its own by the time a backend sees it, so what is left is
+	// what only the backend knows:
 	// translating the geometry into its mechanism's flags and coordinates, or
 	// refusing what that mechanism cannot be asked for — a value it has no
 	// equivalent for, or a combination it cannot place.
 	Title               string
 	Env                 map[string]string
 	X, Y, Width, Height string
+	Anchor, Margin      string
 	Command             []string
 	Script              string
 
@@ -163,11 +196,16 @@ type Backend interface {
 	// moment the pane exists — restore can well run while the popup still
 	// lives, so an implementation must tolerate that. Both may be no-ops: a nil
 	// restore means "nothing to undo", and is the normal result for backends
-	// that need no adjustment.
+	// that need no adjustment. ctx carries the launcher's logger, for an
+	// adjustment worth telling the user about; contextkey.ValueSlogLoggerFallback
+	// retrieves it.
 	//
-	// tmux-floating-pane is the one implementation: it works around the tmux 3.7b
-	// crash on creating a floating pane while a pane is zoomed, under the
-	// contract fixed for it before it was written:
+	// tmux-popup checks that the client it was told to open on is still attached,
+	// and moves to another of the session's when it is not.
+	//
+	// tmux-floating-pane works around the tmux 3.7b crash on creating a floating
+	// pane while a pane is zoomed, under the contract fixed for it before it was
+	// written:
 	//   - Version-gated: de-zoom only on tmux versions affected by the bug
 	//     (< 3.7c). An unparseable version counts as affected — a spurious
 	//     de-zoom is flicker, a missed one takes down the tmux server.
@@ -178,3 +216,21 @@ type Backend interface {
 	//     failing the run.
 	Prepare(ctx context.Context) (restore func(context.Context) error, err error)
 }
+
+// BackendNames lists every backend name, in the order reported to users. The
+// list lives here rather than in the backend package, which imports this one,
+// so that LoadConfig can check a preset's backend without building it;
+// backend.Names returns it, and backend.New builds each.
+func BackendNames() []string {
+	return []string{
+		"tmux-popup",
+		"tmux-floating-pane",
+		"zellij",
+		"screen",
+		"nvim",
+		"wezterm",
+		"kitty",
+		"kitty-os-window",
+		"pty",
+	}
+}
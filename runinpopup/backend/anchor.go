@@ -0,0 +1,46 @@
+package backend
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
+)
+
+// anchorDefaultSize is the size an anchored popup is given along an axis it
+// was not sized on: half, the default of display-popup and of zellij alike.
+// The popup is placed at that size, so it is handed the size it was placed at
+// rather than left to a mechanism whose own default might be another.
+const anchorDefaultSize = "50%"
+
+// anchored resolves spec's Anchor and Margin against a surface cols by rows
+// cells — whatever the backend places a popup on — into the X, Y, Width and
+// Height it means there, all in cells, and clears them; a spec with no Anchor
+// comes back as it was. name is the backend, for the error.
+func anchored(
+	name string,
+	spec runinpopup.LaunchSpec,
+	cols, rows int,
+) (runinpopup.LaunchSpec, error) {
+	if spec.Anchor == "" {
+		return spec, nil
+	}
+	width, okW := geometry.Resolve(cmp.Or(spec.Width, anchorDefaultSize), cols)
+	height, okH := geometry.Resolve(cmp.Or(spec.Height, anchorDefaultSize), rows)
+	if !okW || !okH {
+		return spec, fmt.Errorf(
+			"backend %s: anchor %q: Width %q and Height %q must be cells or percentages",
+			name, spec.Anchor, spec.Width, spec.Height,
+		)
+	}
+	x, y, err := geometry.Place(spec.Anchor, spec.Margin, width, height, cols, rows)
+	if err != nil {
+		return spec, fmt.Errorf("backend %s: %w", name, err)
+	}
+	spec.X, spec.Y = strconv.Itoa(x), strconv.Itoa(y)
+	spec.Width, spec.Height = strconv.Itoa(width), strconv.Itoa(height)
+	spec.Anchor, spec.Margin = "", ""
+	return spec, nil
+}
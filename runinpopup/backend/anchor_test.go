@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+)
+
+// An anchor comes out as the four values every placing mechanism takes, all in
+// cells and the size included, so no mechanism's default size can undo the
+// placement worked out for another.
+func TestAnchored(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    runinpopup.LaunchSpec
+		want    [4]string
+		wantErr string
+	}{
+		{
+			name: "cells",
+			spec: runinpopup.LaunchSpec{Anchor: "bottom-right", Width: "60", Height: "20"},
+			want: [4]string{"140", "30", "60", "20"},
+		},
+		{
+			name: "percentages and a margin",
+			spec: runinpopup.LaunchSpec{
+				Anchor: "top-left", Margin: "10%", Width: "50%", Height: "20%",
+			},
+			want: [4]string{"20", "5", "100", "10"},
+		},
+		{
+			name: "unsized is half",
+			spec: runinpopup.LaunchSpec{Anchor: "bottom"},
+			want: [4]string{"50", "25", "100", "25"},
+		},
+		{
+			name:    "a margin that is no distance",
+			spec:    runinpopup.LaunchSpec{Anchor: "top", Margin: "C"},
+			wantErr: `Margin "C"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := anchored(NameZellij, tc.spec, 200, 50)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("anchored = %v, want an error containing %q", err, tc.wantErr)
+				}
+				if !strings.Contains(err.Error(), NameZellij) {
+					t.Errorf("err = %v, want the backend named in it", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("anchored: %v", err)
+			}
+			if g := [4]string{got.X, got.Y, got.Width, got.Height}; g != tc.want {
+				t.Errorf("geometry = %q, want %q", g, tc.want)
+			}
+			if got.Anchor != "" || got.Margin != "" {
+				t.Errorf("Anchor, Margin = %q, %q, want both resolved away", got.Anchor, got.Margin)
+			}
+		})
+	}
+
+	spec := runinpopup.LaunchSpec{X: "C", Height: "20"}
+	if got, err := anchored(NameZellij, spec, 200, 50); err != nil || got.X != "C" ||
+		got.Height != "20" || got.Width != "" {
+		t.Errorf("anchored without an anchor = %+v, %v; want the spec as it was", got, err)
+	}
+}
@@ -18,11 +18,23 @@ type Options struct {
 	SessionId string
 	// ClientId identifies the tmux client on which to display a popup.
 	ClientId string
-	// SessionMeta is the $TMUX value supplied by PINENTRY_USER_DATA.
+	// SessionMeta is the $TMUX value supplied by PINENTRY_USER_DATA — or, for
+	// wezterm, its $WEZTERM_UNIX_SOCKET, for kitty its $KITTY_LISTEN_ON, for
+	// screen its $SCREENDIR, and for nvim the server address, its $NVIM.
 	SessionMeta string
 	// TMUX is the caller's current $TMUX value.
 	TMUX string
-	// Shell runs payloads for backends requiring a shell. Empty means "sh".
+	// STY is the caller's current $STY value, GNU screen's session name.
+	STY string
+	// NVIM is the caller's current $NVIM value, the server address of the
+	// Neovim whose terminal the caller runs in.
+	NVIM string
+	// WeztermPane is the caller's current $WEZTERM_PANE value.
+	WeztermPane string
+	// KittyWindowId is the caller's current $KITTY_WINDOW_ID value.
+	KittyWindowId string
+	// Shell runs payloads for backends requiring a shell. Empty means "sh", or
+	// "/bin/sh" for pty.
 	Shell string
 }
 
@@ -32,6 +44,12 @@ const (
 	NameTmuxPopup        = "tmux-popup"
 	NameTmuxFloatingPane = "tmux-floating-pane"
 	NameZellij           = "zellij"
+	NameScreen           = "screen"
+	NameNvim             = "nvim"
+	NameWezterm          = "wezterm"
+	NameKitty            = "kitty"
+	NameKittyOSWindow    = "kitty-os-window"
+	NamePty              = "pty"
 )
 
 // New builds the named backend.
@@ -43,6 +61,18 @@ func New(name string, opts Options) (runinpopup.Backend, error) {
 		return NewTmuxFloatingPane(opts)
 	case NameZellij:
 		return NewZellij(opts)
+	case NameScreen:
+		return NewScreen(opts)
+	case NameNvim:
+		return NewNvim(opts)
+	case NameWezterm:
+		return NewWezterm(opts)
+	case NameKitty:
+		return NewKitty(opts)
+	case NameKittyOSWindow:
+		return NewKittyOSWindow(opts)
+	case NamePty:
+		return NewPty(opts)
 	default:
 		return nil, fmt.Errorf(
 			"unknown popup backend %q: valid values are %s",
@@ -51,42 +81,114 @@ func New(name string, opts Options) (runinpopup.Backend, error) {
 	}
 }
 
-// Names lists every name accepted by New, in the order reported to users.
+// Names lists every name accepted by New, in the order reported to users. It
+// is runinpopup.BackendNames, which the config checks presets against.
 func Names() []string {
-	return []string{NameTmuxPopup, NameTmuxFloatingPane, NameZellij}
+	return runinpopup.BackendNames()
+}
+
+// userDataKinds pairs each backend with the PINENTRY_USER_DATA kind that
+// selects it. pty has none: it opens on no multiplexer a wrapper could name.
+var userDataKinds = []struct{ name, kind string }{
+	{NameTmuxPopup, "TMUX_POPUP"},
+	{NameTmuxFloatingPane, "TMUX_FLOATING_PANE"},
+	{NameZellij, "ZELLIJ_POPUP"},
+	{NameScreen, "SCREEN_POPUP"},
+	{NameNvim, "NVIM_POPUP"},
+	{NameWezterm, "WEZTERM_POPUP"},
+	{NameKitty, "KITTY_POPUP"},
+	{NameKittyOSWindow, "KITTY_OS_WINDOW"},
+}
+
+// UserDataKinds lists every PINENTRY_USER_DATA kind DetectName recognises, in
+// the order of Names. A wrapper script matching on them is built from this
+// list so it cannot fall behind a new backend.
+func UserDataKinds() []string {
+	kinds := make([]string, len(userDataKinds))
+	for i, k := range userDataKinds {
+		kinds[i] = k.kind
+	}
+	return kinds
+}
+
+// UserDataKind is the PINENTRY_USER_DATA kind selecting the named backend, or
+// "" for a backend no kind selects.
+func UserDataKind(name string) string {
+	for _, k := range userDataKinds {
+		if k.name == name {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// Hints are the ambient values DetectName picks a backend from. The caller
+// reads them — from the environment, a flag, a test fixture — and detection
+// itself stays pure. They travel as one struct rather than one argument each:
+// they are same-typed neighbours, and a pair of them swapped at a call site
+// would compile and detect the wrong multiplexer.
+type Hints struct {
+	// UserDataKind is runinpopup.PinentryUserData.Kind.
+	UserDataKind string
+	// TMUX is $TMUX.
+	TMUX string
+	// Zellij is $ZELLIJ.
+	Zellij string
+	// STY is $STY.
+	STY string
+	// NVIM is $NVIM.
+	NVIM string
+	// WeztermPane is $WEZTERM_PANE.
+	WeztermPane string
+	// KittyWindowId is $KITTY_WINDOW_ID.
+	KittyWindowId string
 }
 
 // DetectName picks a backend name from ambient hints, for callers that
-// were not told which backend to use. Every hint is passed in — the caller
-// reads the environment, the detection itself stays pure:
+// were not told which backend to use:
 //
-//   - userDataKind is runinpopup.PinentryUserData.Kind, the most specific hint
-//     since the gpg-agent wrapper script picked it deliberately. A "_DEBUG"
-//     suffix does not change the mechanism, so the kind is matched by prefix.
-//   - tmuxEnv is $TMUX and zellijEnv is $ZELLIJ, checked in that order. A bare
-//     $TMUX names the multiplexer, not one of its two popup mechanisms, and
-//     resolves to NameTmuxPopup: display-popup is the older, unconditionally
-//     safe one, so floating panes stay an explicit choice.
+//   - UserDataKind is the most specific hint, since the gpg-agent wrapper
+//     script picked it deliberately. A "_DEBUG" suffix does not change the
+//     mechanism, so the kind is matched by prefix.
+//   - TMUX, Zellij, STY, NVIM, WeztermPane and KittyWindowId are checked in
+//     that order. A bare $TMUX names the multiplexer, not one of its two popup
+//     mechanisms, and resolves to NameTmuxPopup: display-popup is the older,
+//     unconditionally safe one, so floating panes stay an explicit choice.
+//     WezTerm and kitty come last because they are terminals: their variables
+//     are inherited by a multiplexer running inside them, and the
+//     multiplexer nearest the caller is the one whose popup the user would be
+//     looking at. kitty's variable likewise resolves to its overlay, the
+//     OS-window variant staying an explicit choice. NVIM is the exception to
+//     nearest-wins: it is set only inside Neovim's own terminals, but a
+//     multiplexer hosting the editor is what such a caller was always given, and
+//     its popup still works there; Neovim's float is asked for by kind.
 //
 // It returns an error naming the valid backends when nothing matches.
-func DetectName(userDataKind, tmuxEnv, zellijEnv string) (string, error) {
-	switch kind := strings.ToUpper(strings.TrimSpace(userDataKind)); {
-	case strings.HasPrefix(kind, "TMUX_POPUP"):
-		return NameTmuxPopup, nil
-	case strings.HasPrefix(kind, "TMUX_FLOATING_PANE"):
-		return NameTmuxFloatingPane, nil
-	case strings.HasPrefix(kind, "ZELLIJ_POPUP"):
-		return NameZellij, nil
+func DetectName(hints Hints) (string, error) {
+	kind := strings.ToUpper(strings.TrimSpace(hints.UserDataKind))
+	for _, k := range userDataKinds {
+		if strings.HasPrefix(kind, k.kind) {
+			return k.name, nil
+		}
 	}
 	switch {
-	case tmuxEnv != "":
+	case hints.TMUX != "":
 		return NameTmuxPopup, nil
-	case zellijEnv != "":
+	case hints.Zellij != "":
 		return NameZellij, nil
+	case hints.STY != "":
+		return NameScreen, nil
+	case hints.NVIM != "":
+		return NameNvim, nil
+	case hints.WeztermPane != "":
+		return NameWezterm, nil
+	case hints.KittyWindowId != "":
+		return NameKitty, nil
 	}
 	return "", fmt.Errorf(
 		"cannot detect the popup backend:"+
-			" neither PINENTRY_USER_DATA, $TMUX nor $ZELLIJ names one;"+
+			" neither PINENTRY_USER_DATA, $TMUX, $ZELLIJ, $STY, $NVIM, $WEZTERM_PANE"+
+			" nor $KITTY_WINDOW_ID names one;"+
 			" select it explicitly, valid values are %s",
 		strings.Join(Names(), ", "),
 	)
@@ -1,12 +1,19 @@
 package backend
 
 import (
+	"bytes"
+	"log/slog"
+	"maps"
+	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
 
+	"github.com/ngicks/go-common/contextkey"
+
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
 )
 
 func tmuxBackend(t *testing.T) *TmuxPopup {
@@ -49,6 +56,19 @@ func zellijBackend(t *testing.T) *Zellij {
 	return b
 }
 
+func weztermBackend(t *testing.T, paneId string) *Wezterm {
+	t.Helper()
+	b, err := NewWezterm(Options{
+		BinaryPath: "/usr/bin/wezterm",
+		SessionId:  paneId,
+		Shell:      "/bin/bash",
+	})
+	if err != nil {
+		t.Fatalf("NewWezterm: %v", err)
+	}
+	return b
+}
+
 func assertCommand(
 	t *testing.T,
 	gotPath string,
@@ -75,6 +95,8 @@ func launchSpec(spec runinpopup.PopupSpec) runinpopup.LaunchSpec {
 		Y:       spec.Y,
 		Width:   spec.Width,
 		Height:  spec.Height,
+		Anchor:  spec.Anchor,
+		Margin:  spec.Margin,
 		Command: spec.Command,
 		Script:  spec.Script,
 	}
@@ -103,8 +125,7 @@ func TestTmuxPopup_Launch_ttyHandshake(t *testing.T) {
 		"-c", "%1",
 		"-e", "DONE_FIFO_FILE=/tmp/popup/done",
 		"-e", "TTY_FIFO_FILE=/tmp/popup/tty",
-		"-E", "echo $(tty) >> ${TTY_FIFO_FILE}" +
-			" && read done < ${DONE_FIFO_FILE}",
+		"-E", runinpopup.TTYHandshakeScript("${TTY_FIFO_FILE}", "${DONE_FIFO_FILE}"),
 	})
 }
 
@@ -185,7 +206,8 @@ func TestTmuxPopup_Launch_geometry(t *testing.T) {
 
 // Adding a height to Y is the only way display-popup can be asked for a top
 // edge, so a Y that names one without a height to add — or with a height
-// measured in the other unit — is refused rather than placed at a guess.
+// measured in the other unit — is refused rather than placed at a guess when
+// the client's size was never found out to resolve them by.
 func TestTmuxPopup_Launch_yNeedsAMatchingHeight(t *testing.T) {
 	for _, tc := range []struct {
 		name string
@@ -222,6 +244,146 @@ func TestTmuxPopup_Launch_yNeedsAMatchingHeight(t *testing.T) {
 	}
 }
 
+// With the client's size in hand any two units add up: both are resolved to
+// cells, a percentage rounded down as tmux rounds it, so the top edge lands on
+// the row Y names for the height tmux will give the popup.
+func TestTmuxPopup_Launch_mixedUnits(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		spec  runinpopup.PopupSpec
+		wantY string
+	}{
+		{
+			name:  "cells against a percentage",
+			spec:  runinpopup.PopupSpec{Y: "10", Height: "40%"},
+			wantY: "30",
+		},
+		{
+			name:  "a percentage against cells",
+			spec:  runinpopup.PopupSpec{Y: "10%", Height: "20"},
+			wantY: "25",
+		},
+		{
+			name:  "rounded down",
+			spec:  runinpopup.PopupSpec{Y: "10", Height: "15%"},
+			wantY: "17",
+		},
+		{
+			// Half the terminal, as display-popup sizes a popup it is given no height.
+			name:  "display-popup's own height",
+			spec:  runinpopup.PopupSpec{Y: "10"},
+			wantY: "35",
+		},
+		{
+			name:  "a percentage at display-popup's own height",
+			spec:  runinpopup.PopupSpec{Y: "50%"},
+			wantY: "50",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := tmuxBackend(t)
+			b.rows = 51
+			tc.spec.Command = []string{"htop"}
+
+			req, err := b.popupRequest(launchSpec(tc.spec))
+			if err != nil {
+				t.Fatalf("popupRequest: %v", err)
+			}
+			if req.Y != tc.wantY {
+				t.Errorf("-y = %q, want %q", req.Y, tc.wantY)
+			}
+			if req.Height != tc.spec.Height {
+				t.Errorf("-h = %q, want it passed on as %q", req.Height, tc.spec.Height)
+			}
+		})
+	}
+}
+
+// An anchor is placed against the client Prepare measured and reaches
+// display-popup as the cells it resolved to, the bottom edge included; with no
+// measurement there is nothing to place it by.
+func TestTmuxPopup_Launch_anchor(t *testing.T) {
+	spec := runinpopup.PopupSpec{
+		Anchor: "top-right", Margin: "2", Width: "60", Height: "20",
+		Command: []string{"htop"},
+	}
+
+	b := tmuxBackend(t)
+	b.cols, b.rows = 200, 50
+	req, err := b.popupRequest(launchSpec(spec))
+	if err != nil {
+		t.Fatalf("popupRequest: %v", err)
+	}
+	path, args := b.tmux.PopupCommand(req)
+	assertCommand(t, path, args, "/usr/bin/tmux", []string{
+		"popup", "-c", "%1",
+		"-x", "138", "-y", "22", "-w", "60", "-h", "20",
+		"-E", `'htop'`,
+	})
+
+	_, err = tmuxBackend(t).popupRequest(launchSpec(spec))
+	if err == nil || !strings.Contains(err.Error(), "needs the client's size") {
+		t.Errorf("popupRequest = %v, want the missing measurement named", err)
+	}
+}
+
+// Prepare measures the client the popup opens on; a measurement that failed
+// fails only a launch that needed it, and that launch says why.
+func TestTmuxPopup_Prepare_clientSize(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		size    string
+		wantY   string
+		wantErr string
+	}{
+		{name: "measured", size: `printf '200\t50\n'`, wantY: "30"},
+		{name: "unmeasured", size: `echo "no such client" >&2; exit 1`, wantErr: "no such client"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tmux")
+			body := "#!/bin/sh\n" +
+				`[ "$1" = list-clients ] &&` +
+				` { printf '/dev/pts/3\t/dev/pts/3\t$1\twork\t1\n'; exit; }` + "\n" +
+				`[ "$*" = "display-message -p -c /dev/pts/3 ` + tmux.ClientSizeFormat + `" ]` +
+				` || exit 1` + "\n" + tc.size + "\n"
+			if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+				t.Fatalf("writing the fake tmux: %v", err)
+			}
+			b, err := NewTmuxPopup(Options{
+				BinaryPath: path,
+				ClientId:   "/dev/pts/3",
+				TMUX:       "/tmp/tmux-1000/default,1,0",
+			})
+			if err != nil {
+				t.Fatalf("NewTmuxPopup: %v", err)
+			}
+			if _, err := b.Prepare(t.Context()); err != nil {
+				t.Fatalf("Prepare: %v", err)
+			}
+			// Nothing to resolve, so nothing for the failed measurement to fail.
+			oneUnit := runinpopup.PopupSpec{Y: "10", Height: "20"}
+			if _, err := b.popupRequest(launchSpec(oneUnit)); err != nil {
+				t.Fatalf("popupRequest in one unit: %v", err)
+			}
+
+			mixed := runinpopup.PopupSpec{Y: "10", Height: "40%"}
+			req, err := b.popupRequest(launchSpec(mixed))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("popupRequest = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("popupRequest: %v", err)
+			}
+			if req.Y != tc.wantY {
+				t.Errorf("-y = %q, want %q", req.Y, tc.wantY)
+			}
+		})
+	}
+}
+
 // The session meta rules are the tmux client's; both constructors have to
 // surface its verdict.
 func TestNewTmuxBackends_sessionMetaIsValidated(t *testing.T) {
@@ -264,8 +426,7 @@ func TestTmuxFloatingPane_Launch_ttyHandshake(t *testing.T) {
 		"-P", "-F", "#{pane_id}",
 		"-e", "DONE_FIFO_FILE=/tmp/popup/done",
 		"-e", "TTY_FIFO_FILE=/tmp/popup/tty",
-		"--", "echo $(tty) >> ${TTY_FIFO_FILE}" +
-			" && read done < ${DONE_FIFO_FILE}",
+		"--", runinpopup.TTYHandshakeScript("${TTY_FIFO_FILE}", "${DONE_FIFO_FILE}"),
 	})
 }
 
@@ -332,7 +493,7 @@ func TestZellij_Launch_ttyHandshake(t *testing.T) {
 		"--",
 		"/bin/bash",
 		"-c",
-		"echo $(tty) >> /tmp/popup/tty && read done < /tmp/popup/done",
+		runinpopup.TTYHandshakeScript("/tmp/popup/tty", "/tmp/popup/done"),
 	})
 }
 
@@ -413,15 +574,17 @@ func TestZellij_Launch_rejectsTmuxPositions(t *testing.T) {
 		spec  runinpopup.PopupSpec
 		value string
 	}{
-		{name: "x", spec: runinpopup.PopupSpec{X: "C"}, value: "C"},
+		{name: "x", spec: runinpopup.PopupSpec{X: "P"}, value: "P"},
 		{name: "y", spec: runinpopup.PopupSpec{Y: "M"}, value: "M"},
+		{name: "R is no bottom edge", spec: runinpopup.PopupSpec{Y: "R"}, value: "R"},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			tc.spec.Command = []string{"htop"}
 
-			_, err := zellijBackend(t).runRequest(launchSpec(tc.spec))
+			b := zellijBackend(t)
+			_, err := b.Launch(t.Context(), launchSpec(tc.spec))
 			if err == nil {
-				t.Fatal("runRequest must fail: zellij cannot be asked for a tmux position")
+				t.Fatal("Launch must fail: zellij has nothing like this position")
 			}
 			if !strings.Contains(err.Error(), NameZellij) {
 				t.Errorf("err = %v, want the backend named in it", err)
@@ -446,17 +609,582 @@ func TestZellij_Launch_envNeedsAWorkDir(t *testing.T) {
 	}
 }
 
-// Listed explicitly rather than ranging over Names: tmux-floating-pane is
-// the one backend whose Prepare does something, and execs tmux to find out.
+func TestWezterm_Launch_ttyHandshake(t *testing.T) {
+	b := weztermBackend(t, "3")
+
+	handshake, err := b.NewTTYHandshake("/tmp/popup/tty", "/tmp/popup/done")
+	if err != nil {
+		t.Fatalf("NewTTYHandshake: %v", err)
+	}
+	req, err := b.splitRequest(launchSpec(handshake.Spec))
+	if err != nil {
+		t.Fatalf("splitRequest: %v", err)
+	}
+	path, args := b.wezterm.SplitPaneCommand(req)
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "split-pane", "--pane-id", "3", "--bottom", "--",
+		"/bin/bash", "-c",
+		runinpopup.TTYHandshakeScript("/tmp/popup/tty", "/tmp/popup/done"),
+	})
+}
+
+// The pane the user is in comes from the user data first, and only then from
+// the caller's own $WEZTERM_PANE: the wrapper script recorded the pane gpg was
+// started from, while a daemon's children have none.
+func TestNewWezterm_paneId(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "session id", opts: Options{SessionId: "3", WeztermPane: "9"}, want: "3"},
+		{name: "the caller's own pane", opts: Options{WeztermPane: "9"}, want: "9"},
+		{name: "none", opts: Options{}, want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewWezterm(tc.opts)
+			if err != nil {
+				t.Fatalf("NewWezterm: %v", err)
+			}
+			if b.paneId != tc.want {
+				t.Errorf("pane id = %q, want %q", b.paneId, tc.want)
+			}
+		})
+	}
+}
+
+// A split is sized along one axis, and which size was given is what picks the
+// side it opens on.
+func TestWezterm_Launch_geometry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    runinpopup.PopupSpec
+		want    []string
+		wantErr string
+	}{
+		{name: "none", want: []string{"--bottom"}},
+		{
+			name: "a height splits below",
+			spec: runinpopup.PopupSpec{Height: "20"},
+			want: []string{"--bottom", "--cells", "20"},
+		},
+		{
+			name: "a width splits to the right",
+			spec: runinpopup.PopupSpec{Width: "40%"},
+			want: []string{"--right", "--percent", "40"},
+		},
+		{
+			name:    "both at once",
+			spec:    runinpopup.PopupSpec{Width: "80%", Height: "20"},
+			wantErr: "one axis only",
+		},
+		{
+			name:    "a position",
+			spec:    runinpopup.PopupSpec{X: "C"},
+			wantErr: "cannot be placed",
+		},
+		{
+			name:    "an anchor",
+			spec:    runinpopup.PopupSpec{Anchor: "top"},
+			wantErr: "cannot be placed",
+		},
+		{
+			name:    "a margin",
+			spec:    runinpopup.PopupSpec{Margin: "2"},
+			wantErr: `margin "2" has no meaning`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := weztermBackend(t, "3")
+			tc.spec.Command = []string{"htop"}
+
+			req, err := b.splitRequest(launchSpec(tc.spec))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("splitRequest = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitRequest: %v", err)
+			}
+			path, args := b.wezterm.SplitPaneCommand(req)
+			want := append([]string{"cli", "split-pane", "--pane-id", "3"}, tc.want...)
+			assertCommand(t, path, args, "/usr/bin/wezterm", append(want, "--", "htop"))
+		})
+	}
+}
+
+// Without a pane to split the popup gets a window of its own, which wezterm
+// cli can neither place nor size.
+func TestWezterm_Launch_spawnWithoutAPane(t *testing.T) {
+	b := weztermBackend(t, "")
+
+	payload, err := b.spawnPayload(launchSpec(runinpopup.PopupSpec{Command: []string{"htop"}}))
+	if err != nil {
+		t.Fatalf("spawnPayload: %v", err)
+	}
+	path, args := b.wezterm.SpawnCommand(payload)
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "spawn", "--new-window", "--", "htop",
+	})
+
+	for _, spec := range []runinpopup.PopupSpec{
+		{Height: "20"},
+		{Anchor: "top"},
+		{Margin: "2"},
+	} {
+		spec.Command = []string{"htop"}
+		_, err = b.spawnPayload(launchSpec(spec))
+		if err == nil || !strings.Contains(err.Error(), "has no meaning") {
+			t.Errorf("spawnPayload(%+v) = %v, want the field it cannot take named", spec, err)
+		}
+	}
+}
+
+func TestWezterm_Launch_envNeedsAWorkDir(t *testing.T) {
+	_, err := weztermBackend(t, "3").splitRequest(runinpopup.LaunchSpec{
+		Env:     map[string]string{"A": "one"},
+		Command: []string{"true"},
+	})
+	if err == nil {
+		t.Fatal("splitRequest must fail: there is nowhere to write the environment")
+	}
+}
+
+func screenBackend(t *testing.T) *Screen {
+	t.Helper()
+	b, err := NewScreen(Options{
+		BinaryPath: "/usr/bin/screen",
+		SessionId:  "1234.main",
+		Shell:      "/bin/bash",
+	})
+	if err != nil {
+		t.Fatalf("NewScreen: %v", err)
+	}
+	return b
+}
+
+func TestScreen_Launch_ttyHandshake(t *testing.T) {
+	b := screenBackend(t)
+
+	handshake, err := b.NewTTYHandshake("/tmp/popup/tty", "/tmp/popup/done")
+	if err != nil {
+		t.Fatalf("NewTTYHandshake: %v", err)
+	}
+	req, err := b.windowRequest(launchSpec(handshake.Spec))
+	if err != nil {
+		t.Fatalf("windowRequest: %v", err)
+	}
+	path, args := b.screen.NewWindowCommand(req, "tag-1")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.main", "-X", "screen", "-t", "tag-1",
+		"/bin/bash", "-c",
+		runinpopup.TTYHandshakeScript("/tmp/popup/tty", "/tmp/popup/done"),
+	})
+}
+
+// The session comes from the user data first, and only then from the caller's
+// own $STY.
+func TestNewScreen_session(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{name: "the caller's own", opts: Options{STY: "99.own"}, want: []string{"-S", "99.own"}},
+		{
+			name: "the user data's first",
+			opts: Options{SessionId: "1234.main", STY: "99.own"},
+			want: []string{"-S", "1234.main"},
+		},
+		{name: "none leaves it to screen", opts: Options{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewScreen(tc.opts)
+			if err != nil {
+				t.Fatalf("NewScreen: %v", err)
+			}
+			_, args := b.screen.KillWindowCommand("5")
+			assertCommand(t, "screen", args, "screen", append(tc.want, "-X", "at", "5", "kill"))
+		})
+	}
+}
+
+func TestScreen_Launch_refusesGeometry(t *testing.T) {
+	_, err := screenBackend(t).windowRequest(launchSpec(runinpopup.PopupSpec{
+		Height:  "20",
+		Command: []string{"htop"},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "cannot be placed or sized") {
+		t.Fatalf("windowRequest = %v, want the geometry refused", err)
+	}
+}
+
+func TestScreen_Launch_envNeedsAWorkDir(t *testing.T) {
+	_, err := screenBackend(t).windowRequest(runinpopup.LaunchSpec{
+		Env:     map[string]string{"A": "one"},
+		Command: []string{"true"},
+	})
+	if err == nil {
+		t.Fatal("windowRequest must fail: there is nowhere to write the environment")
+	}
+}
+
+func nvimBackend(t *testing.T) *Nvim {
+	t.Helper()
+	b, err := NewNvim(Options{SessionMeta: "/run/user/1000/nvim.1.0", Shell: "/bin/bash"})
+	if err != nil {
+		t.Fatalf("NewNvim: %v", err)
+	}
+	return b
+}
+
+// termopen takes the job's environment, so the handshake's FIFO paths travel
+// the way they do for tmux.
+func TestNvim_Launch_ttyHandshake(t *testing.T) {
+	b := nvimBackend(t)
+
+	handshake, err := b.NewTTYHandshake("/tmp/popup/tty", "/tmp/popup/done")
+	if err != nil {
+		t.Fatalf("NewTTYHandshake: %v", err)
+	}
+	req, err := b.floatRequest(launchSpec(handshake.Spec))
+	if err != nil {
+		t.Fatalf("floatRequest: %v", err)
+	}
+	want := map[string]string{"TTY_FIFO_FILE": "/tmp/popup/tty", "DONE_FIFO_FILE": "/tmp/popup/done"}
+	if !maps.Equal(req.Env, want) {
+		t.Errorf("env = %v, want %v", req.Env, want)
+	}
+	if req.Script != tmuxTTYHandshakeScript {
+		t.Errorf("script = %q, want the tmux handshake", req.Script)
+	}
+}
+
+// Of tmux's specifiers only the two with a meaning inside an editor reach the
+// float; the rest are refused by name before anything is opened.
+func TestNvim_Launch_positions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    runinpopup.PopupSpec
+		wantErr bool
+	}{
+		{name: "cells and percentages", spec: runinpopup.PopupSpec{X: "2", Y: "10%"}},
+		{name: "centred", spec: runinpopup.PopupSpec{X: "C", Y: "C"}},
+		{name: "right edge", spec: runinpopup.PopupSpec{X: "R"}},
+		{name: "R is horizontal only", spec: runinpopup.PopupSpec{Y: "R"}, wantErr: true},
+		{name: "the pane's corner", spec: runinpopup.PopupSpec{X: "P"}, wantErr: true},
+		{name: "the mouse", spec: runinpopup.PopupSpec{Y: "M"}, wantErr: true},
+		{name: "the status line", spec: runinpopup.PopupSpec{Y: "S"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.spec.Command = []string{"htop"}
+			req, err := nvimBackend(t).floatRequest(launchSpec(tc.spec))
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "no equivalent inside an editor") {
+					t.Fatalf("floatRequest = %v, want the specifier refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("floatRequest: %v", err)
+			}
+			if req.X != tc.spec.X || req.Y != tc.spec.Y {
+				t.Errorf("position = %q, %q; want %q, %q", req.X, req.Y, tc.spec.X, tc.spec.Y)
+			}
+		})
+	}
+}
+
+// The server comes from the user data first, and only then from the caller's
+// own $NVIM. The address is only ever visible in what a failed connection
+// says, which is where it is looked for.
+func TestNewNvim_address(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "the caller's own", opts: Options{NVIM: dir + "/own"}, want: dir + "/own"},
+		{
+			name: "the user data's first",
+			opts: Options{SessionMeta: dir + "/user-data", NVIM: dir + "/own"},
+			want: dir + "/user-data",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewNvim(tc.opts)
+			if err != nil {
+				t.Fatalf("NewNvim: %v", err)
+			}
+			h, err := b.Launch(t.Context(), runinpopup.LaunchSpec{Command: []string{"true"}})
+			if err != nil {
+				t.Fatalf("Launch: %v", err)
+			}
+			if err := h.Wait(); err == nil || !strings.Contains(err.Error(), tc.want+":") {
+				t.Errorf("Wait = %v, want a connection to %s attempted", err, tc.want)
+			}
+		})
+	}
+}
+
+func kittyBackend(t *testing.T, name string) *Kitty {
+	t.Helper()
+	b, err := New(name, Options{
+		BinaryPath:  "/usr/bin/kitty",
+		SessionId:   "4",
+		SessionMeta: "/tmp/kitty-1",
+		Shell:       "/bin/bash",
+	})
+	if err != nil {
+		t.Fatalf("New(%q): %v", name, err)
+	}
+	return b.(*Kitty)
+}
+
+// kitty takes the window's environment as flags, so the handshake's FIFO paths
+// travel the way they do for tmux; the two backends differ only in --type.
+func TestKitty_Launch_ttyHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		wantType string
+	}{
+		{NameKitty, "--type=overlay"},
+		{NameKittyOSWindow, "--type=os-window"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := kittyBackend(t, tc.name)
+
+			handshake, err := b.NewTTYHandshake("/tmp/popup/tty", "/tmp/popup/done")
+			if err != nil {
+				t.Fatalf("NewTTYHandshake: %v", err)
+			}
+			req, err := b.launchRequest(launchSpec(handshake.Spec))
+			if err != nil {
+				t.Fatalf("launchRequest: %v", err)
+			}
+			path, args := b.kitty.LaunchCommand(req)
+			assertCommand(t, path, args, "/usr/bin/kitty", []string{
+				"@", "--to", "unix:/tmp/kitty-1", "launch",
+				tc.wantType,
+				"--match", "id:4",
+				"--env", "DONE_FIFO_FILE=/tmp/popup/done",
+				"--env", "TTY_FIFO_FILE=/tmp/popup/tty",
+				"--",
+				"/bin/bash", "-c", tmuxTTYHandshakeScript,
+			})
+		})
+	}
+}
+
+// The window to open over comes from the user data first, and only then from
+// the caller's own $KITTY_WINDOW_ID.
+func TestNewKitty_windowId(t *testing.T) {
+	b, err := NewKitty(Options{KittyWindowId: "9"})
+	if err != nil {
+		t.Fatalf("NewKitty: %v", err)
+	}
+	if b.windowId != "9" {
+		t.Errorf("window id = %q, want the caller's own", b.windowId)
+	}
+	b, err = NewKitty(Options{SessionId: "4", KittyWindowId: "9"})
+	if err != nil {
+		t.Fatalf("NewKitty: %v", err)
+	}
+	if b.windowId != "4" {
+		t.Errorf("window id = %q, want the session id", b.windowId)
+	}
+}
+
+func TestKitty_Launch_refusesGeometry(t *testing.T) {
+	for _, spec := range []runinpopup.PopupSpec{{Width: "80%"}, {Anchor: "bottom-right"}} {
+		spec.Command = []string{"htop"}
+		_, err := kittyBackend(t, NameKitty).launchRequest(launchSpec(spec))
+		if err == nil || !strings.Contains(err.Error(), "cannot be placed or sized") {
+			t.Fatalf("launchRequest = %v, want the geometry refused", err)
+		}
+	}
+}
+
+// Listed explicitly rather than ranging over Names: the two tmux backends are
+// the ones whose Prepare does something, and exec tmux to find out.
 func TestBackendPrepare_isNoOp(t *testing.T) {
-	for _, b := range []runinpopup.Backend{tmuxBackend(t), zellijBackend(t)} {
+	for _, b := range []runinpopup.Backend{
+		zellijBackend(t),
+		screenBackend(t),
+		nvimBackend(t),
+		weztermBackend(t, "3"),
+		kittyBackend(t, NameKitty),
+		ptyBackend(t),
+	} {
 		t.Run(b.Name(), func(t *testing.T) {
 			restore, err := b.Prepare(t.Context())
 			if err != nil {
 				t.Fatalf("Prepare: %v", err)
 			}
 			if restore != nil {
-				t.Error("restore must be nil: neither backend adjusts multiplexer state")
+				t.Error("restore must be nil: none of these backends adjusts multiplexer state")
+			}
+		})
+	}
+}
+
+// fakeTmuxClients writes a tmux standing in for the real one, answering
+// list-clients with clients, one line each in tmux.ClientsFormat's fields, and
+// failing everything else.
+func fakeTmuxClients(t *testing.T, clients ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tmux")
+	body := "#!/bin/sh\n[ \"$1\" = list-clients ] || exit 1\n"
+	for _, c := range clients {
+		body += "printf '%s\\n' '" + c + "'\n"
+	}
+	if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+		t.Fatalf("writing the fake tmux: %v", err)
+	}
+	return path
+}
+
+func TestTmuxPopup_Prepare_clientThatIsGone(t *testing.T) {
+	clients := []string{
+		"/dev/pts/3\t/dev/pts/3\t$1\twork\t100",
+		"/dev/pts/5\t/dev/pts/5\t$1\twork\t300",
+		"/dev/pts/6\t/dev/pts/6\t$2\tplay\t900",
+	}
+	for _, tc := range []struct {
+		name      string
+		clientId  string
+		sessionId string
+		clients   []string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "attached",
+			clientId:  "/dev/pts/3",
+			sessionId: "$1",
+			clients:   clients,
+			want:      "/dev/pts/3",
+		},
+		{
+			name:      "gone, the session's most recent stands in",
+			clientId:  "/dev/pts/4",
+			sessionId: "$1",
+			clients:   clients,
+			want:      "/dev/pts/5",
+		},
+		{
+			name:      "gone, a session named rather than numbered",
+			clientId:  "/dev/pts/4",
+			sessionId: "play",
+			clients:   clients,
+			want:      "/dev/pts/6",
+		},
+		{
+			name:     "gone, no session on record",
+			clientId: "/dev/pts/4",
+			clients:  clients,
+			want:     "/dev/pts/6",
+		},
+		{
+			name:      "gone, and the session with it",
+			clientId:  "/dev/pts/4",
+			sessionId: "$7",
+			clients:   clients,
+			wantErr:   "no other client is attached",
+		},
+		{name: "nobody attached", clientId: "/dev/pts/4", wantErr: "no other client is attached"},
+		// tmux resolves the current client itself, and is not asked which first.
+		{name: "no client named", want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewTmuxPopup(Options{
+				BinaryPath: fakeTmuxClients(t, tc.clients...),
+				ClientId:   tc.clientId,
+				SessionId:  tc.sessionId,
+				TMUX:       "/tmp/tmux-1000/default,1,0",
+			})
+			if err != nil {
+				t.Fatalf("NewTmuxPopup: %v", err)
+			}
+			var log bytes.Buffer
+			ctx := contextkey.WithSlogLogger(t.Context(), slog.New(slog.NewTextHandler(&log, nil)))
+
+			restore, err := b.Prepare(ctx)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Prepare = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Prepare: %v", err)
+			}
+			if restore != nil {
+				t.Error("restore must be nil: nothing on the tmux side was changed")
+			}
+			req, err := b.popupRequest(launchSpec(runinpopup.PopupSpec{Command: []string{"true"}}))
+			if err != nil {
+				t.Fatalf("popupRequest: %v", err)
+			}
+			if req.ClientId != tc.want {
+				t.Errorf("popup opens on %q, want %q", req.ClientId, tc.want)
+			}
+			substituted := strings.Contains(log.String(), "the tmux client is gone")
+			if wantLog := tc.want != tc.clientId; substituted != wantLog {
+				t.Errorf("substitution logged: %v, want %v: %s", substituted, wantLog, log.String())
+			}
+		})
+	}
+}
+
+// Only a client that does not answer has the clients listed, and a list that
+// cannot be had keeps the client named rather than refusing the popup.
+func TestTmuxPopup_Prepare_listClientsFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tmux")
+	body := "#!/bin/sh\n" +
+		`[ "$1" = list-clients ] && { echo "server exited unexpectedly" >&2; exit 1; }` + "\n" +
+		`[ "$*" = "display-message -p -c /dev/pts/3 ` + tmux.ClientSizeFormat + `" ]` +
+		` || exit 1` + "\n" + `printf '200\t50\n'` + "\n"
+	if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+		t.Fatalf("writing the fake tmux: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		clientId string
+		wantWarn bool
+	}{
+		{name: "the client answers", clientId: "/dev/pts/3"},
+		{name: "the client does not", clientId: "/dev/pts/4", wantWarn: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewTmuxPopup(Options{
+				BinaryPath: path,
+				ClientId:   tc.clientId,
+				SessionId:  "$1",
+				TMUX:       "/tmp/tmux-1000/default,1,0",
+			})
+			if err != nil {
+				t.Fatalf("NewTmuxPopup: %v", err)
+			}
+			var log bytes.Buffer
+			ctx := contextkey.WithSlogLogger(t.Context(), slog.New(slog.NewTextHandler(&log, nil)))
+
+			if _, err := b.Prepare(ctx); err != nil {
+				t.Fatalf("Prepare: %v", err)
+			}
+			req, err := b.popupRequest(launchSpec(runinpopup.PopupSpec{Command: []string{"true"}}))
+			if err != nil {
+				t.Fatalf("popupRequest: %v", err)
+			}
+			if req.ClientId != tc.clientId {
+				t.Errorf("popup opens on %q, want %q", req.ClientId, tc.clientId)
+			}
+			warned := strings.Contains(log.String(), "server exited unexpectedly")
+			if warned != tc.wantWarn {
+				t.Errorf("list failure logged: %v, want %v: %s", warned, tc.wantWarn, log.String())
 			}
 		})
 	}
@@ -488,42 +1216,111 @@ func TestNew(t *testing.T) {
 }
 
 func TestDetectName(t *testing.T) {
+	const tmux = "/tmp/s,1,0"
+
 	for _, tc := range []struct {
 		name       string
-		kind       string
-		tmuxEnv    string
-		zellijEnv  string
+		hints      Hints
 		want       string
 		wantErrStr string
 	}{
-		{name: "kind wins over env", kind: "TMUX_POPUP", zellijEnv: "0", want: NameTmuxPopup},
-		{name: "zellij kind", kind: "ZELLIJ_POPUP", tmuxEnv: "/tmp/s,1,0", want: NameZellij},
-		{name: "debug kind", kind: "TMUX_POPUP_DEBUG", want: NameTmuxPopup},
 		{
-			name: "tmux floating pane kind",
-			kind: "TMUX_FLOATING_PANE",
-			want: NameTmuxFloatingPane,
+			name:  "kind wins over env",
+			hints: Hints{UserDataKind: "TMUX_POPUP", Zellij: "0"},
+			want:  NameTmuxPopup,
+		},
+		{
+			name:  "zellij kind",
+			hints: Hints{UserDataKind: "ZELLIJ_POPUP", TMUX: tmux},
+			want:  NameZellij,
 		},
+		{name: "debug kind", hints: Hints{UserDataKind: "TMUX_POPUP_DEBUG"}, want: NameTmuxPopup},
 		{
-			name: "tmux floating pane debug kind",
-			kind: "TMUX_FLOATING_PANE_DEBUG",
-			want: NameTmuxFloatingPane,
+			name:  "tmux floating pane kind",
+			hints: Hints{UserDataKind: "TMUX_FLOATING_PANE"},
+			want:  NameTmuxFloatingPane,
+		},
+		{
+			name:  "tmux floating pane debug kind",
+			hints: Hints{UserDataKind: "TMUX_FLOATING_PANE_DEBUG"},
+			want:  NameTmuxFloatingPane,
+		},
+		{
+			name:  "wezterm kind",
+			hints: Hints{UserDataKind: "WEZTERM_POPUP_DEBUG", TMUX: tmux},
+			want:  NameWezterm,
 		},
 		{
 			// The floating backend is opt-in: nothing ambient selects it.
-			name:    "bare tmux env stays on display-popup",
-			tmuxEnv: "/tmp/s,1,0",
-			want:    NameTmuxPopup,
-		},
-		{name: "lowercase kind", kind: "zellij_popup", want: NameZellij},
-		{name: "tmux env", tmuxEnv: "/tmp/s,1,0", want: NameTmuxPopup},
-		{name: "zellij env", zellijEnv: "0", want: NameZellij},
-		{name: "tmux env wins", tmuxEnv: "/tmp/s,1,0", zellijEnv: "0", want: NameTmuxPopup},
-		{name: "unknown kind falls through", kind: "PINENTRY", zellijEnv: "0", want: NameZellij},
+			name:  "bare tmux env stays on display-popup",
+			hints: Hints{TMUX: tmux},
+			want:  NameTmuxPopup,
+		},
+		{name: "lowercase kind", hints: Hints{UserDataKind: "zellij_popup"}, want: NameZellij},
+		{name: "zellij env", hints: Hints{Zellij: "0"}, want: NameZellij},
+		{name: "wezterm env", hints: Hints{WeztermPane: "3"}, want: NameWezterm},
+		{
+			name:  "screen kind",
+			hints: Hints{UserDataKind: "SCREEN_POPUP_DEBUG", TMUX: tmux},
+			want:  NameScreen,
+		},
+		{name: "screen env", hints: Hints{STY: "1234.main"}, want: NameScreen},
+		{
+			name:  "nvim kind wins over the multiplexer hosting it",
+			hints: Hints{UserDataKind: "NVIM_POPUP", TMUX: tmux, NVIM: "/run/nvim.1.0"},
+			want:  NameNvim,
+		},
+		{name: "nvim env", hints: Hints{NVIM: "/run/nvim.1.0"}, want: NameNvim},
+		{
+			// What a shell in a Neovim terminal inside tmux was always given.
+			name:  "a multiplexer hosting nvim wins over it",
+			hints: Hints{TMUX: tmux, NVIM: "/run/nvim.1.0"},
+			want:  NameTmuxPopup,
+		},
+		{
+			name:  "nvim inside wezterm wins over it",
+			hints: Hints{NVIM: "/run/nvim.1.0", WeztermPane: "3"},
+			want:  NameNvim,
+		},
+		{
+			name:  "screen inside wezterm wins over it",
+			hints: Hints{STY: "1234.main", WeztermPane: "3"},
+			want:  NameScreen,
+		},
+		{name: "kitty kind", hints: Hints{UserDataKind: "KITTY_POPUP"}, want: NameKitty},
+		{
+			name:  "kitty os window kind",
+			hints: Hints{UserDataKind: "KITTY_OS_WINDOW_DEBUG", KittyWindowId: "1"},
+			want:  NameKittyOSWindow,
+		},
+		{
+			// Like tmux's floating pane, the OS-window variant is opt-in.
+			name:  "kitty env stays on the overlay",
+			hints: Hints{KittyWindowId: "1"},
+			want:  NameKitty,
+		},
+		{
+			name:  "a multiplexer inside kitty wins over it",
+			hints: Hints{TMUX: tmux, KittyWindowId: "1"},
+			want:  NameTmuxPopup,
+		},
+		{name: "tmux env wins", hints: Hints{TMUX: tmux, Zellij: "0"}, want: NameTmuxPopup},
+		{
+			// WezTerm's variable leaks into every multiplexer run inside it, so the
+			// multiplexer nearest the caller has to win.
+			name:  "a multiplexer inside wezterm wins over it",
+			hints: Hints{Zellij: "0", WeztermPane: "3"},
+			want:  NameZellij,
+		},
+		{
+			name:  "unknown kind falls through",
+			hints: Hints{UserDataKind: "PINENTRY", Zellij: "0"},
+			want:  NameZellij,
+		},
 		{name: "nothing", wantErrStr: "cannot detect the popup backend"},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := DetectName(tc.kind, tc.tmuxEnv, tc.zellijEnv)
+			got, err := DetectName(tc.hints)
 			if tc.wantErrStr != "" {
 				if err == nil || !strings.Contains(err.Error(), tc.wantErrStr) {
 					t.Fatalf("err = %v, want one containing %q", err, tc.wantErrStr)
@@ -539,3 +1336,25 @@ func TestDetectName(t *testing.T) {
 		})
 	}
 }
+
+// A wrapper script is generated from UserDataKinds, so every kind listed has to
+// detect the backend UserDataKind names it for, and every backend but pty needs
+// one.
+func TestUserDataKinds(t *testing.T) {
+	kinds := UserDataKinds()
+	for _, name := range Names() {
+		kind := UserDataKind(name)
+		if name == NamePty {
+			if kind != "" {
+				t.Errorf("pty has the kind %q, want none", kind)
+			}
+			continue
+		}
+		if !slices.Contains(kinds, kind) {
+			t.Errorf("%s has the kind %q, which UserDataKinds does not list", name, kind)
+		}
+		if got, err := DetectName(Hints{UserDataKind: kind}); err != nil || got != name {
+			t.Errorf("DetectName(%q) = %q, %v, want %q", kind, got, err, name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package backend
+
+import "github.com/ngicks/run-in-tmux-popup/runinpopup"
+
+// tmuxPositions are the position specifiers the tmux mechanisms pass through.
+// tmux decides which suit which axis, so both take all six.
+const tmuxPositions = "CRPMWS"
+
+// capabilities is what each backend honors, in one table so the matrix
+// "run-in-popup backends" prints is the one the launcher checks against. Each
+// row restates what its backend's Launch does with a spec; the reasons are
+// given there.
+var capabilities = map[string]runinpopup.Capabilities{
+	NameTmuxPopup: {
+		Title: true, Env: true,
+		Place: true, PositionsX: tmuxPositions, PositionsY: tmuxPositions,
+		Size:            runinpopup.SizeFull,
+		ClientTargeting: true,
+		ExitStatus:      true,
+	},
+	NameTmuxFloatingPane: {
+		Env:   true,
+		Place: true, PositionsX: tmuxPositions, PositionsY: tmuxPositions,
+		Size: runinpopup.SizeFull,
+	},
+	NameZellij: {
+		Title: true, Env: true,
+		Place: true, PositionsX: "CR", PositionsY: "CS",
+		Size: runinpopup.SizeFull,
+	},
+	NameScreen: {
+		Title: true, Env: true,
+		Size: runinpopup.SizeNone,
+	},
+	NameNvim: {
+		Title: true, Env: true,
+		Place: true, PositionsX: "CR", PositionsY: "C",
+		Size: runinpopup.SizeFull,
+	},
+	NameWezterm: {
+		Env:  true,
+		Size: runinpopup.SizeOneAxis,
+	},
+	NameKitty: {
+		Title: true, Env: true,
+		Size: runinpopup.SizeNone,
+	},
+	NameKittyOSWindow: {
+		Title: true, Env: true,
+		Size: runinpopup.SizeNone,
+	},
+	NamePty: {
+		Env:        true,
+		Size:       runinpopup.SizeCells,
+		ExitStatus: true,
+	},
+}
+
+// weztermWindowCapabilities is the wezterm backend with no pane to split, which
+// spawns a window that takes no geometry at all.
+var weztermWindowCapabilities = runinpopup.Capabilities{
+	Env:  true,
+	Size: runinpopup.SizeNone,
+}
+
+// Capabilities reports what the named backend honors, and false for a name New
+// does not know. For wezterm it is the split a pane id makes; a backend built
+// without one reports less on its own Capabilities.
+func Capabilities(name string) (runinpopup.Capabilities, bool) {
+	c, ok := capabilities[name]
+	return c, ok
+}
@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+)
+
+// The matrix "run-in-popup backends" prints is read off the table, and the
+// launcher checks what a backend it built reports: the two have to be the same
+// answer for every backend New knows.
+func TestCapabilities_everyBackendReportsItsRow(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			want, ok := Capabilities(name)
+			if !ok {
+				t.Fatalf("Capabilities(%q) has no row", name)
+			}
+			b, err := New(name, Options{
+				SessionId:   "1",
+				SessionMeta: "/tmp/tmux-1000/default,1,0",
+			})
+			if err != nil {
+				t.Fatalf("New(%q): %v", name, err)
+			}
+			reporter, ok := b.(runinpopup.CapabilityReporter)
+			if !ok {
+				t.Fatalf("%s does not report its capabilities", name)
+			}
+			if got := reporter.Capabilities(); got != want {
+				t.Errorf("Capabilities() = %+v, want %+v", got, want)
+			}
+		})
+	}
+	if _, ok := Capabilities("no-such-backend"); ok {
+		t.Error("an unknown backend must have no row")
+	}
+}
+
+// wezterm without a pane to split opens a window, and says it takes no geometry
+// rather than reporting the split it is not going to make.
+func TestWezterm_Capabilities_withoutAPane(t *testing.T) {
+	b, err := NewWezterm(Options{})
+	if err != nil {
+		t.Fatalf("NewWezterm: %v", err)
+	}
+	if got := b.Capabilities(); got.Size != runinpopup.SizeNone {
+		t.Errorf("Size = %q, want %q", got.Size, runinpopup.SizeNone)
+	}
+}
@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/zellij"
+)
+
+// multiplexerBinaries is, for each backend driving a binary of its own, the
+// binary's default name and the arguments making it print its version.
+var multiplexerBinaries = map[string]struct {
+	name    string
+	version []string
+}{
+	NameTmuxPopup:        {"tmux", []string{"-V"}},
+	NameTmuxFloatingPane: {"tmux", []string{"-V"}},
+	NameZellij:           {"zellij", []string{"--version"}},
+	NameScreen:           {"screen", []string{"-v"}},
+	NameWezterm:          {"wezterm", []string{"--version"}},
+	NameKitty:            {"kitty", []string{"--version"}},
+	NameKittyOSWindow:    {"kitty", []string{"--version"}},
+}
+
+// Diagnose checks, link by link, what the named backend needs before it can
+// open a popup where opts says: its binary, the server it talks to, and for
+// tmux and zellij the client and session the popup is meant for. It asks
+// without opening anything, so it stops short of what only a real popup shows.
+//
+// A check that fails ends the diagnosis: the ones after it would only fail
+// again for the same reason.
+func Diagnose(ctx context.Context, name string, opts Options) []runinpopup.Check {
+	switch name {
+	case NamePty:
+		return nil
+	case NameNvim:
+		return []runinpopup.Check{diagnoseNvimAddress(cmp.Or(opts.SessionMeta, opts.NVIM))}
+	}
+	bin, ok := multiplexerBinaries[name]
+	if !ok {
+		return []runinpopup.Check{runinpopup.CheckResult(
+			"backend", "", fmt.Errorf("unknown popup backend %q", name),
+		)}
+	}
+
+	path, err := exec.LookPath(cmp.Or(opts.BinaryPath, bin.name))
+	checks := []runinpopup.Check{runinpopup.CheckResult("binary", path, err)}
+	if err != nil {
+		return checks
+	}
+
+	switch name {
+	case NameTmuxPopup, NameTmuxFloatingPane:
+		return append(checks, diagnoseTmux(ctx, name, path, opts)...)
+	case NameZellij:
+		checks = append(checks, diagnoseVersion(ctx, path, bin.version))
+		if opts.SessionId != "" && checks[len(checks)-1].Status != runinpopup.CheckFail {
+			checks = append(checks, diagnoseZellijSession(ctx, path, opts.SessionId))
+		}
+		return checks
+	default:
+		return append(checks, diagnoseVersion(ctx, path, bin.version))
+	}
+}
+
+// diagnoseVersion runs the binary for its version, which shows it runs at all.
+// Some print it and still exit non-zero — screen -v does — so output wins over
+// the status.
+func diagnoseVersion(ctx context.Context, path string, args []string) runinpopup.Check {
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if version != "" {
+		return runinpopup.CheckResult("version", version, nil)
+	}
+	if err == nil {
+		err = errors.New("printed no version")
+	}
+	return runinpopup.CheckResult("version", "", fmt.Errorf("%s: %w", path, err))
+}
+
+func diagnoseTmux(ctx context.Context, name, path string, opts Options) []runinpopup.Check {
+	client, err := tmux.New(tmux.Options{Path: path, SessionMeta: opts.SessionMeta, TMUX: opts.TMUX})
+	if err != nil {
+		return []runinpopup.Check{runinpopup.CheckResult("session meta", "", err)}
+	}
+	meta := diagnoseTmuxMeta(opts)
+	if meta.Status == runinpopup.CheckFail {
+		return []runinpopup.Check{meta}
+	}
+
+	version, err := client.Version(ctx)
+	checks := []runinpopup.Check{
+		meta,
+		runinpopup.CheckResult("version", strings.TrimSpace(version), err),
+	}
+	if err != nil {
+		return checks
+	}
+
+	clients, err := client.ListClients(ctx)
+	if err != nil {
+		return append(checks, runinpopup.CheckResult("clients", "", err))
+	}
+	if len(clients) == 0 {
+		return append(checks, runinpopup.CheckResult("clients", "",
+			errors.New("no client is attached to the server: nobody would see a popup")))
+	}
+
+	if name == NameTmuxPopup && opts.ClientId != "" {
+		checks = append(checks, diagnoseTmuxClient(clients, opts.ClientId, opts.SessionId))
+	}
+	if opts.SessionId != "" {
+		checks = append(checks, diagnoseTmuxSession(clients, opts.SessionId))
+	}
+	return checks
+}
+
+// diagnoseTmuxMeta checks the server coordinates tmux.New accepted: the
+// caller's own $TMUX, else the session meta standing in for it, whose socket
+// has to still be there. A server that has exited leaves its meta looking as
+// well-formed as ever.
+func diagnoseTmuxMeta(opts Options) runinpopup.Check {
+	if opts.TMUX != "" {
+		return runinpopup.CheckResult("session meta", "inside tmux, $TMUX="+opts.TMUX, nil)
+	}
+	socket, _, _ := strings.Cut(opts.SessionMeta, ",")
+	if _, err := os.Stat(socket); err != nil {
+		return runinpopup.CheckResult("session meta", "", fmt.Errorf(
+			"the server socket is gone, the tmux server with it: %w", err,
+		))
+	}
+	return runinpopup.CheckResult("session meta", "server socket "+socket, nil)
+}
+
+// diagnoseTmuxClient checks the client a tmux-popup is drawn on is still
+// attached. One that is gone is a warning, not a failure: Prepare falls back
+// to another, the same one this names.
+func diagnoseTmuxClient(clients []tmux.ClientInfo, clientId, sessionId string) runinpopup.Check {
+	for _, c := range clients {
+		if c.Is(clientId) {
+			return runinpopup.CheckResult(
+				"client", fmt.Sprintf("%s, showing session %s", c.Name, c.SessionName), nil,
+			)
+		}
+	}
+	instead, ok := tmux.MostRecentClient(clients, func(c tmux.ClientInfo) bool {
+		return sessionId == "" || c.InSession(sessionId)
+	})
+	if !ok {
+		return runinpopup.CheckResult("client", "", fmt.Errorf(
+			"client %s is gone, and no other client shows session %s", clientId, sessionId,
+		))
+	}
+	return runinpopup.Check{
+		Name:   "client",
+		Status: runinpopup.CheckWarn,
+		Detail: fmt.Sprintf(
+			"client %s is gone; the popup would go to %s instead", clientId, instead.Name,
+		),
+	}
+}
+
+// diagnoseTmuxSession checks some client shows the session a popup opens in.
+// tmux opens a floating pane in a session nobody views without complaint.
+func diagnoseTmuxSession(clients []tmux.ClientInfo, sessionId string) runinpopup.Check {
+	var viewers []string
+	for _, c := range clients {
+		if c.InSession(sessionId) {
+			viewers = append(viewers, c.Name)
+		}
+	}
+	if len(viewers) == 0 {
+		return runinpopup.Check{
+			Name:   "session",
+			Status: runinpopup.CheckWarn,
+			Detail: fmt.Sprintf("no client shows session %s: nobody would see a popup there",
+				sessionId),
+		}
+	}
+	return runinpopup.CheckResult("session",
+		fmt.Sprintf("%s, shown on %s", sessionId, strings.Join(viewers, ", ")), nil)
+}
+
+func diagnoseZellijSession(ctx context.Context, path, sessionId string) runinpopup.Check {
+	sessions, err := zellij.New(zellij.Options{Path: path}).ListSessions(ctx)
+	if err != nil {
+		return runinpopup.CheckResult("session", "", err)
+	}
+	for _, s := range sessions {
+		if s.Name != sessionId {
+			continue
+		}
+		if s.Exited {
+			return runinpopup.CheckResult("session", "", fmt.Errorf(
+				"session %s has exited and is only kept to be resurrected", sessionId,
+			))
+		}
+		return runinpopup.CheckResult("session", sessionId, nil)
+	}
+	return runinpopup.CheckResult("session", "", fmt.Errorf("no session %s is running", sessionId))
+}
+
+// diagnoseNvimAddress checks Neovim is reachable where it would be asked. Only
+// a unix socket can be checked without speaking to it; a TCP address passes as
+// written.
+func diagnoseNvimAddress(address string) runinpopup.Check {
+	if address == "" {
+		return runinpopup.CheckResult("server", "", errors.New(
+			"no Neovim server: neither session_meta nor $NVIM names one",
+		))
+	}
+	if strings.HasPrefix(address, "/") {
+		if _, err := os.Stat(address); err != nil {
+			return runinpopup.CheckResult("server", "", err)
+		}
+	}
+	return runinpopup.CheckResult("server", address, nil)
+}
@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+)
+
+func TestDiagnose(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, script string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+			t.Fatalf("writing the fake %s: %v", name, err)
+		}
+		return path
+	}
+	tmuxPath := write("tmux", `case "$1" in
+-V) echo 'tmux 3.5a' ;;
+list-clients)
+  printf '%s\n' '/dev/pts/3	/dev/pts/3	$1	work	100'
+  printf '%s\n' '/dev/pts/6	/dev/pts/6	$2	play	900'
+  ;;
+*) exit 1 ;;
+esac
+`)
+	zellijPath := write("zellij", `case "$1" in
+--version) echo 'zellij 0.43.1' ;;
+list-sessions)
+  printf '%s\n' 'old [Created 1day ago] (EXITED - attach to resurrect)'
+  printf '%s\n' 'work [Created 2h ago]'
+  ;;
+esac
+`)
+	socket := filepath.Join(dir, "default")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listening on a stand-in tmux socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	meta := socket + ",1,0"
+
+	for _, tc := range []struct {
+		name    string
+		backend string
+		opts    Options
+		// want is "name:status" per check, in order.
+		want       []string
+		wantDetail string
+	}{
+		{
+			name:    "tmux-popup on its client",
+			backend: NameTmuxPopup,
+			opts: Options{
+				BinaryPath: tmuxPath, SessionMeta: meta, SessionId: "$1", ClientId: "/dev/pts/3",
+			},
+			want: []string{
+				"binary:ok", "session meta:ok", "version:ok", "client:ok", "session:ok",
+			},
+			wantDetail: "tmux 3.5a",
+		},
+		{
+			name:    "tmux-popup on a client that is gone",
+			backend: NameTmuxPopup,
+			opts: Options{
+				BinaryPath: tmuxPath, SessionMeta: meta, SessionId: "$2", ClientId: "/dev/pts/9",
+			},
+			want: []string{
+				"binary:ok", "session meta:ok", "version:ok", "client:warn", "session:ok",
+			},
+			wantDetail: "the popup would go to /dev/pts/6 instead",
+		},
+		{
+			name:    "tmux-floating-pane in a session nobody views",
+			backend: NameTmuxFloatingPane,
+			opts:    Options{BinaryPath: tmuxPath, TMUX: meta, SessionId: "$7"},
+			want:    []string{"binary:ok", "session meta:ok", "version:ok", "session:warn"},
+		},
+		{
+			name:       "a tmux server that is gone",
+			backend:    NameTmuxPopup,
+			opts:       Options{BinaryPath: tmuxPath, SessionMeta: dir + "/gone,1,0"},
+			want:       []string{"binary:ok", "session meta:fail"},
+			wantDetail: "the server socket is gone",
+		},
+		{
+			name:       "a malformed session meta",
+			backend:    NameTmuxPopup,
+			opts:       Options{BinaryPath: tmuxPath, SessionMeta: "nonsense"},
+			want:       []string{"binary:ok", "session meta:fail"},
+			wantDetail: "tmux session meta is malformed",
+		},
+		{
+			name:       "no binary",
+			backend:    NameWezterm,
+			opts:       Options{BinaryPath: filepath.Join(dir, "wezterm")},
+			want:       []string{"binary:fail"},
+			wantDetail: "no such file",
+		},
+		{
+			name:    "zellij",
+			backend: NameZellij,
+			opts:    Options{BinaryPath: zellijPath, SessionId: "work"},
+			want:    []string{"binary:ok", "version:ok", "session:ok"},
+		},
+		{
+			name:       "an exited zellij session",
+			backend:    NameZellij,
+			opts:       Options{BinaryPath: zellijPath, SessionId: "old"},
+			want:       []string{"binary:ok", "version:ok", "session:fail"},
+			wantDetail: "has exited",
+		},
+		{
+			name:       "nvim with nothing to talk to",
+			backend:    NameNvim,
+			want:       []string{"server:fail"},
+			wantDetail: "no Neovim server",
+		},
+		{
+			name:    "pty needs nothing",
+			backend: NamePty,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			checks := Diagnose(t.Context(), tc.backend, tc.opts)
+			var got []string
+			var details []string
+			for _, c := range checks {
+				got = append(got, c.Name+":"+string(c.Status))
+				details = append(details, c.Detail)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Diagnose = %v, want %v\n%+v", got, tc.want, checks)
+			}
+			if !strings.Contains(strings.Join(details, "\n"), tc.wantDetail) {
+				t.Errorf("no detail says %q:\n%+v", tc.wantDetail, checks)
+			}
+		})
+	}
+}
+
+// screen -v exits 1 having printed its version, which is a screen that runs.
+func TestDiagnose_versionDespiteTheStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "screen")
+	script := "#!/bin/sh\necho 'Screen version 4.09.01 (GNU) 20-Aug-23'\nexit 1\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	checks := Diagnose(t.Context(), NameScreen, Options{BinaryPath: path})
+	want := runinpopup.Check{
+		Name:   "version",
+		Status: runinpopup.CheckOK,
+		Detail: "Screen version 4.09.01 (GNU) 20-Aug-23",
+	}
+	if len(checks) != 2 || checks[1] != want {
+		t.Errorf("Diagnose = %+v, want the version %+v", checks, want)
+	}
+}
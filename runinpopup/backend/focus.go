@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/zellij"
+)
+
+// Focus is where the user is, as the multiplexer reports it when asked: the
+// session, and for tmux the client, that Options would otherwise have taken
+// from PINENTRY_USER_DATA.
+type Focus struct {
+	SessionId string
+	ClientId  string
+}
+
+// ResolveFocus asks the multiplexer behind the named backend where the user is
+// now. It is what a "_DYNAMIC" PINENTRY_USER_DATA kind is for: a session and a
+// client recorded when a shell started go stale the moment the user switches
+// sessions or re-attaches, while the server they run on does not.
+//
+// tmux answers with its most recently active client and the session that
+// client shows. zellij keeps no activity, so it answers with the session the
+// caller runs in when there is one, and otherwise only when a single session
+// is live. Only the server coordinates of opts are read: BinaryPath, plus
+// SessionMeta and TMUX for tmux.
+func ResolveFocus(ctx context.Context, name string, opts Options) (Focus, error) {
+	switch name {
+	case NameTmuxPopup, NameTmuxFloatingPane:
+		client, err := tmux.New(tmux.Options{
+			Path:        opts.BinaryPath,
+			SessionMeta: opts.SessionMeta,
+			TMUX:        opts.TMUX,
+		})
+		if err != nil {
+			return Focus{}, err
+		}
+		clients, err := client.ListClients(ctx)
+		if err != nil {
+			return Focus{}, err
+		}
+		recent, ok := tmux.MostRecentClient(clients, nil)
+		if !ok {
+			return Focus{}, errors.New("no tmux client is attached to show the popup on")
+		}
+		return Focus{SessionId: recent.SessionId, ClientId: recent.Name}, nil
+	case NameZellij:
+		sessions, err := zellij.New(zellij.Options{Path: opts.BinaryPath}).ListSessions(ctx)
+		if err != nil {
+			return Focus{}, err
+		}
+		session, err := zellij.FocusedSession(sessions)
+		if err != nil {
+			return Focus{}, err
+		}
+		return Focus{SessionId: session}, nil
+	default:
+		return Focus{}, fmt.Errorf(
+			"backend %s cannot look up where the user is: only %s, %s and %s can",
+			name, NameTmuxPopup, NameTmuxFloatingPane, NameZellij,
+		)
+	}
+}
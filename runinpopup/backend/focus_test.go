@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveFocus(t *testing.T) {
+	tmuxPath := fakeTmuxClients(t,
+		"/dev/pts/3\t/dev/pts/3\t$1\twork\t100",
+		"/dev/pts/6\t/dev/pts/6\t$2\tplay\t900",
+	)
+	zellijPath := filepath.Join(t.TempDir(), "zellij")
+	script := "#!/bin/sh\nprintf '%s\\n' 'old [Created 1day ago] (EXITED - attach to resurrect)'" +
+		" 'work [Created 2h ago]'\n"
+	if err := os.WriteFile(zellijPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake zellij: %v", err)
+	}
+	const tmuxEnv = "/tmp/tmux-1000/default,1,0"
+
+	for _, tc := range []struct {
+		name    string
+		backend string
+		opts    Options
+		want    Focus
+		wantErr string
+	}{
+		{
+			name:    "tmux-popup",
+			backend: NameTmuxPopup,
+			opts:    Options{BinaryPath: tmuxPath, SessionMeta: tmuxEnv},
+			want:    Focus{SessionId: "$2", ClientId: "/dev/pts/6"},
+		},
+		{
+			name:    "tmux-floating-pane",
+			backend: NameTmuxFloatingPane,
+			opts:    Options{BinaryPath: tmuxPath, TMUX: tmuxEnv},
+			want:    Focus{SessionId: "$2", ClientId: "/dev/pts/6"},
+		},
+		{
+			name:    "tmux with nobody attached",
+			backend: NameTmuxPopup,
+			opts:    Options{BinaryPath: fakeTmuxClients(t), TMUX: tmuxEnv},
+			wantErr: "no tmux client is attached",
+		},
+		{
+			name:    "zellij",
+			backend: NameZellij,
+			opts:    Options{BinaryPath: zellijPath},
+			want:    Focus{SessionId: "work"},
+		},
+		{
+			name:    "a backend that cannot tell",
+			backend: NameScreen,
+			wantErr: "backend screen cannot look up where the user is",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveFocus(t.Context(), tc.backend, tc.opts)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ResolveFocus = %+v, %v, want an error containing %q",
+						got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveFocus: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveFocus = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
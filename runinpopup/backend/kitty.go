@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/kitty"
+)
+
+var (
+	_ runinpopup.TTYHandshaker      = (*Kitty)(nil)
+	_ runinpopup.CapabilityReporter = (*Kitty)(nil)
+)
+
+// Kitty opens popups as kitty windows through its remote-control protocol
+// ("kitty @ launch"). The two kinds of window it can use are two backends, the
+// way tmux's two popup mechanisms are: an overlay over the window the user is
+// in, or an OS window of its own.
+type Kitty struct {
+	name       string
+	windowType kitty.WindowType
+	kitty      *kitty.Client
+	windowId   string
+}
+
+// NewKitty builds the "kitty" backend, which opens an overlay window. It uses
+// BinaryPath (default "kitty"), SessionId as the id of the window to overlay —
+// kitty addresses windows rather than sessions — falling back to
+// KittyWindowId, SessionMeta as the $KITTY_LISTEN_ON address kitty takes remote
+// control on, and Shell (default "sh"). ClientId and TMUX are ignored.
+//
+// kitty answers a remote-control request only when allow_remote_control is
+// enabled in its configuration; from outside kitty — gpg-agent's children — it
+// also has to listen on the SessionMeta address.
+func NewKitty(opts Options) (*Kitty, error) {
+	return newKitty(NameKitty, kitty.TypeOverlay, opts), nil
+}
+
+// NewKittyOSWindow builds the "kitty-os-window" backend, which opens a
+// top-level window rather than covering the user's. It reads the same Options
+// as NewKitty.
+func NewKittyOSWindow(opts Options) (*Kitty, error) {
+	return newKitty(NameKittyOSWindow, kitty.TypeOSWindow, opts), nil
+}
+
+func newKitty(name string, windowType kitty.WindowType, opts Options) *Kitty {
+	return &Kitty{
+		name:       name,
+		windowType: windowType,
+		kitty: kitty.New(kitty.Options{
+			Path:   opts.BinaryPath,
+			Socket: opts.SessionMeta,
+			Shell:  opts.Shell,
+		}),
+		windowId: cmp.Or(opts.SessionId, opts.KittyWindowId),
+	}
+}
+
+func (b *Kitty) Name() string {
+	return b.name
+}
+
+func (b *Kitty) Capabilities() runinpopup.Capabilities {
+	return capabilities[b.name]
+}
+
+// Launch opens the spec as a kitty window of this backend's type.
+func (b *Kitty) Launch(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.PopupHandle, error) {
+	req, err := b.launchRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	return b.kitty.StartLaunch(ctx, req)
+}
+
+// launchRequest translates the spec for "kitty @ launch". Neither window type
+// can be placed or sized from there — an overlay is exactly as big as what it
+// covers, and an OS window is the window manager's to place — so any geometry
+// is refused rather than silently dropped.
+func (b *Kitty) launchRequest(spec runinpopup.LaunchSpec) (kitty.LaunchRequest, error) {
+	if spec.X != "" || spec.Y != "" || spec.Width != "" || spec.Height != "" || spec.Anchor != "" {
+		return kitty.LaunchRequest{}, fmt.Errorf(
+			"backend %s: a kitty %s window cannot be placed or sized;"+
+				" leave the geometry to kitty",
+			b.name, b.windowType,
+		)
+	}
+	return kitty.LaunchRequest{
+		Type:     b.windowType,
+		WindowId: b.windowId,
+		Title:    spec.Title,
+		Env:      spec.Env,
+		Command:  spec.Command,
+		Script:   spec.Script,
+	}, nil
+}
+
+// Prepare is a no-op: opening a window disturbs nothing that would need
+// putting back.
+func (b *Kitty) Prepare(_ context.Context) (func(context.Context) error, error) {
+	return nil, nil
+}
+
+// NewTTYHandshake uses the tmux handshake as it is: "kitty @ launch" takes the
+// window's environment as flags (--env) the way tmux does (-e), so the FIFO
+// paths travel the same way.
+func (b *Kitty) NewTTYHandshake(
+	ttyFifo, doneFifo string,
+) (runinpopup.TTYHandshake, error) {
+	return newTmuxTTYHandshake(ttyFifo, doneFifo)
+}
@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/nvim"
+)
+
+var (
+	_ runinpopup.TTYHandshaker      = (*Nvim)(nil)
+	_ runinpopup.CapabilityReporter = (*Nvim)(nil)
+)
+
+// Nvim opens popups as floating terminal windows of a running Neovim, over the
+// msgpack-RPC server it exposes to its own terminals as $NVIM. It is the popup
+// for the program that needs one from inside an editor — a pinentry-curses
+// under a lazygit under Neovim — drawn over the editor rather than beside it.
+type Nvim struct {
+	nvim *nvim.Client
+}
+
+// NewNvim builds the "nvim" backend. It uses SessionMeta as the server address
+// to talk to, falling back to NVIM, and Shell (default "sh"). There is no
+// executable in between, so BinaryPath is ignored, as are SessionId, ClientId
+// and TMUX.
+func NewNvim(opts Options) (*Nvim, error) {
+	return &Nvim{
+		nvim: nvim.New(nvim.Options{
+			Address: cmp.Or(opts.SessionMeta, opts.NVIM),
+			Shell:   opts.Shell,
+		}),
+	}, nil
+}
+
+func (b *Nvim) Name() string {
+	return NameNvim
+}
+
+func (b *Nvim) Capabilities() runinpopup.Capabilities {
+	return capabilities[NameNvim]
+}
+
+// Launch opens the spec as a float over the editor.
+func (b *Nvim) Launch(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.PopupHandle, error) {
+	req, err := b.floatRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	return b.nvim.StartFloat(ctx, req), nil
+}
+
+// floatRequest translates the spec for a float. A float is placed and sized in
+// cells of the editor, so cells and percentages carry over as they are, and of
+// tmux's position specifiers the two that mean something inside an editor —
+// C, and R for X — do too. The rest name things a float has no notion of, a
+// pane's corner or the mouse, and are refused before anything is opened. An
+// Anchor goes along as it is: the float's layout is worked out against the
+// editor's size, which only the editor has.
+func (b *Nvim) floatRequest(spec runinpopup.LaunchSpec) (nvim.FloatRequest, error) {
+	for _, f := range []struct {
+		name, value string
+		right       bool
+	}{{"x", spec.X, true}, {"y", spec.Y, false}} {
+		if geometry.IsPosition(f.value) && f.value != "C" && (f.value != "R" || !f.right) {
+			return nvim.FloatRequest{}, fmt.Errorf(
+				"backend %s: position %s %q has no equivalent inside an editor;"+
+					" use cells, a percentage or C",
+				NameNvim, f.name, f.value,
+			)
+		}
+	}
+	return nvim.FloatRequest{
+		Geometry: nvim.Geometry{
+			X: spec.X, Y: spec.Y, Width: spec.Width, Height: spec.Height,
+			Anchor: spec.Anchor, Margin: spec.Margin,
+		},
+		Title:   spec.Title,
+		Env:     spec.Env,
+		Command: spec.Command,
+		Script:  spec.Script,
+	}, nil
+}
+
+// Prepare is a no-op: a float covers the editor without rearranging it.
+func (b *Nvim) Prepare(_ context.Context) (func(context.Context) error, error) {
+	return nil, nil
+}
+
+// NewTTYHandshake uses the tmux handshake as it is: termopen takes the job's
+// environment, so the FIFO paths travel the way they do for tmux.
+func (b *Nvim) NewTTYHandshake(
+	ttyFifo, doneFifo string,
+) (runinpopup.TTYHandshake, error) {
+	return newTmuxTTYHandshake(ttyFifo, doneFifo)
+}
@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/pty"
+)
+
+var (
+	_ runinpopup.TTYHandshaker      = (*Pty)(nil)
+	_ runinpopup.CapabilityReporter = (*Pty)(nil)
+)
+
+// PtyTerminal is a popup the pty backend opened: the payload running on a
+// pseudo-terminal, and that terminal's master side. Screen and WaitFor read
+// what the payload drew, Write types at it.
+type PtyTerminal = pty.Terminal
+
+// Pty opens popups on pseudo-terminals of this process's own, with no
+// multiplexer and nothing on screen: the payload runs under "/bin/sh -c" on a
+// terminal only this process holds the other side of. It is for tests and CI,
+// where a scripted user takes Next's terminal and plays the part a person at a
+// multiplexer would, and for running a popup's stream plumbing where there is
+// no terminal at all.
+//
+// It is never auto-detected; nothing in the environment names it.
+type Pty struct {
+	pty *pty.Client
+
+	mu        sync.Mutex
+	terminals []*PtyTerminal
+	next      int
+	// launched is closed and replaced whenever terminals grows.
+	launched chan struct{}
+}
+
+// NewPty builds the "pty" backend. It uses Shell (default "/bin/sh") and
+// ignores everything else: there is no multiplexer to find.
+func NewPty(opts Options) (*Pty, error) {
+	return &Pty{
+		pty:      pty.New(pty.Options{Shell: opts.Shell}),
+		launched: make(chan struct{}),
+	}, nil
+}
+
+func (b *Pty) Name() string {
+	return NamePty
+}
+
+func (b *Pty) Capabilities() runinpopup.Capabilities {
+	return capabilities[NamePty]
+}
+
+// Launch starts the spec on a new terminal, which Next then hands out. The
+// environment is the process's own rather than anything on a command line, and
+// spec.Title is dropped: a terminal nobody displays has nowhere to show one.
+func (b *Pty) Launch(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.PopupHandle, error) {
+	req, err := ptyRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	term, err := b.pty.Start(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.terminals = append(b.terminals, term)
+	close(b.launched)
+	b.launched = make(chan struct{})
+	return term, nil
+}
+
+// ptyRequest translates the spec into a terminal. A terminal of its own has a
+// size and no surroundings, so the size is all the geometry it takes, and in
+// cells only: there is no screen for a percentage to be a share of, or for a
+// position to be on.
+func ptyRequest(spec runinpopup.LaunchSpec) (pty.Request, error) {
+	for _, f := range []struct{ name, value string }{
+		{"x", spec.X}, {"y", spec.Y}, {"anchor", spec.Anchor},
+	} {
+		if f.value != "" {
+			return pty.Request{}, fmt.Errorf(
+				"backend %s: a headless terminal has no screen to be placed on, so %s %q"+
+					" has no meaning; leave the position unset",
+				NamePty, f.name, f.value,
+			)
+		}
+	}
+	req := pty.Request{Env: spec.Env, Command: spec.Command, Script: spec.Script}
+	for _, f := range []struct {
+		name, value string
+		cells       *int
+	}{{"width", spec.Width, &req.Cols}, {"height", spec.Height, &req.Rows}} {
+		if f.value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f.value)
+		if err != nil || n <= 0 {
+			return pty.Request{}, fmt.Errorf(
+				"backend %s: a headless terminal has no screen for %s %q to be a share of;"+
+					" size it in cells",
+				NamePty, f.name, f.value,
+			)
+		}
+		*f.cells = n
+	}
+	return req, nil
+}
+
+// Next returns the terminals this backend launched, one per call in launch
+// order, waiting for the next launch once every earlier one has been handed
+// out. It is how a test gets hold of the popup a launcher opened somewhere
+// inside a call it does not otherwise see into.
+func (b *Pty) Next(ctx context.Context) (*PtyTerminal, error) {
+	for {
+		b.mu.Lock()
+		if b.next < len(b.terminals) {
+			term := b.terminals[b.next]
+			b.next++
+			b.mu.Unlock()
+			return term, nil
+		}
+		launched := b.launched
+		b.mu.Unlock()
+		select {
+		case <-launched:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a pty popup: %w", context.Cause(ctx))
+		}
+	}
+}
+
+// Prepare is a no-op: a terminal of its own shares nothing to put back.
+func (b *Pty) Prepare(_ context.Context) (func(context.Context) error, error) {
+	return nil, nil
+}
+
+// NewTTYHandshake hands the FIFO paths over as popup env, like tmux's: the
+// terminal's environment is given to the process directly.
+func (b *Pty) NewTTYHandshake(ttyFifo, doneFifo string) (runinpopup.TTYHandshake, error) {
+	return newTmuxTTYHandshake(ttyFifo, doneFifo)
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+)
+
+func ptyBackend(t *testing.T) *Pty {
+	t.Helper()
+	b, err := NewPty(Options{})
+	if err != nil {
+		t.Fatalf("NewPty: %v", err)
+	}
+	return b
+}
+
+// nextTerminal takes the popup a launch opened, as the user at it would.
+func nextTerminal(t *testing.T, b *Pty) *PtyTerminal {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	term, err := b.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return term
+}
+
+func awaitTerminal(t *testing.T, term *PtyTerminal, text string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	if err := term.WaitFor(ctx, text); err != nil {
+		t.Fatalf("%v; the terminal shows %q", err, term.Screen())
+	}
+}
+
+// A terminal of its own takes a size in cells and nothing else.
+func TestPty_Launch_geometry(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		spec       runinpopup.PopupSpec
+		rows, cols int
+		wantErr    string
+	}{
+		{name: "unset", spec: runinpopup.PopupSpec{}},
+		{name: "cells", spec: runinpopup.PopupSpec{Width: "100", Height: "30"}, rows: 30, cols: 100},
+		{name: "percentage", spec: runinpopup.PopupSpec{Width: "80%"}, wantErr: "size it in cells"},
+		{name: "zero", spec: runinpopup.PopupSpec{Height: "0"}, wantErr: "size it in cells"},
+		{name: "position", spec: runinpopup.PopupSpec{X: "C"}, wantErr: "no screen to be placed on"},
+		{name: "cells apart", spec: runinpopup.PopupSpec{Y: "4"}, wantErr: "no screen to be placed on"},
+		{
+			name:    "anchor",
+			spec:    runinpopup.PopupSpec{Anchor: "center"},
+			wantErr: "no screen to be placed on",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.spec.Command = []string{"true"}
+			req, err := ptyRequest(launchSpec(tc.spec))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ptyRequest = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ptyRequest: %v", err)
+			}
+			if req.Rows != tc.rows || req.Cols != tc.cols {
+				t.Errorf("size = %dx%d, want %dx%d", req.Rows, req.Cols, tc.rows, tc.cols)
+			}
+		})
+	}
+}
+
+// The handshake's FIFO paths reach the payload as its environment, the way
+// tmux's popup env delivers them.
+func TestPty_Launch_ttyHandshake(t *testing.T) {
+	handshake, err := ptyBackend(t).NewTTYHandshake("/tmp/popup/tty", "/tmp/popup/done")
+	if err != nil {
+		t.Fatalf("NewTTYHandshake: %v", err)
+	}
+	req, err := ptyRequest(launchSpec(handshake.Spec))
+	if err != nil {
+		t.Fatalf("ptyRequest: %v", err)
+	}
+	want := map[string]string{"TTY_FIFO_FILE": "/tmp/popup/tty", "DONE_FIFO_FILE": "/tmp/popup/done"}
+	if !maps.Equal(req.Env, want) {
+		t.Errorf("env = %v, want %v", req.Env, want)
+	}
+	if req.Script != tmuxTTYHandshakeScript {
+		t.Errorf("script = %q, want the tmux handshake", req.Script)
+	}
+}
+
+// The whole launch layer against the one backend that needs no multiplexer:
+// the payload prompts on its terminal, a scripted user answers at the master
+// side, and the answer comes back over the payload's stdout FIFO along with its
+// exit status.
+func TestPty_PopupLauncher_Exec(t *testing.T) {
+	b := ptyBackend(t)
+	launcher := &runinpopup.PopupLauncher{Backend: b}
+
+	popup, err := launcher.Exec(
+		t.Context(),
+		runinpopup.PopupSpec{
+			Script: `printf 'name? ' >&2; read name; echo "hello, $name"; exit 7`,
+		},
+		runinpopup.PopupStreams{StdoutPipe: true, ExitStatus: true},
+	)
+	if err != nil {
+		t.Skipf("cannot open a pty popup here: %v", err)
+	}
+	term := nextTerminal(t, b)
+	awaitTerminal(t, term, "name? ")
+	if _, err := term.Write([]byte("gopher\r")); err != nil {
+		t.Fatalf("typing at the popup: %v", err)
+	}
+
+	stdout, _ := popup.StdoutPipe()
+	out, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatalf("reading the popup's stdout: %v", err)
+	}
+	if got, want := string(out), "hello, gopher\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	// The shell is the popup, so its exit is the launcher's too; the status
+	// arrives either way.
+	_ = popup.Wait()
+	if code, ok := popup.ExitCode(); !ok || code != 7 {
+		t.Errorf("ExitCode = %d, %v; want 7, true", code, ok)
+	}
+}
+
+// Next hands each launch's terminal out once, in order, and waits for the
+// next launch when it has handed out every one.
+func TestPty_Next(t *testing.T) {
+	b := ptyBackend(t)
+	var handles []runinpopup.PopupHandle
+	for _, word := range []string{"first", "second"} {
+		h, err := b.Launch(t.Context(), runinpopup.LaunchSpec{Command: []string{"echo", word}})
+		if err != nil {
+			t.Skipf("cannot open a pty popup here: %v", err)
+		}
+		handles = append(handles, h)
+	}
+	for i, want := range []string{"first", "second"} {
+		term := nextTerminal(t, b)
+		if runinpopup.PopupHandle(term) != handles[i] {
+			t.Errorf("Next #%d is not the terminal launch #%d opened", i, i)
+		}
+		awaitTerminal(t, term, want)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if term, err := b.Next(ctx); err == nil {
+		t.Fatalf("Next = %s, want it to wait for a launch that never comes", term.Name())
+	}
+}
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/screen"
+)
+
+var (
+	_ runinpopup.TTYHandshaker      = (*Screen)(nil)
+	_ runinpopup.CapabilityReporter = (*Screen)(nil)
+)
+
+// Screen opens popups as windows of a GNU screen session, through the commands
+// "screen -X" sends it. screen has no floating layer at all, so the popup is a
+// window of its own that takes the display over until its payload exits.
+type Screen struct {
+	screen *screen.Client
+}
+
+// NewScreen builds the "screen" backend. It uses BinaryPath (default "screen"),
+// SessionId as the session to open the window in, falling back to STY,
+// SessionMeta as the $SCREENDIR holding that session's socket, and Shell
+// (default "sh"). ClientId and TMUX are ignored.
+func NewScreen(opts Options) (*Screen, error) {
+	return &Screen{
+		screen: screen.New(screen.Options{
+			Path:    opts.BinaryPath,
+			Session: cmp.Or(opts.SessionId, opts.STY),
+			Dir:     opts.SessionMeta,
+			Shell:   opts.Shell,
+		}),
+	}, nil
+}
+
+func (b *Screen) Name() string {
+	return NameScreen
+}
+
+func (b *Screen) Capabilities() runinpopup.Capabilities {
+	return capabilities[NameScreen]
+}
+
+// Launch opens the spec as a new window of this backend's session.
+func (b *Screen) Launch(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.PopupHandle, error) {
+	req, err := b.windowRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	return b.screen.StartWindow(ctx, req)
+}
+
+// windowRequest translates the spec into a new window. A screen window always
+// fills the display — splitting regions is a per-display layout, not something
+// a window can be opened into — so any geometry is refused rather than
+// silently dropped.
+func (b *Screen) windowRequest(spec runinpopup.LaunchSpec) (screen.WindowRequest, error) {
+	if spec.X != "" || spec.Y != "" || spec.Width != "" || spec.Height != "" || spec.Anchor != "" {
+		return screen.WindowRequest{}, fmt.Errorf(
+			"backend %s: a screen window fills the display and cannot be placed or"+
+				" sized; leave the geometry unset",
+			NameScreen,
+		)
+	}
+	if len(spec.Env) > 0 && spec.WorkDir == "" {
+		return screen.WindowRequest{}, errors.New(
+			"the launch has no work directory to deliver the popup environment in",
+		)
+	}
+	return screen.WindowRequest{
+		Title:          spec.Title,
+		Env:            spec.Env,
+		WorkDir:        spec.WorkDir,
+		StartupTimeout: spec.StartupTimeout,
+		Command:        spec.Command,
+		Script:         spec.Script,
+	}, nil
+}
+
+// Prepare is a no-op: screen switches the display back to the previous window
+// when the popup's window goes away, so there is nothing to put back.
+func (b *Screen) Prepare(_ context.Context) (func(context.Context) error, error) {
+	return nil, nil
+}
+
+// NewTTYHandshake announces the tty as-is, the FIFO paths in the argv itself
+// like wezterm's: "screen -X screen" has no environment flag either.
+func (b *Screen) NewTTYHandshake(
+	ttyFifo, doneFifo string,
+) (runinpopup.TTYHandshake, error) {
+	return runinpopup.TTYHandshake{
+		Spec: runinpopup.PopupSpec{
+			Script: runinpopup.TTYHandshakeScript(ttyFifo, doneFifo),
+		},
+	}, nil
+}
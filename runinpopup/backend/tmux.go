@@ -1,18 +1,19 @@
 package backend
 
-import (
-	"github.com/ngicks/run-in-tmux-popup/runinpopup"
-)
+import "github.com/ngicks/run-in-tmux-popup/runinpopup"
 
 // Shared by the two tmux backends. They differ only in the popup mechanism
 // (display-popup vs. new-pane); the tty handshake works identically, so it
-// lives here rather than being duplicated per backend.
+// lives here rather than being duplicated per backend. The kitty and nvim
+// backends use it too: "kitty @ launch" and termopen inject an environment the
+// same way.
 
-// tmuxTTYHandshakeScript reports the popup's tty on ${TTY_FIFO_FILE}, then
+// tmuxTTYHandshakeScript reports the popup's terminal on ${TTY_FIFO_FILE}, then
 // blocks until the proxy writes to ${DONE_FIFO_FILE}. The FIFO paths arrive as
-// popup env so they never appear in the tmux argv twice.
-const tmuxTTYHandshakeScript = "echo $(tty) >> ${TTY_FIFO_FILE}" +
-	" && read done < ${DONE_FIFO_FILE}"
+// popup env so they never appear in the tmux argv twice. A backend with no way
+// to hand a popup its environment splices the paths themselves into
+// runinpopup.TTYHandshakeScript instead.
+var tmuxTTYHandshakeScript = runinpopup.TTYHandshakeScript("${TTY_FIFO_FILE}", "${DONE_FIFO_FILE}")
 
 // newTmuxTTYHandshake announces the tty as-is. Earlier versions wrapped it in
 // per-popup random prefix/suffix secrets injected through the popup env, but
@@ -8,7 +8,10 @@ import (
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
 )
 
-var _ runinpopup.TTYHandshaker = (*TmuxFloatingPane)(nil)
+var (
+	_ runinpopup.TTYHandshaker      = (*TmuxFloatingPane)(nil)
+	_ runinpopup.CapabilityReporter = (*TmuxFloatingPane)(nil)
+)
 
 // TmuxFloatingPane opens popups as tmux floating panes ("tmux new-pane",
 // bound to `*` by default). A floating pane belongs to a window rather than to a
@@ -43,11 +46,27 @@ func (b *TmuxFloatingPane) Name() string {
 	return NameTmuxFloatingPane
 }
 
-// Launch opens the spec as a floating pane in this backend's session.
+func (b *TmuxFloatingPane) Capabilities() runinpopup.Capabilities {
+	return capabilities[NameTmuxFloatingPane]
+}
+
+// Launch opens the spec as a floating pane in this backend's session. An Anchor
+// is placed in the session's current window, which is the one the pane opens
+// in, so that window is measured first — only then, since nothing else needs
+// its size.
 func (b *TmuxFloatingPane) Launch(
 	ctx context.Context,
 	spec runinpopup.LaunchSpec,
 ) (runinpopup.PopupHandle, error) {
+	if spec.Anchor != "" {
+		cols, rows, err := b.tmux.WindowSize(ctx, b.sessionId)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: anchor %q: %w", NameTmuxFloatingPane, spec.Anchor, err)
+		}
+		if spec, err = anchored(NameTmuxFloatingPane, spec, cols, rows); err != nil {
+			return nil, err
+		}
+	}
 	return b.tmux.StartNewPane(ctx, b.paneRequest(spec))
 }
 
@@ -1,27 +1,50 @@
 package backend
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/ngicks/go-common/contextkey"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
 )
 
-var _ runinpopup.TTYHandshaker = (*TmuxPopup)(nil)
+var (
+	_ runinpopup.TTYHandshaker      = (*TmuxPopup)(nil)
+	_ runinpopup.CapabilityReporter = (*TmuxPopup)(nil)
+)
 
 // TmuxPopup opens popups with tmux's display-popup ("tmux popup"). The
 // popup is a client-side overlay, so it targets a client rather than a session.
 type TmuxPopup struct {
-	tmux     *tmux.Client
-	clientId string
+	tmux      *tmux.Client
+	clientId  string
+	sessionId string
+
+	// liveClient is the client Prepare found attached in clientId's stead, the
+	// one the launch after it opens on. Empty while clientId itself is there.
+	mu         sync.Mutex
+	liveClient string
+	// cols and rows are the size, in cells, of the terminal the popup opens on,
+	// as Prepare found it; zero when it has not, and sizeErr then says why, if
+	// Prepare got as far as asking.
+	cols, rows int
+	sizeErr    error
 }
 
 // NewTmuxPopup builds the "tmux-popup" backend. It uses BinaryPath
-// (default "tmux"), ClientId, SessionMeta and TMUX; SessionId and Shell are not
-// needed because display-popup runs on a client and through tmux's own
-// default-shell.
+// (default "tmux"), ClientId, SessionId, SessionMeta and TMUX; Shell is not
+// needed because display-popup runs through tmux's own default-shell. SessionId
+// only picks the client standing in for a ClientId that has gone away: the
+// popup itself goes to a client, not a session.
 //
 // SessionMeta is only validated when it is the value that will be used, i.e.
 // when TMUX is empty: a caller already inside tmux does not need it at all.
@@ -34,13 +57,17 @@ func NewTmuxPopup(opts Options) (*TmuxPopup, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &TmuxPopup{tmux: client, clientId: opts.ClientId}, nil
+	return &TmuxPopup{tmux: client, clientId: opts.ClientId, sessionId: opts.SessionId}, nil
 }
 
 func (b *TmuxPopup) Name() string {
 	return NameTmuxPopup
 }
 
+func (b *TmuxPopup) Capabilities() runinpopup.Capabilities {
+	return capabilities[NameTmuxPopup]
+}
+
 // Launch opens the spec as a display-popup on this backend's client.
 func (b *TmuxPopup) Launch(
 	ctx context.Context,
@@ -55,14 +82,33 @@ func (b *TmuxPopup) Launch(
 
 // popupRequest translates the spec for display-popup. Y is the one value that
 // does not arrive as it was written: a spec's Y is the popup's top edge, the
-// same as everywhere else, while display-popup's -y is its bottom one.
+// same as everywhere else, while display-popup's -y is its bottom one. An
+// Anchor is resolved into cells first, against the size Prepare measured.
 func (b *TmuxPopup) popupRequest(spec runinpopup.LaunchSpec) (tmux.PopupRequest, error) {
-	y, err := popupBottomEdge(spec.Y, spec.Height)
+	b.mu.Lock()
+	cols, rows, sizeErr := b.cols, b.rows, b.sizeErr
+	b.mu.Unlock()
+	if spec.Anchor != "" {
+		if rows == 0 {
+			return tmux.PopupRequest{}, fmt.Errorf(
+				"backend %s: anchor %q needs the client's size to place the popup by: %w",
+				NameTmuxPopup, spec.Anchor, cmp.Or(sizeErr, errors.New("it was never measured")),
+			)
+		}
+		var err error
+		if spec, err = anchored(NameTmuxPopup, spec, cols, rows); err != nil {
+			return tmux.PopupRequest{}, err
+		}
+	}
+	y, err := popupBottomEdge(spec.Y, spec.Height, rows)
 	if err != nil {
+		if sizeErr != nil {
+			err = fmt.Errorf("%w (%w)", err, sizeErr)
+		}
 		return tmux.PopupRequest{}, err
 	}
 	return tmux.PopupRequest{
-		ClientId: b.clientId,
+		ClientId: b.client(),
 		Title:    spec.Title,
 		Env:      spec.Env,
 		X:        spec.X,
@@ -87,26 +133,121 @@ func (b *TmuxPopup) popupRequest(spec runinpopup.LaunchSpec) (tmux.PopupRequest,
 // terminal" names a placement tmux works out with the height already in hand.
 // An empty y is likewise left alone — it puts no flag on the command line at
 // all — and so needs no height beside it.
-func popupBottomEdge(y, height string) (string, error) {
+//
+// Two values in one unit add up as they are, and stay in it. Across units, or
+// with the height left to display-popup's default of half the terminal, both
+// are resolved to cells against rows, the terminal's height — rounded the way
+// tmux rounds a percentage, so the popup is as tall as the height it is given
+// makes it, and its top edge where y put it. Zero rows is a terminal never
+// measured, and then only the sum in one unit is there to give.
+func popupBottomEdge(y, height string, rows int) (string, error) {
 	if y == "" || geometry.IsPosition(y) {
 		return y, nil
 	}
-	sum, ok := geometry.Sum(y, height)
+	if sum, ok := geometry.Sum(y, height); ok {
+		return sum, nil
+	}
+	if rows > 0 {
+		top, okY := geometry.Resolve(y, rows)
+		h, okH := geometry.Resolve(cmp.Or(height, tmuxPopupDefaultSize), rows)
+		if okY && okH {
+			return strconv.Itoa(top + h), nil
+		}
+	}
+	return "", fmt.Errorf(
+		"backend %s: popup geometry Y %q needs Height in the same unit, got %q, or the"+
+			" client's size to resolve both: display-popup places a popup by its bottom"+
+			" edge, so the top edge Y names is only reachable by adding the height to it",
+		NameTmuxPopup, y, height,
+	)
+}
+
+// tmuxPopupDefaultSize is the share of the terminal display-popup sizes a popup
+// to along an axis it was given no size for.
+const tmuxPopupDefaultSize = "50%"
+
+// Prepare asks the client the popup is meant for for its terminal size, which
+// a Y and a Height in different units need to be added up, and an Anchor to be
+// placed by. Most popups need no such thing, so a query that fails fails only
+// the launch that needs its answer, and says so there.
+//
+// A client that answers is attached, and that is the whole check for it. One
+// that does not may be gone: PINENTRY_USER_DATA is a snapshot taken when the
+// shell exporting it started, and the client it names is gone once that
+// terminal is closed or the session is re-attached from another, when
+// display-popup fails only once the startup timeout has run out. So then, and
+// only then, the clients are listed. When the client is confirmed missing from
+// the list, the session's most recently active client — the one the user is
+// most likely looking at — takes its place, which is logged, and is measured
+// instead. With no session on record any client of the server will do; with
+// no client to stand in the launch fails here, at once. A list that cannot be
+// had confirms nothing, so it is logged and the named client kept. With no
+// client named at all, tmux resolves the current one itself.
+//
+// Nothing is changed on the tmux side, so there is nothing to restore. The
+// tmux 3.7b crash on popup creation over a zoomed pane is specific to floating
+// panes, and display-popup is unaffected.
+func (b *TmuxPopup) Prepare(ctx context.Context) (func(context.Context) error, error) {
+	cols, rows, sizeErr := b.tmux.ClientSize(ctx, b.clientId)
+	var live string
+	if sizeErr != nil && b.clientId != "" {
+		var err error
+		if live, err = b.liveStandIn(ctx); err != nil {
+			return nil, err
+		}
+		if live != "" {
+			cols, rows, sizeErr = b.tmux.ClientSize(ctx, live)
+		}
+	}
+	b.mu.Lock()
+	b.liveClient, b.cols, b.rows, b.sizeErr = live, cols, rows, sizeErr
+	b.mu.Unlock()
+	return nil, nil
+}
+
+// liveStandIn is the client standing in for clientId, when clientId is
+// confirmed gone: empty while it is attached, or when the clients cannot be
+// listed to tell.
+func (b *TmuxPopup) liveStandIn(ctx context.Context) (string, error) {
+	logger := contextkey.ValueSlogLoggerFallback(ctx, slog.New(slog.DiscardHandler))
+	clients, err := b.tmux.ListClients(ctx)
+	if err != nil {
+		logger.Warn(
+			"could not list the tmux clients; opening the popup on the one named",
+			slog.String("client", b.clientId),
+			slog.Any("err", err),
+		)
+		return "", nil
+	}
+	if slices.ContainsFunc(clients, func(c tmux.ClientInfo) bool { return c.Is(b.clientId) }) {
+		return "", nil
+	}
+	var keep func(tmux.ClientInfo) bool
+	if b.sessionId != "" {
+		keep = func(c tmux.ClientInfo) bool { return c.InSession(b.sessionId) }
+	}
+	recent, ok := tmux.MostRecentClient(clients, keep)
 	if !ok {
 		return "", fmt.Errorf(
-			"backend %s: popup geometry Y %q needs Height in the same unit, got %q:"+
-				" display-popup places a popup by its bottom edge, so the top edge Y"+
-				" names is only reachable by adding the height to it",
-			NameTmuxPopup, y, height,
+			"tmux client %s is gone, and no other client is attached to session %q to"+
+				" show the popup on",
+			b.clientId, b.sessionId,
 		)
 	}
-	return sum, nil
+	logger.Info(
+		"the tmux client is gone; opening the popup on the most recently active one",
+		slog.String("gone", b.clientId),
+		slog.String("client", recent.Name),
+	)
+	return recent.Name, nil
 }
 
-// Prepare is a no-op: the tmux 3.7b crash on popup creation over a zoomed pane
-// is specific to floating panes, and display-popup is unaffected.
-func (b *TmuxPopup) Prepare(_ context.Context) (func(context.Context) error, error) {
-	return nil, nil
+// client is the client the popup opens on: the one Prepare found standing in
+// for clientId, or clientId itself.
+func (b *TmuxPopup) client() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return cmp.Or(b.liveClient, b.clientId)
 }
 
 // NewTTYHandshake uses the shared tmux handshake: display-popup injects the
@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/tmux"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/zellij"
+)
+
+// Here are the ambient values of the shell a PINENTRY_USER_DATA is built for,
+// read by the caller as Hints are. They are the variables each multiplexer or
+// terminal sets in the shells it runs, a superset of Hints: a wrapper needs
+// the socket as well as the pane.
+type Here struct {
+	// TMUX is $TMUX.
+	TMUX string
+	// ZellijSessionName is $ZELLIJ_SESSION_NAME.
+	ZellijSessionName string
+	// STY is $STY, and ScreenDir $SCREENDIR.
+	STY, ScreenDir string
+	// NVIM is $NVIM.
+	NVIM string
+	// WeztermPane is $WEZTERM_PANE, and WeztermUnixSocket $WEZTERM_UNIX_SOCKET.
+	WeztermPane, WeztermUnixSocket string
+	// KittyWindowId is $KITTY_WINDOW_ID, and KittyListenOn $KITTY_LISTEN_ON.
+	KittyWindowId, KittyListenOn string
+	// LookPath finds a multiplexer's binary; nil means exec.LookPath.
+	LookPath func(file string) (string, error)
+}
+
+// UserDataHere builds the PINENTRY_USER_DATA that opens the named backend's
+// popup where the caller is, the value a shell exports at startup. Whatever
+// the environment does not say is asked of the multiplexer: tmux for the
+// session and client the caller's shell is attached through, zellij for its
+// current session.
+//
+// A field the backend does not read is left empty, and the value is only as
+// fresh as the moment it was built; see PinentryUserData.Dynamic for one that
+// is not.
+func UserDataHere(
+	ctx context.Context,
+	name string,
+	here Here,
+) (runinpopup.PinentryUserData, error) {
+	data := runinpopup.PinentryUserData{Kind: UserDataKind(name)}
+	if data.Kind == "" {
+		return runinpopup.PinentryUserData{}, fmt.Errorf(
+			"backend %s opens on no multiplexer PINENTRY_USER_DATA could name", name,
+		)
+	}
+	lookPath := here.LookPath
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+	binary := func(file string) error {
+		path, err := lookPath(file)
+		data.Path = path
+		return err
+	}
+
+	switch name {
+	case NameTmuxPopup, NameTmuxFloatingPane:
+		if here.TMUX == "" {
+			return runinpopup.PinentryUserData{}, errors.New("not inside tmux: $TMUX is not set")
+		}
+		if err := binary("tmux"); err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		client, err := tmux.New(tmux.Options{Path: data.Path, TMUX: here.TMUX})
+		if err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		current, err := client.CurrentClient(ctx)
+		if err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		data.SessionId, data.SessionMeta = current.SessionId, here.TMUX
+		// new-pane cannot target a client, and a floating pane's user data has
+		// the field empty.
+		if name == NameTmuxPopup {
+			data.ClientId = current.Name
+		}
+	case NameZellij:
+		if err := binary("zellij"); err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		data.SessionId = here.ZellijSessionName
+		if data.SessionId == "" {
+			sessions, err := zellij.New(zellij.Options{Path: data.Path}).ListSessions(ctx)
+			if err != nil {
+				return runinpopup.PinentryUserData{}, err
+			}
+			if data.SessionId, err = zellij.FocusedSession(sessions); err != nil {
+				return runinpopup.PinentryUserData{}, err
+			}
+		}
+	case NameScreen:
+		if here.STY == "" {
+			return runinpopup.PinentryUserData{}, errors.New("not inside screen: $STY is not set")
+		}
+		if err := binary("screen"); err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		data.SessionId, data.SessionMeta = here.STY, here.ScreenDir
+	case NameNvim:
+		if here.NVIM == "" {
+			return runinpopup.PinentryUserData{}, errors.New(
+				"not inside a Neovim terminal: $NVIM is not set",
+			)
+		}
+		// Requests go to the server socket; there is no binary to record.
+		data.SessionMeta = here.NVIM
+	case NameWezterm:
+		if here.WeztermPane == "" {
+			return runinpopup.PinentryUserData{}, errors.New(
+				"not inside wezterm: $WEZTERM_PANE is not set",
+			)
+		}
+		if err := binary("wezterm"); err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		data.SessionId, data.SessionMeta = here.WeztermPane, here.WeztermUnixSocket
+	case NameKitty, NameKittyOSWindow:
+		if here.KittyWindowId == "" {
+			return runinpopup.PinentryUserData{}, errors.New(
+				"not inside kitty: $KITTY_WINDOW_ID is not set",
+			)
+		}
+		if err := binary("kitty"); err != nil {
+			return runinpopup.PinentryUserData{}, err
+		}
+		data.SessionId, data.SessionMeta = here.KittyWindowId, here.KittyListenOn
+	}
+	return data, nil
+}
@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUserDataHere(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, script string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatalf("writing the fake %s: %v", name, err)
+		}
+	}
+	write("tmux", "#!/bin/sh\n[ \"$1\" = display-message ] || exit 1\n"+
+		"printf '%s\\n' '/dev/pts/4\t/dev/pts/4\t$3\twork\t100'\n")
+	write("zellij", "#!/bin/sh\nprintf '%s\\n' 'work [Created 2h ago] (current)'"+
+		" 'play [Created 1h ago]'\n")
+	lookPath := func(file string) (string, error) {
+		if file == "wezterm" {
+			return "", errors.New("wezterm: not found")
+		}
+		return filepath.Join(dir, file), nil
+	}
+	const tmuxEnv = "/tmp/tmux-1000/default,1,0"
+
+	for _, tc := range []struct {
+		name    string
+		backend string
+		here    Here
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "tmux-popup",
+			backend: NameTmuxPopup,
+			here:    Here{TMUX: tmuxEnv},
+			want:    "TMUX_POPUP:" + dir + "/tmux:$3:/dev/pts/4:" + tmuxEnv,
+		},
+		{
+			name:    "tmux-floating-pane names no client",
+			backend: NameTmuxFloatingPane,
+			here:    Here{TMUX: tmuxEnv},
+			want:    "TMUX_FLOATING_PANE:" + dir + "/tmux:$3::" + tmuxEnv,
+		},
+		{
+			name:    "tmux outside tmux",
+			backend: NameTmuxPopup,
+			wantErr: "$TMUX is not set",
+		},
+		{
+			name:    "zellij from its variable",
+			backend: NameZellij,
+			here:    Here{ZellijSessionName: "mine"},
+			want:    "ZELLIJ_POPUP:" + dir + "/zellij:mine",
+		},
+		{
+			name:    "zellij asked",
+			backend: NameZellij,
+			want:    "ZELLIJ_POPUP:" + dir + "/zellij:work",
+		},
+		{
+			name:    "screen",
+			backend: NameScreen,
+			here:    Here{STY: "1234.pts-0.host", ScreenDir: "/run/screen/S-me"},
+			want:    "SCREEN_POPUP:" + dir + "/screen:1234.pts-0.host::/run/screen/S-me",
+		},
+		{
+			name:    "nvim",
+			backend: NameNvim,
+			here:    Here{NVIM: "/run/user/1000/nvim.1.0"},
+			want:    "NVIM_POPUP::::/run/user/1000/nvim.1.0",
+		},
+		{
+			name:    "wezterm not installed",
+			backend: NameWezterm,
+			here:    Here{WeztermPane: "3"},
+			wantErr: "wezterm: not found",
+		},
+		{
+			name:    "kitty keeps the unix: scheme",
+			backend: NameKittyOSWindow,
+			here:    Here{KittyWindowId: "7", KittyListenOn: "unix:/tmp/kitty-1"},
+			want: "RIP1;kind=KITTY_OS_WINDOW;bin=" + dir + "/kitty;session=7" +
+				";socket=unix:/tmp/kitty-1",
+		},
+		{
+			name:    "pty",
+			backend: NamePty,
+			wantErr: "backend pty opens on no multiplexer",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.here.LookPath = lookPath
+			got, err := UserDataHere(t.Context(), tc.backend, tc.here)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("UserDataHere = %q, %v, want an error containing %q",
+						got.String(), err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UserDataHere: %v", err)
+			}
+			if got.String() != tc.want {
+				t.Errorf("UserDataHere = %q, want %q", got.String(), tc.want)
+			}
+		})
+	}
+}
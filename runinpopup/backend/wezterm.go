@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/wezterm"
+)
+
+var (
+	_ runinpopup.TTYHandshaker      = (*Wezterm)(nil)
+	_ runinpopup.CapabilityReporter = (*Wezterm)(nil)
+)
+
+// Wezterm opens popups as panes of WezTerm's built-in multiplexer, through
+// "wezterm cli". WezTerm has no floating panes, so the popup is a split of the
+// pane the user is in, placed beside it rather than over it — or, with no pane
+// to split, a window of its own.
+type Wezterm struct {
+	wezterm *wezterm.Client
+	paneId  string
+}
+
+// NewWezterm builds the "wezterm" backend. It uses BinaryPath (default
+// "wezterm"), SessionId as the id of the pane to split — WezTerm addresses panes
+// rather than sessions, and the pane the user was in is what places the popup —
+// falling back to WeztermPane, SessionMeta as the $WEZTERM_UNIX_SOCKET of the
+// multiplexer hosting that pane, and Shell (default "sh"). ClientId and TMUX are
+// ignored.
+func NewWezterm(opts Options) (*Wezterm, error) {
+	return &Wezterm{
+		wezterm: wezterm.New(wezterm.Options{
+			Path:   opts.BinaryPath,
+			Socket: opts.SessionMeta,
+			Shell:  opts.Shell,
+		}),
+		paneId: cmp.Or(opts.SessionId, opts.WeztermPane),
+	}, nil
+}
+
+func (b *Wezterm) Name() string {
+	return NameWezterm
+}
+
+// Capabilities reports the split's, or with no pane to split the window's,
+// which takes no geometry at all.
+func (b *Wezterm) Capabilities() runinpopup.Capabilities {
+	if b.paneId == "" {
+		return weztermWindowCapabilities
+	}
+	return capabilities[NameWezterm]
+}
+
+// Launch splits the spec off this backend's pane, or spawns it in a new window
+// when the backend knows of no pane. spec.Title is dropped: neither command has
+// a title flag.
+func (b *Wezterm) Launch(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.PopupHandle, error) {
+	if b.paneId == "" {
+		payload, err := b.spawnPayload(spec)
+		if err != nil {
+			return nil, err
+		}
+		return b.wezterm.StartSpawn(ctx, payload)
+	}
+	req, err := b.splitRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	return b.wezterm.StartSplitPane(ctx, req)
+}
+
+// splitRequest translates the spec into a split of the backend's pane.
+//
+// A split has a side and a size along it and nothing else, so that is all the
+// geometry it can take: a height makes it a split below the pane and a width
+// one to its right, and each says how much of the pane the popup gets. A
+// position, or a width and a height at once, asks for a rectangle a split
+// cannot be — and a pane opened somewhere other than asked is worse than one
+// that never opened, so those are refused rather than half-honored.
+func (b *Wezterm) splitRequest(spec runinpopup.LaunchSpec) (wezterm.SplitRequest, error) {
+	payload, err := weztermPayload(spec)
+	if err != nil {
+		return wezterm.SplitRequest{}, err
+	}
+	for _, f := range []struct{ name, value string }{
+		{"x", spec.X}, {"y", spec.Y}, {"anchor", spec.Anchor}, {"margin", spec.Margin},
+	} {
+		if f.value != "" {
+			return wezterm.SplitRequest{}, fmt.Errorf(
+				"backend %s: a split pane cannot be placed, so %s %q has no meaning;"+
+					" size it with a width or a height instead",
+				NameWezterm, f.name, f.value,
+			)
+		}
+	}
+	req := wezterm.SplitRequest{PaneId: b.paneId, Payload: payload}
+	switch {
+	case spec.Width != "" && spec.Height != "":
+		return wezterm.SplitRequest{}, fmt.Errorf(
+			"backend %s: a split pane is sized along one axis only;"+
+				" set a width (split to the right) or a height (split below), not both",
+			NameWezterm,
+		)
+	case spec.Width != "":
+		req.Side, req.Size = wezterm.SideRight, spec.Width
+	default:
+		req.Side, req.Size = wezterm.SideBottom, spec.Height
+	}
+	return req, nil
+}
+
+// spawnPayload translates the spec into a new window. wezterm cli cannot place
+// or size a window at all, so any geometry is refused for the same reason a
+// split refuses what it cannot honor, and named the same way.
+func (b *Wezterm) spawnPayload(spec runinpopup.LaunchSpec) (wezterm.Payload, error) {
+	for _, f := range []struct{ name, value string }{
+		{"x", spec.X}, {"y", spec.Y}, {"width", spec.Width}, {"height", spec.Height},
+		{"anchor", spec.Anchor}, {"margin", spec.Margin},
+	} {
+		if f.value != "" {
+			return wezterm.Payload{}, fmt.Errorf(
+				"backend %s: no pane to split was given, and the window opened instead"+
+					" cannot be placed or sized, so %s %q has no meaning;"+
+					" pass the pane id as the session id",
+				NameWezterm, f.name, f.value,
+			)
+		}
+	}
+	return weztermPayload(spec)
+}
+
+// weztermPayload carries what the pane runs over to the client. wezterm cli has
+// no environment flag, so an environment goes over a FIFO in the launch's work
+// directory, as it does for zellij.
+func weztermPayload(spec runinpopup.LaunchSpec) (wezterm.Payload, error) {
+	if len(spec.Env) > 0 && spec.WorkDir == "" {
+		return wezterm.Payload{}, errors.New(
+			"the launch has no work directory to deliver the popup environment in",
+		)
+	}
+	return wezterm.Payload{
+		Env:            spec.Env,
+		WorkDir:        spec.WorkDir,
+		StartupTimeout: spec.StartupTimeout,
+		Command:        spec.Command,
+		Script:         spec.Script,
+	}, nil
+}
+
+// Prepare is a no-op: splitting a pane disturbs nothing that would need putting
+// back.
+func (b *Wezterm) Prepare(_ context.Context) (func(context.Context) error, error) {
+	return nil, nil
+}
+
+// NewTTYHandshake announces the tty as-is, the FIFO paths in the argv itself
+// like zellij's: wezterm cli has no environment flag, and a path is not what
+// the sourced environment FIFO exists to keep out of a command line.
+func (b *Wezterm) NewTTYHandshake(
+	ttyFifo, doneFifo string,
+) (runinpopup.TTYHandshake, error) {
+	return runinpopup.TTYHandshake{
+		Spec: runinpopup.PopupSpec{
+			Script: runinpopup.TTYHandshakeScript(ttyFifo, doneFifo),
+		},
+	}, nil
+}
@@ -1,16 +1,22 @@
 package backend
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/zellij"
 )
 
-var _ runinpopup.TTYHandshaker = (*Zellij)(nil)
+var (
+	_ runinpopup.TTYHandshaker      = (*Zellij)(nil)
+	_ runinpopup.CapabilityReporter = (*Zellij)(nil)
+)
 
 // Zellij opens popups as zellij floating panes ("zellij run
 // --floating"). zellij addresses sessions, not clients, so there is no client
@@ -38,12 +44,23 @@ func (b *Zellij) Name() string {
 	return NameZellij
 }
 
+func (b *Zellij) Capabilities() runinpopup.Capabilities {
+	return capabilities[NameZellij]
+}
+
 // Launch opens the spec as a floating pane in this backend's session. zellij
 // takes the session as a flag, so the launcher needs no environment of its own.
 func (b *Zellij) Launch(
 	ctx context.Context,
 	spec runinpopup.LaunchSpec,
 ) (runinpopup.PopupHandle, error) {
+	spec, err := b.resolveAnchor(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec, err = b.resolvePositions(ctx, spec); err != nil {
+		return nil, err
+	}
 	req, err := b.runRequest(spec)
 	if err != nil {
 		return nil, err
@@ -58,9 +75,6 @@ func (b *Zellij) Launch(
 // payload — the zellij client owns that delivery, since it also owns the
 // launcher whose Wait has to join it.
 func (b *Zellij) runRequest(spec runinpopup.LaunchSpec) (zellij.RunRequest, error) {
-	if err := rejectTmuxPositions(spec); err != nil {
-		return zellij.RunRequest{}, err
-	}
 	if len(spec.Env) > 0 && spec.WorkDir == "" {
 		return zellij.RunRequest{}, errors.New(
 			"the launch has no work directory to deliver the popup environment in",
@@ -81,23 +95,114 @@ func (b *Zellij) runRequest(spec runinpopup.LaunchSpec) (zellij.RunRequest, erro
 	}, nil
 }
 
-// rejectTmuxPositions refuses the popup positions zellij cannot express. Cells
-// and percentages are its own vocabulary too, but the single-letter specifiers
-// are tmux's alone — "the centre of the terminal" is not something "zellij run"
-// can be asked for — and a pane placed at a guessed position instead is worse
-// than one that never opened. Only X and Y are looked at: a specifier is the
-// one value the size fields cannot hold, and the launch layer has already said
-// so by the time a request is built.
-func rejectTmuxPositions(spec runinpopup.LaunchSpec) error {
-	for _, value := range []string{spec.X, spec.Y} {
-		if geometry.IsPosition(value) {
-			return fmt.Errorf(
-				"backend %s: position %q is tmux-specific; use cells or a percentage",
-				NameZellij, value,
-			)
+// resolveAnchor places an Anchor in cells of the viewport, which is measured for
+// it: a margin in cells is no percentage of anything until then.
+func (b *Zellij) resolveAnchor(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.LaunchSpec, error) {
+	if spec.Anchor == "" {
+		return spec, nil
+	}
+	cols, rows, err := b.zellij.ViewportSize(ctx, b.sessionId, spec.StartupTimeout)
+	if err != nil {
+		return spec, fmt.Errorf("backend %s: anchor %q: %w", NameZellij, spec.Anchor, err)
+	}
+	return anchored(NameZellij, spec, cols, rows)
+}
+
+// zellijDefaultSize is the share of the viewport zellij gives a floating pane
+// along an axis nobody sized. A position resolved against it is passed on with
+// it, so zellij sizes the pane the way it was placed.
+const zellijDefaultSize = "50%"
+
+// resolvePositions translates the tmux position specifiers zellij has a
+// deterministic equivalent for into the top-left corner "zellij run" takes: C
+// centres the pane on its axis, R puts it against the right edge, and S — the
+// line above tmux's status line, at the bottom of the terminal — against the
+// bottom one. Each is a matter of the pane's size on that axis: a percentage
+// gives a percentage and needs nothing else, while cells need the viewport's
+// size in cells too, which is measured once for the launch and only then.
+//
+// P, M and W name a pane's corner, the mouse and a window on tmux's status
+// line, none of which "zellij run" is given or can be asked about, and a pane
+// placed at a guess instead is worse than one that never opened.
+func (b *Zellij) resolvePositions(
+	ctx context.Context,
+	spec runinpopup.LaunchSpec,
+) (runinpopup.LaunchSpec, error) {
+	var cols, rows int
+	viewport := func(horizontal bool) (int, error) {
+		if cols == 0 {
+			var err error
+			cols, rows, err = b.zellij.ViewportSize(ctx, b.sessionId, spec.StartupTimeout)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if horizontal {
+			return cols, nil
+		}
+		return rows, nil
+	}
+	for _, axis := range []struct {
+		name, end   string
+		value, size *string
+		horizontal  bool
+	}{
+		{"x", "R", &spec.X, &spec.Width, true},
+		{"y", "S", &spec.Y, &spec.Height, false},
+	} {
+		if !geometry.IsPosition(*axis.value) {
+			continue
+		}
+		pos, size, err := resolveZellijPosition(
+			axis.name, *axis.value, axis.end, *axis.size,
+			func() (int, error) { return viewport(axis.horizontal) },
+		)
+		if err != nil {
+			return spec, err
+		}
+		*axis.value, *axis.size = pos, size
+	}
+	return spec, nil
+}
+
+// resolveZellijPosition resolves one axis: the specifier value for the field
+// named name, whose far-edge specifier is end, for a pane of the given size
+// along it. total is the viewport's extent along the axis, asked for only when
+// the size is in cells. The size comes back as the pane will be given it,
+// zellijDefaultSize for one left unset. A pane larger than the viewport is put
+// at its start, as tmux clamps a popup into the terminal.
+func resolveZellijPosition(
+	name, value, end, size string,
+	total func() (int, error),
+) (pos, resolvedSize string, err error) {
+	if value != "C" && value != end {
+		return "", "", fmt.Errorf(
+			"backend %s: position %s %q has no equivalent in zellij;"+
+				" use C, %s, cells or a percentage",
+			NameZellij, name, value, end,
+		)
+	}
+	size = cmp.Or(size, zellijDefaultSize)
+	extent, unit := 100, "%"
+	length, isPercent := strings.CutSuffix(size, "%")
+	if !isPercent {
+		if extent, err = total(); err != nil {
+			return "", "", fmt.Errorf("backend %s: placing %s %q: %w", NameZellij, name, value, err)
 		}
+		unit = ""
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil {
+		return "", "", fmt.Errorf("backend %s: size %q: %w", NameZellij, size, err)
+	}
+	free := max(extent-n, 0)
+	if value == "C" {
+		free /= 2
 	}
-	return nil
+	return strconv.Itoa(free) + unit, size, nil
 }
 
 // Prepare is a no-op: nothing in zellij's floating-pane creation depends on the
@@ -120,7 +225,7 @@ func (b *Zellij) NewTTYHandshake(
 	return runinpopup.TTYHandshake{
 		Spec: runinpopup.PopupSpec{
 			Title:  zellijHandshakePaneName,
-			Script: fmt.Sprintf("echo $(tty) >> %s && read done < %s", ttyFifo, doneFifo),
+			Script: runinpopup.TTYHandshakeScript(ttyFifo, doneFifo),
 		},
 	}, nil
 }
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveZellijPosition(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		value, end  string
+		size        string
+		total       int
+		wantPos     string
+		wantSize    string
+		wantErr     string
+		wantMeasure bool
+	}{
+		{
+			name: "centre of a percentage is a percentage", value: "C", end: "R", size: "60%",
+			wantPos: "20%", wantSize: "60%",
+		},
+		{
+			name: "an unsized pane is centred at zellij's own size", value: "C", end: "R",
+			wantPos: "25%", wantSize: "50%",
+		},
+		{
+			name: "right against a percentage", value: "R", end: "R", size: "30%",
+			wantPos: "70%", wantSize: "30%",
+		},
+		{
+			name: "bottom against a percentage", value: "S", end: "S", size: "25%",
+			wantPos: "75%", wantSize: "25%",
+		},
+		{
+			name: "centre of cells needs the viewport", value: "C", end: "S", size: "20",
+			total: 51, wantPos: "15", wantSize: "20", wantMeasure: true,
+		},
+		{
+			name: "right against cells", value: "R", end: "R", size: "80",
+			total: 200, wantPos: "120", wantSize: "80", wantMeasure: true,
+		},
+		{
+			name: "a pane wider than the viewport starts at its edge", value: "R", end: "R",
+			size: "300", total: 200, wantPos: "0", wantSize: "300", wantMeasure: true,
+		},
+		{
+			name: "R is no bottom edge", value: "R", end: "S",
+			wantErr: `position y "R" has no equivalent in zellij`,
+		},
+		{
+			name: "the mouse has no equivalent", value: "M", end: "R",
+			wantErr: `position y "M" has no equivalent in zellij`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			measured := false
+			pos, size, err := resolveZellijPosition("y", tc.value, tc.end, tc.size,
+				func() (int, error) {
+					measured = true
+					return tc.total, nil
+				})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveZellijPosition: %v", err)
+			}
+			if pos != tc.wantPos || size != tc.wantSize {
+				t.Errorf("= %q, %q; want %q, %q", pos, size, tc.wantPos, tc.wantSize)
+			}
+			if measured != tc.wantMeasure {
+				t.Errorf("measured the viewport = %t, want %t", measured, tc.wantMeasure)
+			}
+		})
+	}
+}
+
+// A viewport that could not be measured fails the launch rather than placing
+// the pane anywhere.
+func TestResolveZellijPosition_measurementFailure(t *testing.T) {
+	_, _, err := resolveZellijPosition("x", "C", "R", "80", func() (int, error) {
+		return 0, errors.New("no pane answered")
+	})
+	if err == nil || !strings.Contains(err.Error(), "no pane answered") {
+		t.Errorf("err = %v, want the measurement's failure", err)
+	}
+}
@@ -0,0 +1,190 @@
+package runinpopup
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
+)
+
+// SizeSupport is how much of a PopupSpec's Width and Height a backend honors.
+type SizeSupport string
+
+const (
+	// SizeNone takes no size at all: the popup is as big as the mechanism makes
+	// it, a screen window or a kitty overlay.
+	SizeNone SizeSupport = "none"
+	// SizeOneAxis takes a width or a height, not both: a split pane is sized
+	// along the one axis it was split on.
+	SizeOneAxis SizeSupport = "one axis"
+	// SizeCells takes both, in cells only: there is no terminal around the popup
+	// for a percentage to be a share of.
+	SizeCells SizeSupport = "cells"
+	// SizeFull takes both, in cells and percentages.
+	SizeFull SizeSupport = "full"
+)
+
+// Capabilities is what a backend honors of a launch, so that what it cannot be
+// asked for is known before anything is opened rather than found out from a
+// popup that came up untitled, or a refusal from inside a launcher nobody reads
+// the output of.
+//
+// It describes the mechanism, not the multiplexer's mood: a backend that takes
+// a value passes it on, and whatever the multiplexer then says about it — a
+// specifier on the wrong axis, a popup clamped to the terminal — is still its
+// own answer.
+type Capabilities struct {
+	// Title is whether PopupSpec.Title is shown anywhere.
+	Title bool `json:"title"`
+	// Env is whether PopupSpec.Env reaches the payload, by a flag or through
+	// the launch's work directory.
+	Env bool `json:"env"`
+	// Place is whether X and Y are taken as cells and percentages, and an Anchor
+	// resolved into them.
+	Place bool `json:"place"`
+	// PositionsX and PositionsY are the position specifiers X and Y take, as
+	// their letters run together: "CRPMWS" for all of tmux's, "" for none.
+	PositionsX string `json:"positions_x"`
+	PositionsY string `json:"positions_y"`
+	// Size is how much of Width and Height is taken.
+	Size SizeSupport `json:"size"`
+	// ClientTargeting is whether the popup opens on one client — the one the
+	// backend was told of — rather than wherever the session or window it
+	// belongs to is shown. No PopupSpec field asks for it, so no launch is
+	// checked against it; it is here for the user choosing a backend.
+	ClientTargeting bool `json:"client_targeting"`
+	// ExitStatus is whether the launcher lasts as long as the popup, which is
+	// what lets PopupStreams.ExitStatus be answered on a launch with no output
+	// stream to wait for. Every backend answers it on a launch that has one.
+	ExitStatus bool `json:"exit_status"`
+}
+
+// CapabilityReporter is a Backend that says what it honors. It is optional: a
+// backend that does not implement it is taken at its word for everything, and
+// refuses in Launch what it has to.
+type CapabilityReporter interface {
+	Backend
+	// Capabilities reports what the backend honors, for every launch it makes.
+	Capabilities() Capabilities
+}
+
+// UnsupportedPolicy is what a PopupLauncher does with a launch asking a backend
+// for something its Capabilities say it does not honor.
+type UnsupportedPolicy string
+
+const (
+	// UnsupportedWarn logs what is unsupported and launches anyway, leaving the
+	// backend to do what it does with it: drop a title, or refuse a position it
+	// has no equivalent for. It is what the zero value means.
+	UnsupportedWarn UnsupportedPolicy = "warn"
+	// UnsupportedFail fails the launch before anything is prepared or opened.
+	UnsupportedFail UnsupportedPolicy = "fail"
+	// UnsupportedIgnore launches without a word, as if nothing were known.
+	UnsupportedIgnore UnsupportedPolicy = "ignore"
+)
+
+// UnsupportedPolicies lists every valid UnsupportedPolicy, the default first.
+func UnsupportedPolicies() []UnsupportedPolicy {
+	return []UnsupportedPolicy{UnsupportedWarn, UnsupportedFail, UnsupportedIgnore}
+}
+
+// Unsupported lists what spec and streams ask of a backend with these
+// capabilities that it does not honor, one phrase each, in the order of the
+// fields asking. An empty list is a launch the backend takes as it is.
+//
+// The geometry is expected to have passed validateGeometry already: a value is
+// only classified here, never parsed.
+func (c Capabilities) Unsupported(spec PopupSpec, streams PopupStreams) []string {
+	var out []string
+	if spec.Title != "" && !c.Title {
+		out = append(out, "a title")
+	}
+	if len(spec.Env) > 0 && !c.Env {
+		out = append(out, "an environment")
+	}
+	for _, f := range []struct{ name, value, positions string }{
+		{"X", spec.X, c.PositionsX},
+		{"Y", spec.Y, c.PositionsY},
+	} {
+		switch {
+		case f.value == "":
+		case geometry.IsPosition(f.value):
+			if !strings.Contains(f.positions, f.value) {
+				out = append(out, fmt.Sprintf("position %s %q", f.name, f.value))
+			}
+		case !c.Place:
+			out = append(out, fmt.Sprintf("placement %s %q", f.name, f.value))
+		}
+	}
+	if spec.Anchor != "" && !c.Place {
+		out = append(out, fmt.Sprintf("anchor %q", spec.Anchor))
+	}
+	out = append(out, c.unsupportedSize(spec.Width, spec.Height)...)
+	if streams.ExitStatus && !c.ExitStatus && !hasOutputStream(streams) {
+		out = append(out, "an exit status with no output stream to wait for")
+	}
+	return out
+}
+
+func (c Capabilities) unsupportedSize(width, height string) []string {
+	var out []string
+	switch c.Size {
+	case SizeFull:
+	case SizeOneAxis:
+		if width != "" && height != "" {
+			out = append(out, fmt.Sprintf("both Width %q and Height %q", width, height))
+		}
+	default:
+		for _, f := range []struct{ name, value string }{{"Width", width}, {"Height", height}} {
+			if f.value != "" && (c.Size != SizeCells || strings.HasSuffix(f.value, "%")) {
+				out = append(out, fmt.Sprintf("size %s %q", f.name, f.value))
+			}
+		}
+	}
+	return out
+}
+
+func hasOutputStream(streams PopupStreams) bool {
+	return streams.Stdout != nil || streams.Stderr != nil ||
+		streams.StdoutPipe || streams.StderrPipe
+}
+
+// checkCapabilities applies the launcher's UnsupportedPolicy to a launch about
+// to be made on a backend that reports its capabilities.
+func (l *PopupLauncher) checkCapabilities(
+	spec PopupSpec,
+	streams PopupStreams,
+	logger *slog.Logger,
+) error {
+	policy := l.Unsupported
+	switch policy {
+	case "":
+		policy = UnsupportedWarn
+	case UnsupportedWarn, UnsupportedFail, UnsupportedIgnore:
+	default:
+		return fmt.Errorf(
+			"unknown unsupported-feature policy %q: valid values are %q, %q and %q",
+			policy, UnsupportedWarn, UnsupportedFail, UnsupportedIgnore,
+		)
+	}
+	reporter, ok := l.Backend.(CapabilityReporter)
+	if !ok || policy == UnsupportedIgnore {
+		return nil
+	}
+	unsupported := reporter.Capabilities().Unsupported(spec, streams)
+	if len(unsupported) == 0 {
+		return nil
+	}
+	if policy == UnsupportedFail {
+		return fmt.Errorf(
+			"backend %s does not support %s", l.Backend.Name(), strings.Join(unsupported, ", "),
+		)
+	}
+	logger.Warn(
+		"the backend does not support part of the popup; launching anyway",
+		slog.String("backend", l.Backend.Name()),
+		slog.Any("unsupported", unsupported),
+	)
+	return nil
+}
@@ -0,0 +1,197 @@
+package runinpopup
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities_Unsupported(t *testing.T) {
+	everything := Capabilities{
+		Title: true, Env: true,
+		Place: true, PositionsX: "CRPMWS", PositionsY: "CRPMWS",
+		Size:       SizeFull,
+		ExitStatus: true,
+	}
+	for _, tc := range []struct {
+		name    string
+		caps    Capabilities
+		spec    PopupSpec
+		streams PopupStreams
+		want    []string
+	}{
+		{
+			name: "a backend honoring everything is asked for nothing it lacks",
+			caps: everything,
+			spec: PopupSpec{
+				Title: "t", Env: map[string]string{"K": "v"},
+				X: "C", Y: "10", Width: "50%", Height: "20",
+			},
+			streams: PopupStreams{ExitStatus: true},
+		},
+		{
+			name: "an empty spec asks nothing of a backend honoring nothing",
+			caps: Capabilities{Size: SizeNone},
+		},
+		{
+			name: "a dropped title and environment",
+			caps: Capabilities{Size: SizeFull},
+			spec: PopupSpec{Title: "t", Env: map[string]string{"K": "v"}},
+			want: []string{"a title", "an environment"},
+		},
+		{
+			name: "position specifiers are checked per axis",
+			caps: Capabilities{Place: true, PositionsX: "CR", PositionsY: "C", Size: SizeFull},
+			spec: PopupSpec{X: "R", Y: "R"},
+			want: []string{`position Y "R"`},
+		},
+		{
+			name: "no specifier at all where the backend takes none",
+			caps: Capabilities{Place: true, Size: SizeFull},
+			spec: PopupSpec{X: "C", Y: "M"},
+			want: []string{`position X "C"`, `position Y "M"`},
+		},
+		{
+			name: "cells and percentages need placement",
+			caps: Capabilities{Size: SizeFull},
+			spec: PopupSpec{X: "10", Y: "5%"},
+			want: []string{`placement X "10"`, `placement Y "5%"`},
+		},
+		{
+			name: "an anchor needs placement, and no specifier",
+			caps: Capabilities{Size: SizeFull},
+			spec: PopupSpec{Anchor: "top-right", Margin: "2"},
+			want: []string{`anchor "top-right"`},
+		},
+		{
+			name: "an anchor on a backend that places",
+			caps: Capabilities{Place: true, Size: SizeFull},
+			spec: PopupSpec{Anchor: "bottom", Margin: "2"},
+		},
+		{
+			name: "no size is taken at all",
+			caps: Capabilities{Size: SizeNone},
+			spec: PopupSpec{Width: "80", Height: "50%"},
+			want: []string{`size Width "80"`, `size Height "50%"`},
+		},
+		{
+			name: "a cells-only size refuses a percentage",
+			caps: Capabilities{Size: SizeCells},
+			spec: PopupSpec{Width: "80", Height: "50%"},
+			want: []string{`size Height "50%"`},
+		},
+		{
+			name: "one axis takes either size",
+			caps: Capabilities{Size: SizeOneAxis},
+			spec: PopupSpec{Height: "50%"},
+		},
+		{
+			name: "one axis refuses both sizes at once",
+			caps: Capabilities{Size: SizeOneAxis},
+			spec: PopupSpec{Width: "80", Height: "50%"},
+			want: []string{`both Width "80" and Height "50%"`},
+		},
+		{
+			name:    "an exit status with nothing to wait for needs a lasting launcher",
+			caps:    Capabilities{Size: SizeFull},
+			streams: PopupStreams{ExitStatus: true},
+			want:    []string{"an exit status with no output stream to wait for"},
+		},
+		{
+			name:    "an output stream is what an exit status can be waited for by",
+			caps:    Capabilities{Size: SizeFull},
+			streams: PopupStreams{ExitStatus: true, StdoutPipe: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.caps.Unsupported(tc.spec, tc.streams)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Unsupported = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// capableBackend is the shell fake reporting capabilities, which is all it
+// takes for a launch to be checked against them.
+type capableBackend struct {
+	*shellBackend
+	caps Capabilities
+}
+
+func (b *capableBackend) Capabilities() Capabilities { return b.caps }
+
+func TestPopupLauncher_Exec_unsupported(t *testing.T) {
+	spec := PopupSpec{Title: "dropped", Script: "true"}
+	for _, tc := range []struct {
+		name     string
+		policy   UnsupportedPolicy
+		wantErr  string
+		wantWarn bool
+	}{
+		{name: "the zero policy warns and launches", policy: "", wantWarn: true},
+		{name: "warn warns and launches", policy: UnsupportedWarn, wantWarn: true},
+		{name: "ignore launches without a word", policy: UnsupportedIgnore},
+		{
+			name:    "fail refuses before anything is prepared",
+			policy:  UnsupportedFail,
+			wantErr: "backend shell does not support a title",
+		},
+		{
+			name:    "an unknown policy is refused",
+			policy:  "sometimes",
+			wantErr: `unknown unsupported-feature policy "sometimes"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			backend := &capableBackend{shellBackend: &shellBackend{}, caps: Capabilities{}}
+			launcher := &PopupLauncher{
+				Backend:     backend,
+				Logger:      slog.New(slog.NewTextHandler(&logs, nil)),
+				Unsupported: tc.policy,
+			}
+
+			popup, err := launcher.Exec(t.Context(), spec, PopupStreams{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Exec err = %v, want one containing %q", err, tc.wantErr)
+				}
+				if backend.prepared != 0 || len(backend.launched) != 0 {
+					t.Errorf("prepared = %d, launched = %d; a refused launch touches nothing",
+						backend.prepared, len(backend.launched))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if err := popup.Wait(); err != nil {
+				t.Fatalf("Wait: %v", err)
+			}
+			if warned := strings.Contains(logs.String(), "a title"); warned != tc.wantWarn {
+				t.Errorf("warned = %t, want %t; logs:\n%s", warned, tc.wantWarn, logs.String())
+			}
+		})
+	}
+}
+
+// A backend not reporting capabilities is taken at its word: nothing is known
+// to be unsupported, so not even the fail policy has anything to fail on.
+func TestPopupLauncher_Exec_unsupportedNeedsAReporter(t *testing.T) {
+	launcher := &PopupLauncher{
+		Backend:     &shellBackend{},
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Unsupported: UnsupportedFail,
+	}
+	popup, err := launcher.Exec(t.Context(), PopupSpec{Title: "t", Script: "true"}, PopupStreams{})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := popup.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+// BackendCapabilities is one row of the matrix RenderBackends prints: a backend
+// name and what it honors. The capabilities are embedded so the JSON form is
+// one flat object per backend.
+type BackendCapabilities struct {
+	Name string `json:"name"`
+	runinpopup.Capabilities
+}
+
+// BackendMatrix lists every backend's capabilities in the order of
+// backend.Names.
+func BackendMatrix() []BackendCapabilities {
+	var rows []BackendCapabilities
+	for _, name := range backend.Names() {
+		caps, _ := backend.Capabilities(name)
+		rows = append(rows, BackendCapabilities{Name: name, Capabilities: caps})
+	}
+	return rows
+}
+
+// RenderBackends writes BackendMatrix to w as an aligned table, one backend a
+// line, or with asJSON as an indented JSON array.
+func RenderBackends(w io.Writer, asJSON bool) error {
+	rows := BackendMatrix()
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BACKEND\tTITLE\tENV\tPLACE\tPOSITIONS X/Y\tSIZE\tCLIENT\tEXIT STATUS")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Name,
+			yesNo(r.Title),
+			yesNo(r.Env),
+			yesNo(r.Place),
+			orDash(r.PositionsX)+"/"+orDash(r.PositionsY),
+			r.Size,
+			yesNo(r.ClientTargeting),
+			yesNo(r.ExitStatus),
+		)
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+func TestRenderBackends(t *testing.T) {
+	t.Run("table", func(t *testing.T) {
+		var b strings.Builder
+		if err := RenderBackends(&b, false); err != nil {
+			t.Fatalf("RenderBackends: %v", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		if want := len(backend.Names()) + 1; len(lines) != want {
+			t.Fatalf("got %d lines, want a header and one per backend (%d):\n%s",
+				len(lines), want, b.String())
+		}
+		for i, name := range backend.Names() {
+			if got := strings.Fields(lines[i+1])[0]; got != name {
+				t.Errorf("line %d names %q, want %q", i+1, got, name)
+			}
+		}
+		// A title nobody sees is the silent drop the matrix exists to show.
+		if !strings.Contains(b.String(), "tmux-floating-pane  no ") {
+			t.Errorf("tmux-floating-pane must show no title:\n%s", b.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var b strings.Builder
+		if err := RenderBackends(&b, true); err != nil {
+			t.Fatalf("RenderBackends: %v", err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal([]byte(b.String()), &rows); err != nil {
+			t.Fatalf("output is not a JSON array: %v\n%s", err, b.String())
+		}
+		if len(rows) != len(backend.Names()) {
+			t.Fatalf("got %d rows, want %d", len(rows), len(backend.Names()))
+		}
+		// Embedded, so each row is one flat object rather than a nested one.
+		if rows[0]["name"] != backend.NameTmuxPopup || rows[0]["title"] != true {
+			t.Errorf("first row = %v, want tmux-popup with a title", rows[0])
+		}
+	})
+}
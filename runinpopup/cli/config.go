@@ -5,11 +5,16 @@
 package cli
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"io"
+	"reflect"
+	"slices"
 	"strings"
+	"text/tabwriter"
 	"text/template"
+	"time"
 
 	"github.com/ngicks/run-in-tmux-popup/internal/templateutil"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup"
@@ -25,12 +30,20 @@ func TemplateFuncHelp() string {
 
 // RenderConfig writes the resolved configuration to w.
 //
-// With format == "" it writes indented JSON. Otherwise format is parsed as a Go
-// text/template and executed against cfg (field paths use the Go field names,
-// e.g. {{.PinentryPath}}); it sees the shared templateutil.FuncMap helpers
-// (json, ...). Either form is terminated with a trailing newline. A malformed or
-// failing template is returned as an error attributed to the --format flag.
-func RenderConfig(w io.Writer, cfg runinpopup.Config, format string) error {
+// With format == "" it writes cfg encoded as output, the way a config file in
+// that format would hold it, indented JSON when output is empty. Otherwise
+// format is parsed as a Go text/template and executed against cfg (field paths
+// use the Go field names, e.g. {{.PinentryPath}}); it sees the shared
+// templateutil.FuncMap helpers (json, ...), and output is not consulted.
+// Either form is terminated with a trailing newline. A malformed or failing
+// template is returned as an error attributed to the --format flag, an unknown
+// output to --output.
+func RenderConfig(
+	w io.Writer,
+	cfg runinpopup.Config,
+	output runinpopup.ConfigFormat,
+	format string,
+) error {
 	if format != "" {
 		tmpl, err := template.New("config").
 			Funcs(templateutil.FuncMap()).
@@ -45,19 +58,128 @@ func RenderConfig(w io.Writer, cfg runinpopup.Config, format string) error {
 		return nil
 	}
 
-	b, err := json.MarshalIndent(cfg, "", "  ")
+	b, err := cmp.Or(output, runinpopup.ConfigJSON).Marshal(cfg)
 	if err != nil {
-		return err
+		return fmt.Errorf("--output: %w", err)
 	}
-	fmt.Fprintln(w, string(b))
-	return nil
+	_, err = w.Write(b)
+	return err
+}
+
+// ConfigFormatList renders the formats config --output takes as a quoted,
+// comma-separated list for help text, like BackendNameList.
+func ConfigFormatList() string {
+	formats := runinpopup.ConfigFormats()
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = string(f)
+	}
+	return quoteNameList(names)
+}
+
+// RenderConfigExplain writes the resolved configuration to w as an aligned
+// table, one key a line in ConfigDocs order: the key as the config file nests
+// it, the layer that supplied it with the file, variable or flag that did, the
+// key's description, and its value, last since a preset's runs long enough to
+// push any column after it off the screen. A preset is a line of its own,
+// being what a layer sets, and an empty map a line saying so, so every key of
+// the schema shows up whether or not anything set it.
+//
+// Values print the way JSON writes them, durations aside, which print the way
+// Go and the environment layer spell them: "20s" answers the question that
+// brought the reader here, where 20000000000 makes them count digits.
+func RenderConfigExplain(
+	w io.Writer,
+	cfg runinpopup.Config,
+	provenance runinpopup.ConfigProvenance,
+) error {
+	rows := configExplainRows(ConfigDocs(), "", reflect.ValueOf(cfg), provenance, nil)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSOURCE\tDESCRIPTION\tVALUE")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.key, r.source, r.desc, r.value)
+	}
+	return tw.Flush()
+}
+
+// configExplainRow is one line of RenderConfigExplain's table.
+type configExplainRow struct {
+	key, source, desc, value string
+}
+
+// configExplainRows flattens docs into the rows for the config value v, whose
+// fields the docs name. A sub-config contributes its fields' rows rather than
+// one of its own: it is never set as a whole, so it has no source to show.
+func configExplainRows(
+	docs []ConfigFieldDoc,
+	keyPrefix string,
+	v reflect.Value,
+	provenance runinpopup.ConfigProvenance,
+	rows []configExplainRow,
+) []configExplainRow {
+	for _, d := range docs {
+		key := keyPrefix + d.Key
+		field := v.FieldByName(d.Name)
+		switch {
+		case d.MapKey != "" && field.Len() > 0:
+			entries := field.MapKeys()
+			slices.SortFunc(entries, func(a, b reflect.Value) int {
+				return strings.Compare(a.String(), b.String())
+			})
+			for _, name := range entries {
+				entryKey := key + "." + name.String()
+				rows = append(rows, configExplainRow{
+					key:    entryKey,
+					value:  explainValue(field.MapIndex(name)),
+					source: explainSource(provenance.Source(entryKey)),
+					desc:   d.Desc,
+				})
+			}
+		case d.Fields != nil && d.MapKey == "":
+			rows = configExplainRows(d.Fields, key+".", field, provenance, rows)
+		default:
+			rows = append(rows, configExplainRow{
+				key:    key,
+				value:  explainValue(field),
+				source: explainSource(provenance.Source(key)),
+				desc:   d.Desc,
+			})
+		}
+	}
+	return rows
+}
+
+// explainValue renders a config value for RenderConfigExplain.
+func explainValue(v reflect.Value) string {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return string(b)
+}
+
+// explainSource renders a source as its layer and, for a layer other than the
+// defaults, what in it set the key: "env RUN_IN_POPUP_BACKEND".
+func explainSource(source runinpopup.ConfigSource) string {
+	if source.Name == "" {
+		return string(source.Layer)
+	}
+	return string(source.Layer) + " " + source.Name
 }
 
 // ConfigFieldDoc documents one field of [runinpopup.Config].
+//
+// A map of sub-configs is documented by its values' fields, with Type "map"
+// and MapKey standing for whichever key a value is found under, so the path to
+// one of its fields can still be spelled out.
 type ConfigFieldDoc struct {
 	Name   string           // Go field name, as a --format template addresses it
 	Type   string           // Go type, e.g. "time.Duration"; empty on a sub-config
 	Key    string           // JSON key of this field alone, not the path to it
+	MapKey string           // a map's placeholder key, e.g. "NAME"; empty otherwise
 	Desc   string           // one-line human description
 	Fields []ConfigFieldDoc // a sub-config's own fields; nil on a scalar
 }
@@ -70,6 +192,13 @@ func ConfigDocs() []ConfigFieldDoc {
 	return []ConfigFieldDoc{
 		{Name: "PinentryPath", Type: "string", Key: "pinentry_path", Desc: "pinentry binary"},
 		{Name: "Backend", Type: "string", Key: "backend", Desc: "backend to use"},
+		{Name: "Fallback", Type: "[]string", Key: "fallback", Desc: "tried when no popup opens"},
+		{
+			Name: "Unsupported",
+			Type: "string",
+			Key:  "unsupported",
+			Desc: "warn, fail or ignore what the backend lacks",
+		},
 		{
 			Name: "Timeouts",
 			Key:  "timeouts",
@@ -83,6 +212,41 @@ func ConfigDocs() []ConfigFieldDoc {
 					Key:  "done_write",
 					Desc: "signal popup done",
 				},
+				{Name: "Linger", Type: "time.Duration", Key: "linger", Desc: "keep popup for reuse"},
+			},
+		},
+		{
+			Name: "Fit",
+			Key:  "fit",
+			Desc: "bounds of a popup sized to fit",
+			Fields: []ConfigFieldDoc{
+				{Name: "MinWidth", Type: "int", Key: "min_width", Desc: "narrowest, in cells"},
+				{Name: "MaxWidth", Type: "int", Key: "max_width", Desc: "widest, in cells"},
+				{Name: "MinHeight", Type: "int", Key: "min_height", Desc: "shortest, in rows"},
+				{Name: "MaxHeight", Type: "int", Key: "max_height", Desc: "tallest, in rows"},
+			},
+		},
+		{
+			Name:   "Presets",
+			Type:   "map",
+			Key:    "presets",
+			MapKey: "NAME",
+			Desc:   "exec --preset NAME setups",
+			Fields: []ConfigFieldDoc{
+				{Name: "Title", Type: "string", Key: "title", Desc: "popup title"},
+				{Name: "Backend", Type: "string", Key: "backend", Desc: "backend to use"},
+				{Name: "X", Type: "string", Key: "x", Desc: "popup x position"},
+				{Name: "Y", Type: "string", Key: "y", Desc: "popup y position"},
+				{Name: "Width", Type: "string", Key: "width", Desc: "popup width"},
+				{Name: "Height", Type: "string", Key: "height", Desc: "popup height"},
+				{Name: "Anchor", Type: "string", Key: "anchor", Desc: "place by name"},
+				{Name: "Margin", Type: "string", Key: "margin", Desc: "distance from the anchor's edges"},
+				{
+					Name: "Env",
+					Type: "map[string]string",
+					Key:  "env",
+					Desc: "command environment",
+				},
 			},
 		},
 	}
@@ -138,6 +302,15 @@ type configHelpRow struct {
 	key  string
 }
 
+// childKeyPrefix is the dotted path d's fields hang off, key being d's own:
+// straight off a sub-config, and through the placeholder key off a map.
+func childKeyPrefix(d ConfigFieldDoc, key string) string {
+	if d.MapKey != "" {
+		return key + "." + d.MapKey + "."
+	}
+	return key + "."
+}
+
 // configHelpRows flattens a doc tree depth-first, which is the order the tree
 // glyphs assume: a node's own row is immediately followed by its children's.
 func configHelpRows(
@@ -160,7 +333,7 @@ func configHelpRows(
 			desc: d.Desc,
 			key:  key,
 		})
-		rows = configHelpRows(d.Fields, key+".", depth+1, rows)
+		rows = configHelpRows(d.Fields, childKeyPrefix(d, key), depth+1, rows)
 	}
 	return rows
 }
@@ -14,6 +14,7 @@ func TestRenderConfig(t *testing.T) {
 	for _, tc := range []struct {
 		name   string
 		cfg    runinpopup.Config
+		output runinpopup.ConfigFormat
 		format string
 		want   string
 	}{
@@ -22,19 +23,54 @@ func TestRenderConfig(t *testing.T) {
 			cfg: runinpopup.Config{
 				PinentryPath: "/usr/bin/pinentry-curses",
 				Backend:      "tmux-popup",
+				Fallback:     []string{"tty"},
+				Unsupported:  "warn",
 				Timeouts: runinpopup.TimeoutsConfig{
 					Overall:   2 * time.Minute,
 					TTYRead:   20 * time.Second,
 					DoneWrite: time.Second,
 				},
+				Fit: runinpopup.FitConfig{
+					MinWidth:  20,
+					MaxWidth:  120,
+					MinHeight: 3,
+					MaxHeight: 40,
+				},
+				Presets: map[string]runinpopup.PresetConfig{
+					"review": {Anchor: "right", Width: "40%"},
+				},
 			},
 			want: `{
   "pinentry_path": "/usr/bin/pinentry-curses",
   "backend": "tmux-popup",
+  "fallback": [
+    "tty"
+  ],
+  "unsupported": "warn",
   "timeouts": {
     "overall": 120000000000,
     "tty_read": 20000000000,
-    "done_write": 1000000000
+    "done_write": 1000000000,
+    "linger": 0
+  },
+  "fit": {
+    "min_width": 20,
+    "max_width": 120,
+    "min_height": 3,
+    "max_height": 40
+  },
+  "presets": {
+    "review": {
+      "title": "",
+      "backend": "",
+      "x": "",
+      "y": "",
+      "width": "40%",
+      "height": "",
+      "anchor": "right",
+      "margin": "",
+      "env": null
+    }
   }
 }
 `,
@@ -44,11 +80,21 @@ func TestRenderConfig(t *testing.T) {
 			want: `{
   "pinentry_path": "",
   "backend": "",
+  "fallback": null,
+  "unsupported": "",
   "timeouts": {
     "overall": 0,
     "tty_read": 0,
-    "done_write": 0
-  }
+    "done_write": 0,
+    "linger": 0
+  },
+  "fit": {
+    "min_width": 0,
+    "max_width": 0,
+    "min_height": 0,
+    "max_height": 0
+  },
+  "presets": null
 }
 `,
 		},
@@ -67,7 +113,8 @@ func TestRenderConfig(t *testing.T) {
 			want: `{
   "overall": 60000000000,
   "tty_read": 0,
-  "done_write": 0
+  "done_write": 0,
+  "linger": 0
 }
 `,
 		},
@@ -76,6 +123,80 @@ func TestRenderConfig(t *testing.T) {
 			format: "{{.Backend}}",
 			want:   "\n",
 		},
+		{
+			name: "yaml output spells durations as strings",
+			cfg: runinpopup.Config{
+				Backend:  "zellij",
+				Fallback: []string{"tty"},
+				Timeouts: runinpopup.TimeoutsConfig{Overall: 2 * time.Minute},
+				Presets:  map[string]runinpopup.PresetConfig{},
+			},
+			output: runinpopup.ConfigYAML,
+			want: `pinentry_path: ""
+backend: zellij
+fallback:
+  - tty
+unsupported: ""
+timeouts:
+  overall: 2m0s
+  tty_read: 0s
+  done_write: 0s
+  linger: 0s
+fit:
+  min_width: 0
+  max_width: 0
+  min_height: 0
+  max_height: 0
+presets: {}
+`,
+		},
+		{
+			name: "toml output puts each sub-config in a table",
+			cfg: runinpopup.Config{
+				Backend:  "zellij",
+				Fallback: []string{"tty"},
+				Timeouts: runinpopup.TimeoutsConfig{Overall: 2 * time.Minute},
+				Presets: map[string]runinpopup.PresetConfig{
+					"review": {Anchor: "right"},
+				},
+			},
+			output: runinpopup.ConfigTOML,
+			want: `pinentry_path = ""
+backend = "zellij"
+fallback = ["tty"]
+unsupported = ""
+
+[timeouts]
+  overall = "2m0s"
+  tty_read = "0s"
+  done_write = "0s"
+  linger = "0s"
+
+[fit]
+  min_width = 0
+  max_width = 0
+  min_height = 0
+  max_height = 0
+
+[presets]
+  [presets.review]
+    title = ""
+    backend = ""
+    x = ""
+    y = ""
+    width = ""
+    height = ""
+    anchor = "right"
+    margin = ""
+`,
+		},
+		{
+			name:   "a template wins over the output",
+			cfg:    runinpopup.Config{Backend: "zellij"},
+			output: runinpopup.ConfigYAML,
+			format: "{{.Backend}}",
+			want:   "zellij\n",
+		},
 		{
 			name:   "literal text passes through",
 			cfg:    runinpopup.Config{Backend: "zellij"},
@@ -85,7 +206,7 @@ func TestRenderConfig(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var buf strings.Builder
-			if err := RenderConfig(&buf, tc.cfg, tc.format); err != nil {
+			if err := RenderConfig(&buf, tc.cfg, tc.output, tc.format); err != nil {
 				t.Fatalf("RenderConfig: %v", err)
 			}
 			if got := buf.String(); got != tc.want {
@@ -111,7 +232,7 @@ func TestRenderConfig_formatFailures(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var buf strings.Builder
-			err := RenderConfig(&buf, runinpopup.Config{}, tc.format)
+			err := RenderConfig(&buf, runinpopup.Config{}, "", tc.format)
 			if err == nil || !strings.Contains(err.Error(), "--format") {
 				t.Fatalf("err = %v, want one attributed to --format", err)
 			}
@@ -119,6 +240,99 @@ func TestRenderConfig_formatFailures(t *testing.T) {
 	}
 }
 
+func TestRenderConfig_unknownOutput(t *testing.T) {
+	var buf strings.Builder
+	err := RenderConfig(&buf, runinpopup.Config{}, "ini", "")
+	if err == nil || !strings.Contains(err.Error(), "--output") {
+		t.Fatalf("err = %v, want one attributed to --output", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q before failing, want nothing", buf.String())
+	}
+}
+
+// Every key of the schema gets a line, in ConfigDocs order, crediting the
+// layer the provenance names, and every preset gets one of its own.
+func TestRenderConfigExplain(t *testing.T) {
+	// explained is one line of the table: the key it starts with, the source
+	// in it, and the value it ends with.
+	type explained struct{ key, source, value string }
+	defaults := []explained{
+		{"pinentry_path", "default", `"/usr/bin/pinentry-curses"`},
+		{"backend", "flag --backend", `"zellij"`},
+		{"fallback", "default", "[]"},
+		{"unsupported", "default", `"warn"`},
+		{"timeouts.overall", "env RUN_IN_POPUP_TIMEOUTS_OVERALL", "1m0s"},
+		{"timeouts.tty_read", "default", "20s"},
+		{"timeouts.done_write", "default", "1s"},
+		{"timeouts.linger", "default", "0s"},
+		{"fit.min_width", "default", "20"},
+		{"fit.max_width", "default", "120"},
+		{"fit.min_height", "default", "3"},
+		{"fit.max_height", "default", "40"},
+	}
+	provenance := runinpopup.ConfigProvenance{
+		"backend":          {Layer: runinpopup.LayerFlag, Name: "--backend"},
+		"timeouts.overall": {Layer: runinpopup.LayerEnv, Name: "RUN_IN_POPUP_TIMEOUTS_OVERALL"},
+		"presets.build":    {Layer: runinpopup.LayerFile, Name: "/c.json"},
+		"presets.review":   {Layer: runinpopup.LayerEnv, Name: "RUN_IN_POPUP_PRESETS"},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		presets map[string]runinpopup.PresetConfig
+		want    []explained
+	}{
+		{
+			name: "each preset is a line of its own, in name order",
+			presets: map[string]runinpopup.PresetConfig{
+				"review": {Anchor: "right"},
+				"build":  {Width: "80%"},
+			},
+			want: append(slices.Clone(defaults),
+				explained{"presets.build", "file /c.json", `"width":"80%"`},
+				explained{"presets.review", "env RUN_IN_POPUP_PRESETS", `"anchor":"right"`},
+			),
+		},
+		{
+			name:    "no presets is a line saying so",
+			presets: map[string]runinpopup.PresetConfig{},
+			want:    append(slices.Clone(defaults), explained{"presets", "default", "{}"}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := runinpopup.DefaultConfig()
+			cfg.Backend = "zellij"
+			cfg.Timeouts.Overall = time.Minute
+			cfg.Presets = tc.presets
+
+			var buf strings.Builder
+			if err := RenderConfigExplain(&buf, cfg, provenance); err != nil {
+				t.Fatalf("RenderConfigExplain: %v", err)
+			}
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if got := strings.Fields(lines[0]); !slices.Equal(
+				got, []string{"KEY", "SOURCE", "DESCRIPTION", "VALUE"},
+			) {
+				t.Errorf("header = %q", lines[0])
+			}
+			lines = lines[1:]
+			if len(lines) != len(tc.want) {
+				t.Fatalf("%d lines, want %d:\n%s", len(lines), len(tc.want), buf.String())
+			}
+			for i, want := range tc.want {
+				line := lines[i]
+				if !strings.HasPrefix(line, want.key+" ") ||
+					!strings.Contains(line, "  "+want.source+"  ") ||
+					!strings.Contains(line, want.value) {
+					t.Errorf("line %d = %q, want %s from %s at %s",
+						i, line, want.key, want.source, want.value)
+				}
+			}
+		})
+	}
+}
+
 // ConfigDocs is written by hand so the descriptions can say something a struct
 // cannot; reflection lives here instead, where it holds the table to the type
 // it documents. A field added to runinpopup.Config without a doc entry — or the
@@ -162,7 +376,7 @@ func TestConfigSchemaHelp_showsEveryDocumentedField(t *testing.T) {
 					t.Errorf("ConfigSchemaHelp is missing %q of %s:\n%s", want, key, help)
 				}
 			}
-			walk(d.Fields, key+".")
+			walk(d.Fields, childKeyPrefix(d, key))
 		}
 	}
 	walk(ConfigDocs(), "")
@@ -177,13 +391,14 @@ func configDocLines(docs []ConfigFieldDoc, goPrefix, jsonPrefix string) []string
 		lines = append(lines, configSchemaLine(goPrefix+"."+d.Name, jsonPrefix+d.Key, d.Type))
 		lines = append(
 			lines,
-			configDocLines(d.Fields, goPrefix+"."+d.Name, jsonPrefix+d.Key+".")...)
+			configDocLines(d.Fields, goPrefix+"."+d.Name, childKeyPrefix(d, jsonPrefix+d.Key))...)
 	}
 	return lines
 }
 
 // configTypeLines renders the same lines off the struct itself, so the two can
-// be compared.
+// be compared. A map of structs is walked into like a struct is, through the
+// placeholder key ConfigDocs spells its paths with.
 func configTypeLines(t *testing.T, typ reflect.Type, goPrefix, jsonPrefix string) []string {
 	t.Helper()
 	var lines []string
@@ -198,6 +413,13 @@ func configTypeLines(t *testing.T, typ reflect.Type, goPrefix, jsonPrefix string
 			lines = append(lines, configTypeLines(t, field.Type, goPath, jsonPrefix+key+".")...)
 			continue
 		}
+		if field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct {
+			lines = append(lines, configSchemaLine(goPath, jsonPrefix+key, "map"))
+			lines = append(
+				lines,
+				configTypeLines(t, field.Type.Elem(), goPath, jsonPrefix+key+".NAME.")...)
+			continue
+		}
 		lines = append(lines, configSchemaLine(goPath, jsonPrefix+key, field.Type.String()))
 	}
 	return lines
@@ -1,15 +1,23 @@
 package runinpopup
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/caarlos0/env/v11"
+	"go.yaml.in/yaml/v3"
 )
 
 // Well-known names the config machinery uses, gathered in one block above the
@@ -36,51 +44,139 @@ const (
 // Config is the materialized configuration the service consumes, after every
 // layer (defaults < file < env < flags) is applied. Its fields are value types
 // (the merged config is always concrete) and carry json tags so the `config`
-// subcommand can marshal it. The config file is JSON; the yaml tags ride along
-// unused, kept field-for-field in sync so adopting YAML stays a decoder swap
-// rather than a retagging. The file is NOT decoded into Config —
+// subcommand can marshal it, and yaml and toml tags, kept field-for-field in
+// sync with them, so it prints in whichever format a config file can be
+// written in (see ConfigFormat). The file is NOT decoded into Config —
 // PartialConfig is the decode target; Config only ever holds a fully-merged
 // result.
 type Config struct {
 	// PinentryPath is the pinentry binary the proxy executes outside the popup.
-	PinentryPath string `json:"pinentry_path" yaml:"pinentry_path"`
+	PinentryPath string `json:"pinentry_path" yaml:"pinentry_path" toml:"pinentry_path"`
 	// Backend names the popup backend to use: the config file and the
 	// environment set it, the --backend flag overrides it. Valid values are
-	// "tmux-popup", "tmux-floating-pane" and "zellij"; empty means auto-detect
-	// from the environment.
-	Backend string `json:"backend" yaml:"backend"`
+	// "tmux-popup", "tmux-floating-pane", "zellij", "screen", "nvim", "wezterm",
+	// "kitty", "kitty-os-window" and "pty"; empty means auto-detect from the
+	// environment.
+	Backend string `json:"backend" yaml:"backend" toml:"backend"`
+	// Fallback is what pinentry tries, in order, when the backend cannot open a
+	// popup or its popup never reports a terminal: another backend name, "tty"
+	// for pinentry_path on the terminal gpg-agent named, or "exec:" and the path
+	// of another pinentry to hand the exchange to as it is, a graphical one say.
+	// A hop naming the backend already tried is skipped.
+	Fallback []string `json:"fallback" yaml:"fallback" toml:"fallback"`
+	// Unsupported is what a popup asking its backend for something the backend
+	// does not honor does — a title on tmux-floating-pane, a position specifier
+	// on zellij: "warn" logs it and opens the popup anyway, "fail" fails before
+	// anything is opened, "ignore" says nothing. "run-in-popup backends" prints
+	// what each backend honors.
+	Unsupported string `json:"unsupported" yaml:"unsupported" toml:"unsupported"`
 	// Timeouts bounds the popup/pinentry handshake (nested sub-config:
 	// deep-merged).
-	Timeouts TimeoutsConfig `json:"timeouts" yaml:"timeouts"`
+	Timeouts TimeoutsConfig `json:"timeouts" yaml:"timeouts" toml:"timeouts"`
+	// Fit bounds the size of a popup sized to its content (nested sub-config:
+	// deep-merged).
+	Fit FitConfig `json:"fit" yaml:"fit" toml:"fit"`
+	// Presets are named popup setups for recurring uses, picked by name with
+	// exec --preset (a map, merged name by name).
+	Presets map[string]PresetConfig `json:"presets" yaml:"presets" toml:"presets"`
 }
 
 // TimeoutsConfig bounds each stage of the popup/pinentry handshake. A
-// time.Duration serializes as an integer nanosecond count in JSON, while the
-// env layer accepts Go duration strings ("2m", "20s").
+// time.Duration serializes as an integer nanosecond count in JSON and as a Go
+// duration string ("2m0s") in YAML and TOML. The env layer and a YAML file
+// take only the string ("2m", "20s"), a TOML file either.
 type TimeoutsConfig struct {
 	// Overall bounds the whole popup/pinentry exchange.
-	Overall time.Duration `json:"overall" yaml:"overall"`
+	Overall time.Duration `json:"overall" yaml:"overall" toml:"overall"`
 	// TTYRead bounds reading the popup's tty name from the handshake FIFO.
-	TTYRead time.Duration `json:"tty_read" yaml:"tty_read"`
+	TTYRead time.Duration `json:"tty_read" yaml:"tty_read" toml:"tty_read"`
 	// DoneWrite bounds signalling the popup to close once pinentry exits.
-	DoneWrite time.Duration `json:"done_write" yaml:"done_write"`
+	DoneWrite time.Duration `json:"done_write" yaml:"done_write" toml:"done_write"`
+	// Linger is how long the pinentry popup stays open after its prompt, waiting
+	// for the next one to reuse it. Zero closes it right away.
+	Linger time.Duration `json:"linger" yaml:"linger" toml:"linger"`
+}
+
+// FitConfig bounds a popup whose Width or Height is "fit", in cells, frame
+// included. The size a payload asks for is only a wish: a list of a thousand
+// files would otherwise ask for a popup no terminal has, and an empty one for a
+// popup too small to see. The bounds apply as given, a zero minimum included;
+// LoadConfig rejects a negative one, a maximum below 1 and a minimum above its
+// maximum, none of which bounds anything a popup could be.
+type FitConfig struct {
+	MinWidth  int `json:"min_width" yaml:"min_width" toml:"min_width"`
+	MaxWidth  int `json:"max_width" yaml:"max_width" toml:"max_width"`
+	MinHeight int `json:"min_height" yaml:"min_height" toml:"min_height"`
+	MaxHeight int `json:"max_height" yaml:"max_height" toml:"max_height"`
+}
+
+// PresetConfig is one named setup exec --preset applies: the popup's title,
+// placement and size, the backend it opens on, and the environment its command
+// runs with. Each field means what the exec flag of the same name does, Env
+// aside, which no flag sets. An empty field leaves the run's own, and a flag
+// given on the command line wins over the preset's value.
+//
+// A preset is a unit: a layer naming it replaces the lower layer's whole,
+// rather than merging into it field by field, so an empty field in the file is
+// an empty field rather than a gap for something else to show through.
+type PresetConfig struct {
+	Title   string            `json:"title" yaml:"title" toml:"title"`
+	Backend string            `json:"backend" yaml:"backend" toml:"backend"`
+	X       string            `json:"x" yaml:"x" toml:"x"`
+	Y       string            `json:"y" yaml:"y" toml:"y"`
+	Width   string            `json:"width" yaml:"width" toml:"width"`
+	Height  string            `json:"height" yaml:"height" toml:"height"`
+	Anchor  string            `json:"anchor" yaml:"anchor" toml:"anchor"`
+	Margin  string            `json:"margin" yaml:"margin" toml:"margin"`
+	Env     map[string]string `json:"env" yaml:"env" toml:"env"`
+}
+
+// validate reports a preset whose backend or geometry no launch could act on,
+// the same way the launch would: it is found when the config is loaded rather
+// than the day the preset is first used, when whoever wrote it is no longer
+// looking.
+func (p PresetConfig) validate() error {
+	if names := BackendNames(); p.Backend != "" && !slices.Contains(names, p.Backend) {
+		return fmt.Errorf(
+			"unknown popup backend %q: valid values are %s",
+			p.Backend, strings.Join(names, ", "),
+		)
+	}
+	return PopupSpec{
+		X:      p.X,
+		Y:      p.Y,
+		Width:  p.Width,
+		Height: p.Height,
+		Anchor: p.Anchor,
+		Margin: p.Margin,
+	}.validateGeometry()
 }
 
 // DefaultConfig is the lowest-precedence layer. Initialize maps and sub-configs
 // here so later layers deep-merge into a populated base.
 //
 // Backend stays empty on purpose: an unset backend means "detect from
-// PINENTRY_USER_DATA / $TMUX / $ZELLIJ", so materializing a concrete backend
-// here would make that detection unreachable.
+// PINENTRY_USER_DATA / $TMUX / $ZELLIJ / $STY / $NVIM / $WEZTERM_PANE /
+// $KITTY_WINDOW_ID", so materializing a concrete backend here would make that detection
+// unreachable.
 func DefaultConfig() Config {
 	return Config{
 		PinentryPath: "/usr/bin/pinentry-curses",
 		Backend:      "",
+		Fallback:     []string{},
+		Unsupported:  string(UnsupportedWarn),
 		Timeouts: TimeoutsConfig{
 			Overall:   2 * time.Minute,
 			TTYRead:   20 * time.Second,
 			DoneWrite: time.Second,
 		},
+		Fit: FitConfig{
+			MinWidth:  20,
+			MaxWidth:  120,
+			MinHeight: 3,
+			MaxHeight: 40,
+		},
+		Presets: map[string]PresetConfig{},
 	}
 }
 
@@ -91,33 +187,52 @@ func DefaultConfig() Config {
 // so file and env merge through one method, Apply. Exported so other code can
 // build or inspect partial overrides.
 //
-// Carries three tag sets, kept in sync with Config field-for-field: json for
-// the file decode, yaml unused (see Config), and env / envPrefix for
-// caarlos0/env. The RUN_IN_POPUP_ prefix is applied once via envOptions, so the
-// tags hold only the bare names (PINENTRY_PATH -> RUN_IN_POPUP_PINENTRY_PATH,
-// TIMEOUTS_ + OVERALL -> RUN_IN_POPUP_TIMEOUTS_OVERALL).
+// Carries four tag sets, kept in sync with Config field-for-field: json, yaml
+// and toml for the file decode, whichever the file's format (see
+// ConfigFormat), and env / envPrefix for caarlos0/env. The RUN_IN_POPUP_
+// prefix is applied once via envOptions, so the tags hold only the bare names
+// (PINENTRY_PATH -> RUN_IN_POPUP_PINENTRY_PATH, TIMEOUTS_ + OVERALL ->
+// RUN_IN_POPUP_TIMEOUTS_OVERALL).
 //
 // JSON tags use ",omitzero" (Go 1.24+) so a marshaled partial stays sparse
 // while preserving an explicit zero; YAML has no omitzero, so its tags use
-// ",omitempty".
+// ",omitempty", and TOML's match them, omitempty omitting only a nil pointer
+// there too.
 //
-//nolint:lll // triple json/yaml/env tags; one field per line, never wrap tags
+//nolint:lll // json/yaml/toml/env tags; one field per line, never wrap tags
 type PartialConfig struct {
-	PinentryPath *string               `json:"pinentry_path,omitzero" yaml:"pinentry_path,omitempty" env:"PINENTRY_PATH"`
-	Backend      *string               `json:"backend,omitzero" yaml:"backend,omitempty" env:"BACKEND"`
-	Timeouts     PartialTimeoutsConfig `json:"timeouts,omitzero" yaml:"timeouts,omitempty" envPrefix:"TIMEOUTS_"`
+	PinentryPath *string                  `json:"pinentry_path,omitzero" yaml:"pinentry_path,omitempty" toml:"pinentry_path,omitempty" env:"PINENTRY_PATH"`
+	Backend      *string                  `json:"backend,omitzero" yaml:"backend,omitempty" toml:"backend,omitempty" env:"BACKEND"`
+	Fallback     *[]string                `json:"fallback,omitzero" yaml:"fallback,omitempty" toml:"fallback,omitempty" env:"FALLBACK"`
+	Unsupported  *string                  `json:"unsupported,omitzero" yaml:"unsupported,omitempty" toml:"unsupported,omitempty" env:"UNSUPPORTED"`
+	Timeouts     PartialTimeoutsConfig    `json:"timeouts,omitzero" yaml:"timeouts,omitempty" toml:"timeouts,omitempty" envPrefix:"TIMEOUTS_"`
+	Fit          PartialFitConfig         `json:"fit,omitzero" yaml:"fit,omitempty" toml:"fit,omitempty" envPrefix:"FIT_"`
+	Presets      *map[string]PresetConfig `json:"presets,omitzero" yaml:"presets,omitempty" toml:"presets,omitempty" env:"PRESETS"`
 }
 
-//nolint:lll // triple json/yaml/env tags; one field per line, never wrap tags
+//nolint:lll // json/yaml/toml/env tags; one field per line, never wrap tags
 type PartialTimeoutsConfig struct {
-	Overall   *time.Duration `json:"overall,omitzero" yaml:"overall,omitempty" env:"OVERALL"`
-	TTYRead   *time.Duration `json:"tty_read,omitzero" yaml:"tty_read,omitempty" env:"TTY_READ"`
-	DoneWrite *time.Duration `json:"done_write,omitzero" yaml:"done_write,omitempty" env:"DONE_WRITE"`
+	Overall   *time.Duration `json:"overall,omitzero" yaml:"overall,omitempty" toml:"overall,omitempty" env:"OVERALL"`
+	TTYRead   *time.Duration `json:"tty_read,omitzero" yaml:"tty_read,omitempty" toml:"tty_read,omitempty" env:"TTY_READ"`
+	DoneWrite *time.Duration `json:"done_write,omitzero" yaml:"done_write,omitempty" toml:"done_write,omitempty" env:"DONE_WRITE"`
+	Linger    *time.Duration `json:"linger,omitzero" yaml:"linger,omitempty" toml:"linger,omitempty" env:"LINGER"`
+}
+
+//nolint:lll // json/yaml/toml/env tags; one field per line, never wrap tags
+type PartialFitConfig struct {
+	MinWidth  *int `json:"min_width,omitzero" yaml:"min_width,omitempty" toml:"min_width,omitempty" env:"MIN_WIDTH"`
+	MaxWidth  *int `json:"max_width,omitzero" yaml:"max_width,omitempty" toml:"max_width,omitempty" env:"MAX_WIDTH"`
+	MinHeight *int `json:"min_height,omitzero" yaml:"min_height,omitempty" toml:"min_height,omitempty" env:"MIN_HEIGHT"`
+	MaxHeight *int `json:"max_height,omitzero" yaml:"max_height,omitempty" toml:"max_height,omitempty" env:"MAX_HEIGHT"`
 }
 
 // Apply overlays p's present fields onto base and returns the merged Config.
 // Merge rules by field kind:
 //   - scalar:        non-nil pointer overwrites (explicit zero included).
+//   - list:          non-nil pointer replaces the whole list; an ordered chain
+//     merged element by element would be nobody's order.
+//   - map:           non-nil pointer merges name by name, each entry replacing
+//     the lower layer's entry of that name whole (see PresetConfig).
 //   - nested struct: deep-merged via the sub-partial's Apply — always called; a
 //     zero sub-partial (all fields nil) merges nothing.
 func (p PartialConfig) Apply(base Config) Config {
@@ -127,7 +242,24 @@ func (p PartialConfig) Apply(base Config) Config {
 	if p.Backend != nil {
 		base.Backend = *p.Backend
 	}
+	if p.Fallback != nil {
+		base.Fallback = *p.Fallback
+	}
+	if p.Unsupported != nil {
+		base.Unsupported = *p.Unsupported
+	}
 	base.Timeouts = p.Timeouts.Apply(base.Timeouts)
+	base.Fit = p.Fit.Apply(base.Fit)
+	if p.Presets != nil {
+		// Cloned so the lower layer's map, DefaultConfig's included, is never
+		// written through.
+		presets := maps.Clone(base.Presets)
+		if presets == nil {
+			presets = make(map[string]PresetConfig, len(*p.Presets))
+		}
+		maps.Copy(presets, *p.Presets)
+		base.Presets = presets
+	}
 	return base
 }
 
@@ -141,14 +273,120 @@ func (p PartialTimeoutsConfig) Apply(base TimeoutsConfig) TimeoutsConfig {
 	if p.DoneWrite != nil {
 		base.DoneWrite = *p.DoneWrite
 	}
+	if p.Linger != nil {
+		base.Linger = *p.Linger
+	}
+	return base
+}
+
+func (p PartialFitConfig) Apply(base FitConfig) FitConfig {
+	if p.MinWidth != nil {
+		base.MinWidth = *p.MinWidth
+	}
+	if p.MaxWidth != nil {
+		base.MaxWidth = *p.MaxWidth
+	}
+	if p.MinHeight != nil {
+		base.MinHeight = *p.MinHeight
+	}
+	if p.MaxHeight != nil {
+		base.MaxHeight = *p.MaxHeight
+	}
 	return base
 }
 
+// keys lists the keys p sets, as ConfigProvenance has them, in declaration
+// order. Like Apply it spells every field out by hand, and a test holds the two
+// to the same field list.
+func (p PartialConfig) keys() []string {
+	var keys []string
+	if p.PinentryPath != nil {
+		keys = append(keys, "pinentry_path")
+	}
+	if p.Backend != nil {
+		keys = append(keys, "backend")
+	}
+	if p.Fallback != nil {
+		keys = append(keys, "fallback")
+	}
+	if p.Unsupported != nil {
+		keys = append(keys, "unsupported")
+	}
+	keys = append(keys, p.Timeouts.keys("timeouts.")...)
+	keys = append(keys, p.Fit.keys("fit.")...)
+	if p.Presets != nil {
+		for _, name := range slices.Sorted(maps.Keys(*p.Presets)) {
+			keys = append(keys, "presets."+name)
+		}
+	}
+	return keys
+}
+
+func (p PartialTimeoutsConfig) keys(prefix string) []string {
+	var keys []string
+	if p.Overall != nil {
+		keys = append(keys, prefix+"overall")
+	}
+	if p.TTYRead != nil {
+		keys = append(keys, prefix+"tty_read")
+	}
+	if p.DoneWrite != nil {
+		keys = append(keys, prefix+"done_write")
+	}
+	if p.Linger != nil {
+		keys = append(keys, prefix+"linger")
+	}
+	return keys
+}
+
+func (p PartialFitConfig) keys(prefix string) []string {
+	var keys []string
+	if p.MinWidth != nil {
+		keys = append(keys, prefix+"min_width")
+	}
+	if p.MaxWidth != nil {
+		keys = append(keys, prefix+"max_width")
+	}
+	if p.MinHeight != nil {
+		keys = append(keys, prefix+"min_height")
+	}
+	if p.MaxHeight != nil {
+		keys = append(keys, prefix+"max_height")
+	}
+	return keys
+}
+
 // envOptions configures caarlos0/env for the env layer in LoadConfig. The
 // variable names live in the env: / envPrefix: tags on PartialConfig; the
 // EnvPrefix const is applied here, yielding RUN_IN_POPUP_PINENTRY_PATH,
 // RUN_IN_POPUP_TIMEOUTS_OVERALL, etc.
-var envOptions = env.Options{Prefix: EnvPrefix}
+//
+// caarlos0/env parses a list but not a pointer to one, which is what keeps an
+// absent list apart from a present one, so lists get a parser of their own:
+// comma-separated, with the spaces around an entry and empty entries dropped.
+// The presets have no flat spelling at all, and are read as the JSON object
+// a JSON file would hold, whatever format the file itself is in.
+var envOptions = env.Options{
+	Prefix: EnvPrefix,
+	FuncMap: map[reflect.Type]env.ParserFunc{
+		reflect.TypeFor[[]string](): func(v string) (any, error) {
+			list := []string{}
+			for entry := range strings.SplitSeq(v, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					list = append(list, entry)
+				}
+			}
+			return list, nil
+		},
+		reflect.TypeFor[map[string]PresetConfig](): func(v string) (any, error) {
+			var presets map[string]PresetConfig
+			if err := json.Unmarshal([]byte(v), &presets); err != nil {
+				return nil, err
+			}
+			return presets, nil
+		},
+	},
+}
 
 // LoadConfig assembles defaults < config file < environment through Apply. The
 // ./cmd layer applies explicitly-set flags on top (flags win). flagPath is the
@@ -161,30 +399,256 @@ var envOptions = env.Options{Prefix: EnvPrefix}
 // ParseWithOptions errors when a present value fails to parse — a hard error
 // that aborts startup.
 func LoadConfig(flagPath string) (Config, error) {
+	cfg, _, err := LoadConfigExplained(flagPath)
+	return cfg, err
+}
+
+// LoadConfigExplained is LoadConfig, also recording where each key's value came
+// from. LoadConfig is this with the record dropped rather than a second
+// assembly, so what config explain says is what every command loads.
+func LoadConfigExplained(flagPath string) (Config, ConfigProvenance, error) {
 	cfg := DefaultConfig()
+	provenance := ConfigProvenance{}
 
 	path, err := configPath(flagPath)
 	if err != nil {
-		return cfg, err
+		return cfg, provenance, err
 	}
 	filePartial, err := unmarshalConfigFile(path)
 	if err != nil {
-		return cfg, err
+		return cfg, provenance, err
 	}
-	cfg = filePartial.Apply(cfg)
+	cfg = provenance.Overlay(cfg, filePartial, func(string) ConfigSource {
+		return ConfigSource{Layer: LayerFile, Name: path}
+	})
 
 	var envPartial PartialConfig
 	if err := env.ParseWithOptions(&envPartial, envOptions); err != nil {
-		return cfg, err
+		return cfg, provenance, err
+	}
+	cfg = provenance.Overlay(cfg, envPartial, func(key string) ConfigSource {
+		return ConfigSource{Layer: LayerEnv, Name: configEnvVar(key)}
+	})
+
+	if err := validateUnsupported(cfg.Unsupported); err != nil {
+		return cfg, provenance, err
 	}
-	cfg = envPartial.Apply(cfg)
+	if err := cfg.Fit.validate(); err != nil {
+		return cfg, provenance, err
+	}
+	if err := validatePresets(cfg.Presets); err != nil {
+		return cfg, provenance, err
+	}
+	return cfg, provenance, nil
+}
+
+// ConfigLayer is one of the layers a Config is assembled from, named by what
+// config explain prints for it.
+type ConfigLayer string
 
-	return cfg, nil
+const (
+	LayerDefault ConfigLayer = "default"
+	LayerFile    ConfigLayer = "file"
+	LayerEnv     ConfigLayer = "env"
+	LayerFlag    ConfigLayer = "flag"
+)
+
+// ConfigSource is where a key's final value came from: the layer, and what in
+// it set the key — the file's path, the variable's name or the flag's, empty
+// for a default, which nothing sets.
+type ConfigSource struct {
+	Layer ConfigLayer
+	Name  string
+}
+
+// ConfigProvenance maps each key a layer set to the source of its final value.
+// A key is dotted the way the config file nests it ("timeouts.overall"), and a
+// preset's is its name under "presets" ("presets.review"): a map merges entry
+// by entry, so each entry has a source of its own. A key it lacks holds its
+// default; see Source.
+type ConfigProvenance map[string]ConfigSource
+
+// Source reports where key's value came from, the default layer when no layer
+// above it set the key.
+func (p ConfigProvenance) Source(key string) ConfigSource {
+	if source, ok := p[key]; ok {
+		return source
+	}
+	return ConfigSource{Layer: LayerDefault}
+}
+
+// Overlay applies partial onto base through Apply, crediting every key the
+// partial sets to source(key) over whatever lower layer set it before, and
+// returns the merged Config. It is how a layer above LoadConfig's, the flags,
+// joins the record: the credit and the merge cannot be done apart, so neither
+// can disagree with the other.
+func (p ConfigProvenance) Overlay(
+	base Config,
+	partial PartialConfig,
+	source func(key string) ConfigSource,
+) Config {
+	for _, key := range partial.keys() {
+		p[key] = source(key)
+	}
+	return partial.Apply(base)
+}
+
+// configEnvVar names the variable the env layer reads key from. Every name
+// follows from the key, the nesting dots becoming the underscores envPrefix
+// joins with, save a preset's: the presets are read whole from one variable,
+// whatever the entry.
+func configEnvVar(key string) string {
+	if strings.HasPrefix(key, "presets.") {
+		key = "presets"
+	}
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// validateUnsupported checks the policy the moment it is read. Nothing else
+// would until a launch consulted it, and then every launch would fail, every
+// pinentry prompt included, a long way from the typo that caused it. Empty is
+// the launcher's own default, warn.
+func validateUnsupported(policy string) error {
+	policies := UnsupportedPolicies()
+	if policy == "" || slices.Contains(policies, UnsupportedPolicy(policy)) {
+		return nil
+	}
+	names := make([]string, len(policies))
+	for i, p := range policies {
+		names[i] = strconv.Quote(string(p))
+	}
+	return fmt.Errorf("config: unsupported %q: want one of %s", policy, strings.Join(names, ", "))
+}
+
+// validate checks the bounds pair by pair, naming the keys a user would fix.
+func (c FitConfig) validate() error {
+	for _, b := range []struct {
+		axis     string
+		min, max int
+	}{
+		{"width", c.MinWidth, c.MaxWidth},
+		{"height", c.MinHeight, c.MaxHeight},
+	} {
+		switch {
+		case b.min < 0:
+			return fmt.Errorf("config: fit.min_%s %d: want 0 or more", b.axis, b.min)
+		case b.max < 1:
+			return fmt.Errorf("config: fit.max_%s %d: want 1 or more", b.axis, b.max)
+		case b.min > b.max:
+			return fmt.Errorf(
+				"config: fit.min_%[1]s %[2]d is above fit.max_%[1]s %[3]d",
+				b.axis, b.min, b.max,
+			)
+		}
+	}
+	return nil
+}
+
+// validatePresets checks every preset, in name order so the one reported is
+// the same from run to run.
+func validatePresets(presets map[string]PresetConfig) error {
+	for _, name := range slices.Sorted(maps.Keys(presets)) {
+		if name == "" {
+			return errors.New("config: a preset has an empty name, which --preset cannot pick")
+		}
+		if err := presets[name].validate(); err != nil {
+			return fmt.Errorf("config: preset %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ConfigFormat is an encoding a config file can be written in, named by the
+// extension that selects it and by the value config --output takes. The three
+// decode into the same PartialConfig through their own tag sets, so a file
+// means the same whichever of them it is written in.
+type ConfigFormat string
+
+const (
+	ConfigJSON ConfigFormat = "json"
+	ConfigYAML ConfigFormat = "yaml"
+	ConfigTOML ConfigFormat = "toml"
+)
+
+// ConfigFormats lists the formats, JSON first: it is the default output, and
+// the format a file whose extension names none is read in.
+func ConfigFormats() []ConfigFormat {
+	return []ConfigFormat{ConfigJSON, ConfigYAML, ConfigTOML}
+}
+
+// configFormatOf picks the format path is read in by its extension. Anything
+// but YAML's or TOML's is JSON, which is what every file was read as before
+// there was a choice, so a --config path named otherwise keeps working.
+func configFormatOf(path string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ConfigYAML
+	case ".toml":
+		return ConfigTOML
+	}
+	return ConfigJSON
+}
+
+// Marshal encodes v, a Config or a PartialConfig, as a config file in f would
+// hold it: JSON indented by two spaces like the rest of the tool's JSON, YAML
+// by two to match, and TOML with a table per sub-config.
+func (f ConfigFormat) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	switch f {
+	case ConfigJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	case ConfigYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case ConfigTOML:
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, f.unknown()
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshal decodes b into v, which is always a zero PartialConfig; see
+// unmarshalConfigFile.
+func (f ConfigFormat) unmarshal(b []byte, v any) error {
+	switch f {
+	case ConfigJSON:
+		return json.Unmarshal(b, v)
+	case ConfigYAML:
+		return yaml.Unmarshal(b, v)
+	case ConfigTOML:
+		_, err := toml.Decode(string(b), v)
+		return err
+	}
+	return f.unknown()
+}
+
+// unknown is the error a format no case knows gets, listing those that are.
+func (f ConfigFormat) unknown() error {
+	names := make([]string, 0, len(ConfigFormats()))
+	for _, known := range ConfigFormats() {
+		names = append(names, string(known))
+	}
+	return fmt.Errorf("unknown config format %q: want %s", f, strings.Join(names, ", "))
 }
 
 // unmarshalConfigFile only reads + decodes; it never merges. It decodes into a
-// fresh zero PartialConfig (all nil) and returns the zero value when the file
-// does not exist. A non-ENOENT read error or a JSON parse error aborts.
+// fresh zero PartialConfig (all nil), in the format path's extension names
+// (see configFormatOf), and returns the zero value when the file does not
+// exist. A non-ENOENT read error or a parse error aborts.
 //
 // Decoding into a zero value — never a defaults-populated struct — sidesteps the
 // v1 encoding/json merge edge cases that decoding into a populated struct hits;
@@ -198,15 +662,30 @@ func unmarshalConfigFile(path string) (PartialConfig, error) {
 		return PartialConfig{}, fmt.Errorf("read config %q: %w", path, err)
 	}
 	var p PartialConfig
-	if err := json.Unmarshal(b, &p); err != nil {
+	if err := configFormatOf(path).unmarshal(b, &p); err != nil {
 		return PartialConfig{}, fmt.Errorf("parse config %q: %w", path, err)
 	}
 	return p, nil
 }
 
+// defaultConfigNames are the files configPath looks for in the default
+// directory, config.json first as the one assumed when there is none. Every
+// extension configFormatOf knows is here, .yml included, so no file it could
+// read is passed over.
+var defaultConfigNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
 // configPath resolves the file path: --config (flagPath), else the
-// $ENV_RUN_IN_POPUP_CONF override, else os.UserConfigDir()/defaultConfigDir/
-// config.json. (The const is declared in the block at the top of the file.)
+// $ENV_RUN_IN_POPUP_CONF override, else whichever of defaultConfigNames exists
+// under os.UserConfigDir()/defaultConfigDir. (The const is declared in the
+// block at the top of the file.)
+//
+// A path given by flag or variable is taken as it is, its extension picking
+// the format. The default directory is searched instead, and holding more
+// than one of the names is an error rather than a silent pick: an edit to the
+// one not read would otherwise go nowhere without a word. When it holds none,
+// the path is config.json's, which unmarshalConfigFile reads as empty. A name
+// that cannot be looked at, for want of permission say, is an error too: it
+// may well be the file the user meant.
 func configPath(flagPath string) (string, error) {
 	if flagPath != "" {
 		return flagPath, nil
@@ -218,5 +697,26 @@ func configPath(flagPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, defaultConfigDir, "config.json"), nil
+	dir = filepath.Join(dir, defaultConfigDir)
+	var found []string
+	for _, name := range defaultConfigNames {
+		_, err := os.Stat(filepath.Join(dir, name))
+		switch {
+		case err == nil:
+			found = append(found, name)
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", fmt.Errorf("config: %w", err)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return filepath.Join(dir, defaultConfigNames[0]), nil
+	case 1:
+		return filepath.Join(dir, found[0]), nil
+	}
+	return "", fmt.Errorf(
+		"config: %s holds %s, and only one is read; remove the others,"+
+			" or name one with --config or $%s",
+		dir, strings.Join(found, " and "), ENV_RUN_IN_POPUP_CONF,
+	)
 }
@@ -25,9 +25,9 @@ type configLeaf struct {
 }
 
 // walkConfigTree flattens a config struct into its leaves in declaration order,
-// checking the tag conventions on the way down: json and yaml agree on every
-// key, a sparse mirror marks every field optional and names its env variable,
-// and the concrete config marks nothing optional.
+// checking the tag conventions on the way down: json, yaml and toml agree on
+// every key, a sparse mirror marks every field optional and names its env
+// variable, and the concrete config marks nothing optional.
 func walkConfigTree(t *testing.T, typ reflect.Type, sparse bool) []configLeaf {
 	t.Helper()
 	return appendConfigLeaves(t, nil, typ, sparse, configLeaf{})
@@ -43,13 +43,15 @@ func appendConfigLeaves(
 	t.Helper()
 	for field := range typ.Fields() {
 		jsonKey := configTagKey(t, typ, field, "json", "omitzero", sparse)
-		yamlKey := configTagKey(t, typ, field, "yaml", "omitempty", sparse)
-		if jsonKey != yamlKey {
-			t.Errorf(
-				"%s.%s: json key %q and yaml key %q disagree,"+
-					" but the tag sets are kept field-for-field in sync",
-				typ, field.Name, jsonKey, yamlKey,
-			)
+		for _, format := range []string{"yaml", "toml"} {
+			key := configTagKey(t, typ, field, format, "omitempty", sparse)
+			if key != jsonKey {
+				t.Errorf(
+					"%s.%s: json key %q and %s key %q disagree,"+
+						" but the tag sets are kept field-for-field in sync",
+					typ, field.Name, jsonKey, format, key,
+				)
+			}
 		}
 
 		leaf := configLeaf{
@@ -95,7 +97,7 @@ func configTagKey(
 	t.Helper()
 	value, ok := field.Tag.Lookup(tag)
 	if !ok {
-		t.Errorf("%s.%s: no %s tag; every config field carries all three tag sets",
+		t.Errorf("%s.%s: no %s tag; every config field carries all four tag sets",
 			typ, field.Name, tag)
 		return ""
 	}
@@ -172,7 +174,7 @@ func TestPartialConfig_applyReachesEveryField(t *testing.T) {
 			for _, leaf := range concrete {
 				gotValue := got.FieldByIndex(leaf.index)
 				if leaf.jsonPath == set.jsonPath {
-					if !gotValue.Equal(want) {
+					if !reflect.DeepEqual(gotValue.Interface(), want.Interface()) {
 						t.Errorf(
 							"Apply left %s at %v though the partial set %v:"+
 								" the merge has no branch for this field",
@@ -182,8 +184,8 @@ func TestPartialConfig_applyReachesEveryField(t *testing.T) {
 					continue
 				}
 				if defValue := reflect.ValueOf(def).
-					FieldByIndex(leaf.index); !gotValue.Equal(
-					defValue,
+					FieldByIndex(leaf.index); !reflect.DeepEqual(
+					gotValue.Interface(), defValue.Interface(),
 				) {
 					t.Errorf(
 						"Apply changed %s from %v to %v while only %s was set",
@@ -195,6 +197,53 @@ func TestPartialConfig_applyReachesEveryField(t *testing.T) {
 	}
 }
 
+// The provenance a load records is only as good as keys, which spells the
+// field list out a third time: every field a partial can set is credited, under
+// the key the file nests it at, and to the variable the env layer reads it from.
+func TestPartialConfig_keysReachEveryField(t *testing.T) {
+	def := DefaultConfig()
+	concrete := walkConfigTree(t, reflect.TypeFor[Config](), false)
+	byJSONPath := make(map[string]configLeaf, len(concrete))
+	for _, leaf := range concrete {
+		byJSONPath[leaf.jsonPath] = leaf
+	}
+
+	for _, set := range walkConfigTree(t, reflect.TypeFor[PartialConfig](), true) {
+		t.Run(set.jsonPath, func(t *testing.T) {
+			target, ok := byJSONPath[set.jsonPath]
+			if !ok {
+				t.Fatalf("PartialConfig has %s but Config does not", set.jsonPath)
+			}
+			value := differentConfigValue(t, reflect.ValueOf(def).FieldByIndex(target.index))
+
+			partial := reflect.New(reflect.TypeFor[PartialConfig]()).Elem()
+			field := partial.FieldByIndex(set.index)
+			field.Set(reflect.New(field.Type().Elem()))
+			field.Elem().Set(value)
+
+			// A map is credited entry by entry, the unit it merges by.
+			want := []string{set.jsonPath}
+			if value.Kind() == reflect.Map {
+				want = nil
+				for _, k := range value.MapKeys() {
+					want = append(want, set.jsonPath+"."+k.String())
+				}
+				slices.Sort(want)
+			}
+			got := partial.Interface().(PartialConfig).keys()
+			if !slices.Equal(got, want) {
+				t.Errorf("keys = %q, want %q: keys has no branch for this field", got, want)
+			}
+			for _, key := range got {
+				if env := configEnvVar(key); env != EnvPrefix+set.env {
+					t.Errorf("configEnvVar(%q) = %s, but the env layer reads %s%s",
+						key, env, EnvPrefix, set.env)
+				}
+			}
+		})
+	}
+}
+
 // differentConfigValue returns a value the field does not already hold, so a
 // merge that skips the field is visible rather than accidentally right.
 func differentConfigValue(t *testing.T, current reflect.Value) reflect.Value {
@@ -209,6 +258,28 @@ func differentConfigValue(t *testing.T, current reflect.Value) reflect.Value {
 		return reflect.ValueOf(current.Int() + 1).Convert(current.Type())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return reflect.ValueOf(current.Uint() + 1).Convert(current.Type())
+	case reflect.Slice:
+		if current.Type().Elem().Kind() == reflect.String {
+			return reflect.Append(current, reflect.ValueOf("-overridden"))
+		}
+		t.Fatalf("no override value for a %s field: teach this test how to vary one",
+			current.Type())
+		return reflect.Value{}
+	case reflect.Map:
+		if current.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMap(current.Type())
+			for iter := current.MapRange(); iter.Next(); {
+				m.SetMapIndex(iter.Key(), iter.Value())
+			}
+			m.SetMapIndex(
+				reflect.ValueOf("-overridden").Convert(current.Type().Key()),
+				reflect.Zero(current.Type().Elem()),
+			)
+			return m
+		}
+		t.Fatalf("no override value for a %s field: teach this test how to vary one",
+			current.Type())
+		return reflect.Value{}
 	default:
 		t.Fatalf("no override value for a %s field: teach this test how to vary one",
 			current.Type())
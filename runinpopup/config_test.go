@@ -1,8 +1,11 @@
 package runinpopup
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -14,9 +17,17 @@ var configEnvVars = []string{
 	ENV_RUN_IN_POPUP_CONF,
 	"RUN_IN_POPUP_PINENTRY_PATH",
 	"RUN_IN_POPUP_BACKEND",
+	"RUN_IN_POPUP_FALLBACK",
+	"RUN_IN_POPUP_UNSUPPORTED",
 	"RUN_IN_POPUP_TIMEOUTS_OVERALL",
 	"RUN_IN_POPUP_TIMEOUTS_TTY_READ",
 	"RUN_IN_POPUP_TIMEOUTS_DONE_WRITE",
+	"RUN_IN_POPUP_TIMEOUTS_LINGER",
+	"RUN_IN_POPUP_FIT_MIN_WIDTH",
+	"RUN_IN_POPUP_FIT_MAX_WIDTH",
+	"RUN_IN_POPUP_FIT_MIN_HEIGHT",
+	"RUN_IN_POPUP_FIT_MAX_HEIGHT",
+	"RUN_IN_POPUP_PRESETS",
 }
 
 // isolateConfigEnv unsets every variable of the env layer so a case sees only
@@ -33,10 +44,18 @@ func isolateConfigEnv(t *testing.T) {
 	}
 }
 
-// writeConfig writes body to a file in a fresh temp dir and returns its path.
+// writeConfig writes body to a JSON file in a fresh temp dir and returns its
+// path.
 func writeConfig(t *testing.T, body string) string {
 	t.Helper()
-	path := filepath.Join(t.TempDir(), "config.json")
+	return writeConfigFile(t, t.TempDir(), "config.json", body)
+}
+
+// writeConfigFile writes body to dir/name, whose extension picks the format it
+// is read in, and returns its path.
+func writeConfigFile(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
 	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
 		t.Fatalf("WriteFile(%q): %v", path, err)
 	}
@@ -64,7 +83,11 @@ func TestLoadConfig_layering(t *testing.T) {
 			want: Config{
 				PinentryPath: "/usr/bin/pinentry-tty",
 				Backend:      "zellij",
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
 				Timeouts:     def.Timeouts,
+				Fit:          def.Fit,
+				Presets:      def.Presets,
 			},
 		},
 		{
@@ -73,11 +96,15 @@ func TestLoadConfig_layering(t *testing.T) {
 			want: Config{
 				PinentryPath: def.PinentryPath,
 				Backend:      def.Backend,
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
 				Timeouts: TimeoutsConfig{
 					Overall:   time.Minute,
 					TTYRead:   def.Timeouts.TTYRead,
 					DoneWrite: def.Timeouts.DoneWrite,
 				},
+				Fit:     def.Fit,
+				Presets: def.Presets,
 			},
 		},
 		{
@@ -86,11 +113,15 @@ func TestLoadConfig_layering(t *testing.T) {
 			want: Config{
 				PinentryPath: def.PinentryPath,
 				Backend:      def.Backend,
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
 				Timeouts: TimeoutsConfig{
 					Overall:   0,
 					TTYRead:   def.Timeouts.TTYRead,
 					DoneWrite: def.Timeouts.DoneWrite,
 				},
+				Fit:     def.Fit,
+				Presets: def.Presets,
 			},
 		},
 		{
@@ -102,11 +133,47 @@ func TestLoadConfig_layering(t *testing.T) {
 			want: Config{
 				PinentryPath: "/opt/pinentry",
 				Backend:      def.Backend,
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
 				Timeouts: TimeoutsConfig{
 					Overall:   def.Timeouts.Overall,
 					TTYRead:   5 * time.Second,
 					DoneWrite: def.Timeouts.DoneWrite,
 				},
+				Fit:     def.Fit,
+				Presets: def.Presets,
+			},
+		},
+		{
+			name: "a fit bound from the env preserves its siblings",
+			env:  map[string]string{"RUN_IN_POPUP_FIT_MAX_HEIGHT": "12"},
+			want: Config{
+				PinentryPath: def.PinentryPath,
+				Backend:      def.Backend,
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
+				Timeouts:     def.Timeouts,
+				Fit: FitConfig{
+					MinWidth:  def.Fit.MinWidth,
+					MaxWidth:  def.Fit.MaxWidth,
+					MinHeight: def.Fit.MinHeight,
+					MaxHeight: 12,
+				},
+				Presets: def.Presets,
+			},
+		},
+		{
+			name: "a list from the env replaces the file's whole",
+			file: `{"fallback":["tmux-floating-pane","tty"]}`,
+			env:  map[string]string{"RUN_IN_POPUP_FALLBACK": " tty , exec:/usr/bin/pinentry-qt,"},
+			want: Config{
+				PinentryPath: def.PinentryPath,
+				Backend:      def.Backend,
+				Fallback:     []string{"tty", "exec:/usr/bin/pinentry-qt"},
+				Unsupported:  def.Unsupported,
+				Timeouts:     def.Timeouts,
+				Fit:          def.Fit,
+				Presets:      def.Presets,
 			},
 		},
 		{
@@ -120,11 +187,15 @@ func TestLoadConfig_layering(t *testing.T) {
 			want: Config{
 				PinentryPath: "/from/env",
 				Backend:      "tmux-popup",
+				Fallback:     def.Fallback,
+				Unsupported:  def.Unsupported,
 				Timeouts: TimeoutsConfig{
 					Overall:   time.Minute,
 					TTYRead:   5 * time.Second,
 					DoneWrite: def.Timeouts.DoneWrite,
 				},
+				Fit:     def.Fit,
+				Presets: def.Presets,
 			},
 		},
 	} {
@@ -142,7 +213,7 @@ func TestLoadConfig_layering(t *testing.T) {
 			if err != nil {
 				t.Fatalf("LoadConfig: %v", err)
 			}
-			if got != tc.want {
+			if !reflect.DeepEqual(got, tc.want) {
 				t.Errorf("LoadConfig =\n\t%+v\nwant\n\t%+v", got, tc.want)
 			}
 		})
@@ -181,6 +252,84 @@ func TestLoadConfig_path(t *testing.T) {
 		}
 	})
 
+	t.Run("the default directory holds any one format", func(t *testing.T) {
+		isolateConfigEnv(t)
+		home := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", home)
+		dir := filepath.Join(home, defaultConfigDir)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		writeConfigFile(t, dir, "config.toml", `pinentry_path = "/from/toml"`)
+
+		got, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if got.PinentryPath != "/from/toml" {
+			t.Errorf("PinentryPath = %q, want config.toml's", got.PinentryPath)
+		}
+	})
+
+	t.Run("the default directory holding two formats aborts", func(t *testing.T) {
+		isolateConfigEnv(t)
+		home := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", home)
+		dir := filepath.Join(home, defaultConfigDir)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		writeConfigFile(t, dir, "config.json", `{}`)
+		writeConfigFile(t, dir, "config.yaml", `{}`)
+
+		_, err := LoadConfig("")
+		if err == nil || !strings.Contains(err.Error(), "config.json and config.yaml") {
+			t.Fatalf("err = %v, want one naming both files", err)
+		}
+		// Naming one settles it.
+		if _, err := LoadConfig(filepath.Join(dir, "config.yaml")); err != nil {
+			t.Errorf("LoadConfig with --config: %v", err)
+		}
+	})
+
+	t.Run("the default directory's config.yml is read", func(t *testing.T) {
+		isolateConfigEnv(t)
+		home := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", home)
+		dir := filepath.Join(home, defaultConfigDir)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+		writeConfigFile(t, dir, "config.yml", `pinentry_path: /from/yml`)
+
+		got, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if got.PinentryPath != "/from/yml" {
+			t.Errorf("PinentryPath = %q, want config.yml's", got.PinentryPath)
+		}
+		// Beside a config.yaml it is one file too many.
+		writeConfigFile(t, dir, "config.yaml", `{}`)
+		if _, err := LoadConfig(""); err == nil ||
+			!strings.Contains(err.Error(), "config.yaml and config.yml") {
+			t.Errorf("err = %v, want one naming both files", err)
+		}
+	})
+
+	t.Run("a default file that cannot be looked at aborts", func(t *testing.T) {
+		isolateConfigEnv(t)
+		home := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", home)
+		// A file where the directory should be: stat fails with ENOTDIR,
+		// which, like EACCES, says nothing about whether the config exists.
+		writeConfigFile(t, home, defaultConfigDir, `{}`)
+
+		if _, err := LoadConfig(""); err == nil || errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("err = %v, want the stat failure", err)
+		}
+	})
+
 	t.Run("a malformed file aborts", func(t *testing.T) {
 		isolateConfigEnv(t)
 		path := writeConfig(t, `{"pinentry_path":`)
@@ -191,3 +340,321 @@ func TestLoadConfig_path(t *testing.T) {
 		}
 	})
 }
+
+// A file means the same in every format it can be written in, each spelling
+// durations its own way, and an explicit zero survives all three.
+func TestLoadConfig_formats(t *testing.T) {
+	def := DefaultConfig()
+	want := def
+	want.PinentryPath = "/usr/bin/pinentry-tty"
+	want.Fallback = []string{"tty"}
+	want.Timeouts.Overall = time.Minute
+	want.Timeouts.DoneWrite = 0
+	want.Fit.MaxWidth = 80
+	want.Presets = map[string]PresetConfig{
+		"build": {Width: "80%", Env: map[string]string{"GOFLAGS": "-race"}},
+	}
+
+	for _, tc := range []struct {
+		name, body string
+	}{
+		{
+			name: "config.json",
+			body: `{"pinentry_path":"/usr/bin/pinentry-tty","fallback":["tty"],` +
+				`"timeouts":{"overall":60000000000,"done_write":0},"fit":{"max_width":80},` +
+				`"presets":{"build":{"width":"80%","env":{"GOFLAGS":"-race"}}}}`,
+		},
+		{
+			name: "config.yaml",
+			body: `pinentry_path: /usr/bin/pinentry-tty
+fallback: [tty]
+timeouts:
+  overall: 1m
+  done_write: 0s
+fit:
+  max_width: 80
+presets:
+  build:
+    width: 80%
+    env: {GOFLAGS: -race}
+`,
+		},
+		{
+			name: "config.yml",
+			body: `{pinentry_path: /usr/bin/pinentry-tty, fallback: [tty],` +
+				` timeouts: {overall: 1m, done_write: 0s}, fit: {max_width: 80},` +
+				` presets: {build: {width: 80%, env: {GOFLAGS: -race}}}}`,
+		},
+		{
+			name: "config.toml",
+			body: `pinentry_path = "/usr/bin/pinentry-tty"
+fallback = ["tty"]
+
+[timeouts]
+overall = "1m"
+done_write = 0
+
+[fit]
+max_width = 80
+
+[presets.build]
+width = "80%"
+env = { GOFLAGS = "-race" }
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolateConfigEnv(t)
+			got, err := LoadConfig(writeConfigFile(t, t.TempDir(), tc.name, tc.body))
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadConfig =\n\t%+v\nwant\n\t%+v", got, want)
+			}
+		})
+	}
+}
+
+// What config prints in a format reads back as the same config from a file in
+// it, so its output is a starting point for one.
+func TestConfigFormat_Marshal(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Backend = "zellij"
+	cfg.Timeouts.Linger = 90 * time.Second
+	cfg.Presets = map[string]PresetConfig{
+		"review": {Title: "review", Anchor: "right", Env: map[string]string{"A": "1"}},
+	}
+
+	for _, format := range ConfigFormats() {
+		t.Run(string(format), func(t *testing.T) {
+			isolateConfigEnv(t)
+			b, err := format.Marshal(cfg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			path := writeConfigFile(t, t.TempDir(), "config."+string(format), string(b))
+			got, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig of\n%s: %v", b, err)
+			}
+			if !reflect.DeepEqual(got, cfg) {
+				t.Errorf("read back\n%s\nas\n\t%+v\nwant\n\t%+v", b, got, cfg)
+			}
+		})
+	}
+
+	if _, err := ConfigFormat("ini").Marshal(cfg); err == nil ||
+		!strings.Contains(err.Error(), "want json, yaml, toml") {
+		t.Errorf("Marshal as ini: err = %v, want one listing the formats", err)
+	}
+}
+
+// Each key is credited to the highest layer that set it, naming the file,
+// the variable or the flag; the rest are defaults.
+func TestLoadConfigExplained(t *testing.T) {
+	isolateConfigEnv(t)
+	path := writeConfig(t, `{"backend":"zellij","timeouts":{"overall":60000000000,"linger":0},`+
+		`"presets":{"review":{"anchor":"right"},"build":{"width":"80%"}}}`)
+	t.Setenv("RUN_IN_POPUP_TIMEOUTS_OVERALL", "90s")
+	t.Setenv("RUN_IN_POPUP_PRESETS", `{"build":{"width":"90%"}}`)
+
+	cfg, provenance, err := LoadConfigExplained(path)
+	if err != nil {
+		t.Fatalf("LoadConfigExplained: %v", err)
+	}
+	backend := "tmux-popup"
+	flagged := provenance.Overlay(cfg, PartialConfig{Backend: &backend}, func(string) ConfigSource {
+		return ConfigSource{Layer: LayerFlag, Name: "--backend"}
+	})
+	if flagged.Backend != backend {
+		t.Errorf("Overlay left Backend at %q, want the flag's %q", flagged.Backend, backend)
+	}
+
+	for key, want := range map[string]ConfigSource{
+		"pinentry_path":       {Layer: LayerDefault},
+		"backend":             {Layer: LayerFlag, Name: "--backend"},
+		"timeouts.overall":    {Layer: LayerEnv, Name: "RUN_IN_POPUP_TIMEOUTS_OVERALL"},
+		"timeouts.tty_read":   {Layer: LayerDefault},
+		"timeouts.linger":     {Layer: LayerFile, Name: path},
+		"presets.review":      {Layer: LayerFile, Name: path},
+		"presets.build":       {Layer: LayerEnv, Name: "RUN_IN_POPUP_PRESETS"},
+		"fit.max_width":       {Layer: LayerDefault},
+		"an unknown key, too": {Layer: LayerDefault},
+	} {
+		if got := provenance.Source(key); got != want {
+			t.Errorf("Source(%q) = %+v, want %+v", key, got, want)
+		}
+	}
+
+	plain, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !reflect.DeepEqual(plain, cfg) {
+		t.Errorf("LoadConfig =\n\t%+v\nwant what LoadConfigExplained loads\n\t%+v", plain, cfg)
+	}
+}
+
+// A policy no launch could apply fails the load that read it, wherever it was
+// read from, rather than every launch after it.
+func TestLoadConfig_invalidUnsupported(t *testing.T) {
+	t.Run("from the file", func(t *testing.T) {
+		isolateConfigEnv(t)
+		_, err := LoadConfig(writeConfig(t, `{"unsupported":"fial"}`))
+		if err == nil || !strings.Contains(err.Error(), `unsupported "fial"`) {
+			t.Errorf("LoadConfig err = %v, want the key and value named", err)
+		}
+	})
+	t.Run("from the environment", func(t *testing.T) {
+		isolateConfigEnv(t)
+		t.Setenv("RUN_IN_POPUP_UNSUPPORTED", "Warn")
+		_, err := LoadConfig(filepath.Join(t.TempDir(), "none.json"))
+		if err == nil || !strings.Contains(err.Error(), `unsupported "Warn"`) {
+			t.Errorf("LoadConfig err = %v, want the key and value named", err)
+		}
+	})
+	for _, policy := range UnsupportedPolicies() {
+		t.Run(string(policy), func(t *testing.T) {
+			isolateConfigEnv(t)
+			t.Setenv("RUN_IN_POPUP_UNSUPPORTED", string(policy))
+			if _, err := LoadConfig(filepath.Join(t.TempDir(), "none.json")); err != nil {
+				t.Errorf("LoadConfig: %v", err)
+			}
+		})
+	}
+}
+
+// Bounds no popup could meet fail the load, with the key to fix named.
+func TestLoadConfig_invalidFit(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "a negative minimum",
+			file:    `{"fit":{"min_height":-1}}`,
+			wantErr: "fit.min_height -1",
+		},
+		{
+			name:    "a zero maximum",
+			file:    `{"fit":{"min_width":0,"max_width":0}}`,
+			wantErr: "fit.max_width 0",
+		},
+		{
+			name:    "a minimum above its maximum",
+			file:    `{"fit":{"max_width":80}}`,
+			env:     map[string]string{"RUN_IN_POPUP_FIT_MIN_WIDTH": "100"},
+			wantErr: "fit.min_width 100 is above fit.max_width 80",
+		},
+		{
+			name:    "a default maximum below a minimum from the env",
+			env:     map[string]string{"RUN_IN_POPUP_FIT_MIN_HEIGHT": "50"},
+			wantErr: "fit.min_height 50 is above fit.max_height 40",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolateConfigEnv(t)
+			path := filepath.Join(t.TempDir(), "absent.json")
+			if tc.file != "" {
+				path = writeConfig(t, tc.file)
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("LoadConfig err = %v, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// A preset is merged by name: the environment's replaces the file's of the same
+// name whole, and leaves the file's others alone.
+func TestLoadConfig_presets(t *testing.T) {
+	isolateConfigEnv(t)
+	path := writeConfig(t, `{"presets":{`+
+		`"review":{"title":"review","anchor":"right","width":"40%"},`+
+		`"build":{"backend":"tmux-popup","width":"80%","env":{"GOFLAGS":"-race"}}}}`)
+	t.Setenv("RUN_IN_POPUP_PRESETS", `{"review":{"height":"fit"}}`)
+
+	got, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := map[string]PresetConfig{
+		"review": {Height: "fit"},
+		"build": {
+			Backend: "tmux-popup",
+			Width:   "80%",
+			Env:     map[string]string{"GOFLAGS": "-race"},
+		},
+	}
+	if !reflect.DeepEqual(got.Presets, want) {
+		t.Errorf("Presets = %+v, want %+v", got.Presets, want)
+	}
+	if len(DefaultConfig().Presets) != 0 {
+		t.Error("loading wrote the presets into the defaults' map")
+	}
+}
+
+// A preset no launch could act on fails the load that read it, naming the
+// preset and the value.
+func TestLoadConfig_invalidPreset(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		env     string
+		wantErr string
+	}{
+		{
+			name:    "a malformed size",
+			file:    `{"presets":{"wide":{"width":"90 %"}}}`,
+			wantErr: `preset "wide": popup geometry Width "90 %"`,
+		},
+		{
+			name:    "an anchor beside a position",
+			file:    `{"presets":{"corner":{"anchor":"top-right","x":"0"}}}`,
+			wantErr: `preset "corner": popup geometry Anchor "top-right"`,
+		},
+		{
+			name:    "an unknown backend",
+			file:    `{"presets":{"side":{"backend":"tmux"}}}`,
+			wantErr: `preset "side": unknown popup backend "tmux"`,
+		},
+		{
+			name:    "no name",
+			file:    `{"presets":{"":{"width":"50%"}}}`,
+			wantErr: "empty name",
+		},
+		{
+			name:    "from the environment",
+			env:     `{"tall":{"height":"C"}}`,
+			wantErr: `preset "tall": popup geometry Height "C"`,
+		},
+		{
+			name:    "the environment's is not JSON",
+			env:     `tall=50%`,
+			wantErr: `field "Presets"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isolateConfigEnv(t)
+			path := filepath.Join(t.TempDir(), "absent.json")
+			if tc.file != "" {
+				path = writeConfig(t, tc.file)
+			}
+			if tc.env != "" {
+				t.Setenv("RUN_IN_POPUP_PRESETS", tc.env)
+			}
+
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("LoadConfig err = %v, want %q in it", err, tc.wantErr)
+			}
+		})
+	}
+}
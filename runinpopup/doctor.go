@@ -0,0 +1,112 @@
+package runinpopup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+)
+
+// CheckStatus is how one diagnostic check came out.
+type CheckStatus string
+
+const (
+	// CheckOK is a link that holds.
+	CheckOK CheckStatus = "ok"
+	// CheckWarn is a link that holds today but is likely to be why a popup
+	// appears somewhere nobody looks: a client gone, a session nobody views.
+	CheckWarn CheckStatus = "warn"
+	// CheckFail is a broken link, one a popup cannot open past.
+	CheckFail CheckStatus = "fail"
+	// CheckSkip is a check not run, because a link it depends on is broken or
+	// the caller asked it not to be.
+	CheckSkip CheckStatus = "skip"
+)
+
+// Check is one link of the chain a popup goes through, as a diagnosis found it.
+// It is what "run-in-popup doctor" prints a line of, and the JSON it prints
+// with --json.
+type Check struct {
+	// Name names the link, a short lower-case word or two ("binary",
+	// "session meta").
+	Name string `json:"name"`
+	// Status is how it came out.
+	Status CheckStatus `json:"status"`
+	// Detail says what was found, or what is wrong and why it matters.
+	Detail string `json:"detail,omitempty"`
+}
+
+// CheckResult is the check named name, failed with err's message when err is
+// non-nil and passed with detail otherwise.
+func CheckResult(name, detail string, err error) Check {
+	if err != nil {
+		return Check{Name: name, Status: CheckFail, Detail: err.Error()}
+	}
+	return Check{Name: name, Status: CheckOK, Detail: detail}
+}
+
+// DiagnoseWorkspace checks dir against the contract a caller-provided work
+// directory has to meet, the one a launch refuses a directory for: a
+// workspace some other user can write is one where the terminal a passphrase is
+// typed on can be swapped.
+func DiagnoseWorkspace(dir string) Check {
+	return CheckResult("workspace", dir, checkWorkspace(dir))
+}
+
+// DiagnoseFifo creates a FIFO in os.TempDir, where every launch creates its
+// payload's, and takes it away again. A temporary directory on a filesystem
+// without FIFOs — some network and FUSE mounts — fails every launch the same
+// way, before any popup is opened.
+func DiagnoseFifo() Check {
+	dir, err := os.MkdirTemp("", defaultWorkspacePrefix+"doctor-")
+	if err != nil {
+		return CheckResult("fifo", "", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fifo")
+	return CheckResult("fifo", "created "+path, fifo.Mkfifo(path))
+}
+
+// DiagnosePinentry checks that path, a pinentry the proxy would run, is a file
+// this user can execute. A bare name is looked up in PATH, as exec would.
+func DiagnosePinentry(path string) Check {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return CheckResult("pinentry", "", err)
+	}
+	return CheckResult("pinentry", resolved, nil)
+}
+
+// DiagnoseRoundTrip opens a real popup that prints the terminal it runs on and
+// reads that back: every link at once, including the ones no query can reach —
+// a popup drawn on a client the user does not look at still gets this far, but
+// one that never starts its payload does not.
+func (l *PopupLauncher) DiagnoseRoundTrip(ctx context.Context) Check {
+	var out bytes.Buffer
+	cmd, err := l.Exec(ctx, PopupSpec{
+		Title:   "run-in-popup doctor",
+		Command: []string{"tty"},
+	}, PopupStreams{Stdout: nopWriteCloser{&out}})
+	if err != nil {
+		return CheckResult("popup", "", err)
+	}
+	if err := cmd.WaitStreams(); err != nil {
+		return CheckResult("popup", "", err)
+	}
+	tty := strings.TrimSpace(out.String())
+	if !strings.HasPrefix(tty, "/dev/") {
+		return CheckResult("popup", "", fmt.Errorf(
+			"the popup ran, but on no terminal: tty printed %q", tty,
+		))
+	}
+	return CheckResult("popup", "opened on "+tty, nil)
+}
+
+type nopWriteCloser struct{ *bytes.Buffer }
+
+func (nopWriteCloser) Close() error { return nil }
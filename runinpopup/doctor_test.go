@@ -0,0 +1,100 @@
+package runinpopup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseWorkspace(t *testing.T) {
+	private := t.TempDir()
+	shared := t.TempDir()
+	if err := os.Chmod(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if got := DiagnoseWorkspace(private); got.Status != CheckOK {
+		t.Errorf("a private directory: %+v", got)
+	}
+	got := DiagnoseWorkspace(shared)
+	if got.Status != CheckFail || !strings.Contains(got.Detail, "writable by other users") {
+		t.Errorf("a directory others can write: %+v", got)
+	}
+}
+
+func TestDiagnoseFifo(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	if got := DiagnoseFifo(); got.Status != CheckOK {
+		t.Errorf("DiagnoseFifo = %+v", got)
+	}
+	entries, _ := os.ReadDir(os.TempDir())
+	if len(entries) != 0 {
+		t.Errorf("DiagnoseFifo left %d entries behind", len(entries))
+	}
+}
+
+func TestDiagnosePinentry(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "pinentry")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		path string
+		want CheckStatus
+	}{
+		{"sh", CheckOK},
+		{notExecutable, CheckFail},
+		{filepath.Join(dir, "missing"), CheckFail},
+	} {
+		if got := DiagnosePinentry(tc.path); got.Status != tc.want {
+			t.Errorf("DiagnosePinentry(%q) = %+v, want %s", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestPopupLauncher_DiagnoseRoundTrip(t *testing.T) {
+	// The shell backend runs its payload with no terminal, so the one the popup
+	// would print comes from a stand-in for tty.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho /dev/pts/9\n"
+	if err := os.WriteFile(filepath.Join(bin, "tty"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := "PATH=" + bin + string(os.PathListSeparator) + os.Getenv("PATH")
+
+	for _, tc := range []struct {
+		name       string
+		backend    *shellBackend
+		want       CheckStatus
+		wantDetail string
+	}{
+		{
+			name:       "a popup on a terminal",
+			backend:    &shellBackend{environ: []string{path}},
+			want:       CheckOK,
+			wantDetail: "opened on /dev/pts/9",
+		},
+		{
+			name:       "a popup on none",
+			backend:    &shellBackend{},
+			want:       CheckFail,
+			wantDetail: "on no terminal",
+		},
+		{
+			name:       "no popup",
+			backend:    &shellBackend{launchErr: errors.New("no server running")},
+			want:       CheckFail,
+			wantDetail: "no server running",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			launcher := &PopupLauncher{Backend: tc.backend}
+			got := launcher.DiagnoseRoundTrip(t.Context())
+			if got.Status != tc.want || !strings.Contains(got.Detail, tc.wantDetail) {
+				t.Errorf("DiagnoseRoundTrip = %+v, want %s with %q", got, tc.want, tc.wantDetail)
+			}
+		})
+	}
+}
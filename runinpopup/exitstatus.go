@@ -0,0 +1,83 @@
+package runinpopup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+)
+
+// statusFifoName is what a launch calls the FIFO its payload reports its exit
+// status on. It sits beside the stream FIFOs, whose names are the streams', and
+// clear of the handshake and environment FIFOs that can share the directory.
+const statusFifoName = "status"
+
+// exitStatus is the FIFO a payload reports its exit status on, and what it
+// reported.
+//
+// This end is opened read-write before the popup is launched, for the same
+// reason the tty handshake opens its FIFO that way: the payload's open for
+// writing then never blocks. That matters more here than anywhere else, because
+// the status is the payload's very last act — a write-only open waiting on a
+// reader that gave up would leave the popup standing with nothing left to run.
+type exitStatus struct {
+	f *os.File
+
+	code     int
+	reported bool
+}
+
+// openExitStatus creates the status FIFO in dir and opens this end of it.
+func openExitStatus(dir string) (*exitStatus, string, error) {
+	path := filepath.Join(dir, statusFifoName)
+	if err := fifo.Mkfifo(path); err != nil {
+		return nil, "", err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("opening the status fifo: %w", err)
+	}
+	return &exitStatus{f: f}, path, nil
+}
+
+// collect reads what the payload has reported by now, without waiting for more.
+//
+// Nothing is waited for because nothing could say how long to wait: a payload
+// that reports its status does so before its group lets go of the stream FIFOs,
+// so once a launch has seen those end — or seen a launcher out that stays as
+// long as the popup does — the status is in the FIFO or is never coming. A
+// blocking read would spend the rest of the popup's life finding that out.
+func (s *exitStatus) collect() {
+	rc, err := s.f.SyscallConn()
+	if err != nil {
+		return
+	}
+	var (
+		buf  [32]byte
+		n    int
+		rerr error
+	)
+	// Returning true whatever the read said is what keeps this from parking on
+	// the poller: an empty FIFO answers EAGAIN, and EAGAIN is the answer.
+	err = rc.Read(func(fd uintptr) bool {
+		n, rerr = syscall.Read(int(fd), buf[:])
+		return true
+	})
+	if err != nil || rerr != nil || n <= 0 {
+		return
+	}
+	line, _, _ := strings.Cut(string(buf[:n]), "\n")
+	code, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return
+	}
+	s.code, s.reported = code, true
+}
+
+func (s *exitStatus) close() {
+	_ = s.f.Close()
+}
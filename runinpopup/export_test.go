@@ -0,0 +1,18 @@
+package runinpopup
+
+import "io"
+
+// What the external tests in package runinpopup_test need of the internals —
+// they live outside so they can import the backends, which import this package.
+
+// FakePinentryCommand and PinentryPromptsOnTTY build the argv that turns the
+// test binary into a pinentry prompting on its terminal; see runFakePinentry.
+const (
+	FakePinentryCommand  = fakePinentryCommand
+	PinentryPromptsOnTTY = pinentryPromptsOnTTY
+)
+
+// SetStdio sets the process stdio the exchange runs on.
+func (l *PinentryLauncher) SetStdio(stdin io.Reader, stdout, stderr io.Writer) {
+	l.stdin, l.stdout, l.stderr = stdin, stdout, stderr
+}
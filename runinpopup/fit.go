@@ -0,0 +1,212 @@
+package runinpopup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
+)
+
+// SizeFit, as a PopupSpec's Width or Height, sizes the popup to its content
+// rather than to a number written down in advance. See PopupSpec.SizeHint.
+const SizeFit = geometry.Fit
+
+// EnvFit names the variable a payload run to be measured finds the path of its
+// size report in. A payload tells the measurement from the real thing by it
+// being set.
+const EnvFit = "RUN_IN_POPUP_FIT"
+
+const (
+	// fitFrame is the cells a popup's frame takes along each axis, one on each
+	// side: the size a payload reports is what it draws, and a popup that size
+	// inside its border would cut off the last row and column.
+	fitFrame = 2
+	// fitShell runs a Script being measured. The popup's own shell is the
+	// backend's to choose and nowhere to be had here; every Script is written
+	// for sh anyway.
+	fitShell = "/bin/sh"
+	// fitReportName is the FIFO a measured payload reports its size on.
+	fitReportName = "fit"
+)
+
+// fitSpec resolves a Width or Height of SizeFit into cells, from the size the
+// payload reports, plus the frame, clamped to the launcher's bounds. Anything
+// else comes back as it was, so no backend ever sees SizeFit.
+func (l *PopupLauncher) fitSpec(
+	ctx context.Context,
+	spec PopupSpec,
+	logger *slog.Logger,
+) (PopupSpec, error) {
+	fitWidth, fitHeight := spec.Width == SizeFit, spec.Height == SizeFit
+	if !fitWidth && !fitHeight {
+		return spec, nil
+	}
+	measure := spec.SizeHint
+	if measure == nil {
+		measure = func(ctx context.Context) (int, int, error) {
+			return l.measurePayload(ctx, spec, logger)
+		}
+	}
+	width, height, err := measure(ctx)
+	if err != nil {
+		return spec, fmt.Errorf("sizing the popup to fit: %w", err)
+	}
+	bounds := l.fitBounds()
+	if fitWidth {
+		spec.Width = strconv.Itoa(clampFit(width+fitFrame, bounds.MinWidth, bounds.MaxWidth))
+	}
+	if fitHeight {
+		spec.Height = strconv.Itoa(clampFit(height+fitFrame, bounds.MinHeight, bounds.MaxHeight))
+	}
+	logger.Debug(
+		"sized the popup to fit",
+		slog.Int("content_width", width),
+		slog.Int("content_height", height),
+		slog.String("width", spec.Width),
+		slog.String("height", spec.Height),
+	)
+	return spec, nil
+}
+
+// fitBounds is l.Fit with its gaps filled. A launcher that never set Fit gets
+// DefaultConfig().Fit whole. One that set part of it gets the default for each
+// maximum it left at zero, which no popup could be sized to, while a zero
+// minimum stays the bound it says: no lower bound at all.
+func (l *PopupLauncher) fitBounds() FitConfig {
+	def := DefaultConfig().Fit
+	if l.Fit == (FitConfig{}) {
+		return def
+	}
+	bounds := l.Fit
+	bounds.MaxWidth = cmp.Or(bounds.MaxWidth, def.MaxWidth)
+	bounds.MaxHeight = cmp.Or(bounds.MaxHeight, def.MaxHeight)
+	return bounds
+}
+
+// clampFit bounds n to [lo, hi], lo winning a range that is empty. LoadConfig
+// rejects one, but a launcher's Fit need not have come from there.
+func clampFit(n, lo, hi int) int {
+	return max(min(n, hi), lo)
+}
+
+// measurePayload runs spec's payload headless and reads back the size it
+// reports on the FIFO EnvFit names; see PopupSpec.SizeHint.
+//
+// The payload runs in a session of its own, which is what headless means here:
+// it has no controlling terminal, so a payload that opens /dev/tty to draw
+// fails to instead of drawing over the caller's screen. Its process group goes
+// down with it once the report is in, so a Script's children do too.
+func (l *PopupLauncher) measurePayload(
+	ctx context.Context,
+	spec PopupSpec,
+	logger *slog.Logger,
+) (width, height int, err error) {
+	argv := spec.Command
+	if spec.Script != "" {
+		argv = []string{fitShell, "-c", spec.Script}
+	}
+	if len(argv) == 0 {
+		return 0, 0, errors.New("the spec has no payload to measure")
+	}
+
+	dir, release, err := l.Workspace.open(logger)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer release()
+	report := filepath.Join(dir, fitReportName)
+	if err := fifo.Mkfifo(report); err != nil {
+		return 0, 0, err
+	}
+	// A caller's directory outlives the launch, and the next one makes its own.
+	defer os.Remove(report)
+
+	// The whole measurement answers to the one bound, the payload included.
+	timeout := cmp.Or(l.StartupTimeout, defaultPopupStartupTimeout)
+	ctx, cancelProbe := context.WithTimeout(ctx, timeout)
+	defer cancelProbe()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = os.Environ()
+	for _, k := range slices.Sorted(maps.Keys(spec.Env)) {
+		cmd.Env = append(cmd.Env, k+"="+spec.Env[k])
+	}
+	cmd.Env = append(cmd.Env, EnvFit+"="+report)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, 0, fmt.Errorf("starting the payload to measure it: %w", err)
+	}
+	var waitErr error
+	exited := make(chan struct{})
+	go func() {
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+	defer func() {
+		cancelProbe()
+		<-exited
+	}()
+
+	// A payload that exits has nothing left to report, and ends the wait for
+	// the report at once rather than once the bound has run out.
+	openCtx, cancelOpen := context.WithCancelCause(ctx)
+	defer cancelOpen(nil)
+	go func() {
+		<-exited
+		exitErr := errors.New("the payload exited without reporting its size")
+		if waitErr != nil {
+			exitErr = fmt.Errorf("%w: %w", exitErr, waitErr)
+		}
+		cancelOpen(exitErr)
+	}()
+	r, err := fifo.OpenReader(openCtx, report, timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	out, err := io.ReadAll(io.LimitReader(r, 64))
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading the payload's size: %w", err)
+	}
+	width, height, ok := parseFitReport(string(out))
+	if !ok {
+		return 0, 0, fmt.Errorf(
+			"the payload reported its size as %q, want \"<width> <height>\"",
+			strings.TrimSpace(string(out)),
+		)
+	}
+	return width, height, nil
+}
+
+// parseFitReport reads a payload's size report, "<width> <height>" in cells.
+// Content of no size is no content worth sizing a popup by.
+func parseFitReport(out string) (width, height int, ok bool) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	width, errWidth := strconv.Atoi(fields[0])
+	height, errHeight := strconv.Atoi(fields[1])
+	if errWidth != nil || errHeight != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
@@ -0,0 +1,196 @@
+package runinpopup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fitScript reports size when it is being measured, and otherwise does what a
+// payload does once its popup is open.
+func fitScript(size string) string {
+	return `if [ -n "$` + EnvFit + `" ]; then echo '` + size + `' > "$` + EnvFit + `"; exit; fi
+echo shown`
+}
+
+// A size of fit is asked of the payload before the popup is opened, and the
+// popup is opened at what it answered, frame included and bounds applied.
+func TestPopupLauncher_Exec_fit(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		spec       PopupSpec
+		fit        FitConfig
+		wantWidth  string
+		wantHeight string
+	}{
+		{
+			name:      "both axes",
+			spec:      PopupSpec{Width: SizeFit, Height: SizeFit, Script: fitScript("30 5")},
+			wantWidth: "32", wantHeight: "7",
+		},
+		{
+			name:      "one axis leaves the other as written",
+			spec:      PopupSpec{Width: "80%", Height: SizeFit, Script: fitScript("30 5")},
+			wantWidth: "80%", wantHeight: "7",
+		},
+		{
+			name:      "the default bounds",
+			spec:      PopupSpec{Width: SizeFit, Height: SizeFit, Script: fitScript("500 1")},
+			wantWidth: "120", wantHeight: "3",
+		},
+		{
+			name:      "the launcher's bounds",
+			spec:      PopupSpec{Width: SizeFit, Height: SizeFit, Script: fitScript("30 30")},
+			fit:       FitConfig{MinWidth: 40, MaxHeight: 10},
+			wantWidth: "40", wantHeight: "10",
+		},
+		{
+			// The maxima left unset are the default's, not zero cells.
+			name:      "a partial FitConfig",
+			spec:      PopupSpec{Width: SizeFit, Height: SizeFit, Script: fitScript("200 30")},
+			fit:       FitConfig{MinWidth: 40},
+			wantWidth: "120", wantHeight: "32",
+		},
+		{
+			// A zero minimum is a bound like any other, not the default's 20.
+			name:      "a zero minimum as given",
+			spec:      PopupSpec{Width: SizeFit, Height: SizeFit, Script: fitScript("5 1")},
+			fit:       FitConfig{MinWidth: 0, MaxWidth: 120, MinHeight: 0, MaxHeight: 40},
+			wantWidth: "7", wantHeight: "3",
+		},
+		{
+			// The payload reads the variable whatever its argv.
+			name: "an argv payload",
+			spec: PopupSpec{
+				Width: SizeFit, Height: SizeFit,
+				Command: []string{"sh", "-c", fitScript("50 9")},
+			},
+			wantWidth: "52", wantHeight: "11",
+		},
+		{
+			name: "the payload's environment",
+			spec: PopupSpec{
+				Width: SizeFit, Height: SizeFit,
+				Env:    map[string]string{"SIZE": "24 4"},
+				Script: `[ -z "$` + EnvFit + `" ] || echo "$SIZE" > "$` + EnvFit + `"`,
+			},
+			wantWidth: "26", wantHeight: "6",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &shellBackend{}
+			launcher := &PopupLauncher{Backend: backend, Fit: tc.fit}
+
+			popup, err := launcher.Exec(t.Context(), tc.spec, PopupStreams{})
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if err := popup.Wait(); err != nil {
+				t.Fatalf("Wait: %v", err)
+			}
+			got := backend.launched[0]
+			if got.Width != tc.wantWidth || got.Height != tc.wantHeight {
+				t.Errorf("launched at %q x %q, want %q x %q",
+					got.Width, got.Height, tc.wantWidth, tc.wantHeight)
+			}
+		})
+	}
+}
+
+// A hint is the caller's word for the size, and the payload is not run to ask
+// it again.
+func TestPopupLauncher_Exec_fitSizeHint(t *testing.T) {
+	backend := &shellBackend{}
+	launcher := &PopupLauncher{Backend: backend}
+	spec := PopupSpec{
+		Width: SizeFit, Height: SizeFit,
+		Script: `[ -z "$` + EnvFit + `" ]`,
+		SizeHint: func(context.Context) (int, int, error) {
+			return 60, 12, nil
+		},
+	}
+
+	popup, err := launcher.Exec(t.Context(), spec, PopupStreams{})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := popup.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if got := backend.launched[0]; got.Width != "62" || got.Height != "14" {
+		t.Errorf("launched at %q x %q, want the hint's 62 x 14", got.Width, got.Height)
+	}
+}
+
+// A size that cannot be had opens nothing, and a payload that gave up on
+// reporting one says so at once rather than once the startup timeout is over.
+func TestPopupLauncher_Exec_fitFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    PopupSpec
+		wantErr string
+	}{
+		{
+			name:    "the payload exits without reporting",
+			spec:    PopupSpec{Height: SizeFit, Script: "exit 3"},
+			wantErr: "exited without reporting its size: exit status 3",
+		},
+		{
+			name:    "the payload reports nonsense",
+			spec:    PopupSpec{Height: SizeFit, Script: `echo tall > "$` + EnvFit + `"`},
+			wantErr: `reported its size as "tall"`,
+		},
+		{
+			name: "the hint fails",
+			spec: PopupSpec{
+				Height: SizeFit, Command: []string{"true"},
+				SizeHint: func(context.Context) (int, int, error) {
+					return 0, 0, errors.New("no idea")
+				},
+			},
+			wantErr: "no idea",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &shellBackend{}
+			launcher := &PopupLauncher{Backend: backend, StartupTimeout: 20 * time.Second}
+
+			start := time.Now()
+			_, err := launcher.Exec(t.Context(), tc.spec, PopupStreams{})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Exec err = %v, want %q in it", err, tc.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Exec took %v, want the failure reported at once", elapsed)
+			}
+			if backend.prepared != 0 || len(backend.launched) != 0 {
+				t.Errorf("prepared %d and launched %d, want nothing touched",
+					backend.prepared, len(backend.launched))
+			}
+		})
+	}
+}
+
+func TestParseFitReport(t *testing.T) {
+	for _, tc := range []struct {
+		out           string
+		width, height int
+		ok            bool
+	}{
+		{out: "80 24\n", width: 80, height: 24, ok: true},
+		{out: "  7\t3 ", width: 7, height: 3, ok: true},
+		{out: "0 3\n"},
+		{out: "80\n"},
+		{out: "80 24 1\n"},
+		{out: "80x24\n"},
+		{out: ""},
+	} {
+		width, height, ok := parseFitReport(tc.out)
+		if width != tc.width || height != tc.height || ok != tc.ok {
+			t.Errorf("parseFitReport(%q) = %d, %d, %t; want %d, %d, %t",
+				tc.out, width, height, ok, tc.width, tc.height, tc.ok)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package runinpopup
 
 import (
+	"fmt"
+
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
 )
 
@@ -13,21 +15,40 @@ import (
 // output nobody is looking at — or, for the mechanisms that report nothing, by
 // silently placing the popup somewhere else.
 func (s PopupSpec) validateGeometry() error {
-	for _, f := range []struct {
-		name  string
-		value string
-		// position says whether the field takes tmux's position specifiers, which
-		// place a popup and cannot size one.
-		position bool
-	}{
-		{"X", s.X, true},
-		{"Y", s.Y, true},
-		{"Width", s.Width, false},
-		{"Height", s.Height, false},
-	} {
-		if err := geometry.Validate(f.name, f.value, f.position); err != nil {
+	// X and Y take tmux's position specifiers, which place a popup and cannot
+	// size one; Width and Height take Fit instead, which sizes one and cannot
+	// place it.
+	for _, f := range []struct{ name, value string }{{"X", s.X}, {"Y", s.Y}} {
+		if err := geometry.Validate(f.name, f.value, true); err != nil {
+			return err
+		}
+	}
+	for _, f := range []struct{ name, value string }{{"Width", s.Width}, {"Height", s.Height}} {
+		if err := geometry.ValidateSize(f.name, f.value); err != nil {
 			return err
 		}
 	}
+	if err := geometry.ValidateAnchor(s.Anchor); err != nil {
+		return err
+	}
+	if err := geometry.Validate("Margin", s.Margin, false); err != nil {
+		return err
+	}
+	// Each of these would leave one of two values unused, and which one wins is
+	// a guess the caller did not ask for.
+	switch {
+	case s.Anchor != "" && (s.X != "" || s.Y != ""):
+		return fmt.Errorf(
+			"popup geometry Anchor %q: it places the popup in place of X %q and Y %q;"+
+				" set one or the other",
+			s.Anchor, s.X, s.Y,
+		)
+	case s.Margin != "" && s.Anchor == "":
+		return fmt.Errorf(
+			"popup geometry Margin %q: a margin keeps an anchored popup off the edges;"+
+				" set an Anchor too",
+			s.Margin,
+		)
+	}
 	return nil
 }
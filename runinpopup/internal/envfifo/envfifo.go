@@ -0,0 +1,119 @@
+// Package envfifo delivers a popup's environment over a FIFO, for the
+// multiplexers whose launch command has no environment flag of its own. An argv
+// is readable by every process for as long as the pane lives, so the values
+// never go on the command line: the payload sources a FIFO in the launch's work
+// directory before it runs, and only that FIFO's path is in the argv.
+//
+// A FIFO rather than a file because those same launch commands return the
+// moment the pane exists, long before the pane sources anything, while the work
+// directory lives only as long as the launch: the delivery is the rendezvous
+// that keeps the launch — whose Wait joins it — open until the payload has its
+// environment.
+package envfifo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// name is what the delivery calls its FIFO. The work directory it lands in also
+// holds the launch's payload FIFOs and, during a pinentry exchange, the
+// handshake ones, so the name stays clear of all of theirs.
+const name = "env"
+
+// DefaultTimeout mirrors the launch layer's default startup bound, for a
+// request that set none of its own.
+const DefaultTimeout = 30 * time.Second
+
+// Path names the env FIFO a payload launched with workDir sources.
+func Path(workDir string) string {
+	return filepath.Join(workDir, name)
+}
+
+// Create makes the env FIFO in workDir. It is created before the pane so the
+// payload cannot find it missing, and removed with the workDir it lives in.
+func Create(workDir string) error {
+	return fifo.Mkfifo(Path(workDir))
+}
+
+// Script renders env as the shell input the payload sources: one export per
+// variable, sorted, every value quoted into a single word.
+func Script(env map[string]string) string {
+	var sb strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		fmt.Fprintf(&sb, "export %s=%s\n", k, shellargv.Quote(env[k]))
+	}
+	return sb.String()
+}
+
+// Gate prefixes a shell command line with the sourcing of workDir's env FIFO.
+//
+// A pane that could not read its environment must not run the payload without
+// it, hence "&&" rather than the ";" an inline export would take; the payload is
+// grouped so that the gate covers all of it and not just the first command of a
+// script. The newline is what makes the closing brace a command of its own,
+// whatever the payload ends with.
+func Gate(workDir, line string) string {
+	return fmt.Sprintf(". %s && { %s\n}", shellargv.Quote(Path(workDir)), line)
+}
+
+// Delivery is one environment being written into an env FIFO.
+type Delivery struct {
+	wait   func() error
+	cancel context.CancelFunc
+}
+
+// Deliver starts writing script into the FIFO at path once the pane opens its
+// reading end. ctx ending or timeout running out abandons a delivery whose pane
+// never came.
+func Deliver(ctx context.Context, path, script string, timeout time.Duration) *Delivery {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	g := new(errgroup.Group)
+	g.Go(func() error { return write(ctx, path, script, timeout) })
+	return &Delivery{
+		wait: sync.OnceValue(func() error {
+			defer cancel()
+			return g.Wait()
+		}),
+		cancel: cancel,
+	}
+}
+
+// Wait joins the delivery and reports how it went. It is memoized, so every
+// caller that has to know hears the same answer.
+func (d *Delivery) Wait() error { return d.wait() }
+
+// Cancel ends a delivery nobody is coming for, such as one whose launcher
+// failed; Wait still has to be called to join it.
+func (d *Delivery) Cancel() { d.cancel() }
+
+// write is the delivering half of the payload's ". env" gate. Closing the FIFO
+// is what ends the sourcing, so a close that fails is an environment the pane
+// may wait on forever, and reported like the write.
+func write(ctx context.Context, path, script string, timeout time.Duration) error {
+	f, err := fifo.OpenWriter(ctx, path, timeout)
+	if err != nil {
+		return fmt.Errorf("delivering the popup environment: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = f.SetWriteDeadline(time.Now()) })
+	defer stop()
+	_, err = f.WriteString(script)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("delivering the popup environment: %w", err)
+	}
+	return nil
+}
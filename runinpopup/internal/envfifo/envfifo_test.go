@@ -0,0 +1,28 @@
+package envfifo
+
+import "testing"
+
+func TestScript(t *testing.T) {
+	got := Script(map[string]string{
+		"B":       "two",
+		"A":       "it's one",
+		"HOSTILE": "$(id) `id` \"; rm -rf /",
+	})
+	// Sorted, one export per line, every value a single quoted word: what the
+	// popup's shell reads in must be the values and nothing the shell would act
+	// on itself.
+	want := "export A='it'\\''s one'\n" +
+		"export B='two'\n" +
+		"export HOSTILE='$(id) `id` \"; rm -rf /'\n"
+	if got != want {
+		t.Errorf("env script =\n\t%q\nwant\n\t%q", got, want)
+	}
+}
+
+func TestGate(t *testing.T) {
+	got := Gate("/w", "make test; echo done")
+	want := ". '/w/env' && { make test; echo done\n}"
+	if got != want {
+		t.Errorf("Gate = %q, want %q", got, want)
+	}
+}
@@ -1,7 +1,7 @@
 // Package fifo creates and opens the named pipes this module's popups
 // rendezvous over: the launch layer's payload streams, and a backend's own
-// exchanges — zellij's environment delivery — that need the same open
-// semantics.
+// exchanges — the environment delivery of a multiplexer with no environment
+// flag — that need the same open semantics.
 package fifo
 
 import (
@@ -0,0 +1,89 @@
+package geometry
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Side is where an anchor puts a popup along one axis: against the edge the
+// axis starts at, in its middle, or against the edge it ends at.
+type Side int
+
+const (
+	Start Side = iota
+	Middle
+	End
+)
+
+// anchorNames are the anchors in reading order, the top row first. Each is a
+// side per axis, so nine cover every combination; the names are spelled out
+// rather than tmux-style letters, since writing one is the whole point of them.
+var anchorNames = []string{
+	"top-left", "top", "top-right",
+	"left", "center", "right",
+	"bottom-left", "bottom", "bottom-right",
+}
+
+// Anchors lists the anchor names, in reading order.
+func Anchors() []string {
+	return slices.Clone(anchorNames)
+}
+
+// ParseAnchor reads an anchor name into the side it puts a popup at along x and
+// along y, and reports whether it is one.
+func ParseAnchor(anchor string) (x, y Side, ok bool) {
+	i := slices.Index(anchorNames, anchor)
+	if i < 0 {
+		return 0, 0, false
+	}
+	return Side(i % 3), Side(i / 3), true
+}
+
+// ValidateAnchor reports whether anchor names a place for a popup, empty
+// meaning none was asked for. Like Validate, it quotes the value back: a
+// mistyped compass point is the likely cause.
+func ValidateAnchor(anchor string) error {
+	if _, _, ok := ParseAnchor(anchor); anchor == "" || ok {
+		return nil
+	}
+	return fmt.Errorf(
+		"popup geometry Anchor %q: want one of %s",
+		anchor, strings.Join(anchorNames, ", "),
+	)
+}
+
+// Place resolves anchor into the top-left corner of a popup width by height
+// cells, on a terminal cols by rows: against the edges the anchor names, margin
+// cells or percent of the terminal away from them, or centred on an axis it
+// names no edge of, where a margin has nothing to keep away from and is not
+// applied. An invalid anchor is an error rather than a guess, as is a margin
+// that is neither cells nor a percentage.
+func Place(anchor, margin string, width, height, cols, rows int) (x, y int, err error) {
+	sideX, sideY, ok := ParseAnchor(anchor)
+	if !ok {
+		return 0, 0, ValidateAnchor(anchor)
+	}
+	margin = cmp.Or(margin, "0")
+	marginX, okX := Resolve(margin, cols)
+	marginY, okY := Resolve(margin, rows)
+	if !okX || !okY {
+		return 0, 0, fmt.Errorf("popup geometry Margin %q: want %s", margin, syntax(false))
+	}
+	return Offset(sideX, width, marginX, cols), Offset(sideY, height, marginY, rows), nil
+}
+
+// Offset is where a popup size cells long starts along an axis total cells
+// long, at side, margin cells away from the edge it is put against. A margin
+// the popup is too big to keep gives way, so the popup stays on the terminal as
+// far as it fits at all, and one that does not fit starts at the axis's start.
+func Offset(side Side, size, margin, total int) int {
+	switch side {
+	case Middle:
+		return max(total-size, 0) / 2
+	case End:
+		return max(total-size-margin, 0)
+	}
+	return min(margin, max(total-size, 0))
+}
@@ -0,0 +1,90 @@
+package geometry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAnchor(t *testing.T) {
+	for _, anchor := range append(Anchors(), "") {
+		if err := ValidateAnchor(anchor); err != nil {
+			t.Errorf("ValidateAnchor(%q) = %v, want it accepted", anchor, err)
+		}
+	}
+	for _, anchor := range []string{"centre", "top_right", "Top", "right-top", "C", "ne"} {
+		err := ValidateAnchor(anchor)
+		if err == nil {
+			t.Errorf("ValidateAnchor(%q) = nil, want it rejected", anchor)
+			continue
+		}
+		if !strings.Contains(err.Error(), `"`+anchor+`"`) {
+			t.Errorf("err = %v, want the value %q quoted in it", err, anchor)
+		}
+	}
+}
+
+// A popup 20x10 on a terminal 100x50: every anchor, with and without a margin,
+// and the margin applied only against the edges the anchor names.
+func TestPlace(t *testing.T) {
+	for _, tc := range []struct {
+		anchor, margin string
+		x, y           int
+	}{
+		{anchor: "top-left", x: 0, y: 0},
+		{anchor: "top", x: 40, y: 0},
+		{anchor: "top-right", x: 80, y: 0},
+		{anchor: "left", x: 0, y: 20},
+		{anchor: "center", x: 40, y: 20},
+		{anchor: "right", x: 80, y: 20},
+		{anchor: "bottom-left", x: 0, y: 40},
+		{anchor: "bottom", x: 40, y: 40},
+		{anchor: "bottom-right", x: 80, y: 40},
+		{anchor: "top-left", margin: "2", x: 2, y: 2},
+		{anchor: "top-right", margin: "2", x: 78, y: 2},
+		{anchor: "bottom", margin: "2", x: 40, y: 38},
+		{anchor: "center", margin: "2", x: 40, y: 20},
+		// A percentage is of each axis on its own.
+		{anchor: "bottom-right", margin: "10%", x: 70, y: 35},
+	} {
+		x, y, err := Place(tc.anchor, tc.margin, 20, 10, 100, 50)
+		if err != nil {
+			t.Errorf("Place(%q, %q): %v", tc.anchor, tc.margin, err)
+			continue
+		}
+		if x != tc.x || y != tc.y {
+			t.Errorf("Place(%q, %q) = %d, %d; want %d, %d",
+				tc.anchor, tc.margin, x, y, tc.x, tc.y)
+		}
+	}
+
+	for _, tc := range []struct{ anchor, margin string }{
+		{anchor: "north"},
+		{anchor: "top", margin: "C"},
+		{anchor: "top", margin: "-2"},
+	} {
+		if x, y, err := Place(tc.anchor, tc.margin, 20, 10, 100, 50); err == nil {
+			t.Errorf("Place(%q, %q) = %d, %d, want an error", tc.anchor, tc.margin, x, y)
+		}
+	}
+}
+
+// A popup is kept on the terminal before its margin is: the margin gives way
+// first, and a popup bigger than the terminal starts at its edge.
+func TestOffset(t *testing.T) {
+	for _, tc := range []struct {
+		name                      string
+		side                      Side
+		size, margin, total, want int
+	}{
+		{name: "start keeps its margin", side: Start, size: 20, margin: 5, total: 100, want: 5},
+		{name: "start gives its margin way", side: Start, size: 98, margin: 5, total: 100, want: 2},
+		{name: "end gives its margin way", side: End, size: 98, margin: 5, total: 100, want: 0},
+		{name: "middle of an odd leftover", side: Middle, size: 20, total: 101, want: 40},
+		{name: "too big at the end", side: End, size: 120, total: 100, want: 0},
+		{name: "too big in the middle", side: Middle, size: 120, total: 100, want: 0},
+	} {
+		if got := Offset(tc.side, tc.size, tc.margin, tc.total); got != tc.want {
+			t.Errorf("%s: Offset = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package geometry
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -16,6 +17,11 @@ import (
 // are only a set to recognize, since they reach tmux untranslated.
 const positions = "CRPMWS"
 
+// Fit is the size a Width or Height takes to be worked out from the popup's
+// content rather than written down. It is resolved into cells by the launch
+// layer before a backend ever sees it, so it is only ever validated here.
+const Fit = "fit"
+
 // IsPosition reports whether value is one of tmux's position specifiers.
 func IsPosition(value string) bool {
 	return len(value) == 1 && strings.Contains(positions, value)
@@ -43,12 +49,29 @@ func Validate(field, value string, position bool) error {
 	return fmt.Errorf("popup geometry %s %q: want %s", field, value, syntax(position))
 }
 
+// ValidateSize is Validate for a Width or a Height, which besides cells and a
+// percentage take Fit.
+func ValidateSize(field, value string) error {
+	switch {
+	case value == Fit:
+		return nil
+	case IsPosition(value):
+		return Validate(field, value, false)
+	case Validate(field, value, false) != nil:
+		return fmt.Errorf(
+			"popup geometry %s %q: want cells, \"N%%\" or %s", field, value, Fit,
+		)
+	}
+	return nil
+}
+
 // Sum adds two values of one unit — cells to cells, a percentage of the
 // terminal to a percentage of it — and reports whether there was a sum to give.
 // Anything else has none: a cell count and a percentage cannot be added without
-// the terminal size, which is the multiplexer's to know, and a position
-// specifier is not a quantity at all. It is the caller that knows what the two
-// values are and what to say when they do not add up.
+// the terminal size, which is the multiplexer's to know — a caller that has it
+// resolves both with Resolve and adds cells — and a position specifier is not a
+// quantity at all. It is the caller that knows what the two values are and what
+// to say when they do not add up.
 func Sum(a, b string) (string, bool) {
 	switch {
 	case isCells(a) && isCells(b):
@@ -59,6 +82,27 @@ func Sum(a, b string) (string, bool) {
 	return "", false
 }
 
+// Resolve turns a count of cells or a percentage into cells along an axis total
+// cells long, and reports whether value was either. A percentage rounds down,
+// as tmux's own do, so a value resolved here and the same value left for tmux
+// to resolve land on the same cell. A position specifier says where rather than
+// how far, and empty says nothing; neither resolves.
+func Resolve(value string, total int) (int, bool) {
+	digits, percent := strings.CutSuffix(value, "%")
+	if !isDigits(digits) {
+		return 0, false
+	}
+	// As with a sum, a count too large to compute with is a mistake.
+	n, err := strconv.Atoi(digits)
+	if err != nil || (percent && total > 0 && n > math.MaxInt/total) {
+		return 0, false
+	}
+	if percent {
+		return total * n / 100, true
+	}
+	return n, true
+}
+
 // add sums two digit strings and renders the total with unit appended. A count
 // too large for an int has no sum either: the width of a terminal is what these
 // measure, so a value that far out is a mistake rather than a total to compute.
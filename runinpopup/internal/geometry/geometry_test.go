@@ -73,6 +73,38 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+// A size takes Fit where a position does not, and a mistyped one is told fit is
+// what it may have meant.
+func TestValidateSize(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		wantErr string
+	}{
+		{value: ""},
+		{value: "40"},
+		{value: "80%"},
+		{value: "fit"},
+		{value: "Fit", wantErr: `want cells, "N%" or fit`},
+		{value: "fits", wantErr: `want cells, "N%" or fit`},
+		{value: "C", wantErr: "a position specifier says where, not how big"},
+	} {
+		err := ValidateSize("Width", tc.value)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValidateSize(%q) = %v, want it accepted", tc.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("ValidateSize(%q) = %v, want %q in it", tc.value, err, tc.wantErr)
+		}
+	}
+	// Fit sizes a popup; it places nothing.
+	if err := Validate("X", Fit, true); err == nil {
+		t.Errorf("Validate(X, fit) = nil, want it rejected")
+	}
+}
+
 // A sum exists only between two values measuring the same thing: cells say how
 // many cells, a percentage says how much of a terminal nobody here has measured.
 func TestSum(t *testing.T) {
@@ -114,6 +146,38 @@ func TestSum(t *testing.T) {
 	}
 }
 
+// Resolving is what makes a sum across units possible, so it has to agree with
+// tmux on where a percentage lands: rounded down, never up.
+func TestResolve(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		total int
+		want  int
+		ok    bool
+	}{
+		{name: "cells are cells", value: "20", total: 50, want: 20, ok: true},
+		{name: "cells past the terminal stay as written", value: "80", total: 50, want: 80, ok: true},
+		{name: "a percentage", value: "40%", total: 50, want: 20, ok: true},
+		{name: "a percentage rounds down", value: "50%", total: 51, want: 25, ok: true},
+		{name: "none at all", value: "0%", total: 50, want: 0, ok: true},
+		{name: "a whole terminal", value: "100%", total: 50, want: 50, ok: true},
+		{name: "a position specifier is not a quantity", value: "C", total: 50},
+		{name: "an empty value", total: 50},
+		{name: "a malformed value", value: "twenty", total: 50},
+		{name: "a count no terminal has", value: strings.Repeat("9", 30), total: 50},
+		{name: "a share no terminal has", value: strings.Repeat("9", 18) + "%", total: 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := Resolve(tc.value, tc.total)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("Resolve(%q, %d) = %d, %v; want %d, %v",
+					tc.value, tc.total, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
 func TestIsPosition(t *testing.T) {
 	for _, value := range []string{"C", "R", "P", "M", "W", "S"} {
 		if !IsPosition(value) {
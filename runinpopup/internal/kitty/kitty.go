@@ -0,0 +1,176 @@
+// Package kitty speaks to kitty's remote-control protocol through the "kitty @"
+// command: it builds every argv this module sends to it, including the shell
+// wrapping a payload needs when it cannot be run as a bare argv, and parses the
+// window id kitty prints back. Callers decide which kind of window expresses
+// their popup; how kitty is asked for it lives here.
+package kitty
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Options are the coordinates of the kitty instance a Client talks to.
+type Options struct {
+	// Path is the kitty executable. Empty means "kitty".
+	Path string
+	// Socket is the address kitty listens for remote control on, its
+	// $KITTY_LISTEN_ON ("unix:/tmp/kitty-1234"), passed as --to. A bare path is
+	// taken as a unix socket: the positional PINENTRY_USER_DATA cannot carry
+	// the "unix:" in front of it. Empty leaves kitty to reach the instance
+	// through the controlling terminal, which only a caller running inside kitty
+	// has.
+	Socket string
+	// Shell runs the payloads kitty cannot run as a bare argv. Empty means "sh".
+	Shell string
+}
+
+// Client runs "kitty @" commands against one kitty instance.
+type Client struct {
+	path   string
+	socket string
+	shell  string
+}
+
+// New builds a client.
+func New(opts Options) *Client {
+	return &Client{
+		path:   cmp.Or(opts.Path, "kitty"),
+		socket: socketAddress(opts.Socket),
+		shell:  cmp.Or(opts.Shell, "sh"),
+	}
+}
+
+// socketAddress completes a bare socket path into the "unix:" address --to
+// takes, and leaves anything already carrying a scheme as it is.
+func socketAddress(socket string) string {
+	if strings.HasPrefix(socket, "/") {
+		return "unix:" + socket
+	}
+	return socket
+}
+
+// remote starts a "kitty @" argv, addressed to the client's instance. --to is a
+// flag of "@" itself rather than of the command after it, so it goes first.
+func (c *Client) remote(command string) []string {
+	args := []string{"@"}
+	if c.socket != "" {
+		args = append(args, "--to", c.socket)
+	}
+	return append(args, command)
+}
+
+// start runs a kitty command in the background. Canceling ctx interrupts it,
+// which tears the launcher down; closing the window it opened is Dismiss.
+func (c *Client) start(ctx context.Context, args []string) (*Launcher, error) {
+	l := &Launcher{line: c.path + " " + strings.Join(args, " ")}
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGINT)
+	}
+	cmd.WaitDelay = launcherWaitDelay
+	cmd.Stdout = &l.stdout
+	cmd.Stderr = &l.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.line, err)
+	}
+	l.cmd = cmd
+	l.wait = sync.OnceValue(l.reap)
+	return l, nil
+}
+
+// run executes a kitty command and folds its stderr into the error, where kitty
+// reports the window no match found and a remote control it refused.
+func (c *Client) run(ctx context.Context, args ...string) error {
+	_, err := exec.CommandContext(ctx, c.path, args...).Output()
+	if execErr, ok := errors.AsType[*exec.ExitError](err); ok {
+		return fmt.Errorf(
+			"%s %s: %w: %s",
+			c.path, strings.Join(args, " "), err, strings.TrimSpace(string(execErr.Stderr)),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", c.path, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// launcherWaitDelay is how long a dismissed launcher has to go away on its own
+// before it is killed. A kitty that ignores its interrupt, or that leaves a
+// child holding the pipes its output is read from, would otherwise be waited on
+// forever.
+const launcherWaitDelay = 2 * time.Second
+
+// Launcher is a running "kitty @ launch", and the way to close the window it
+// opened. Its own streams are of no interest to the payload, which draws on the
+// window rather than on this process's terminal.
+type Launcher struct {
+	cmd  *exec.Cmd
+	line string
+	// The launcher's own output is diagnostics, reported only with a failure —
+	// and the one place the created window's id is. The two streams are kept
+	// apart while kitty writes them and joined only in that error, where which
+	// descriptor carried a message says nothing.
+	stdout, stderr bytes.Buffer
+	// wait is memoized: a process can only be reaped once, while both the caller
+	// waiting on the launcher and a dismissal reading what it printed have to go
+	// through it.
+	wait func() error
+	// close closes the window this launcher opened, set by the Start that built
+	// it.
+	close     func(context.Context) error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Wait waits for the launcher to exit and decorates a failure with the command
+// that produced it and everything it printed — "Remote control is disabled"
+// and friends, which are the only trace a window that never appeared leaves.
+func (l *Launcher) Wait() error { return l.wait() }
+
+func (l *Launcher) reap() error {
+	err := l.cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %w", l.line, err)
+	if out := strings.TrimSpace(l.stdout.String() + l.stderr.String()); out != "" {
+		err = fmt.Errorf("%w: %s", err, out)
+	}
+	return err
+}
+
+// Dismiss closes the window this launcher opened, once per launcher: the close
+// is the window's end, and a second one could only be told it is already gone.
+func (l *Launcher) Dismiss(ctx context.Context) error {
+	l.closeOnce.Do(func() { l.closeErr = l.close(ctx) })
+	return l.closeErr
+}
+
+// waitBounded waits for the launcher to exit, giving up when ctx does. Only the
+// bound is reported: how the launcher itself exited says nothing about whether
+// the window it created is still there.
+//
+// The goroutine outlives a bound that ran out, and has to: a wait cannot be
+// taken back, and this one ends when the launcher does.
+func (l *Launcher) waitBounded(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = l.wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
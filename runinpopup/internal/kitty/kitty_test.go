@@ -0,0 +1,96 @@
+package kitty
+
+import (
+	"slices"
+	"testing"
+)
+
+func testClient() *Client {
+	return New(Options{Path: "/usr/bin/kitty", Socket: "unix:/tmp/kitty-1", Shell: "/bin/bash"})
+}
+
+func assertCommand(
+	t *testing.T,
+	gotPath string,
+	gotArgs []string,
+	wantPath string,
+	wantArgs []string,
+) {
+	t.Helper()
+	if gotPath != wantPath {
+		t.Errorf("path = %q, want %q", gotPath, wantPath)
+	}
+	if !slices.Equal(gotArgs, wantArgs) {
+		t.Errorf("args =\n\t%#v\nwant\n\t%#v", gotArgs, wantArgs)
+	}
+}
+
+func TestClient_LaunchCommand_overlay(t *testing.T) {
+	path, args := testClient().LaunchCommand(LaunchRequest{
+		WindowId: "4",
+		Title:    "editor",
+		Env:      map[string]string{"B": "two", "A": "it's one"},
+		Command:  []string{"vim", "my file.txt"},
+	})
+	assertCommand(t, path, args, "/usr/bin/kitty", []string{
+		"@", "--to", "unix:/tmp/kitty-1", "launch",
+		"--type=overlay",
+		"--match", "id:4",
+		"--title", "editor",
+		"--env", "A=it's one",
+		"--env", "B=two",
+		"--",
+		"vim", "my file.txt",
+	})
+}
+
+// Without a socket kitty is reached through the controlling terminal, and
+// without a window id it opens over the active one: neither flag is emitted.
+func TestClient_LaunchCommand_osWindowScript(t *testing.T) {
+	path, args := New(Options{}).LaunchCommand(LaunchRequest{
+		Type:   TypeOSWindow,
+		Script: "make test; echo done",
+	})
+	assertCommand(t, path, args, "kitty", []string{
+		"@", "launch", "--type=os-window", "--", "sh", "-c", "make test; echo done",
+	})
+}
+
+func TestClient_CloseWindowCommand(t *testing.T) {
+	path, args := testClient().CloseWindowCommand("7")
+	assertCommand(t, path, args, "/usr/bin/kitty", []string{
+		"@", "--to", "unix:/tmp/kitty-1", "close-window", "--match", "id:7",
+	})
+}
+
+func TestSocketAddress(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"", ""},
+		{"/tmp/kitty-1", "unix:/tmp/kitty-1"},
+		{"unix:/tmp/kitty-1", "unix:/tmp/kitty-1"},
+		{"tcp:localhost:12345", "tcp:localhost:12345"},
+	} {
+		if got := socketAddress(tc.in); got != tc.want {
+			t.Errorf("socketAddress(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseWindowId(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want string
+	}{
+		{name: "the id alone", out: "7\n", want: "7"},
+		{name: "nothing printed", out: ""},
+		{name: "a message instead", out: "Remote control is disabled\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseWindowId(tc.out)
+			if ok != (tc.want != "") || got != tc.want {
+				t.Errorf("parseWindowId(%q) = %q, %t; want %q", tc.out, got, ok, tc.want)
+			}
+		})
+	}
+}
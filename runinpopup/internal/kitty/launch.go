@@ -0,0 +1,124 @@
+package kitty
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// WindowType is the kind of window "kitty @ launch" opens (--type).
+type WindowType string
+
+// The window types a popup can be. Both take the whole of what they open in, so
+// neither can be placed or sized from the command line.
+const (
+	// TypeOverlay covers the window it is opened over, and goes away with its
+	// payload, uncovering that window again — the nearest kitty has to a popup.
+	TypeOverlay WindowType = "overlay"
+	// TypeOSWindow is a top-level window of its own, for a popup that should
+	// leave whatever the user was looking at untouched.
+	TypeOSWindow WindowType = "os-window"
+)
+
+// LaunchRequest is a "kitty @ launch" invocation.
+type LaunchRequest struct {
+	// Type is the kind of window opened. Empty means TypeOverlay.
+	Type WindowType
+	// WindowId is the window the new one is opened over or beside (--match
+	// id:<n>). Empty lets kitty take the active window.
+	WindowId string
+	// Title names the window (--title). Empty leaves kitty's default.
+	Title string
+	// Env is the window's environment, one --env KEY=VALUE each, in sorted order
+	// so the argv is stable. The launcher is gone the moment the window exists,
+	// so the values are on a command line only for as long as that takes.
+	Env map[string]string
+	// Command is the argv the window runs.
+	Command []string
+	// Script is a raw shell command line taking precedence over Command.
+	Script string
+}
+
+// LaunchCommand builds "kitty @ [--to <socket>] launch --type=<type> [--match
+// id:<n>] [--title <title>] [--env KEY=VALUE]... -- <payload>".
+func (c *Client) LaunchCommand(req LaunchRequest) (path string, args []string) {
+	args = append(c.remote("launch"), "--type="+string(cmp.Or(req.Type, TypeOverlay)))
+	if req.WindowId != "" {
+		args = append(args, "--match", "id:"+req.WindowId)
+	}
+	if req.Title != "" {
+		args = append(args, "--title", req.Title)
+	}
+	for _, k := range slices.Sorted(maps.Keys(req.Env)) {
+		args = append(args, "--env", k+"="+req.Env[k])
+	}
+	args = append(args, "--")
+	return c.path, append(args, c.payload(req)...)
+}
+
+// StartLaunch runs LaunchCommand's argv. "kitty @ launch" returns as soon as the
+// window exists, printing its id, so its launcher says nothing about the
+// payload still running in it.
+func (c *Client) StartLaunch(ctx context.Context, req LaunchRequest) (*Launcher, error) {
+	_, args := c.LaunchCommand(req)
+	l, err := c.start(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	l.close = func(ctx context.Context) error { return c.closeWindow(ctx, l) }
+	return l, nil
+}
+
+// closeWindow closes the window the launcher created. The id it is named by is
+// on the launcher's own stdout, so the launcher is waited on first — reading
+// that buffer beside a kitty still writing it is the race this waits out.
+func (c *Client) closeWindow(ctx context.Context, l *Launcher) error {
+	if err := l.waitBounded(ctx); err != nil {
+		return fmt.Errorf("%s: waiting for the new window's id: %w", l.line, err)
+	}
+	windowId, ok := parseWindowId(l.stdout.String())
+	if !ok {
+		return fmt.Errorf(
+			"%s: no window id to close, the launcher printed %q",
+			l.line, strings.TrimSpace(l.stdout.String()+l.stderr.String()),
+		)
+	}
+	return c.CloseWindow(ctx, windowId)
+}
+
+// parseWindowId picks the window id out of what "kitty @ launch" printed: the
+// new window's id, a bare number on a line of its own. Anything else is a
+// launcher that never got as far as creating a window.
+func parseWindowId(out string) (string, bool) {
+	id := strings.TrimSpace(out)
+	if id == "" || strings.ContainsFunc(id, func(r rune) bool { return r < '0' || r > '9' }) {
+		return "", false
+	}
+	return id, true
+}
+
+// CloseWindowCommand builds "kitty @ [--to <socket>] close-window --match
+// id:<n>". A window id is unique within the kitty instance, so the match needs
+// nothing beside it.
+func (c *Client) CloseWindowCommand(windowId string) (path string, args []string) {
+	return c.path, append(c.remote("close-window"), "--match", "id:"+windowId)
+}
+
+// CloseWindow closes the window a matching StartLaunch created, taking whatever
+// runs in it along.
+func (c *Client) CloseWindow(ctx context.Context, windowId string) error {
+	_, args := c.CloseWindowCommand(windowId)
+	return c.run(ctx, args...)
+}
+
+// payload renders what the window executes. kitty runs an argv directly, so
+// only a script payload is wrapped in a shell.
+func (c *Client) payload(req LaunchRequest) []string {
+	if req.Script == "" {
+		return slices.Clone(req.Command)
+	}
+	return []string{c.shell, "-c", req.Script}
+}
@@ -0,0 +1,93 @@
+package kitty
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeKitty writes an executable standing in for kitty, running body under
+// /bin/sh with the kitty argv, and returns its path. Every invocation appends
+// its argv to log first, so a test can assert what kitty was asked.
+func fakeKitty(t *testing.T, body string) (path, log string) {
+	t.Helper()
+	dir := t.TempDir()
+	log = filepath.Join(dir, "log")
+	path = filepath.Join(dir, "kitty")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake kitty: %v", err)
+	}
+	return path, log
+}
+
+func loggedCalls(t *testing.T, log string) []string {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("reading the fake kitty's log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+// The full round trip: the launcher exits the moment the window exists, and
+// the dismissal closes the window by the id the launcher printed.
+func TestClient_StartLaunch_lifecycle(t *testing.T) {
+	path, log := fakeKitty(t, `case "$*" in *close-window*) : ;; *) echo 12 ;; esac`)
+	c := New(Options{Path: path, Socket: "unix:/tmp/kitty-1"})
+
+	l, err := c.StartLaunch(t.Context(), LaunchRequest{Command: []string{"true"}})
+	if err != nil {
+		t.Fatalf("StartLaunch: %v", err)
+	}
+	if err := l.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := l.Dismiss(t.Context()); err != nil {
+		t.Fatalf("Dismiss: %v", err)
+	}
+
+	calls := loggedCalls(t, log)
+	if len(calls) != 2 {
+		t.Fatalf("kitty was invoked %d times %q, want the launch and the close", len(calls), calls)
+	}
+	if want := "@ --to unix:/tmp/kitty-1 close-window --match id:12"; calls[1] != want {
+		t.Errorf("dismissal ran %q, want %q", calls[1], want)
+	}
+}
+
+// A launcher that failed carries its own diagnostics: the command line and
+// whatever kitty printed are the only trace a window that never appeared leaves.
+func TestClient_StartLaunch_waitReportsTheLauncherFailure(t *testing.T) {
+	path, _ := fakeKitty(t, `echo "Remote control is disabled" >&2; exit 1`)
+	c := New(Options{Path: path})
+
+	l, err := c.StartLaunch(t.Context(), LaunchRequest{Command: []string{"true"}})
+	if err != nil {
+		t.Fatalf("StartLaunch: %v", err)
+	}
+	err = l.Wait()
+	if err == nil || !strings.Contains(err.Error(), "Remote control is disabled") {
+		t.Errorf("Wait = %v, want kitty's own message in it", err)
+	}
+}
+
+// Output without a window id is a launcher that never got as far as creating a
+// window, and a dismissal must say so instead of guessing at one to close.
+func TestClient_StartLaunch_dismissalWithoutAWindowId(t *testing.T) {
+	path, log := fakeKitty(t, `echo "opened something"`)
+	c := New(Options{Path: path})
+
+	l, err := c.StartLaunch(t.Context(), LaunchRequest{Command: []string{"true"}})
+	if err != nil {
+		t.Fatalf("StartLaunch: %v", err)
+	}
+	err = l.Dismiss(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "no window id to close") {
+		t.Errorf("Dismiss = %v, want the missing window id reported", err)
+	}
+	if calls := loggedCalls(t, log); len(calls) != 1 {
+		t.Errorf("kitty was invoked %d times %q, want no close attempted", len(calls), calls)
+	}
+}
@@ -0,0 +1,284 @@
+package nvim
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/geometry"
+)
+
+// Geometry places and sizes a float, in the vocabulary the launch layer takes:
+// cells, "N%" of the editor, and for X and Y the position specifiers that have
+// a meaning inside an editor — C, centred, and for X, R, against the right
+// edge. Empty centres the float, or sizes it to half the editor, as tmux's
+// display-popup does with its own. Anchor and Margin place the float by name
+// instead of X and Y, against the editor's edges.
+type Geometry struct {
+	X, Y, Width, Height string
+	Anchor, Margin      string
+}
+
+// Rect is a float's outer rectangle in editor cells, its border included — the
+// way display-popup counts its size, so a width means the same thing on either.
+type Rect struct {
+	Row, Col, Width, Height int
+}
+
+// Layout resolves g against an editor of columns by lines. It is where the
+// percentages and specifiers become cells: a float is configured in cells
+// alone, and only the editor knows how many it has.
+func Layout(g Geometry, columns, lines int) (Rect, error) {
+	var r Rect
+	var err error
+	if r.Width, err = extent("width", g.Width, columns); err != nil {
+		return Rect{}, err
+	}
+	if r.Height, err = extent("height", g.Height, lines); err != nil {
+		return Rect{}, err
+	}
+	if g.Anchor != "" {
+		if r.Col, r.Row, err = geometry.Place(
+			g.Anchor, g.Margin, r.Width, r.Height, columns, lines,
+		); err != nil {
+			return Rect{}, fmt.Errorf("nvim float: %w", err)
+		}
+		return r, nil
+	}
+	if r.Col, err = offset("x", g.X, columns, r.Width, true); err != nil {
+		return Rect{}, err
+	}
+	if r.Row, err = offset("y", g.Y, lines, r.Height, false); err != nil {
+		return Rect{}, err
+	}
+	return r, nil
+}
+
+// extent resolves a size along an axis of total cells, kept between the
+// smallest float a border leaves room in and the editor itself.
+func extent(field, value string, total int) (int, error) {
+	n := total / 2
+	if value != "" {
+		var ok bool
+		if n, ok = geometry.Resolve(value, total); !ok {
+			return 0, fmt.Errorf("nvim float %s %q: want cells or \"N%%\"", field, value)
+		}
+	}
+	return max(min(n, total), min(minExtent, total)), nil
+}
+
+// minExtent is the smallest float drawn: a border on each side and one cell
+// between them.
+const minExtent = 3
+
+// offset resolves a position along an axis of total cells for a float size
+// cells across. right says whether the axis takes R, the far edge.
+func offset(field, value string, total, size int, right bool) (int, error) {
+	switch {
+	case value == "" || value == "C":
+		return max(total-size, 0) / 2, nil
+	case value == "R" && right:
+		return max(total-size, 0), nil
+	}
+	if n, ok := geometry.Resolve(value, total); ok {
+		return n, nil
+	}
+	specifiers := "C"
+	if right {
+		specifiers = "C or R"
+	}
+	return 0, fmt.Errorf(
+		"nvim float %s %q: want cells, \"N%%\" or %s; the other position specifiers"+
+			" have no equivalent inside an editor",
+		field, value, specifiers,
+	)
+}
+
+// FloatRequest is a floating terminal window to open.
+type FloatRequest struct {
+	Geometry
+	// Title is shown in the float's top border. Empty leaves the border plain.
+	Title string
+	// Env is the terminal job's environment on top of Neovim's own. It travels
+	// inside the request, so unlike a multiplexer's argv it is never visible to
+	// other processes.
+	Env map[string]string
+	// Command is the argv the terminal runs.
+	Command []string
+	// Script is a raw shell command line taking precedence over Command.
+	Script string
+}
+
+// sizeLua answers the editor's size in cells: its columns, and its lines less
+// the command line's, which a float cannot cover.
+const sizeLua = `return { vim.o.columns, vim.o.lines - vim.o.cmdheight }`
+
+// openLua opens the float and starts the terminal in it, in one request so
+// that nothing the user types lands between the two. The buffer is wiped with
+// its last window — closing the float ends the job along with it — and the
+// float closes when the job ends, as a popup would, instead of leaving
+// "[Process exited]" behind.
+const openLua = `local config, cmd, env = ...
+local buf = vim.api.nvim_create_buf(false, true)
+vim.bo[buf].bufhidden = 'wipe'
+local win = vim.api.nvim_open_win(buf, true, config)
+local job = vim.fn.termopen(cmd, {
+  env = env,
+  on_exit = function()
+    vim.schedule(function()
+      if vim.api.nvim_win_is_valid(win) then
+        vim.api.nvim_win_close(win, true)
+      end
+    end)
+  end,
+})
+if job <= 0 then
+  vim.api.nvim_win_close(win, true)
+  error('termopen failed: ' .. job)
+end
+vim.cmd.startinsert()
+return { win, buf }`
+
+// StartFloat opens the float in the background. Its handle's Wait returns once
+// the float exists, and says nothing about the payload still running in it;
+// canceling ctx abandons the request.
+func (c *Client) StartFloat(ctx context.Context, req FloatRequest) *Float {
+	f := &Float{client: c, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.err = c.openFloat(ctx, req, f)
+	}()
+	return f
+}
+
+func (c *Client) openFloat(ctx context.Context, req FloatRequest, f *Float) error {
+	cn, hangUp, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer hangUp()
+
+	size, err := cn.call("nvim_exec_lua", sizeLua, []any{})
+	if err != nil {
+		return err
+	}
+	columns, lines, ok := intPair(size)
+	if !ok {
+		return fmt.Errorf("nvim_exec_lua: the editor size came back as %v", size)
+	}
+	rect, err := Layout(req.Geometry, int(columns), int(lines))
+	if err != nil {
+		return err
+	}
+	env := req.Env
+	if env == nil {
+		env = map[string]string{}
+	}
+	args := []any{FloatConfig(rect, req.Title), c.payload(req), env}
+	res, err := cn.call("nvim_exec_lua", openLua, args)
+	if err != nil {
+		return err
+	}
+	win, buf, ok := intPair(res)
+	if !ok {
+		return fmt.Errorf("nvim_exec_lua: the new float came back as %v", res)
+	}
+	f.window, f.buffer = win, buf
+	return nil
+}
+
+// FloatConfig builds the nvim_open_win configuration of a float occupying
+// rect. Width and height are the window's own, inside the border.
+func FloatConfig(rect Rect, title string) map[string]any {
+	config := map[string]any{
+		"relative": "editor",
+		"row":      rect.Row,
+		"col":      rect.Col,
+		"width":    max(rect.Width-2, 1),
+		"height":   max(rect.Height-2, 1),
+		"style":    "minimal",
+		"border":   "rounded",
+	}
+	if title != "" {
+		config["title"] = title
+	}
+	return config
+}
+
+// intPair reads the two integers a Lua chunk above returned as a list.
+func intPair(v any) (int64, int64, bool) {
+	a, ok := v.([]any)
+	if !ok || len(a) != 2 {
+		return 0, 0, false
+	}
+	x, okX := asInt(a[0])
+	y, okY := asInt(a[1])
+	return x, y, okX && okY
+}
+
+// payload renders what the terminal runs. termopen takes an argv list as one,
+// so only a script payload is wrapped in a shell.
+func (c *Client) payload(req FloatRequest) []string {
+	if req.Script == "" {
+		return slices.Clone(req.Command)
+	}
+	return []string{c.shell, "-c", req.Script}
+}
+
+// CloseWindow closes a window, forcing it: the float's terminal is a modified
+// buffer for as long as its job runs.
+func (c *Client) CloseWindow(ctx context.Context, window int64) error {
+	cn, hangUp, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer hangUp()
+	_, err = cn.call("nvim_win_close", window, true)
+	return err
+}
+
+// Float is a floating terminal window being opened, and the way to close it.
+type Float struct {
+	client *Client
+	done   chan struct{}
+	// err, window and buffer are the open's outcome, written before done is
+	// closed and read only after.
+	err            error
+	window, buffer int64
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Wait waits for the float to be open. A failure names the request that failed
+// and what Neovim answered, which is the only trace a float that never appeared
+// leaves.
+func (f *Float) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// Window and Buffer are the float's window and buffer handles, valid once Wait
+// has returned nil.
+func (f *Float) Window() int64 { return f.window }
+func (f *Float) Buffer() int64 { return f.buffer }
+
+// Dismiss closes the float, once per handle: closing it is the float's end, and
+// a second close could only be told the window is already gone.
+func (f *Float) Dismiss(ctx context.Context) error {
+	f.closeOnce.Do(func() { f.closeErr = f.dismiss(ctx) })
+	return f.closeErr
+}
+
+func (f *Float) dismiss(ctx context.Context) error {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the float to open: %w", context.Cause(ctx))
+	}
+	if f.window == 0 {
+		return fmt.Errorf("no float to close: %w", f.err)
+	}
+	return f.client.CloseWindow(ctx, f.window)
+}
@@ -0,0 +1,120 @@
+package nvim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// An editor of 100 columns by 40 lines throughout.
+func TestLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		g       Geometry
+		want    Rect
+		wantErr string
+	}{
+		{
+			name: "defaults are half the editor, centred",
+			want: Rect{Row: 10, Col: 25, Width: 50, Height: 20},
+		},
+		{
+			name: "cells",
+			g:    Geometry{X: "2", Y: "3", Width: "60", Height: "10"},
+			want: Rect{Row: 3, Col: 2, Width: 60, Height: 10},
+		},
+		{
+			name: "percentages round down",
+			g:    Geometry{X: "10%", Y: "25%", Width: "33%", Height: "33%"},
+			want: Rect{Row: 10, Col: 10, Width: 33, Height: 13},
+		},
+		{
+			name: "centred explicitly",
+			g:    Geometry{X: "C", Y: "C", Width: "80", Height: "20"},
+			want: Rect{Row: 10, Col: 10, Width: 80, Height: 20},
+		},
+		{
+			name: "against the right edge",
+			g:    Geometry{X: "R", Width: "30"},
+			want: Rect{Row: 10, Col: 70, Width: 30, Height: 20},
+		},
+		{
+			name: "sizes are kept inside the editor",
+			g:    Geometry{Width: "500", Height: "150%"},
+			want: Rect{Row: 0, Col: 0, Width: 100, Height: 40},
+		},
+		{
+			name: "and large enough for a border around a cell",
+			g:    Geometry{Width: "0", Height: "1"},
+			want: Rect{Row: 18, Col: 48, Width: 3, Height: 3},
+		},
+		{
+			name: "anchored, off the edges it names",
+			g:    Geometry{Anchor: "bottom-right", Margin: "2", Width: "30", Height: "10"},
+			want: Rect{Row: 28, Col: 68, Width: 30, Height: 10},
+		},
+		{
+			name: "anchored at half the editor",
+			g:    Geometry{Anchor: "top"},
+			want: Rect{Row: 0, Col: 25, Width: 50, Height: 20},
+		},
+		{
+			name:    "a margin that is no distance",
+			g:       Geometry{Anchor: "top", Margin: "M"},
+			wantErr: `Margin "M"`,
+		},
+		{name: "R is horizontal only", g: Geometry{Y: "R"}, wantErr: `y "R"`},
+		{name: "the mouse has no float equivalent", g: Geometry{X: "M"}, wantErr: `x "M"`},
+		{name: "a signed size", g: Geometry{Width: "+5"}, wantErr: `width "+5"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Layout(tc.g, 100, 40)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Layout = %v, %v; want an error naming %s", got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Layout: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Layout = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// The configured size is the window inside the border, two cells smaller than
+// the rectangle it occupies.
+func TestFloatConfig(t *testing.T) {
+	got := FloatConfig(Rect{Row: 1, Col: 2, Width: 30, Height: 10}, "pinentry")
+	want := map[string]any{
+		"relative": "editor",
+		"row":      1,
+		"col":      2,
+		"width":    28,
+		"height":   8,
+		"style":    "minimal",
+		"border":   "rounded",
+		"title":    "pinentry",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FloatConfig =\n\t%#v\nwant\n\t%#v", got, want)
+	}
+	if _, ok := FloatConfig(Rect{Width: 3, Height: 3}, "")["title"]; ok {
+		t.Error("an empty title must leave the border without one")
+	}
+}
+
+func TestClient_payload(t *testing.T) {
+	c := New(Options{Shell: "/bin/bash"})
+	if got, want := c.payload(FloatRequest{Command: []string{"vim", "my file"}}),
+		[]string{"vim", "my file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("argv payload = %q, want %q", got, want)
+	}
+	if got, want := c.payload(FloatRequest{Script: "make; echo done", Command: []string{"x"}}),
+		[]string{"/bin/bash", "-c", "make; echo done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("script payload = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package nvim
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// call is one request a fakeNvim received.
+type call struct {
+	method string
+	params []any
+}
+
+// fakeNvim serves msgpack-RPC on a unix socket in a temporary directory,
+// answering each request with what answer returns for it — a result, or an
+// error message sent as Neovim sends one. It returns the socket's address and
+// a func listing the requests received so far.
+func fakeNvim(
+	t *testing.T,
+	answer func(method string, params []any) (result any, errMsg string),
+) (address string, calls func() []call) {
+	t.Helper()
+	address = filepath.Join(t.TempDir(), "nvim.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("listening for the fake neovim: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	var mu sync.Mutex
+	var received []call
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					msg, err := decode(r)
+					if err != nil {
+						return
+					}
+					req := msg.([]any)
+					method, params := req[2].(string), req[3].([]any)
+					mu.Lock()
+					received = append(received, call{method, params})
+					mu.Unlock()
+					result, errMsg := answer(method, params)
+					var rpcErr any
+					if errMsg != "" {
+						rpcErr = []any{0, errMsg}
+					}
+					// A notification first: the client has to read past it.
+					out := encode(nil, []any{2, "nvim_buf_lines_event", []any{}})
+					out = encode(out, []any{1, req[1].(int64), rpcErr, result})
+					if _, err := c.Write(out); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return address, func() []call {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]call(nil), received...)
+	}
+}
+
+// answerFloat answers like a Neovim of 100 by 40 that opens window 1001 on
+// buffer 7.
+func answerFloat(method string, params []any) (any, string) {
+	if method == "nvim_exec_lua" && params[0] == sizeLua {
+		return []any{100, 40}, ""
+	}
+	if method == "nvim_exec_lua" {
+		return []any{1001, 7}, ""
+	}
+	return nil, ""
+}
+
+// The full round trip: the size is asked for, the float opened at the
+// rectangle resolved against it, and the dismissal closes the window the open
+// answered with.
+func TestClient_StartFloat_lifecycle(t *testing.T) {
+	address, calls := fakeNvim(t, answerFloat)
+	c := New(Options{Address: address, Shell: "/bin/bash"})
+
+	f := c.StartFloat(t.Context(), FloatRequest{
+		Geometry: Geometry{Width: "80", Height: "20"},
+		Title:    "pinentry",
+		Env:      map[string]string{"TTY_FIFO_FILE": "/tmp/popup/tty"},
+		Script:   "echo hi",
+	})
+	if err := f.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if f.Window() != 1001 || f.Buffer() != 7 {
+		t.Errorf("window, buffer = %d, %d; want 1001, 7", f.Window(), f.Buffer())
+	}
+	if err := f.Dismiss(t.Context()); err != nil {
+		t.Fatalf("Dismiss: %v", err)
+	}
+
+	got := calls()
+	if len(got) != 3 {
+		t.Fatalf("neovim received %d requests %v, want size, open and close", len(got), got)
+	}
+	wantOpen := []any{
+		map[string]any{
+			"relative": "editor",
+			"row":      int64(10),
+			"col":      int64(10),
+			"width":    int64(78),
+			"height":   int64(18),
+			"style":    "minimal",
+			"border":   "rounded",
+			"title":    "pinentry",
+		},
+		[]any{"/bin/bash", "-c", "echo hi"},
+		map[string]any{"TTY_FIFO_FILE": "/tmp/popup/tty"},
+	}
+	if got[1].params[0] != openLua || !reflect.DeepEqual(got[1].params[1], wantOpen) {
+		t.Errorf("open sent %#v, want openLua with %#v", got[1].params, wantOpen)
+	}
+	want := call{"nvim_win_close", []any{int64(1001), true}}
+	if !reflect.DeepEqual(got[2], want) {
+		t.Errorf("dismissal sent %v, want %v", got[2], want)
+	}
+}
+
+// Neovim's own error is what a float that never opened leaves behind, and the
+// dismissal has no window to close.
+func TestClient_StartFloat_waitReportsNeovimsError(t *testing.T) {
+	address, calls := fakeNvim(t, func(method string, params []any) (any, string) {
+		if params[0] == sizeLua {
+			return []any{100, 40}, ""
+		}
+		return nil, "Vim:E5108: termopen failed"
+	})
+	c := New(Options{Address: address})
+
+	f := c.StartFloat(t.Context(), FloatRequest{Command: []string{"true"}})
+	err := f.Wait()
+	if err == nil || !strings.Contains(err.Error(), "E5108: termopen failed") {
+		t.Errorf("Wait = %v, want neovim's message in it", err)
+	}
+	err = f.Dismiss(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "no float to close") {
+		t.Errorf("Dismiss = %v, want the missing window reported", err)
+	}
+	if got := calls(); len(got) != 2 {
+		t.Errorf("neovim received %d requests %v, want no close attempted", len(got), got)
+	}
+}
+
+// A Neovim that never answers holds the launch only as long as its context.
+func TestClient_StartFloat_canceled(t *testing.T) {
+	hang := make(chan struct{})
+	address, _ := fakeNvim(t, func(string, []any) (any, string) {
+		<-hang
+		return nil, ""
+	})
+	defer close(hang)
+	ctx, cancel := context.WithCancel(t.Context())
+	f := New(Options{Address: address}).StartFloat(ctx, FloatRequest{Command: []string{"true"}})
+	cancel()
+	if err := f.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait = %v, want the cancellation", err)
+	}
+}
+
+func TestClient_StartFloat_noAddress(t *testing.T) {
+	err := New(Options{}).StartFloat(t.Context(), FloatRequest{Command: []string{"true"}}).Wait()
+	if err == nil || !strings.Contains(err.Error(), "$NVIM") {
+		t.Errorf("Wait = %v, want the missing server reported", err)
+	}
+}
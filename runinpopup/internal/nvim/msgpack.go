@@ -0,0 +1,283 @@
+package nvim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+)
+
+// The subset of MessagePack that msgpack-RPC with Neovim needs: what a request
+// is made of going out, and whatever an API function can answer with coming
+// back. It is written out here rather than pulled in as a dependency because
+// that subset is small and fixed — the API speaks nil, booleans, integers,
+// floats, strings, arrays, maps and the ext types its handles are — and this
+// module otherwise needs no serialization library at all.
+
+// Ext is an ext-typed value Neovim sent: its buffer, window and tabpage
+// handles, told apart by Type. Data is the handle itself, MessagePack-encoded.
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// encode appends the MessagePack encoding of v to b. It takes the types a
+// request is built from and panics on anything else: which values go out is
+// this package's own choice, so another type is a bug here, not input to
+// report.
+func encode(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return encodeInt(b, int64(v))
+	case int64:
+		return encodeInt(b, v)
+	case uint32:
+		return encodeInt(b, int64(v))
+	case string:
+		return append(encodeHeader(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb), v...)
+	case []string:
+		b = encodeHeader(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			b = encode(b, e)
+		}
+		return b
+	case []any:
+		b = encodeHeader(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			b = encode(b, e)
+		}
+		return b
+	case map[string]string:
+		b = encodeHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			b = encode(encode(b, k), v[k])
+		}
+		return b
+	case map[string]any:
+		b = encodeHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			b = encode(encode(b, k), v[k])
+		}
+		return b
+	}
+	panic(fmt.Sprintf("nvim: cannot encode a %T", v))
+}
+
+func encodeInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n < 128:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(int8(n)))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// encodeHeader appends the header of a string, array or map of n elements:
+// the fix form when n fits in it (below fixMax), else the 8-, 16- or 32-bit
+// length form. Only strings have an 8-bit form; the others pass 0 for it.
+func encodeHeader(b []byte, n int, fix byte, fixMax int, op8, op16, op32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case op8 != 0 && n <= math.MaxUint8:
+		return append(b, op8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, op16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, op32), uint32(n))
+}
+
+// decode reads one MessagePack value from r. Integers come back as int64 —
+// or uint64 past its range — floats as float64, str as string, bin as []byte,
+// arrays as []any, maps as map[string]any and ext values as Ext. A map key that
+// is not a string is rendered with fmt: Neovim's never are, so one is only
+// ever looked at in an error.
+func decode(r *bufio.Reader) (any, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case op <= 0x7f:
+		return int64(op), nil
+	case op >= 0xe0:
+		return int64(int8(op)), nil
+	case op&0xe0 == 0xa0:
+		return decodeString(r, int(op&0x1f))
+	case op&0xf0 == 0x90:
+		return decodeArray(r, int(op&0x0f))
+	case op&0xf0 == 0x80:
+		return decodeMap(r, int(op&0x0f))
+	}
+	switch op {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := readUint(r, 1<<(op-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (op - 0xd0)
+		n, err := readUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width.
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xca:
+		n, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := readUint(r, 8)
+		return math.Float64frombits(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(r, 1<<(op-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decodeString(r, int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUint(r, 1<<(op-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(r, int(n))
+	case 0xdc, 0xdd:
+		n, err := readUint(r, 2<<(op-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeArray(r, int(n))
+	case 0xde, 0xdf:
+		n, err := readUint(r, 2<<(op-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMap(r, int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decodeExt(r, 1<<(op-0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readUint(r, 1<<(op-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return decodeExt(r, int(n))
+	}
+	return nil, fmt.Errorf("nvim: unknown MessagePack type byte 0x%02x", op)
+}
+
+func decodeString(r *bufio.Reader, n int) (any, error) {
+	b, err := readN(r, n)
+	return string(b), err
+}
+
+func decodeArray(r *bufio.Reader, n int) (any, error) {
+	a := make([]any, 0, min(n, 1024))
+	for range n {
+		v, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func decodeMap(r *bufio.Reader, n int) (any, error) {
+	m := make(map[string]any, min(n, 1024))
+	for range n {
+		k, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func decodeExt(r *bufio.Reader, n int) (any, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readN(r, n)
+	return Ext{Type: int8(t), Data: data}, err
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	b, err := readN(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// readN reads exactly n bytes. The buffer grows as the bytes arrive rather than
+// being sized from n up front: n is the peer's to claim, and a corrupt length
+// must not be an allocation of gigabytes.
+func readN(r *bufio.Reader, n int) ([]byte, error) {
+	b := make([]byte, 0, min(n, 4096))
+	for len(b) < n {
+		chunk := make([]byte, min(n-len(b), 4096))
+		m, err := io.ReadFull(r, chunk)
+		b = append(b, chunk[:m]...)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// asInt reads an integer out of a decoded value: a plain integer, or a handle
+// Neovim sent as an ext value wrapping one.
+func asInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case Ext:
+		n, err := decode(bufio.NewReader(bytes.NewReader(v.Data)))
+		if err != nil {
+			return 0, false
+		}
+		i, ok := n.(int64)
+		return i, ok
+	}
+	return 0, false
+}
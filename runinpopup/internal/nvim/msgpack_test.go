@@ -0,0 +1,137 @@
+package nvim
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeBytes(t *testing.T, b []byte) any {
+	t.Helper()
+	v, err := decode(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("decode(% x): %v", b, err)
+	}
+	return v
+}
+
+// What goes out comes back as the decoder's own types, across every length
+// boundary an encoding changes at.
+func TestEncode_roundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   any
+		want any
+	}{
+		{name: "nil", in: nil, want: nil},
+		{name: "true", in: true, want: true},
+		{name: "false", in: false, want: false},
+		{name: "positive fixint", in: 127, want: int64(127)},
+		{name: "past fixint", in: 128, want: int64(128)},
+		{name: "negative fixint", in: -32, want: int64(-32)},
+		{name: "past negative fixint", in: -33, want: int64(-33)},
+		{name: "large", in: int64(1) << 40, want: int64(1) << 40},
+		{name: "msgid", in: uint32(7), want: int64(7)},
+		{name: "fixstr", in: strings.Repeat("a", 31), want: strings.Repeat("a", 31)},
+		{name: "str8", in: strings.Repeat("a", 32), want: strings.Repeat("a", 32)},
+		{name: "str16", in: strings.Repeat("a", 256), want: strings.Repeat("a", 256)},
+		{name: "str32", in: strings.Repeat("a", 1<<16), want: strings.Repeat("a", 1<<16)},
+		{name: "fixarray", in: []string{"a", "b"}, want: []any{"a", "b"}},
+		{
+			name: "array16",
+			in:   make([]any, 16),
+			want: make([]any, 16),
+		},
+		{
+			name: "nested",
+			in:   []any{0, uint32(1), "nvim_exec_lua", []any{"return 1", []any{}}},
+			want: []any{int64(0), int64(1), "nvim_exec_lua", []any{"return 1", []any{}}},
+		},
+		{
+			name: "maps",
+			in:   map[string]any{"env": map[string]string{"A": "1"}, "row": 3},
+			want: map[string]any{"env": map[string]any{"A": "1"}, "row": int64(3)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := decodeBytes(t, encode(nil, tc.in)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("round trip of %v = %#v, want %#v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+// The encodings only Neovim sends: sized integers, floats, binary and the ext
+// values its handles travel as.
+func TestDecode_neovimEncodings(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		want any
+	}{
+		{name: "uint16", in: []byte{0xcd, 0x01, 0x00}, want: int64(256)},
+		{
+			name: "uint64 past int64",
+			in:   []byte{0xcf, 0xff, 0, 0, 0, 0, 0, 0, 0},
+			want: uint64(0xff) << 56,
+		},
+		{name: "int8", in: []byte{0xd0, 0x80}, want: int64(-128)},
+		{name: "int32", in: []byte{0xd2, 0xff, 0xff, 0xff, 0xfe}, want: int64(-2)},
+		{name: "float64", in: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, want: 1.5},
+		{name: "bin8", in: []byte{0xc4, 0x02, 'h', 'i'}, want: []byte("hi")},
+		{name: "fixext1 window", in: []byte{0xd4, 0x01, 0x05}, want: Ext{Type: 1, Data: []byte{5}}},
+		{
+			name: "ext8 window",
+			in:   []byte{0xc7, 0x03, 0x01, 0xcd, 0x03, 0xe9},
+			want: Ext{Type: 1, Data: []byte{0xcd, 0x03, 0xe9}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := decodeBytes(t, tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("decode(% x) = %#v, want %#v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAsInt(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		in     any
+		want   int64
+		wantOk bool
+	}{
+		{name: "integer", in: int64(1001), want: 1001, wantOk: true},
+		{
+			name:   "window handle",
+			in:     Ext{Type: 1, Data: []byte{0xcd, 0x03, 0xe9}},
+			want:   1001,
+			wantOk: true,
+		},
+		{name: "string", in: "1001"},
+		{name: "ext wrapping no integer", in: Ext{Type: 1, Data: []byte{0xa1, 'x'}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := asInt(tc.in)
+			if got != tc.want || ok != tc.wantOk {
+				t.Errorf("asInt(%#v) = %d, %t; want %d, %t", tc.in, got, ok, tc.want, tc.wantOk)
+			}
+		})
+	}
+}
+
+// A message cut short is an error, whatever length its header claimed — not
+// an allocation of that length.
+func TestDecode_truncated(t *testing.T) {
+	for _, in := range [][]byte{
+		{0xdb, 0x7f, 0xff, 0xff, 0xff, 'a'},
+		{0x92, 0x01},
+		{0xcd, 0x01},
+	} {
+		if _, err := decode(bufio.NewReader(bytes.NewReader(in))); err == nil {
+			t.Errorf("decode(% x) succeeded, want an error", in)
+		}
+	}
+}
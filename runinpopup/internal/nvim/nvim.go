@@ -0,0 +1,136 @@
+// Package nvim speaks msgpack-RPC to a running Neovim, the server $NVIM names
+// inside its terminal buffers: it builds every request this module sends, and
+// the Lua those requests run to open a floating terminal window. Callers decide
+// what their popup is; how Neovim is asked for it lives here.
+//
+// Unlike the multiplexers' packages there is no executable in between: a
+// request is a message on the server's socket, and the answer comes back on the
+// same connection.
+package nvim
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Options are the coordinates of the Neovim a Client talks to.
+type Options struct {
+	// Address is the server address, $NVIM inside Neovim's own terminals: a unix
+	// socket path, or "host:port" for one listening on TCP.
+	Address string
+	// Shell runs the payloads Neovim cannot run as a bare argv. Empty means "sh".
+	Shell string
+}
+
+// Client sends requests to one Neovim.
+type Client struct {
+	address string
+	shell   string
+}
+
+// New builds a client.
+func New(opts Options) *Client {
+	return &Client{
+		address: opts.Address,
+		shell:   cmp.Or(opts.Shell, "sh"),
+	}
+}
+
+// network picks the network an address is dialed on. Neovim's own addresses
+// are socket paths, so anything with a slash in it is one.
+func network(address string) string {
+	if strings.Contains(address, "/") {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// conn is one msgpack-RPC session with the server.
+type conn struct {
+	ctx   context.Context
+	c     net.Conn
+	r     *bufio.Reader
+	msgid uint32
+}
+
+// dial connects to the server. ctx bounds the whole session, not only the
+// dial: a Neovim busy with something else answers nothing until it is done, and
+// a request must not outlive the caller that wanted its answer.
+func (c *Client) dial(ctx context.Context) (*conn, func(), error) {
+	if c.address == "" {
+		return nil, nil, errors.New(
+			"no neovim server to talk to: $NVIM is set only inside neovim's terminals",
+		)
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, network(c.address), c.address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to neovim at %s: %w", c.address, err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = nc.SetDeadline(time.Now()) })
+	return &conn{ctx: ctx, c: nc, r: bufio.NewReader(nc)}, func() {
+		stop()
+		_ = nc.Close()
+	}, nil
+}
+
+// call sends one request and returns its result. What the server sends in
+// between — notifications, answers to nobody — is read past: a session is
+// this package's alone and only ever has one request in flight.
+func (cn *conn) call(method string, params ...any) (any, error) {
+	cn.msgid++
+	id := cn.msgid
+	if params == nil {
+		params = []any{}
+	}
+	if _, err := cn.c.Write(encode(nil, []any{0, id, method, params})); err != nil {
+		return nil, fmt.Errorf("%s: %w", method, cn.cause(err))
+	}
+	for {
+		msg, err := decode(cn.r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading the response: %w", method, cn.cause(err))
+		}
+		a, ok := msg.([]any)
+		if !ok || len(a) != 4 {
+			continue
+		}
+		if kind, _ := asInt(a[0]); kind != 1 {
+			continue
+		}
+		if got, _ := asInt(a[1]); got != int64(id) {
+			continue
+		}
+		if a[2] != nil {
+			return nil, fmt.Errorf("%s: %s", method, errorMessage(a[2]))
+		}
+		return a[3], nil
+	}
+}
+
+// cause reports why the session failed: the session's context when it is what
+// cut the connection short — the deadline it set is otherwise reported as a
+// timeout nobody asked for — and err itself when not.
+func (cn *conn) cause(err error) error {
+	if cn.ctx.Err() != nil {
+		return context.Cause(cn.ctx)
+	}
+	return err
+}
+
+// errorMessage renders a msgpack-RPC error. Neovim sends [type, message], the
+// message being the part worth showing; anything else is shown as it came.
+func errorMessage(v any) string {
+	if a, ok := v.([]any); ok && len(a) == 2 {
+		if msg, ok := a[1].(string); ok {
+			return msg
+		}
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,263 @@
+// Package pty runs payloads on pseudo-terminals this process allocates itself,
+// with nothing drawing them: the master side stays here, where a test or a
+// scripted user reads what the payload drew and types at it. It is the one
+// popup mechanism that needs no multiplexer, which is what lets a launch be
+// driven end to end without one.
+package pty
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// Default terminal size, the one a terminal emulator opens with.
+const (
+	DefaultRows = 24
+	DefaultCols = 80
+)
+
+// Options configure the terminals a Client opens.
+type Options struct {
+	// Shell runs every payload as "<Shell> -c <line>". Empty means "/bin/sh".
+	Shell string
+}
+
+// Client opens terminals.
+type Client struct {
+	shell string
+}
+
+// New builds a client.
+func New(opts Options) *Client {
+	return &Client{shell: cmp.Or(opts.Shell, "/bin/sh")}
+}
+
+// Request is a payload to run on a terminal of its own.
+type Request struct {
+	// Rows and Cols size the terminal. Zero means DefaultRows and DefaultCols.
+	Rows, Cols int
+	// Env is the payload's environment on top of this process's own. It is
+	// handed to the process directly, so it is never on any command line.
+	Env map[string]string
+	// Command is the argv the payload runs, quoted into the shell's line.
+	Command []string
+	// Script is a raw shell command line taking precedence over Command.
+	Script string
+}
+
+// Start allocates a terminal and starts the payload on it as the leader of a
+// session of its own, the terminal being that session's controlling terminal —
+// what a shell in a terminal emulator would have, so "tty" answers and job
+// control works. Canceling ctx hangs the terminal up, as Dismiss does.
+func (c *Client) Start(ctx context.Context, req Request) (*Terminal, error) {
+	master, tty, name, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("allocating a pty: %w", err)
+	}
+	rows, cols := cmp.Or(req.Rows, DefaultRows), cmp.Or(req.Cols, DefaultCols)
+	if err := setSize(master, rows, cols); err != nil {
+		_ = tty.Close()
+		_ = master.Close()
+		return nil, fmt.Errorf("sizing %s: %w", name, err)
+	}
+
+	cmd := exec.Command(c.shell, "-c", c.line(req))
+	cmd.Env = environ(req.Env)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	// Ctty is the child's descriptor 0, the terminal itself.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	err = cmd.Start()
+	// The payload holds the terminal from here on. Keeping a descriptor on it in
+	// this process would keep the master from ever reading the end of it.
+	_ = tty.Close()
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("%s -c on %s: %w", c.shell, name, err)
+	}
+
+	t := &Terminal{
+		name:     name,
+		master:   master,
+		cmd:      cmd,
+		exited:   make(chan struct{}),
+		recorded: make(chan struct{}),
+		changed:  make(chan struct{}),
+	}
+	go t.record()
+	go t.reap()
+	stop := context.AfterFunc(ctx, func() { t.hangUp(syscall.SIGHUP) })
+	go func() {
+		<-t.exited
+		stop()
+	}()
+	return t, nil
+}
+
+// line renders the payload as the shell's command line.
+func (c *Client) line(req Request) string {
+	if req.Script != "" {
+		return req.Script
+	}
+	return shellargv.Join(req.Command)
+}
+
+// environ appends env to this process's environment, in key order so two runs
+// of one request start identical processes.
+func environ(env map[string]string) []string {
+	out := os.Environ()
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		out = append(out, k+"="+env[k])
+	}
+	return out
+}
+
+// Terminal is a payload running on a pseudo-terminal, and the master side of
+// that terminal: what the payload draws is recorded as it arrives, and what is
+// written here reaches the payload as typed keys.
+type Terminal struct {
+	name   string
+	master *os.File
+	cmd    *exec.Cmd
+
+	exited  chan struct{}
+	waitErr error
+
+	// recorded is closed once the master has read the last of the terminal.
+	recorded chan struct{}
+	mu       sync.Mutex
+	screen   []byte
+	// changed is closed and replaced whenever screen grows.
+	changed chan struct{}
+
+	dismissOnce sync.Once
+	dismissErr  error
+}
+
+// Name is the terminal's device path, what "tty" prints on it.
+func (t *Terminal) Name() string { return t.name }
+
+// Master is the master side of the terminal, for what Write and Screen do not
+// cover — resizing it, say. Reading it competes with the recording Screen
+// returns, and is best left to that.
+func (t *Terminal) Master() *os.File { return t.master }
+
+// Write types p at the terminal. The line discipline sits in between, so a
+// line is ended with "\r", as the return key ends it, and control characters
+// mean what they do at a keyboard.
+func (t *Terminal) Write(p []byte) (int, error) {
+	return t.master.Write(p)
+}
+
+// Screen returns everything the payload has written to the terminal so far,
+// escape sequences and all. It is the byte stream rather than a rendered
+// screen: what a test looks for in it is text being drawn, not where.
+func (t *Terminal) Screen() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.screen)
+}
+
+// WaitFor waits for text to appear in Screen. It fails once ctx is done, or
+// once the terminal has been read to its end without text appearing, since
+// nothing more is ever coming then.
+func (t *Terminal) WaitFor(ctx context.Context, text string) error {
+	for {
+		t.mu.Lock()
+		found, changed := strings.Contains(string(t.screen), text), t.changed
+		t.mu.Unlock()
+		if found {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-t.recorded:
+			if strings.Contains(t.Screen(), text) {
+				return nil
+			}
+			return fmt.Errorf("%s ended without %q appearing on it", t.name, text)
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %q on %s: %w", text, t.name, context.Cause(ctx))
+		}
+	}
+}
+
+// record reads the terminal until its last holder closes it, then closes the
+// master along with it. Reading never stops before that, whether or not anyone
+// looks: a terminal nobody reads fills up, and blocks the payload writing to it.
+func (t *Terminal) record() {
+	defer close(t.recorded)
+	defer t.master.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := t.master.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			t.screen = append(t.screen, buf[:n]...)
+			close(t.changed)
+			t.changed = make(chan struct{})
+			t.mu.Unlock()
+		}
+		if err != nil {
+			// EIO is how a master reports that nothing holds the terminal anymore.
+			return
+		}
+	}
+}
+
+func (t *Terminal) reap() {
+	defer close(t.exited)
+	if err := t.cmd.Wait(); err != nil {
+		t.waitErr = fmt.Errorf("the payload on %s: %w", t.name, err)
+	}
+}
+
+// Wait waits for the payload to exit, and reports how it failed. The shell is
+// the popup here, so this is the popup being over — as with a display-popup,
+// and unlike the floating panes whose launcher returns as soon as they exist.
+func (t *Terminal) Wait() error {
+	<-t.exited
+	return t.waitErr
+}
+
+// Dismiss hangs the terminal up, as a closed terminal window would, and waits
+// for the payload to go. A payload that outlasts ctx is killed. It is done once
+// however often it is called, and a payload gone already is not an error.
+func (t *Terminal) Dismiss(ctx context.Context) error {
+	t.dismissOnce.Do(func() { t.dismissErr = t.dismiss(ctx) })
+	return t.dismissErr
+}
+
+func (t *Terminal) dismiss(ctx context.Context) error {
+	t.hangUp(syscall.SIGHUP)
+	select {
+	case <-t.exited:
+		return nil
+	case <-ctx.Done():
+	}
+	t.hangUp(syscall.SIGKILL)
+	return fmt.Errorf("the payload on %s outlasted its hangup: %w", t.name, context.Cause(ctx))
+}
+
+// hangUp signals the payload's whole session — whatever it started on the
+// terminal, not only the shell. ESRCH is a payload already gone.
+func (t *Terminal) hangUp(sig syscall.Signal) {
+	select {
+	case <-t.exited:
+		return
+	default:
+	}
+	if err := syscall.Kill(-t.cmd.Process.Pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		_ = t.cmd.Process.Signal(sig)
+	}
+}
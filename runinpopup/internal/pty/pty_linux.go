@@ -0,0 +1,69 @@
+package pty
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// open allocates a pty pair through /dev/ptmx, returning the master, the
+// terminal side opened for the payload and that side's device path.
+func open() (master, tty *os.File, name string, err error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var index uint32
+	err = control(m, func(fd uintptr) error {
+		var unlock int32
+		if err := ioctl(fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+			return fmt.Errorf("unlocking the pty: %w", err)
+		}
+		if err := ioctl(fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&index))); err != nil {
+			return fmt.Errorf("naming the pty: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = m.Close()
+		return nil, nil, "", err
+	}
+	name = fmt.Sprintf("/dev/pts/%d", index)
+	t, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = m.Close()
+		return nil, nil, "", err
+	}
+	return m, t, name, nil
+}
+
+// setSize sets the terminal's size in cells.
+func setSize(master *os.File, rows, cols int) error {
+	size := struct{ rows, cols, x, y uint16 }{uint16(rows), uint16(cols), 0, 0}
+	return control(master, func(fd uintptr) error {
+		return ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size)))
+	})
+}
+
+// control runs fn on f's descriptor. It goes through SyscallConn rather than Fd,
+// which would put the master into blocking mode, where closing it no longer
+// interrupts the read recording it.
+func control(f *os.File, fn func(fd uintptr) error) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ferr error
+	if err := rc.Control(func(fd uintptr) { ferr = fn(fd) }); err != nil {
+		return err
+	}
+	return ferr
+}
+
+func ioctl(fd, request, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
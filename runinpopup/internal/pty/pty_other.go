@@ -0,0 +1,20 @@
+//go:build !linux
+
+package pty
+
+import (
+	"errors"
+	"os"
+)
+
+// errUnsupported is every allocation on a platform whose pty interface this
+// package does not speak; only Linux's /dev/ptmx ioctls are implemented.
+var errUnsupported = errors.New("pty allocation is only implemented on linux")
+
+func open() (master, tty *os.File, name string, err error) {
+	return nil, nil, "", errUnsupported
+}
+
+func setSize(*os.File, int, int) error {
+	return errUnsupported
+}
@@ -0,0 +1,142 @@
+package pty
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// start starts req on a terminal, skipping where none can be allocated, and
+// makes sure its payload is gone by the end of the test.
+func start(t *testing.T, req Request) *Terminal {
+	t.Helper()
+	term, err := New(Options{}).Start(t.Context(), req)
+	if err != nil {
+		t.Skipf("cannot run a payload on a pty: %v", err)
+	}
+	t.Cleanup(func() { _ = term.Dismiss(context.Background()) })
+	return term
+}
+
+func waitFor(t *testing.T, term *Terminal, text string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	if err := term.WaitFor(ctx, text); err != nil {
+		t.Fatalf("%v; the terminal shows %q", err, term.Screen())
+	}
+}
+
+// The payload runs on the terminal as its controlling one: "tty" names the
+// terminal Name reports, the size is the one asked for, and the environment
+// arrives without ever being on a command line.
+func TestClient_Start_terminal(t *testing.T) {
+	term := start(t, Request{
+		Rows:   30,
+		Cols:   100,
+		Env:    map[string]string{"GREETING": "hello from the env"},
+		Script: `echo "tty=$(tty) size=$(stty size) $GREETING"`,
+	})
+	if err := term.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	waitFor(t, term, "tty="+term.Name()+" size=30 100 hello from the env")
+	if !strings.HasPrefix(term.Name(), "/dev/pts/") {
+		t.Errorf("Name = %q, want a /dev/pts device", term.Name())
+	}
+}
+
+// A command is quoted into the shell's line rather than split by it.
+func TestClient_Start_command(t *testing.T) {
+	term := start(t, Request{Command: []string{"printf", "%s|", "one arg", "$HOME"}})
+	if err := term.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	waitFor(t, term, "one arg|$HOME|")
+}
+
+// What is written at the master is typed at the payload, through the line
+// discipline: a line is ended with a carriage return, as the return key ends it.
+func TestTerminal_Write_types(t *testing.T) {
+	term := start(t, Request{Script: `printf 'name? '; read name; echo "hi, $name"`})
+	waitFor(t, term, "name? ")
+	if _, err := term.Write([]byte("gopher\r")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	waitFor(t, term, "hi, gopher")
+	if err := term.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestTerminal_Wait_reportsTheExitStatus(t *testing.T) {
+	term := start(t, Request{Script: "exit 3"})
+	err := term.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("Wait = %v, want exit status 3", err)
+	}
+	if !strings.Contains(err.Error(), term.Name()) {
+		t.Errorf("Wait = %v, want it to name the terminal", err)
+	}
+}
+
+// Dismissing hangs up everything on the terminal, not only the shell, and a
+// second dismissal has nothing left to do.
+func TestTerminal_Dismiss(t *testing.T) {
+	term := start(t, Request{Script: "sleep 30 & echo started; wait"})
+	waitFor(t, term, "started")
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := term.Dismiss(ctx); err != nil {
+		t.Fatalf("Dismiss: %v", err)
+	}
+	if err := term.Wait(); err == nil {
+		t.Fatal("Wait = nil, want the payload to have been hung up")
+	}
+	// The terminal is read to its end only once the background sleep has let go
+	// of it too.
+	select {
+	case <-term.recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("something on the terminal outlived its hangup")
+	}
+	if err := term.Dismiss(ctx); err != nil {
+		t.Errorf("second Dismiss: %v", err)
+	}
+}
+
+// Canceling the launch context hangs the terminal up as well.
+func TestClient_Start_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	term, err := New(Options{}).Start(ctx, Request{Script: "echo started; sleep 30"})
+	if err != nil {
+		t.Skipf("cannot run a payload on a pty: %v", err)
+	}
+	waitFor(t, term, "started")
+	cancel()
+	done := make(chan error, 1)
+	go func() { done <- term.Wait() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Wait = nil, want the payload to have been hung up")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the payload outlived its canceled launch")
+	}
+}
+
+// Text that never comes fails the wait once the terminal has ended, rather than
+// at the deadline.
+func TestTerminal_WaitFor_endedTerminal(t *testing.T) {
+	term := start(t, Request{Script: "echo something else"})
+	_ = term.Wait()
+	err := term.WaitFor(t.Context(), "never printed")
+	if err == nil || !strings.Contains(err.Error(), "ended without") {
+		t.Fatalf("WaitFor = %v, want it to report the terminal ended", err)
+	}
+}
@@ -0,0 +1,232 @@
+package screen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeScreen writes an executable standing in for screen, running body under
+// /bin/sh with the screen argv, and returns its path. Every invocation appends
+// its argv — and the $SCREENDIR it was pointed at — to log first, so a test can
+// assert what screen was asked.
+func fakeScreen(t *testing.T, body string) (path, log string) {
+	t.Helper()
+	dir := t.TempDir()
+	log = filepath.Join(dir, "log")
+	path = filepath.Join(dir, "screen")
+	script := "#!/bin/sh\necho \"${SCREENDIR:-} $*\" >> " + log + "\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake screen: %v", err)
+	}
+	return path, log
+}
+
+func loggedCalls(t *testing.T, log string) []string {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("reading the fake screen's log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+// answerNumber is a fake screen body answering "-Q number" the way screen does,
+// with the number and the tag it was asked by.
+const answerNumber = `case "$*" in *"-Q number"*) echo "5 ($4)" ;; esac`
+
+// The full round trip: the window opens under its tag, Wait looks its number up
+// by that tag and retitles it, and the dismissal checks the number still has
+// that title and kills it by that number — on the session and socket directory
+// the client was pointed at, every time.
+func TestClient_StartWindow_lifecycle(t *testing.T) {
+	path, log := fakeScreen(t, answerNumber+`
+case "$*" in *"-Q title"*) echo pinentry ;; esac`)
+	c := New(Options{Path: path, Session: "1234.main", Dir: "/run/screen/S-me"})
+
+	l, err := c.StartWindow(t.Context(), WindowRequest{
+		Title:   "pinentry",
+		Command: []string{"true"},
+	})
+	if err != nil {
+		t.Fatalf("StartWindow: %v", err)
+	}
+	if err := l.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := l.Dismiss(t.Context()); err != nil {
+		t.Fatalf("Dismiss: %v", err)
+	}
+
+	calls := loggedCalls(t, log)
+	if len(calls) != 5 {
+		t.Fatalf(
+			"screen was invoked %d times %q, want the launch, lookup, retitle, check and kill",
+			len(calls), calls,
+		)
+	}
+	launch := strings.Fields(calls[0])
+	if len(launch) != 8 || launch[6] == "pinentry" {
+		t.Fatalf("launch ran %q, want the window opened under a tag", calls[0])
+	}
+	tag := launch[6]
+	for i, want := range []string{
+		"/run/screen/S-me -S 1234.main -X screen -t " + tag + " true",
+		"/run/screen/S-me -S 1234.main -p " + tag + " -Q number",
+		"/run/screen/S-me -S 1234.main -p 5 -X title pinentry",
+		"/run/screen/S-me -S 1234.main -p 5 -Q title",
+		"/run/screen/S-me -S 1234.main -X at 5 kill",
+	} {
+		if calls[i] != want {
+			t.Errorf("call %d ran %q, want %q", i, calls[i], want)
+		}
+	}
+}
+
+// A launcher that failed carries its own diagnostics: the command line and
+// whatever screen printed are the only trace a window that never appeared
+// leaves.
+func TestClient_StartWindow_waitReportsTheLauncherFailure(t *testing.T) {
+	path, log := fakeScreen(t, `echo "No screen session found." ; exit 1`)
+	c := New(Options{Path: path})
+
+	l, err := c.StartWindow(t.Context(), WindowRequest{Command: []string{"true"}})
+	if err != nil {
+		t.Fatalf("StartWindow: %v", err)
+	}
+	err = l.Wait()
+	if err == nil || !strings.Contains(err.Error(), "No screen session found.") {
+		t.Errorf("Wait = %v, want screen's own message in it", err)
+	}
+	if calls := loggedCalls(t, log); len(calls) != 1 {
+		t.Errorf("screen was invoked %d times %q, want no lookup after the failure", len(calls), calls)
+	}
+}
+
+// A payload quick enough to close its window before the lookup leaves no
+// number, however screen puts it: the window is done, so the wait succeeds and
+// the dismissal has nothing to kill.
+func TestClient_StartWindow_goneBeforeTheLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+	}{
+		{
+			name: "answered without a number",
+			body: `case "$*" in *"-Q number"*) echo "no such window" ;; esac`,
+		},
+		{
+			name: "failed naming no window",
+			body: `case "$*" in *"-Q number"*)
+  echo "Could not find pre-select window." >&2; exit 1 ;;
+esac`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, log := fakeScreen(t, tc.body)
+			c := New(Options{Path: path})
+
+			l, err := c.StartWindow(t.Context(), WindowRequest{Command: []string{"true"}})
+			if err != nil {
+				t.Fatalf("StartWindow: %v", err)
+			}
+			if err := l.Wait(); err != nil {
+				t.Errorf("Wait = %v, want a window gone to be no failure", err)
+			}
+			if err := l.Dismiss(t.Context()); err != nil {
+				t.Errorf("Dismiss = %v, want a window gone to be dismissed already", err)
+			}
+			if calls := loggedCalls(t, log); len(calls) != 2 {
+				t.Errorf("screen was invoked %d times %q, want no kill attempted",
+					len(calls), calls)
+			}
+		})
+	}
+}
+
+// A window that closed after its lookup has its number free for the next
+// window opened, which the dismissal must leave alone: it kills the number
+// only while it still has the title the launch gave it.
+func TestClient_StartWindow_goneBeforeTheDismissal(t *testing.T) {
+	for _, tc := range []struct {
+		name, answer string
+	}{
+		{
+			name:   "the number went to another window",
+			answer: `echo "vim"`,
+		},
+		{
+			name:   "the number is gone",
+			answer: `echo "Could not find pre-select window." >&2; exit 1`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, log := fakeScreen(t, answerNumber+`
+case "$*" in *"-Q title"*) `+tc.answer+` ;; esac`)
+			c := New(Options{Path: path})
+
+			l, err := c.StartWindow(t.Context(), WindowRequest{
+				Title:   "pinentry",
+				Command: []string{"true"},
+			})
+			if err != nil {
+				t.Fatalf("StartWindow: %v", err)
+			}
+			if err := l.Wait(); err != nil {
+				t.Fatalf("Wait: %v", err)
+			}
+			if err := l.Dismiss(t.Context()); err != nil {
+				t.Errorf("Dismiss = %v, want a window gone to be dismissed already", err)
+			}
+			for _, call := range loggedCalls(t, log) {
+				if strings.Contains(call, " kill") {
+					t.Errorf("screen was asked %q, want no window killed", call)
+				}
+			}
+		})
+	}
+}
+
+// The environment travels over the env FIFO and Wait joins the delivery, so by
+// the time Wait returns the window has read what it will source. The fake runs
+// the real payload under a real sh, as the window would.
+func TestClient_StartWindow_envReachesTheWindow(t *testing.T) {
+	path, _ := fakeScreen(t, answerNumber+`
+case "$*" in *"-X screen"*)
+  shift 4
+  ( "$@" ) >/dev/null 2>&1 &
+  ;;
+esac`)
+	c := New(Options{Path: path})
+	dir := t.TempDir()
+	result := filepath.Join(dir, "result")
+
+	l, err := c.StartWindow(t.Context(), WindowRequest{
+		Env:     map[string]string{"GREETING": "hello window"},
+		WorkDir: dir,
+		Script:  `printf '%s' "$GREETING" > ` + result,
+	})
+	if err != nil {
+		t.Fatalf("StartWindow: %v", err)
+	}
+	if err := l.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// Wait pins the sourcing, not the payload's completion; the write behind the
+	// sourcing gate lands a moment later.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if b, err := os.ReadFile(result); err == nil {
+			if got := string(b); got != "hello window" {
+				t.Errorf("the payload saw GREETING=%q, want %q", got, "hello window")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the payload never wrote its result")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
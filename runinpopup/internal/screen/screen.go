@@ -0,0 +1,221 @@
+// Package screen speaks to GNU screen through the commands "screen -X" sends to
+// a running session: it builds every argv this module sends to it, including
+// the shell wrapping a payload needs when it cannot be run as a bare argv, and
+// the environment FIFO such a payload sources. Callers decide what their popup
+// is; how screen is asked for it lives here.
+package screen
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
+)
+
+// Options are the coordinates of the screen session a Client talks to.
+type Options struct {
+	// Path is the screen executable. Empty means "screen".
+	Path string
+	// Session is the session to send commands to (-S), its $STY
+	// ("pid.tty.host") or any unambiguous part of that. Empty leaves the choice
+	// to screen, which only makes one when a single session is running.
+	Session string
+	// Dir is the $SCREENDIR the session's socket lives in, for a caller whose
+	// own environment points elsewhere. Empty leaves screen's default.
+	Dir string
+	// Shell runs the payloads screen cannot run as a bare argv. Empty means "sh".
+	Shell string
+}
+
+// Client runs screen commands against one session.
+type Client struct {
+	path    string
+	session string
+	shell   string
+	env     []string
+}
+
+// New builds a client.
+func New(opts Options) *Client {
+	c := &Client{
+		path:    cmp.Or(opts.Path, "screen"),
+		session: opts.Session,
+		shell:   cmp.Or(opts.Shell, "sh"),
+	}
+	if opts.Dir != "" {
+		c.env = []string{"SCREENDIR=" + opts.Dir}
+	}
+	return c
+}
+
+// sessionArgs starts an argv addressed to the client's session. -S selects the
+// session for both -X and -Q, and has to come before either.
+func (c *Client) sessionArgs() []string {
+	if c.session == "" {
+		return nil
+	}
+	return []string{"-S", c.session}
+}
+
+// command builds a screen command carrying the client's environment: screen
+// finds sessions by listing $SCREENDIR, so without it a caller whose own
+// environment differs — gpg-agent's children among them — finds none.
+func (c *Client) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	return cmd
+}
+
+// start runs a screen command in the background. Canceling ctx interrupts it,
+// which tears the launcher down; killing the window it opened is Dismiss.
+func (c *Client) start(ctx context.Context, args []string) (*Launcher, error) {
+	l := &Launcher{line: c.path + " " + strings.Join(args, " ")}
+	cmd := c.command(ctx, args)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGINT)
+	}
+	cmd.WaitDelay = launcherWaitDelay
+	cmd.Stdout = &l.stdout
+	cmd.Stderr = &l.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.line, err)
+	}
+	l.cmd = cmd
+	return l, nil
+}
+
+// output executes a screen command and returns what it printed. screen reports
+// a session it could not find on stdout as often as on stderr, so a failure
+// carries both.
+func (c *Client) output(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := c.command(ctx, args)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("%s %s: %w", c.path, strings.Join(args, " "), err)
+		if out := strings.TrimSpace(stdout.String() + stderr.String()); out != "" {
+			err = fmt.Errorf("%w: %s", err, out)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// run executes a screen command for its effect alone.
+func (c *Client) run(ctx context.Context, args ...string) error {
+	_, err := c.output(ctx, args...)
+	return err
+}
+
+// launcherWaitDelay is how long a dismissed launcher has to go away on its own
+// before it is killed. A screen that ignores its interrupt, or that leaves a
+// child holding the pipes its output is read from, would otherwise be waited on
+// forever.
+const launcherWaitDelay = 2 * time.Second
+
+// Launcher is a running "screen -X screen", and the way to kill the window it
+// opened. Its own streams are of no interest to the payload, which draws on the
+// window rather than on this process's terminal.
+type Launcher struct {
+	cmd  *exec.Cmd
+	line string
+	// The launcher's own output is diagnostics, reported only with a failure.
+	// Unlike the other multiplexers' launchers it says nothing of the window it
+	// created; the window's number is asked for separately, into number.
+	stdout, stderr bytes.Buffer
+	// wait is memoized: a process can only be reaped once, while both the caller
+	// waiting on the launcher and a dismissal needing the window's number have
+	// to go through it. It covers the launch and the lookup of the number both,
+	// set by the Start that built the launcher.
+	wait   func() error
+	number string
+	// title is the window's title once its number is known: the one the launch
+	// asked for, else the tag it was opened under. A dismissal checks it before
+	// killing by number, which screen may have reused.
+	title string
+	// env is the delivery of the window's environment, nil for a launch that
+	// carries none. Kept apart from wait: a dismissal waits for the launcher
+	// alone — the window it is killing may be exactly the one that never came
+	// for its environment.
+	env *envfifo.Delivery
+	// close kills the window this launcher opened, set by the Start that built
+	// it.
+	close     func(context.Context) error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Wait waits for the launcher to exit and the new window's number to be known —
+// and, for a launch carrying an environment, for the window to have sourced
+// it: "screen -X" returns the moment the session has the command, and whoever
+// owns the env FIFO's directory must not take it away before the payload has
+// read it. A failure is decorated with the command that produced it and
+// everything it printed, which is the only trace a window that never appeared
+// leaves.
+func (l *Launcher) Wait() error {
+	err := l.wait()
+	if l.env == nil {
+		return err
+	}
+	if err != nil {
+		// The launch failed, so no window is coming for the environment; the
+		// delivery is ended rather than sat out, and the launch's error is the
+		// one that explains it.
+		l.env.Cancel()
+	}
+	if derr := l.env.Wait(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+func (l *Launcher) reap() error {
+	err := l.cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %w", l.line, err)
+	if out := strings.TrimSpace(l.stdout.String() + l.stderr.String()); out != "" {
+		err = fmt.Errorf("%w: %s", err, out)
+	}
+	return err
+}
+
+// Dismiss kills the window this launcher opened, once per launcher: the kill is
+// the window's end, and a second one could only be told it is already gone.
+func (l *Launcher) Dismiss(ctx context.Context) error {
+	l.closeOnce.Do(func() { l.closeErr = l.close(ctx) })
+	return l.closeErr
+}
+
+// waitBounded waits for the launcher to exit and the window's number to be
+// looked up, giving up when ctx does. Only the bound is reported: whether the
+// lookup found a number is the dismissal's to check. The env delivery is
+// deliberately not joined, for the reason Launcher.env gives.
+//
+// The goroutine outlives a bound that ran out, and has to: a wait cannot be
+// taken back, and this one ends when the launcher does.
+func (l *Launcher) waitBounded(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = l.wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,238 @@
+package screen
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// WindowRequest is a "screen -X screen" invocation. screen has no floating
+// layer, so a new window — taking over the display until the payload exits and
+// screen switches back — is as close to a popup as it comes.
+type WindowRequest struct {
+	// Title is the title the window ends up with. Empty leaves the tag the
+	// window was opened under.
+	Title string
+	// Env is the window's environment. "screen -X screen" has no environment
+	// flag of its own — "setenv" would leak into every later window of the
+	// session — so the values travel over an env FIFO in WorkDir that the
+	// payload sources before it runs; only the FIFO's path is on the command
+	// line.
+	Env map[string]string
+	// WorkDir is the launch's work directory, holding the env FIFO. Required
+	// when Env is set; the caller checks, since it is the caller that knows
+	// whether a launch has one.
+	WorkDir string
+	// StartupTimeout bounds the env delivery rendezvous — how long the window
+	// has to open its end of the FIFO. Zero means 30s.
+	StartupTimeout time.Duration
+	// Command is the argv the window runs.
+	Command []string
+	// Script is a raw shell command line taking precedence over Command.
+	Script string
+}
+
+// errNoWindow is what a lookup reports when screen answered without a number:
+// the tag matched no window, or -S matched no session or more than one.
+var errNoWindow = errors.New("screen named no window")
+
+// noWindowMessage is what screen says when -p names no window, on stdout or
+// stderr and whichever its exit status: the window has closed, which for a
+// window a launch opened means its payload is done.
+const noWindowMessage = "Could not find pre-select window"
+
+// tagSeq numbers the tags of this process's windows.
+var tagSeq atomic.Uint64
+
+// newTag names a window uniquely for as long as it takes to look its number up.
+// "screen -X" prints nothing back, so the only way to find the window a launch
+// created is to ask for it by a title nothing else in the session has.
+//
+// A number outlives its window: screen hands it to the next window opened. So
+// the dismissal asks the number's title first, and kills it only while it is
+// still the one this launch gave it; see Client.killWindow.
+func newTag() string {
+	return fmt.Sprintf("run-in-popup-%d-%d", os.Getpid(), tagSeq.Add(1))
+}
+
+// NewWindowCommand builds "screen [-S <session>] -X screen -t <tag> <payload>".
+// The window opens under tag rather than the request's title; see newTag.
+func (c *Client) NewWindowCommand(req WindowRequest, tag string) (path string, args []string) {
+	args = append(c.sessionArgs(), "-X", "screen", "-t", tag)
+	return c.path, append(args, c.payload(req)...)
+}
+
+// NumberCommand builds "screen [-S <session>] -p <tag> -Q number", which prints
+// the number of the window titled tag as "<n> (<title>)".
+func (c *Client) NumberCommand(tag string) (path string, args []string) {
+	return c.path, append(c.sessionArgs(), "-p", tag, "-Q", "number")
+}
+
+// TitleCommand builds "screen [-S <session>] -p <n> -X title <title>".
+func (c *Client) TitleCommand(number, title string) (path string, args []string) {
+	return c.path, append(c.sessionArgs(), "-p", number, "-X", "title", title)
+}
+
+// TitleQueryCommand builds "screen [-S <session>] -p <n> -Q title", which
+// prints the title of window n.
+func (c *Client) TitleQueryCommand(number string) (path string, args []string) {
+	return c.path, append(c.sessionArgs(), "-p", number, "-Q", "title")
+}
+
+// StartWindow runs NewWindowCommand's argv. Its launcher's Wait goes on to look
+// the new window's number up by its tag, then gives it the requested title, so
+// a window whose number is known is all a dismissal ever deals with. A payload
+// quick enough to have closed its window before the lookup leaves no number,
+// and nothing to dismiss: that is a window done, not a launch failed.
+func (c *Client) StartWindow(ctx context.Context, req WindowRequest) (*Launcher, error) {
+	if len(req.Env) > 0 {
+		if err := envfifo.Create(req.WorkDir); err != nil {
+			return nil, err
+		}
+	}
+	tag := newTag()
+	_, args := c.NewWindowCommand(req, tag)
+	l, err := c.start(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	l.wait = sync.OnceValue(func() error {
+		if err := l.reap(); err != nil {
+			return err
+		}
+		number, err := c.windowNumber(ctx, tag)
+		if errors.Is(err, errNoWindow) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l.number, l.title = number, cmp.Or(req.Title, tag)
+		if req.Title == "" {
+			return nil
+		}
+		_, args := c.TitleCommand(number, req.Title)
+		return c.run(ctx, args...)
+	})
+	if len(req.Env) > 0 {
+		l.env = envfifo.Deliver(ctx, envfifo.Path(req.WorkDir), envfifo.Script(req.Env),
+			cmp.Or(req.StartupTimeout, envfifo.DefaultTimeout))
+	}
+	l.close = func(ctx context.Context) error { return c.killWindow(ctx, l) }
+	return l, nil
+}
+
+// windowNumber asks screen for the number of the window titled tag.
+func (c *Client) windowNumber(ctx context.Context, tag string) (string, error) {
+	_, args := c.NumberCommand(tag)
+	out, err := c.output(ctx, args...)
+	if err != nil {
+		if strings.Contains(err.Error(), noWindowMessage) {
+			return "", fmt.Errorf("%w: %w", errNoWindow, err)
+		}
+		return "", err
+	}
+	number, ok := parseWindowNumber(out)
+	if !ok {
+		return "", fmt.Errorf(
+			"%s %s: %w: %q", c.path, strings.Join(args, " "), errNoWindow, strings.TrimSpace(out),
+		)
+	}
+	return number, nil
+}
+
+// parseWindowNumber picks the window number out of what "-Q number" printed:
+// the number, then the window's title in parentheses. Anything else — screen's
+// messages come back on the same stream — names no window.
+func parseWindowNumber(out string) (string, bool) {
+	number, _, _ := strings.Cut(strings.TrimSpace(out), " ")
+	notDigit := func(r rune) bool { return r < '0' || r > '9' }
+	if number == "" || strings.ContainsFunc(number, notDigit) {
+		return "", false
+	}
+	return number, true
+}
+
+// windowTitle asks screen for the title of window number, errNoWindow when
+// there is no such window.
+func (c *Client) windowTitle(ctx context.Context, number string) (string, error) {
+	_, args := c.TitleQueryCommand(number)
+	out, err := c.output(ctx, args...)
+	switch {
+	case err != nil && strings.Contains(err.Error(), noWindowMessage):
+		return "", fmt.Errorf("%w: %w", errNoWindow, err)
+	case err != nil:
+		return "", err
+	case strings.Contains(out, noWindowMessage):
+		return "", fmt.Errorf("%w: %q", errNoWindow, strings.TrimSpace(out))
+	}
+	return strings.TrimSuffix(out, "\n"), nil
+}
+
+// killWindow kills the window the launcher created, once its number is known:
+// the launcher is waited on first, since the number is what that wait looks up.
+//
+// A window already gone is dismissed already. One whose payload closed it
+// before its number was looked up left none; one that closed since has its
+// number gone or handed to a window opened after it, which the title tells
+// apart from this launch's own and which is left alone. Only a window another
+// launch opened under the very same title passes for this one.
+func (c *Client) killWindow(ctx context.Context, l *Launcher) error {
+	if err := l.waitBounded(ctx); err != nil {
+		return fmt.Errorf("%s: waiting for the new window's number: %w", l.line, err)
+	}
+	if l.number == "" {
+		if err := l.wait(); err != nil {
+			return fmt.Errorf("%s: no window to kill: %w", l.line, err)
+		}
+		return nil
+	}
+	title, err := c.windowTitle(ctx, l.number)
+	if errors.Is(err, errNoWindow) || (err == nil && title != l.title) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.KillWindow(ctx, l.number)
+}
+
+// KillWindowCommand builds "screen [-S <session>] -X at <n> kill". "at" runs
+// the command in the window it names without switching the display to it.
+func (c *Client) KillWindowCommand(number string) (path string, args []string) {
+	return c.path, append(c.sessionArgs(), "-X", "at", number, "kill")
+}
+
+// KillWindow kills the window a StartWindow created, taking whatever runs in it
+// along.
+func (c *Client) KillWindow(ctx context.Context, number string) error {
+	_, args := c.KillWindowCommand(number)
+	return c.run(ctx, args...)
+}
+
+// payload renders what the window executes. screen runs an argv directly, so a
+// script payload — or an environment, which only a shell can read in — is
+// wrapped in a shell.
+func (c *Client) payload(req WindowRequest) []string {
+	if req.Script == "" && len(req.Env) == 0 {
+		return slices.Clone(req.Command)
+	}
+	line := req.Script
+	if line == "" {
+		line = shellargv.Join(req.Command)
+	}
+	if len(req.Env) > 0 {
+		line = envfifo.Gate(req.WorkDir, line)
+	}
+	return []string{c.shell, "-c", line}
+}
@@ -0,0 +1,107 @@
+package screen
+
+import (
+	"slices"
+	"testing"
+)
+
+func testClient() *Client {
+	return New(Options{Path: "/usr/bin/screen", Session: "1234.pts-0.host", Shell: "/bin/bash"})
+}
+
+func assertCommand(
+	t *testing.T,
+	gotPath string,
+	gotArgs []string,
+	wantPath string,
+	wantArgs []string,
+) {
+	t.Helper()
+	if gotPath != wantPath {
+		t.Errorf("path = %q, want %q", gotPath, wantPath)
+	}
+	if !slices.Equal(gotArgs, wantArgs) {
+		t.Errorf("args =\n\t%#v\nwant\n\t%#v", gotArgs, wantArgs)
+	}
+}
+
+func TestClient_NewWindowCommand_argvRunsDirectly(t *testing.T) {
+	path, args := testClient().NewWindowCommand(WindowRequest{
+		Title:   "ignored here",
+		Command: []string{"vim", "my file.txt"},
+	}, "tag-1")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.pts-0.host", "-X", "screen", "-t", "tag-1", "vim", "my file.txt",
+	})
+}
+
+// The environment reaches the window by being sourced: the argv names the env
+// FIFO and nothing of what will travel over it.
+func TestClient_NewWindowCommand_envIsSourced(t *testing.T) {
+	path, args := New(Options{Shell: "/bin/bash"}).NewWindowCommand(WindowRequest{
+		Env:     map[string]string{"KEY": "value"},
+		WorkDir: "/tmp/popup",
+		Script:  "make test; echo done",
+	}, "tag-1")
+	assertCommand(t, path, args, "screen", []string{
+		"-X", "screen", "-t", "tag-1",
+		"/bin/bash", "-c", ". '/tmp/popup/env' && { make test; echo done\n}",
+	})
+}
+
+func TestClient_NumberCommand(t *testing.T) {
+	path, args := testClient().NumberCommand("tag-1")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.pts-0.host", "-p", "tag-1", "-Q", "number",
+	})
+}
+
+func TestClient_TitleQueryCommand(t *testing.T) {
+	path, args := testClient().TitleQueryCommand("3")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.pts-0.host", "-p", "3", "-Q", "title",
+	})
+}
+
+func TestClient_TitleCommand(t *testing.T) {
+	path, args := testClient().TitleCommand("3", "pinentry")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.pts-0.host", "-p", "3", "-X", "title", "pinentry",
+	})
+}
+
+func TestClient_KillWindowCommand(t *testing.T) {
+	path, args := testClient().KillWindowCommand("3")
+	assertCommand(t, path, args, "/usr/bin/screen", []string{
+		"-S", "1234.pts-0.host", "-X", "at", "3", "kill",
+	})
+}
+
+// Two launches of one process never share a tag: the tag is what finds the
+// window again, and a shared one could find the other launch's.
+func TestNewTag_unique(t *testing.T) {
+	if a, b := newTag(), newTag(); a == b {
+		t.Errorf("newTag returned %q twice", a)
+	}
+}
+
+func TestParseWindowNumber(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want string
+	}{
+		{name: "number and title", out: "3 (run-in-popup-1-1)\n", want: "3"},
+		{name: "a title with spaces", out: "12 (my window)", want: "12"},
+		{name: "the number alone", out: "0\n", want: "0"},
+		{name: "nothing printed", out: ""},
+		{name: "a message instead", out: "No screen session found.\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseWindowNumber(tc.out)
+			if ok != (tc.want != "") || got != tc.want {
+				t.Errorf("parseWindowNumber(%q) = %q, %t; want %q", tc.out, got, ok, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClientsFormat is what list-clients is asked to print per client, tab-separated
+// so no field can run into the next: a session name may hold spaces and colons,
+// never a tab tmux would print as is.
+const ClientsFormat = "#{client_name}\t#{client_tty}\t#{session_id}\t#{session_name}" +
+	"\t#{client_activity}"
+
+// ClientInfo is one client attached to the server, as list-clients reports it.
+type ClientInfo struct {
+	// Name is the client's name, which is its tty unless it was given another.
+	Name string
+	// TTY is the terminal the client runs on.
+	TTY string
+	// SessionId and SessionName are the session the client is attached to, the
+	// id in tmux's own "$1" form.
+	SessionId, SessionName string
+	// Activity is when the client last received input, in Unix seconds.
+	Activity int64
+}
+
+// Is reports whether id names this client: display-popup -c takes the name or
+// the tty, and PINENTRY_USER_DATA records whichever #{client_name} printed when
+// the wrapper ran.
+func (i ClientInfo) Is(id string) bool {
+	return id != "" && (i.Name == id || i.TTY == id)
+}
+
+// InSession reports whether the client is attached to the session id names,
+// by id or by name, as -t would resolve it.
+func (i ClientInfo) InSession(id string) bool {
+	return id != "" && (i.SessionId == id || i.SessionName == id)
+}
+
+// ListClients lists the clients attached to the server. A server with none
+// attached lists nothing, which is not an error; no server at all is.
+func (c *Client) ListClients(ctx context.Context) ([]ClientInfo, error) {
+	out, err := c.run(ctx, "list-clients", "-F", ClientsFormat)
+	if err != nil {
+		return nil, fmt.Errorf("listing the clients: %w", err)
+	}
+	return parseClients(out)
+}
+
+// CurrentClient is the client the caller runs under, as display-message
+// resolves it from $TMUX: the one a shell inside tmux is typing at.
+func (c *Client) CurrentClient(ctx context.Context) (ClientInfo, error) {
+	out, err := c.run(ctx, "display-message", "-p", ClientsFormat)
+	if err != nil {
+		return ClientInfo{}, fmt.Errorf("querying the current client: %w", err)
+	}
+	clients, err := parseClients(out)
+	if err != nil {
+		return ClientInfo{}, err
+	}
+	if len(clients) != 1 {
+		return ClientInfo{}, fmt.Errorf("querying the current client: unexpected output %q", out)
+	}
+	return clients[0], nil
+}
+
+// ClientSizeFormat is the client's terminal size, which display-popup takes a
+// percentage of.
+const ClientSizeFormat = "#{client_width}\t#{client_height}"
+
+// ClientSize reports the size, in cells, of the terminal clientId runs on; an
+// empty clientId asks for the current client, as display-popup with no -c
+// would resolve it.
+func (c *Client) ClientSize(ctx context.Context, clientId string) (width, height int, err error) {
+	args := []string{"display-message", "-p"}
+	if clientId != "" {
+		args = append(args, "-c", clientId)
+	}
+	return c.size(ctx, "the client's size", append(args, ClientSizeFormat)...)
+}
+
+// WindowSizeFormat is the size of a session's current window, which a floating
+// pane is placed in and takes a percentage of.
+const WindowSizeFormat = "#{window_width}\t#{window_height}"
+
+// WindowSize reports the size, in cells, of the targeted session's current
+// window.
+func (c *Client) WindowSize(ctx context.Context, sessionId string) (width, height int, err error) {
+	args := append(targeted(sessionId, "display-message", "-p"), WindowSizeFormat)
+	return c.size(ctx, "the window's size", args...)
+}
+
+// size runs a query printing a width and a height, tab-separated, which what
+// names in the error.
+func (c *Client) size(
+	ctx context.Context,
+	what string,
+	args ...string,
+) (width, height int, err error) {
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("querying %s: %w", what, err)
+	}
+	w, h, ok := strings.Cut(strings.TrimSpace(out), "\t")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("querying %s: unexpected output %q", what, out)
+	}
+	return width, height, nil
+}
+
+func parseClients(out string) ([]ClientInfo, error) {
+	var clients []ClientInfo
+	for line := range strings.Lines(out) {
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("listing the clients: unexpected output %q", line)
+		}
+		// A tmux too old to know the format prints it empty, which is as good as
+		// no activity on record.
+		var activity int64
+		if fields[4] != "" {
+			var err error
+			if activity, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+				return nil, fmt.Errorf("listing the clients: unexpected activity in %q", line)
+			}
+		}
+		clients = append(clients, ClientInfo{
+			Name:        fields[0],
+			TTY:         fields[1],
+			SessionId:   fields[2],
+			SessionName: fields[3],
+			Activity:    activity,
+		})
+	}
+	return clients, nil
+}
+
+// MostRecentClient is the client in clients that received input last, of those
+// keep accepts; nil keep accepts all. ok is false when none is left.
+func MostRecentClient(clients []ClientInfo, keep func(ClientInfo) bool) (ClientInfo, bool) {
+	var (
+		recent ClientInfo
+		found  bool
+	)
+	for _, client := range clients {
+		if keep != nil && !keep(client) {
+			continue
+		}
+		if !found || client.Activity > recent.Activity {
+			recent, found = client, true
+		}
+	}
+	return recent, found
+}
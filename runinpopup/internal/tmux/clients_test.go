@@ -0,0 +1,162 @@
+package tmux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_ListClients(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		out     string
+		want    []ClientInfo
+		wantErr bool
+	}{
+		{name: "nobody attached", out: ""},
+		{
+			name: "two clients",
+			out: `/dev/pts/3\t/dev/pts/3\t$1\tmy work\t1700000000\n` +
+				`laptop\t/dev/pts/5\t$2\tplay\t1700000300\n`,
+			want: []ClientInfo{
+				{
+					Name:        "/dev/pts/3",
+					TTY:         "/dev/pts/3",
+					SessionId:   "$1",
+					SessionName: "my work",
+					Activity:    1700000000,
+				},
+				{
+					Name:        "laptop",
+					TTY:         "/dev/pts/5",
+					SessionId:   "$2",
+					SessionName: "play",
+					Activity:    1700000300,
+				},
+			},
+		},
+		{
+			name: "no activity on record",
+			out:  `/dev/pts/3\t/dev/pts/3\t$1\twork\t\n`,
+			want: []ClientInfo{
+				{Name: "/dev/pts/3", TTY: "/dev/pts/3", SessionId: "$1", SessionName: "work"},
+			},
+		},
+		{name: "too few fields", out: `/dev/pts/3\t$1\n`, wantErr: true},
+		{
+			name:    "activity that is no time",
+			out:     `/dev/pts/3\t/dev/pts/3\t$1\twork\tsoon\n`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testClient(t, Options{
+				Path: fakeTmux(t, `printf '`+tc.out+`'`),
+				TMUX: "/tmp/tmux-1000/default,1,0",
+			})
+			got, err := c.ListClients(t.Context())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ListClients = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListClients: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ListClients = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMostRecentClient(t *testing.T) {
+	clients := []ClientInfo{
+		{Name: "a", SessionId: "$1", Activity: 100},
+		{Name: "b", SessionId: "$1", Activity: 300},
+		{Name: "c", SessionId: "$2", Activity: 900},
+	}
+	if got, ok := MostRecentClient(clients, nil); !ok || got.Name != "c" {
+		t.Errorf("MostRecentClient = %+v, %v, want c", got, ok)
+	}
+	inFirst := func(c ClientInfo) bool { return c.InSession("$1") }
+	if got, ok := MostRecentClient(clients, inFirst); !ok || got.Name != "b" {
+		t.Errorf("MostRecentClient in $1 = %+v, %v, want b", got, ok)
+	}
+	if got, ok := MostRecentClient(nil, nil); ok {
+		t.Errorf("MostRecentClient of nobody = %+v, want none", got)
+	}
+}
+
+func TestClient_CurrentClient(t *testing.T) {
+	c := testClient(t, Options{
+		Path: fakeTmux(t, `[ "$1" = display-message ] &&`+
+			` printf '/dev/pts/3\t/dev/pts/3\t$1\twork\t100\n'`),
+		TMUX: "/tmp/tmux-1000/default,1,0",
+	})
+	got, err := c.CurrentClient(t.Context())
+	if err != nil {
+		t.Fatalf("CurrentClient: %v", err)
+	}
+	want := ClientInfo{
+		Name: "/dev/pts/3", TTY: "/dev/pts/3", SessionId: "$1", SessionName: "work", Activity: 100,
+	}
+	if got != want {
+		t.Errorf("CurrentClient = %+v, want %+v", got, want)
+	}
+
+	outside := testClient(t, Options{Path: fakeTmux(t, `true`), TMUX: "/tmp/tmux-1000/default,1,0"})
+	if got, err := outside.CurrentClient(t.Context()); err == nil {
+		t.Errorf("CurrentClient = %+v, want an error when tmux names no client", got)
+	}
+}
+
+func TestClient_ClientSize(t *testing.T) {
+	path, log := fakeTmuxLogged(t, `printf '212\t51\n'`)
+	c := testClient(t, Options{Path: path, TMUX: "/tmp/tmux-1000/default,1,0"})
+
+	for _, clientId := range []string{"/dev/pts/3", ""} {
+		width, height, err := c.ClientSize(t.Context(), clientId)
+		if err != nil {
+			t.Fatalf("ClientSize(%q): %v", clientId, err)
+		}
+		if width != 212 || height != 51 {
+			t.Errorf("ClientSize(%q) = %dx%d, want 212x51", clientId, width, height)
+		}
+	}
+	want := []string{
+		"display-message -p -c /dev/pts/3 " + ClientSizeFormat,
+		// No client named is the current one, which tmux resolves itself.
+		"display-message -p " + ClientSizeFormat,
+	}
+	if got := loggedCalls(t, log); !reflect.DeepEqual(got, want) {
+		t.Errorf("tmux was invoked %q, want %q", got, want)
+	}
+
+	for _, out := range []string{`''`, `'212\n'`, `'wide\ttall\n'`, `'0\t0\n'`} {
+		c := testClient(t, Options{
+			Path: fakeTmux(t, `printf `+out),
+			TMUX: "/tmp/tmux-1000/default,1,0",
+		})
+		if w, h, err := c.ClientSize(t.Context(), ""); err == nil {
+			t.Errorf("ClientSize of %s = %dx%d, want an error", out, w, h)
+		}
+	}
+}
+
+func TestClient_WindowSize(t *testing.T) {
+	path, log := fakeTmuxLogged(t, `printf '180\t44\n'`)
+	c := testClient(t, Options{Path: path, TMUX: "/tmp/tmux-1000/default,1,0"})
+
+	width, height, err := c.WindowSize(t.Context(), "$1")
+	if err != nil {
+		t.Fatalf("WindowSize: %v", err)
+	}
+	if width != 180 || height != 44 {
+		t.Errorf("WindowSize = %dx%d, want 180x44", width, height)
+	}
+	want := []string{"display-message -p -t $1 " + WindowSizeFormat}
+	if got := loggedCalls(t, log); !reflect.DeepEqual(got, want) {
+		t.Errorf("tmux was invoked %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package wezterm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWezterm writes an executable standing in for wezterm, running body under
+// /bin/sh with the wezterm argv, and returns its path. Every invocation appends
+// its argv — and the socket it was pointed at — to log first, so a test can
+// assert what wezterm was asked.
+func fakeWezterm(t *testing.T, body string) (path, log string) {
+	t.Helper()
+	dir := t.TempDir()
+	log = filepath.Join(dir, "log")
+	path = filepath.Join(dir, "wezterm")
+	script := "#!/bin/sh\necho \"${WEZTERM_UNIX_SOCKET:-} $*\" >> " + log + "\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake wezterm: %v", err)
+	}
+	return path, log
+}
+
+func loggedCalls(t *testing.T, log string) []string {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("reading the fake wezterm's log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+// The full round trip of a split: the launcher exits the moment the pane
+// exists, and the dismissal kills the pane by the id the launcher printed — on
+// the multiplexer the client was pointed at, both times.
+func TestClient_StartSplitPane_lifecycle(t *testing.T) {
+	path, log := fakeWezterm(t, `case "$*" in *kill-pane*) : ;; *) echo 7 ;; esac`)
+	c := New(Options{Path: path, Socket: "/run/wez/sock"})
+
+	l, err := c.StartSplitPane(t.Context(), SplitRequest{
+		PaneId:  "3",
+		Payload: Payload{Command: []string{"true"}},
+	})
+	if err != nil {
+		t.Fatalf("StartSplitPane: %v", err)
+	}
+	if err := l.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := l.Dismiss(t.Context()); err != nil {
+		t.Fatalf("Dismiss: %v", err)
+	}
+
+	calls := loggedCalls(t, log)
+	if len(calls) != 2 {
+		t.Fatalf("wezterm was invoked %d times %q, want the split and the kill", len(calls), calls)
+	}
+	if want := "/run/wez/sock cli split-pane --pane-id 3 --bottom -- true"; calls[0] != want {
+		t.Errorf("launch ran %q, want %q", calls[0], want)
+	}
+	if want := "/run/wez/sock cli kill-pane --pane-id 7"; calls[1] != want {
+		t.Errorf("dismissal ran %q, want %q", calls[1], want)
+	}
+}
+
+// A launcher that failed carries its own diagnostics: the command line and
+// whatever wezterm printed are the only trace a pane that never appeared leaves.
+func TestClient_StartSplitPane_waitReportsTheLauncherFailure(t *testing.T) {
+	path, _ := fakeWezterm(t, `echo "pane 3 not found" >&2; exit 1`)
+	c := New(Options{Path: path})
+
+	l, err := c.StartSplitPane(t.Context(), SplitRequest{
+		PaneId:  "3",
+		Payload: Payload{Command: []string{"true"}},
+	})
+	if err != nil {
+		t.Fatalf("StartSplitPane: %v", err)
+	}
+	err = l.Wait()
+	if err == nil || !strings.Contains(err.Error(), "pane 3 not found") {
+		t.Errorf("Wait = %v, want wezterm's own message in it", err)
+	}
+}
+
+// The environment travels over the env FIFO and Wait joins the delivery, so by
+// the time Wait returns the pane has read what it will source. The fake runs the
+// real payload under a real sh, as the pane would.
+func TestClient_StartSpawn_envReachesThePane(t *testing.T) {
+	path, _ := fakeWezterm(t, `while [ "$1" != "--" ]; do shift; done; shift
+( "$@" ) >/dev/null 2>&1 &
+echo 4`)
+	c := New(Options{Path: path})
+	dir := t.TempDir()
+	result := filepath.Join(dir, "result")
+
+	l, err := c.StartSpawn(t.Context(), Payload{
+		Env:     map[string]string{"GREETING": "hello pane"},
+		WorkDir: dir,
+		Script:  `printf '%s' "$GREETING" > ` + result,
+	})
+	if err != nil {
+		t.Fatalf("StartSpawn: %v", err)
+	}
+	if err := l.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// Wait pins the sourcing, not the payload's completion; the write behind the
+	// sourcing gate lands a moment later.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if b, err := os.ReadFile(result); err == nil {
+			if got := string(b); got != "hello pane" {
+				t.Errorf("the payload saw GREETING=%q, want %q", got, "hello pane")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the payload never wrote its result")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Output without a pane id is a launcher that never got as far as creating a
+// pane, and a dismissal must say so instead of guessing at a pane to kill.
+func TestClient_StartSplitPane_dismissalWithoutAPaneId(t *testing.T) {
+	path, log := fakeWezterm(t, `echo "created a pane"`)
+	c := New(Options{Path: path})
+
+	l, err := c.StartSplitPane(t.Context(), SplitRequest{
+		Payload: Payload{Command: []string{"true"}},
+	})
+	if err != nil {
+		t.Fatalf("StartSplitPane: %v", err)
+	}
+	err = l.Dismiss(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "no pane id to kill") {
+		t.Errorf("Dismiss = %v, want the missing pane id reported", err)
+	}
+	if calls := loggedCalls(t, log); len(calls) != 1 {
+		t.Errorf("wezterm was invoked %d times %q, want no kill attempted", len(calls), calls)
+	}
+}
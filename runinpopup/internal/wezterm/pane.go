@@ -0,0 +1,179 @@
+package wezterm
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// Payload is what a new pane runs, and the environment it runs with. It is the
+// same for both operations that open a pane, which differ only in where.
+type Payload struct {
+	// Env is the pane's environment. "wezterm cli" has no environment flag of its
+	// own, so the values travel over an env FIFO in WorkDir that the payload
+	// sources before it runs; only the FIFO's path is on the command line.
+	Env map[string]string
+	// WorkDir is the launch's work directory, holding the env FIFO. Required
+	// when Env is set; the caller checks, since it is the caller that knows
+	// whether a launch has one.
+	WorkDir string
+	// StartupTimeout bounds the env delivery rendezvous — how long the pane has
+	// to open its end of the FIFO. Zero means 30s.
+	StartupTimeout time.Duration
+	// Command is the argv the pane runs.
+	Command []string
+	// Script is a raw shell command line taking precedence over Command.
+	Script string
+}
+
+// Side is where a split puts the new pane, relative to the pane it splits.
+type Side string
+
+// The sides a split is asked for. They are the flags' own names, so a Side is
+// rendered by prefixing it with "--".
+const (
+	SideBottom Side = "bottom"
+	SideRight  Side = "right"
+)
+
+// SplitRequest is a "wezterm cli split-pane" invocation: the new pane takes a
+// slice of an existing one, which is as close to a popup as WezTerm comes —
+// it has no floating panes, and a split keeps the pane the user was looking at
+// in view beside it.
+type SplitRequest struct {
+	// PaneId is the pane to split (--pane-id). Empty lets wezterm take
+	// $WEZTERM_PANE, which only a caller inside WezTerm has.
+	PaneId string
+	// Side is where the new pane goes. Empty means SideBottom, which is also
+	// wezterm's own default.
+	Side Side
+	// Size is how much of the split pane the new one takes along Side's axis: a
+	// bare number of cells (--cells) or a percentage (--percent). Empty leaves
+	// wezterm's half.
+	Size string
+	Payload
+}
+
+// SplitPaneCommand builds "wezterm cli split-pane [--pane-id <id>] --<side>
+// [--cells <n>|--percent <n>] -- <payload>".
+func (c *Client) SplitPaneCommand(req SplitRequest) (path string, args []string) {
+	args = []string{"cli", "split-pane"}
+	if req.PaneId != "" {
+		args = append(args, "--pane-id", req.PaneId)
+	}
+	args = append(args, "--"+string(cmp.Or(req.Side, SideBottom)))
+	if n, ok := strings.CutSuffix(req.Size, "%"); ok {
+		args = append(args, "--percent", n)
+	} else if req.Size != "" {
+		args = append(args, "--cells", req.Size)
+	}
+	args = append(args, "--")
+	return c.path, append(args, c.payload(req.Payload)...)
+}
+
+// SpawnCommand builds "wezterm cli spawn --new-window -- <payload>". A new
+// window is the one place a pane can open without an existing pane to anchor
+// it, which is what a caller that knows of none — a daemon started outside
+// WezTerm — is left with.
+func (c *Client) SpawnCommand(p Payload) (path string, args []string) {
+	args = []string{"cli", "spawn", "--new-window", "--"}
+	return c.path, append(args, c.payload(p)...)
+}
+
+// StartSplitPane runs SplitPaneCommand's argv. "wezterm cli split-pane" returns
+// as soon as the pane exists, so its launcher says nothing about the payload
+// still running in it — except when the request carries an environment, whose
+// delivery the launcher's Wait then joins.
+func (c *Client) StartSplitPane(ctx context.Context, req SplitRequest) (*Launcher, error) {
+	_, args := c.SplitPaneCommand(req)
+	return c.startPane(ctx, args, req.Payload)
+}
+
+// StartSpawn runs SpawnCommand's argv, with the same launcher semantics as
+// StartSplitPane.
+func (c *Client) StartSpawn(ctx context.Context, p Payload) (*Launcher, error) {
+	_, args := c.SpawnCommand(p)
+	return c.startPane(ctx, args, p)
+}
+
+func (c *Client) startPane(ctx context.Context, args []string, p Payload) (*Launcher, error) {
+	if len(p.Env) > 0 {
+		if err := envfifo.Create(p.WorkDir); err != nil {
+			return nil, err
+		}
+	}
+	l, err := c.start(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Env) > 0 {
+		l.env = envfifo.Deliver(ctx, envfifo.Path(p.WorkDir), envfifo.Script(p.Env),
+			cmp.Or(p.StartupTimeout, envfifo.DefaultTimeout))
+	}
+	l.close = func(ctx context.Context) error { return c.killPane(ctx, l) }
+	return l, nil
+}
+
+// killPane kills the pane the launcher created. The id it is named by is on the
+// launcher's own stdout, so the launcher is waited on first — reading that
+// buffer beside a wezterm still writing it is the race this waits out.
+func (c *Client) killPane(ctx context.Context, l *Launcher) error {
+	if err := l.waitBounded(ctx); err != nil {
+		return fmt.Errorf("%s: waiting for the new pane's id: %w", l.line, err)
+	}
+	paneId, ok := parsePaneId(l.stdout.String())
+	if !ok {
+		return fmt.Errorf(
+			"%s: no pane id to kill, the launcher printed %q",
+			l.line, strings.TrimSpace(l.stdout.String()+l.stderr.String()),
+		)
+	}
+	return c.KillPane(ctx, paneId)
+}
+
+// parsePaneId picks the pane id out of what "split-pane" or "spawn" printed:
+// both print the new pane's id, a bare number, on a line of its own. Anything
+// else is a launcher that never got as far as creating a pane.
+func parsePaneId(out string) (string, bool) {
+	id := strings.TrimSpace(out)
+	if id == "" || strings.ContainsFunc(id, func(r rune) bool { return r < '0' || r > '9' }) {
+		return "", false
+	}
+	return id, true
+}
+
+// KillPaneCommand builds "wezterm cli kill-pane --pane-id <id>". A pane id is
+// unique across the whole multiplexer, so it needs nothing beside it.
+func (c *Client) KillPaneCommand(paneId string) (path string, args []string) {
+	return c.path, []string{"cli", "kill-pane", "--pane-id", paneId}
+}
+
+// KillPane kills the pane a matching Start created, taking whatever runs in it
+// along.
+func (c *Client) KillPane(ctx context.Context, paneId string) error {
+	_, args := c.KillPaneCommand(paneId)
+	return c.run(ctx, args...)
+}
+
+// payload renders what the pane executes. wezterm runs an argv directly, so a
+// script payload — or an environment, which only a shell can read in — is
+// wrapped in a shell.
+func (c *Client) payload(p Payload) []string {
+	if p.Script == "" && len(p.Env) == 0 {
+		return slices.Clone(p.Command)
+	}
+	line := p.Script
+	if line == "" {
+		line = shellargv.Join(p.Command)
+	}
+	if len(p.Env) > 0 {
+		line = envfifo.Gate(p.WorkDir, line)
+	}
+	return []string{c.shell, "-c", line}
+}
@@ -0,0 +1,197 @@
+// Package wezterm speaks to the wezterm executable's "cli" subcommand, the way
+// into the multiplexer built into WezTerm: it builds every argv this module
+// sends to it, including the shell wrapping a payload needs when it cannot be
+// run as a bare argv, and the environment FIFO such a payload sources. Callers
+// decide which wezterm operation expresses their popup; how wezterm is asked
+// for it lives here.
+package wezterm
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
+)
+
+// Options are the coordinates of the wezterm multiplexer a Client talks to.
+type Options struct {
+	// Path is the wezterm executable. Empty means "wezterm".
+	Path string
+	// Socket is the multiplexer's $WEZTERM_UNIX_SOCKET, for callers that are not
+	// running inside WezTerm themselves. Empty leaves the discovery to wezterm,
+	// which finds the running GUI on its own in the common case.
+	Socket string
+	// Shell runs the payloads wezterm cannot run as a bare argv. Empty means
+	// "sh".
+	Shell string
+}
+
+// Client runs wezterm cli commands against one multiplexer.
+type Client struct {
+	path  string
+	shell string
+	env   []string
+}
+
+// New builds a client.
+func New(opts Options) *Client {
+	c := &Client{
+		path:  cmp.Or(opts.Path, "wezterm"),
+		shell: cmp.Or(opts.Shell, "sh"),
+	}
+	if opts.Socket != "" {
+		c.env = []string{"WEZTERM_UNIX_SOCKET=" + opts.Socket}
+	}
+	return c
+}
+
+// command builds a wezterm command carrying the client's environment: without
+// the socket, a caller outside WezTerm — gpg-agent's children among them —
+// could be talking to another multiplexer than the one hosting the popup.
+func (c *Client) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	return cmd
+}
+
+// start runs a wezterm command in the background. Canceling ctx interrupts it,
+// which tears the launcher down; killing the pane it opened is Dismiss.
+func (c *Client) start(ctx context.Context, args []string) (*Launcher, error) {
+	l := &Launcher{line: c.path + " " + strings.Join(args, " ")}
+	cmd := c.command(ctx, args)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGINT)
+	}
+	cmd.WaitDelay = launcherWaitDelay
+	cmd.Stdout = &l.stdout
+	cmd.Stderr = &l.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.line, err)
+	}
+	l.cmd = cmd
+	l.wait = sync.OnceValue(l.reap)
+	return l, nil
+}
+
+// run executes a wezterm command and folds its stderr into the error, where
+// wezterm reports the pane it could not find and the GUI it could not reach.
+func (c *Client) run(ctx context.Context, args ...string) error {
+	_, err := c.command(ctx, args).Output()
+	if execErr, ok := errors.AsType[*exec.ExitError](err); ok {
+		return fmt.Errorf(
+			"%s %s: %w: %s",
+			c.path, strings.Join(args, " "), err, strings.TrimSpace(string(execErr.Stderr)),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", c.path, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// launcherWaitDelay is how long a dismissed launcher has to go away on its own
+// before it is killed. A wezterm that ignores its interrupt, or that leaves a
+// child holding the pipes its output is read from, would otherwise be waited on
+// forever.
+const launcherWaitDelay = 2 * time.Second
+
+// Launcher is a running wezterm command that opens a pane, and the way to kill
+// the pane it opened. Its own streams are of no interest to the payload, which
+// draws on the pane rather than on this process's terminal.
+type Launcher struct {
+	cmd  *exec.Cmd
+	line string
+	// The launcher's own output is diagnostics, reported only with a failure —
+	// and the one place the created pane's id is. The two streams are kept apart
+	// while wezterm writes them and joined only in that error, where which
+	// descriptor carried a message says nothing.
+	stdout, stderr bytes.Buffer
+	// wait is memoized: a process can only be reaped once, while both the caller
+	// waiting on the launcher and a dismissal reading what it printed have to go
+	// through it.
+	wait func() error
+	// env is the delivery of the pane's environment, nil for a launch that
+	// carries none. Kept apart from wait: a dismissal waits for the launcher
+	// alone — the pane it is killing may be exactly the one that never came for
+	// its environment.
+	env *envfifo.Delivery
+	// close kills the pane this launcher opened, set by the Start that built it.
+	close     func(context.Context) error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Wait waits for the launcher to exit — and, for a launch carrying an
+// environment, for the pane to have sourced it: "wezterm cli split-pane" and
+// "spawn" return the moment the pane exists, and whoever owns the env FIFO's
+// directory must not take it away before the payload has read it. A failure is
+// decorated with the command that produced it and everything it printed, which
+// is the only trace a pane that never appeared leaves.
+func (l *Launcher) Wait() error {
+	err := l.wait()
+	if l.env == nil {
+		return err
+	}
+	if err != nil {
+		// The launcher failed, so no pane is coming for the environment; the
+		// delivery is ended rather than sat out, and the launcher's error is the
+		// one that explains the launch.
+		l.env.Cancel()
+	}
+	if derr := l.env.Wait(); err == nil {
+		err = derr
+	}
+	return err
+}
+
+func (l *Launcher) reap() error {
+	err := l.cmd.Wait()
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("%s: %w", l.line, err)
+	if out := strings.TrimSpace(l.stdout.String() + l.stderr.String()); out != "" {
+		err = fmt.Errorf("%w: %s", err, out)
+	}
+	return err
+}
+
+// Dismiss kills the pane this launcher opened, once per launcher: the kill is
+// the pane's end, and a second one could only be told the pane is already gone.
+func (l *Launcher) Dismiss(ctx context.Context) error {
+	l.closeOnce.Do(func() { l.closeErr = l.close(ctx) })
+	return l.closeErr
+}
+
+// waitBounded waits for the launcher to exit, giving up when ctx does. Only the
+// bound is reported: how the launcher itself exited says nothing about whether
+// the pane it created is still there. The env delivery is deliberately not
+// joined: this wait fronts a dismissal, and the pane being killed may be exactly
+// the one that never came for its environment.
+//
+// The goroutine outlives a bound that ran out, and has to: a wait cannot be
+// taken back, and this one ends when the launcher does.
+func (l *Launcher) waitBounded(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = l.wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,120 @@
+package wezterm
+
+import (
+	"slices"
+	"testing"
+)
+
+func testClient() *Client {
+	return New(Options{Path: "/usr/bin/wezterm", Shell: "/bin/bash"})
+}
+
+func assertCommand(
+	t *testing.T,
+	gotPath string,
+	gotArgs []string,
+	wantPath string,
+	wantArgs []string,
+) {
+	t.Helper()
+	if gotPath != wantPath {
+		t.Errorf("path = %q, want %q", gotPath, wantPath)
+	}
+	if !slices.Equal(gotArgs, wantArgs) {
+		t.Errorf("args =\n\t%#v\nwant\n\t%#v", gotArgs, wantArgs)
+	}
+}
+
+func TestClient_SplitPaneCommand_argvRunsDirectly(t *testing.T) {
+	path, args := testClient().SplitPaneCommand(SplitRequest{
+		PaneId:  "3",
+		Payload: Payload{Command: []string{"vim", "my file.txt"}},
+	})
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "split-pane", "--pane-id", "3", "--bottom", "--", "vim", "my file.txt",
+	})
+}
+
+// The size takes the flag its unit names: wezterm has one for cells and one for
+// a percentage, and neither reads the other's syntax.
+func TestClient_SplitPaneCommand_size(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  SplitRequest
+		want []string
+	}{
+		{
+			name: "cells",
+			req:  SplitRequest{Size: "20"},
+			want: []string{"--bottom", "--cells", "20"},
+		},
+		{
+			name: "percent",
+			req:  SplitRequest{Side: SideRight, Size: "40%"},
+			want: []string{"--right", "--percent", "40"},
+		},
+		{
+			name: "no size leaves wezterm its own",
+			req:  SplitRequest{Side: SideRight},
+			want: []string{"--right"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.Command = []string{"true"}
+			path, args := New(Options{}).SplitPaneCommand(tc.req)
+			want := append(append([]string{"cli", "split-pane"}, tc.want...), "--", "true")
+			assertCommand(t, path, args, "wezterm", want)
+		})
+	}
+}
+
+// The environment reaches the pane by being sourced: the argv names the env
+// FIFO and nothing of what will travel over it.
+func TestClient_SplitPaneCommand_envIsSourced(t *testing.T) {
+	path, args := testClient().SplitPaneCommand(SplitRequest{
+		Payload: Payload{
+			Env:     map[string]string{"KEY": "value"},
+			WorkDir: "/tmp/popup",
+			Script:  "make test; echo done",
+		},
+	})
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "split-pane", "--bottom", "--",
+		"/bin/bash", "-c", ". '/tmp/popup/env' && { make test; echo done\n}",
+	})
+}
+
+func TestClient_SpawnCommand(t *testing.T) {
+	path, args := testClient().SpawnCommand(Payload{Script: "htop"})
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "spawn", "--new-window", "--", "/bin/bash", "-c", "htop",
+	})
+}
+
+func TestClient_KillPaneCommand(t *testing.T) {
+	path, args := testClient().KillPaneCommand("7")
+	assertCommand(t, path, args, "/usr/bin/wezterm", []string{
+		"cli", "kill-pane", "--pane-id", "7",
+	})
+}
+
+func TestParsePaneId(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want string
+	}{
+		{name: "the id alone", out: "7\n", want: "7"},
+		{name: "surrounding space", out: "  12 \n", want: "12"},
+		{name: "nothing printed", out: ""},
+		{name: "a message instead", out: "failed to connect\n"},
+		{name: "not only digits", out: "7 panes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parsePaneId(tc.out)
+			if ok != (tc.want != "") || got != tc.want {
+				t.Errorf("parsePaneId(%q) = %q, %t; want %q", tc.out, got, ok, tc.want)
+			}
+		})
+	}
+}
@@ -4,13 +4,11 @@ import (
 	"cmp"
 	"context"
 	"fmt"
-	"maps"
-	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
-	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
 )
 
@@ -40,8 +38,8 @@ type RunRequest struct {
 	StartupTimeout time.Duration
 	// X, Y, Width and Height place and size the floating pane (--x, --y, --width,
 	// --height). zellij takes a bare number of cells or a percentage, and nothing
-	// else: the single-letter positions tmux understands have no equivalent here
-	// and are refused by whoever builds the request. Empty leaves zellij's
+	// else: the single-letter positions tmux understands are resolved into one of
+	// those, or refused, by whoever builds the request. Empty leaves zellij's
 	// default.
 	//
 	// X and Y are the pane's top-left corner, which is what zellij's own flags
@@ -77,9 +75,7 @@ func (c *Client) RunCommand(req RunRequest) (path string, args []string) {
 func (c *Client) StartRun(ctx context.Context, req RunRequest) (*Launcher, error) {
 	_, args := c.RunCommand(req)
 	if len(req.Env) > 0 {
-		// Created before the pane so the payload cannot find it missing, removed
-		// with the WorkDir it lives in.
-		if err := fifo.Mkfifo(envPath(req.WorkDir)); err != nil {
+		if err := envfifo.Create(req.WorkDir); err != nil {
 			return nil, err
 		}
 	}
@@ -88,8 +84,8 @@ func (c *Client) StartRun(ctx context.Context, req RunRequest) (*Launcher, error
 		return nil, err
 	}
 	if len(req.Env) > 0 {
-		l.deliverEnv(ctx, envPath(req.WorkDir), envScript(req.Env),
-			cmp.Or(req.StartupTimeout, defaultEnvDeliveryTimeout))
+		l.env = envfifo.Deliver(ctx, envfifo.Path(req.WorkDir), envfifo.Script(req.Env),
+			cmp.Or(req.StartupTimeout, envfifo.DefaultTimeout))
 	}
 	l.close = func(ctx context.Context) error { return c.closePane(ctx, req.SessionId, l) }
 	return l, nil
@@ -149,7 +145,8 @@ func (c *Client) ClosePaneCommand(sessionId, paneId string) (path string, args [
 // it along.
 func (c *Client) ClosePane(ctx context.Context, sessionId, paneId string) error {
 	_, args := c.ClosePaneCommand(sessionId, paneId)
-	return c.run(ctx, args...)
+	_, err := c.run(ctx, args...)
+	return err
 }
 
 // payload renders what the pane executes. zellij runs an argv directly, so a
@@ -161,41 +158,11 @@ func (c *Client) payload(req RunRequest) []string {
 	}
 	line := commandLine(req.Command, req.Script)
 	if len(req.Env) > 0 {
-		// A pane that could not read its environment must not run the payload
-		// without it, hence "&&" rather than the ";" an inline export would take;
-		// the payload is grouped so that the gate covers all of it and not just
-		// the first command of a Script. The newline is what makes the closing
-		// brace a command of its own, whatever the payload ends with.
-		line = fmt.Sprintf(". %s && { %s\n}", shellargv.Quote(envPath(req.WorkDir)), line)
+		line = envfifo.Gate(req.WorkDir, line)
 	}
 	return []string{c.shell, "-c", line}
 }
 
-// envFifoName is what the delivery calls its FIFO. The work directory it lands
-// in also holds the launch's payload FIFOs and, during a pinentry exchange, the
-// handshake ones, so the name stays clear of all of theirs.
-const envFifoName = "env"
-
-// defaultEnvDeliveryTimeout mirrors the launch layer's default startup bound,
-// for a RunRequest that set none of its own.
-const defaultEnvDeliveryTimeout = 30 * time.Second
-
-// envPath names the env FIFO a request's payload sources.
-func envPath(workDir string) string {
-	return filepath.Join(workDir, envFifoName)
-}
-
-// envScript renders env as the shell input the payload sources: where a
-// multiplexer has no environment flag, this is how the values reach the pane
-// without passing through an argv every process can read.
-func envScript(env map[string]string) string {
-	var sb strings.Builder
-	for _, k := range slices.Sorted(maps.Keys(env)) {
-		fmt.Fprintf(&sb, "export %s=%s\n", k, shellargv.Quote(env[k]))
-	}
-	return sb.String()
-}
-
 // geometryArgs renders a pane's placement and size as "zellij run" flags, in
 // the order --x, --y, --width, --height. An empty value emits nothing at all,
 // leaving zellij's own placement.
@@ -0,0 +1,84 @@
+package zellij
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SessionInfo is one session zellij knows of, as list-sessions reports it.
+type SessionInfo struct {
+	Name string
+	// Current is the session the command was run from, which zellij knows only
+	// when it runs inside one.
+	Current bool
+	// Exited is a session that is only kept to be resurrected: nobody sees a
+	// pane opened there.
+	Exited bool
+}
+
+// ListSessions lists the sessions zellij knows of, live and exited. No session
+// at all lists nothing, which zellij reports as a failure and this does not.
+func (c *Client) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	out, err := c.run(ctx, "list-sessions", "--no-formatting")
+	if err != nil {
+		if strings.Contains(err.Error(), "No active zellij sessions found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing the sessions: %w", err)
+	}
+	return parseSessions(out), nil
+}
+
+// parseSessions reads list-sessions' unformatted lines,
+//
+//	work [Created 2h 3m ago] (current)
+//	old [Created 1day ago] (EXITED - attach to resurrect)
+//
+// the name first and zellij's remarks on it after.
+func parseSessions(out string) []SessionInfo {
+	var sessions []SessionInfo
+	for line := range strings.Lines(out) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, remarks, ok := strings.Cut(line, " [Created ")
+		if !ok {
+			name, remarks, _ = strings.Cut(line, " ")
+		}
+		sessions = append(sessions, SessionInfo{
+			Name:    name,
+			Current: strings.Contains(remarks, "(current)"),
+			Exited:  strings.Contains(remarks, "(EXITED"),
+		})
+	}
+	return sessions
+}
+
+// FocusedSession is the session a popup is wanted in: the current one when
+// zellij knows it, else the only live one. zellij records no activity to tell
+// several live sessions apart by, so with more than one there is no answer.
+func FocusedSession(sessions []SessionInfo) (string, error) {
+	var live []string
+	for _, s := range sessions {
+		if s.Current {
+			return s.Name, nil
+		}
+		if !s.Exited {
+			live = append(live, s.Name)
+		}
+	}
+	switch len(live) {
+	case 0:
+		return "", errors.New("no zellij session is running")
+	case 1:
+		return live[0], nil
+	default:
+		return "", fmt.Errorf(
+			"zellij runs %d sessions, %s, and cannot tell which one is in use",
+			len(live), strings.Join(live, ", "),
+		)
+	}
+}
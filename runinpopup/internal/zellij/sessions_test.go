@@ -0,0 +1,100 @@
+package zellij
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClient_ListSessions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    string
+		want    []SessionInfo
+		wantErr string
+	}{
+		{
+			name: "live, current and exited",
+			body: `printf '%s\n' 'work [Created 2h 3m ago] (current)' ` +
+				`'my play [Created 10s ago] ' 'old [Created 1day ago] (EXITED - attach to resurrect)'`,
+			want: []SessionInfo{
+				{Name: "work", Current: true},
+				{Name: "my play"},
+				{Name: "old", Exited: true},
+			},
+		},
+		{
+			name: "none at all",
+			body: `echo 'No active zellij sessions found.' >&2; exit 1`,
+		},
+		{
+			name:    "zellij failing",
+			body:    `echo 'boom' >&2; exit 1`,
+			wantErr: "listing the sessions",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, log := fakeZellij(t, tc.body)
+			got, err := New(Options{Path: path}).ListSessions(t.Context())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ListSessions = %v, want an error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListSessions: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ListSessions = %+v, want %+v", got, tc.want)
+			}
+			if calls := loggedCalls(t, log); calls[0] != "list-sessions --no-formatting" {
+				t.Errorf("zellij was asked %q", calls)
+			}
+		})
+	}
+}
+
+func TestFocusedSession(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sessions []SessionInfo
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "the current one",
+			sessions: []SessionInfo{{Name: "a"}, {Name: "b", Current: true}},
+			want:     "b",
+		},
+		{
+			name:     "the only live one",
+			sessions: []SessionInfo{{Name: "a", Exited: true}, {Name: "b"}},
+			want:     "b",
+		},
+		{
+			name:     "several live ones",
+			sessions: []SessionInfo{{Name: "a"}, {Name: "b"}},
+			wantErr:  "2 sessions, a, b",
+		},
+		{
+			name:     "only exited ones",
+			sessions: []SessionInfo{{Name: "a", Exited: true}},
+			wantErr:  "no zellij session is running",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FocusedSession(tc.sessions)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("FocusedSession = %q, %v, want an error containing %q",
+						got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("FocusedSession = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package zellij
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// viewportProbeName is the probe pane's name, for the moment it is on screen.
+const viewportProbeName = "run-in-popup"
+
+// floatingFrame is how many cells a floating pane's frame takes out of each of
+// its dimensions: one on either side.
+const floatingFrame = 2
+
+// ViewportProbeCommand builds the "zellij run" of the pane ViewportSize opens:
+// a floating pane covering the whole viewport, writing "stty size" to report.
+func (c *Client) ViewportProbeCommand(sessionId, report string) (path string, args []string) {
+	if sessionId != "" {
+		args = append(args, "--session="+sessionId)
+	}
+	args = append(args,
+		"run",
+		"--name="+viewportProbeName,
+		"--x=0", "--y=0", "--width=100%", "--height=100%",
+		"--floating", "--close-on-exit", "--",
+		c.shell, "-c", "stty size > "+shellargv.Quote(report),
+	)
+	return c.path, args
+}
+
+// ViewportSize reports the size, in columns and rows, of the area zellij places
+// floating panes in: what a percentage of a floating pane's geometry is a share
+// of. No zellij command reports it, so it is measured — a floating pane is
+// opened over all of it and asked for its own terminal size, to which the frame
+// it is drawn with is added back. The pane closes itself once it has answered,
+// and is on screen for about as long as a shell takes to start.
+//
+// timeout bounds how long the pane has to answer; zero means 30s.
+func (c *Client) ViewportSize(
+	ctx context.Context,
+	sessionId string,
+	timeout time.Duration,
+) (cols, rows int, err error) {
+	timeout = cmp.Or(timeout, envfifo.DefaultTimeout)
+	dir, err := os.MkdirTemp("", "run-in-popup-zellij-")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(dir)
+	report := filepath.Join(dir, "size")
+	if err := fifo.Mkfifo(report); err != nil {
+		return 0, 0, err
+	}
+
+	// The whole measurement answers to the one bound, a launcher that hangs
+	// included: it is interrupted, like a canceled launch's.
+	ctx, cancelProbe := context.WithTimeout(ctx, timeout)
+	defer cancelProbe()
+	_, args := c.ViewportProbeCommand(sessionId, report)
+	l, err := c.start(ctx, args)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer l.wait()
+
+	// A launcher that failed has opened no pane, and says why better than the
+	// timeout would once it ran out; it ends the wait for the report at once.
+	openCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		if l.wait() != nil {
+			cancel()
+		}
+	}()
+	r, err := fifo.OpenReader(openCtx, report, timeout)
+	if err != nil {
+		if openCtx.Err() != nil && ctx.Err() == nil {
+			// Not the bound, so the launcher: it has failed, and says why.
+			err = l.wait()
+		}
+		return 0, 0, fmt.Errorf("measuring the zellij viewport: %w", err)
+	}
+	defer r.Close()
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("measuring the zellij viewport: %w", err)
+	}
+	rows, cols, ok := parseSttySize(string(out))
+	if !ok {
+		return 0, 0, fmt.Errorf(
+			"measuring the zellij viewport: the probe pane reported %q, want \"rows cols\"",
+			strings.TrimSpace(string(out)),
+		)
+	}
+	return cols + floatingFrame, rows + floatingFrame, nil
+}
+
+// parseSttySize reads "stty size" output, "<rows> <cols>". A terminal of no size
+// is one that reported nothing worth placing a pane by.
+func parseSttySize(out string) (rows, cols int, ok bool) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	rows, errRows := strconv.Atoi(fields[0])
+	cols, errCols := strconv.Atoi(fields[1])
+	if errRows != nil || errCols != nil || rows <= 0 || cols <= 0 {
+		return 0, 0, false
+	}
+	return rows, cols, true
+}
@@ -0,0 +1,83 @@
+package zellij
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStty puts an stty reporting size on PATH, which is the terminal the probe
+// pane would have had.
+func fakeStty(t *testing.T, size string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" + size + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "stty"), []byte(script), 0o755); err != nil {
+		t.Fatalf("writing the fake stty: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// The probe pane covers the viewport and answers with its own size, to which
+// the frame it was drawn with is added back.
+func TestClient_ViewportSize(t *testing.T) {
+	fakeStty(t, "40 120")
+	path, log := fakeZellij(t, `while [ "$1" != "--" ]; do shift; done; shift
+( "$@" ) >/dev/null 2>&1 &
+echo terminal_9`)
+	c := New(Options{Path: path})
+
+	cols, rows, err := c.ViewportSize(t.Context(), "work", 10*time.Second)
+	if err != nil {
+		t.Fatalf("ViewportSize: %v", err)
+	}
+	if cols != 122 || rows != 42 {
+		t.Errorf("ViewportSize = %dx%d, want 122x42", cols, rows)
+	}
+	call := loggedCalls(t, log)[0]
+	for _, want := range []string{
+		"--session=work run ",
+		"--x=0 --y=0 --width=100% --height=100% --floating --close-on-exit --",
+	} {
+		if !strings.Contains(call, want) {
+			t.Errorf("the probe ran %q, want %q in it", call, want)
+		}
+	}
+}
+
+// A launcher that failed opened no pane: its error is the answer, at once
+// rather than once the timeout has run out.
+func TestClient_ViewportSize_launcherFailure(t *testing.T) {
+	path, _ := fakeZellij(t, `echo "No session named work found" >&2; exit 1`)
+	c := New(Options{Path: path})
+
+	start := time.Now()
+	_, _, err := c.ViewportSize(t.Context(), "work", 20*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "No session named work") {
+		t.Errorf("ViewportSize err = %v, want zellij's own message in it", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("ViewportSize took %v, want the failure reported at once", elapsed)
+	}
+}
+
+func TestParseSttySize(t *testing.T) {
+	for _, tc := range []struct {
+		out        string
+		rows, cols int
+		ok         bool
+	}{
+		{out: "24 80\n", rows: 24, cols: 80, ok: true},
+		{out: "0 0\n"},
+		{out: "stty: 'standard input': Inappropriate ioctl for device\n"},
+		{out: ""},
+	} {
+		rows, cols, ok := parseSttySize(tc.out)
+		if rows != tc.rows || cols != tc.cols || ok != tc.ok {
+			t.Errorf("parseSttySize(%q) = %d, %d, %t; want %d, %d, %t",
+				tc.out, rows, cols, ok, tc.rows, tc.cols, tc.ok)
+		}
+	}
+}
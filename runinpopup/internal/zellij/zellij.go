@@ -17,9 +17,7 @@ import (
 	"syscall"
 	"time"
 
-	"golang.org/x/sync/errgroup"
-
-	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/envfifo"
 )
 
 // Options are the coordinates of the zellij installation a Client talks to.
@@ -67,20 +65,21 @@ func (c *Client) start(ctx context.Context, args []string) (*Launcher, error) {
 }
 
 // run executes a zellij command and folds its stderr into the error, where
-// zellij reports the session and the pane it could not find.
-func (c *Client) run(ctx context.Context, args ...string) error {
+// zellij reports the session and the pane it could not find. It returns what
+// the command printed, for the queries.
+func (c *Client) run(ctx context.Context, args ...string) (string, error) {
 	cmd := exec.CommandContext(ctx, c.path, args...)
-	_, err := cmd.Output()
+	out, err := cmd.Output()
 	if execErr, ok := errors.AsType[*exec.ExitError](err); ok {
-		return fmt.Errorf(
+		return "", fmt.Errorf(
 			"%s %s: %w: %s",
 			c.path, strings.Join(args, " "), err, strings.TrimSpace(string(execErr.Stderr)),
 		)
 	}
 	if err != nil {
-		return fmt.Errorf("%s %s: %w", c.path, strings.Join(args, " "), err)
+		return "", fmt.Errorf("%s %s: %w", c.path, strings.Join(args, " "), err)
 	}
-	return nil
+	return string(out), nil
 }
 
 // launcherWaitDelay is how long a dismissed launcher has to go away on its own
@@ -104,12 +103,11 @@ type Launcher struct {
 	// waiting on the launcher and a dismissal reading what it printed have to go
 	// through it.
 	wait func() error
-	// env joins the delivery of the pane's environment, nil for a launch that
-	// carries none. Memoized like wait, and kept apart from it: a dismissal
-	// waits for the launcher alone — the pane it is closing may be exactly the
-	// one that never came for its environment.
-	env       func() error
-	cancelEnv context.CancelFunc
+	// env is the delivery of the pane's environment, nil for a launch that
+	// carries none. Kept apart from wait: a dismissal waits for the launcher
+	// alone — the pane it is closing may be exactly the one that never came for
+	// its environment.
+	env *envfifo.Delivery
 	// close closes the pane this launcher opened, set by the Start that built it.
 	close     func(context.Context) error
 	closeOnce sync.Once
@@ -131,52 +129,14 @@ func (l *Launcher) Wait() error {
 		// The launcher failed, so no pane is coming for the environment; the
 		// delivery is ended rather than sat out, and the launcher's error is the
 		// one that explains the launch.
-		l.cancelEnv()
+		l.env.Cancel()
 	}
-	if derr := l.env(); err == nil {
+	if derr := l.env.Wait(); err == nil {
 		err = derr
 	}
 	return err
 }
 
-// deliverEnv starts the environment delivery: script is written into the FIFO
-// at path once the pane opens its reading end, and Wait joins the outcome. ctx
-// ending or timeout running out abandons a delivery whose pane never came.
-func (l *Launcher) deliverEnv(
-	ctx context.Context,
-	path, script string,
-	timeout time.Duration,
-) {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	l.cancelEnv = cancel
-	g := new(errgroup.Group)
-	g.Go(func() error { return writeEnvFifo(ctx, path, script, timeout) })
-	l.env = sync.OnceValue(func() error {
-		defer cancel()
-		return g.Wait()
-	})
-}
-
-// writeEnvFifo is the delivering half of the payload's ". env" gate. Closing
-// the FIFO is what ends the sourcing, so a close that fails is an environment
-// the pane may wait on forever, and reported like the write.
-func writeEnvFifo(ctx context.Context, path, script string, timeout time.Duration) error {
-	f, err := fifo.OpenWriter(ctx, path, timeout)
-	if err != nil {
-		return fmt.Errorf("delivering the popup environment: %w", err)
-	}
-	stop := context.AfterFunc(ctx, func() { _ = f.SetWriteDeadline(time.Now()) })
-	defer stop()
-	_, err = f.WriteString(script)
-	if cerr := f.Close(); err == nil {
-		err = cerr
-	}
-	if err != nil {
-		return fmt.Errorf("delivering the popup environment: %w", err)
-	}
-	return nil
-}
-
 func (l *Launcher) reap() error {
 	err := l.cmd.Wait()
 	if err == nil {
@@ -138,11 +138,7 @@ type JsonIpcConn[In, Out any] struct {
 // value has already reached the payload and cannot be taken back.
 func (c *JsonIpcConn[In, Out]) Send(ctx context.Context, v In) error {
 	if c.send == nil {
-		return errors.New(
-			"this exchange has no input stream:" +
-				" its launcher's AddPayload put the input in the popup's command line," +
-				" leaving the payload's stdin on the popup's terminal",
-		)
+		return errNoInputStream
 	}
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -163,6 +159,27 @@ func (c *JsonIpcConn[In, Out]) Send(ctx context.Context, v In) error {
 	return nil
 }
 
+// CloseSend ends the input stream: the payload reads EOF once it has read
+// everything sent before it. A payload reading its input to the end — a filter,
+// answering once it has seen all of it — has no other way to learn there is
+// nothing more. Like Send, it needs an exchange that streams its input.
+func (c *JsonIpcConn[In, Out]) CloseSend() error {
+	if c.send == nil {
+		return errNoInputStream
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.send.Close()
+}
+
+// errNoInputStream is what Send and CloseSend report on an exchange whose input
+// did not stream.
+var errNoInputStream = errors.New(
+	"this exchange has no input stream:" +
+		" its launcher's AddPayload put the input in the popup's command line," +
+		" leaving the payload's stdin on the popup's terminal",
+)
+
 // Results streams the values the payload writes on its stdout, decoded as they
 // arrive, and is closed when the exchange ends. Every call returns the same
 // channel.
@@ -97,6 +97,39 @@ func TestJsonIpcConn_Send(t *testing.T) {
 	}
 }
 
+// A payload reading its input to the end answers only once the input is closed:
+// here it counts the lines it was sent, which it cannot do before EOF.
+func TestJsonIpcConn_CloseSend(t *testing.T) {
+	launcher := &JsonIpcLauncher[ipcMessage, ipcMessage]{
+		Popup:       &PopupLauncher{Backend: &shellBackend{}},
+		PartialSpec: PopupSpec{Script: `printf '{"value":%d}' "$(wc -l)"`},
+	}
+
+	conn, err := launcher.Exec(t.Context(), ipcMessage{})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	for _, v := range []ipcMessage{{Value: 1}, {Value: 2}, {Value: 3}} {
+		if err := conn.Send(t.Context(), v); err != nil {
+			t.Fatalf("Send(%+v): %v", v, err)
+		}
+	}
+	if err := conn.CloseSend(); err != nil {
+		t.Fatalf("CloseSend: %v", err)
+	}
+
+	got, err := collectIpcResults(conn)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if want := []ipcMessage{{Value: 3}}; !slices.Equal(got, want) {
+		t.Errorf("results = %+v, want %+v", got, want)
+	}
+	if err := conn.Send(t.Context(), ipcMessage{Value: 4}); err == nil {
+		t.Error("Send after CloseSend must fail: the stream has ended")
+	}
+}
+
 // The input went into the command line, so there is no stream to send on and
 // saying so beats writing into a stdin the payload never got.
 func TestJsonIpcConn_Send_withoutAnInputStream(t *testing.T) {
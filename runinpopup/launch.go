@@ -17,6 +17,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ngicks/go-common/contextkey"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/fifo"
@@ -153,6 +154,20 @@ type PopupStreams struct {
 	// them taken over; an ordinary terminal program is not, and drawing in the
 	// popup as it would anywhere is the whole reason it was put there.
 	KeepStdio bool
+
+	// ExitStatus has the payload report its own exit status, read back by
+	// PopupCommand.ExitCode. The payload is run in a subshell of the popup's
+	// command line, whose last act is to write that subshell's status to a FIFO
+	// of its own in the launch's workspace, so the answer is the same on every
+	// mechanism — rather than only on the one whose launcher happens to exit with
+	// it.
+	//
+	// The report is written while the group still holds the stream FIFOs, so a
+	// launch whose wait saw those end has it by then. One with no output stream
+	// to wait for has it only when its launcher stays as long as the popup: the
+	// floating-pane mechanisms return first, and their payload has not reported
+	// anything by the time Wait does.
+	ExitStatus bool
 }
 
 // PopupLauncher opens popups through a Backend. It owns everything a launch
@@ -170,6 +185,14 @@ type PopupLauncher struct {
 	// StartupTimeout bounds the rendezvous on each payload FIFO — how long the
 	// popup has to reach the payload and open its end. Zero means 30s.
 	StartupTimeout time.Duration
+	// Unsupported is what a launch asking the backend for something its
+	// Capabilities say it does not honor does. Empty means UnsupportedWarn; a
+	// backend not reporting capabilities is never checked.
+	Unsupported UnsupportedPolicy
+	// Fit bounds a popup sized to its content. The zero FitConfig means
+	// DefaultConfig().Fit; otherwise a zero maximum means the default's and a
+	// zero minimum means no lower bound.
+	Fit FitConfig
 }
 
 // Exec opens a popup running spec and returns as soon as it has been launched.
@@ -197,6 +220,18 @@ func (l *PopupLauncher) Exec(
 		return nil, err
 	}
 	logger := loggerOrDiscard(l.Logger)
+	// So is a spec the backend cannot honor, which otherwise shows up as a
+	// refusal after the multiplexer was prepared, or as nothing at all.
+	if err := l.checkCapabilities(spec, streams, logger); err != nil {
+		return nil, err
+	}
+	// Measured before the multiplexer is touched, and from the launch's own
+	// process rather than inside a popup: what is being worked out is how big
+	// to open the popup, so there is none yet to measure anything in.
+	spec, err = l.fitSpec(ctx, spec, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	// Undone in reverse on the way out of a launch that never happened; a launch
 	// that does happen hands the same funcs to the PopupCommand.
@@ -210,7 +245,7 @@ func (l *PopupLauncher) Exec(
 		}
 	}()
 
-	restore, err := l.Backend.Prepare(ctx)
+	restore, err := l.Backend.Prepare(contextkey.WithSlogLogger(ctx, logger))
 	if err != nil {
 		return nil, fmt.Errorf("backend %s: preparing popup: %w", l.Backend.Name(), err)
 	}
@@ -236,8 +271,12 @@ func (l *PopupLauncher) Exec(
 	// Asked here rather than of the backend, so a spec's needs alone decide what
 	// a launch allocates; the tmux backends have their flag and leave the
 	// directory empty, which is cheaper than negotiating with every backend.
-	var workDir string
-	if len(set) > 0 || len(spec.Env) > 0 {
+	var (
+		workDir    string
+		status     *exitStatus
+		statusPath string
+	)
+	if len(set) > 0 || len(spec.Env) > 0 || streams.ExitStatus {
 		dir, releaseWorkspace, err := l.Workspace.open(logger)
 		if err != nil {
 			return nil, err
@@ -250,10 +289,17 @@ func (l *PopupLauncher) Exec(
 				return nil, err
 			}
 		}
+		if streams.ExitStatus {
+			status, statusPath, err = openExitStatus(dir)
+			if err != nil {
+				return nil, err
+			}
+			rollback = append(rollback, status.close)
+		}
 	}
 
 	startupTimeout := cmp.Or(l.StartupTimeout, defaultPopupStartupTimeout)
-	command, script := launchCommandLine(spec, set)
+	command, script := launchCommandLine(spec, set, statusPath)
 	launchSpec := LaunchSpec{
 		Title:          spec.Title,
 		Env:            spec.Env,
@@ -261,6 +307,8 @@ func (l *PopupLauncher) Exec(
 		Y:              spec.Y,
 		Width:          spec.Width,
 		Height:         spec.Height,
+		Anchor:         spec.Anchor,
+		Margin:         spec.Margin,
 		Command:        command,
 		Script:         script,
 		WorkDir:        workDir,
@@ -316,6 +364,7 @@ func (l *PopupLauncher) Exec(
 		piped:      new(errgroup.Group),
 		stdoutPipe: stdoutPipe,
 		stderrPipe: stderrPipe,
+		status:     status,
 		waitLauncher: sync.OnceValue(func() error {
 			if err := handle.Wait(); err != nil {
 				return fmt.Errorf("popup failed: %w", err)
@@ -395,6 +444,12 @@ type PopupCommand struct {
 	hasEndpoints bool
 	stdoutPipe   io.ReadCloser
 	stderrPipe   io.ReadCloser
+	// status is the FIFO the payload reports its exit status on, nil unless
+	// PopupStreams.ExitStatus asked for one. It is read once the wait is over and
+	// before the release takes the FIFO away.
+	status     *exitStatus
+	statusOnce sync.Once
+	statusMu   sync.Mutex
 	// release dismisses the popup and gives back everything the launch took. It
 	// runs exactly once, however the command ends.
 	release func()
@@ -418,6 +473,7 @@ func (c *PopupCommand) Wait() error {
 	if perr := c.endpoints.Wait(); err == nil {
 		err = perr
 	}
+	c.collectStatus()
 	c.release()
 	return err
 }
@@ -445,6 +501,7 @@ func (c *PopupCommand) WaitStreams() error {
 	}
 	streamErr := c.endpoints.Wait()
 	launcherErr := c.waitLauncher()
+	c.collectStatus()
 	c.release()
 	if streamErr == nil {
 		return nil
@@ -452,6 +509,33 @@ func (c *PopupCommand) WaitStreams() error {
 	return cmp.Or(launcherErr, streamErr)
 }
 
+// ExitCode reports the exit status the payload reported, and false when it
+// reported none: the launch did not ask for one through PopupStreams.ExitStatus,
+// Wait or WaitStreams has not returned yet, or the payload never got as far as
+// reporting — a popup dismissed under it, or a launch whose wait was over before
+// the payload was, which PopupStreams.ExitStatus says when to expect.
+func (c *PopupCommand) ExitCode() (int, bool) {
+	if c.status == nil {
+		return 0, false
+	}
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.status.code, c.status.reported
+}
+
+// collectStatus reads the payload's report, once and before the release closes
+// the FIFO it arrives on.
+func (c *PopupCommand) collectStatus() {
+	if c.status == nil {
+		return
+	}
+	c.statusOnce.Do(func() {
+		c.statusMu.Lock()
+		defer c.statusMu.Unlock()
+		c.status.collect()
+	})
+}
+
 // StdoutPipe returns the reader allocated when PopupStreams.StdoutPipe was set,
 // and false when piping was not requested — the flag was unset, or a non-nil
 // Stdout endpoint overrode it.
@@ -567,22 +651,39 @@ func outStream(
 //
 // The payload is wrapped in a group so that a redirection covers all of it, and
 // not just the last command of a Script, and whatever names the FIFOs is exported
-// ahead of that group. Without allocated streams the spec's own argv is handed
-// over untouched: nothing is being attached to the payload, and a backend able to
-// run an argv directly must not be pushed through a shell for nothing.
+// ahead of that group. Without allocated streams or a status FIFO the spec's own
+// argv is handed over untouched: nothing is being attached to the payload, and a
+// backend able to run an argv directly must not be pushed through a shell for
+// nothing.
 //
 // The group's redirections are what open the FIFOs inside the popup, on the way
 // into the group and whichever descriptors they land on, so the rendezvous with
 // the relays out here is the same either way — as is the end of it: the group
 // exiting closes them, and that is the payload's EOF.
-func launchCommandLine(spec PopupSpec, set []*popupStream) (command []string, script string) {
-	if len(set) == 0 {
+//
+// A non-empty statusPath runs the payload in a subshell inside that group and
+// reports the subshell's status on the FIFO there — a subshell, because a Script
+// ending in "exit 3" would otherwise take the report down with it. The report is
+// written inside the group, ahead of the streams' EOF, and the group exits with
+// the payload's status, so a launcher that carries one still carries the same.
+func launchCommandLine(
+	spec PopupSpec,
+	set []*popupStream,
+	statusPath string,
+) (command []string, script string) {
+	if len(set) == 0 && statusPath == "" {
 		return spec.Command, spec.Script
 	}
 	payload := spec.Script
 	if payload == "" {
 		payload = shellargv.Join(spec.Command)
 	}
+	if statusPath != "" {
+		payload = fmt.Sprintf(
+			"( %s\n); s=$?; printf '%%d\\n' \"$s\" > %s; exit \"$s\"",
+			payload, shellargv.Quote(statusPath),
+		)
+	}
 	var sb strings.Builder
 	for _, s := range set {
 		if s.envName == "" {
@@ -548,6 +548,23 @@ func TestLaunchCommandLine(t *testing.T) {
 			wantScript: `export TTY_ERR='/w/stderr'` + "\n" +
 				"{ make test\n" + `} 5> '/w/stderr'`,
 		},
+		{
+			// The status alone is reason enough for a wrapper: the payload has to
+			// be run by something that outlives it to say how it went.
+			name:    "a status report wraps a payload allocated no streams",
+			spec:    PopupSpec{Command: []string{"make", "test"}},
+			streams: PopupStreams{ExitStatus: true},
+			wantScript: "{ ( 'make' 'test'\n" +
+				`); s=$?; printf '%d\n' "$s" > '/w/status'; exit "$s"` + "\n}",
+		},
+		{
+			name:    "the status is reported inside the group holding the streams",
+			spec:    PopupSpec{Script: "make test"},
+			streams: PopupStreams{Stdout: new(popupOutput), ExitStatus: true},
+			wantScript: "{ ( make test\n" +
+				`); s=$?; printf '%d\n' "$s" > '/w/status'; exit "$s"` + "\n" +
+				`} > '/w/stdout'`,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			set, _, _ := payloadStreams(tc.streams)
@@ -555,7 +572,12 @@ func TestLaunchCommandLine(t *testing.T) {
 				s.path = "/w/" + s.name
 			}
 
-			command, script := launchCommandLine(tc.spec, set)
+			var statusPath string
+			if tc.streams.ExitStatus {
+				statusPath = "/w/" + statusFifoName
+			}
+
+			command, script := launchCommandLine(tc.spec, set, statusPath)
 			if !slices.Equal(command, tc.wantCommand) {
 				t.Errorf("command = %q, want %q", command, tc.wantCommand)
 			}
@@ -843,6 +865,79 @@ func TestPopupCommand_WaitStreams_noEndpointFallsBackToWait(t *testing.T) {
 	}
 }
 
+// The status is the payload's own, whichever way the launch is waited on and
+// whether or not the launcher carries it too: a detached launcher exits 0 long
+// before its payload does, and only the streams say when the report is in.
+func TestPopupCommand_ExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		backend Backend
+		script  string
+		streams bool
+		want    int
+	}{
+		{name: "success", backend: &shellBackend{}, script: "true", want: 0},
+		{name: "failure", backend: &shellBackend{}, script: "false", want: 1},
+		{
+			// A payload's own exit must not take the report down with it.
+			name:    "a script exiting on its own",
+			backend: &shellBackend{},
+			script:  "printf x; exit 3; echo unreachable",
+			streams: true,
+			want:    3,
+		},
+		{
+			name:    "a detached launcher",
+			backend: &detachedBackend{shellBackend: &shellBackend{}},
+			script:  "sleep 0.1; printf x; exit 7",
+			streams: true,
+			want:    7,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			launcher := &PopupLauncher{Backend: tc.backend}
+			streams := PopupStreams{ExitStatus: true}
+			if tc.streams {
+				streams.Stdout = new(popupOutput)
+			}
+
+			popup, err := launcher.Exec(t.Context(), PopupSpec{Script: tc.script}, streams)
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+			if code, ok := popup.ExitCode(); ok {
+				t.Errorf("ExitCode = %d before the wait, want nothing reported yet", code)
+			}
+			// The launcher exiting with the payload's status is its own report of
+			// a failure; the status is what this test is about.
+			_ = popup.WaitStreams()
+
+			code, ok := popup.ExitCode()
+			if !ok {
+				t.Fatal("ExitCode reported nothing")
+			}
+			if code != tc.want {
+				t.Errorf("ExitCode = %d, want %d", code, tc.want)
+			}
+		})
+	}
+}
+
+// Without the request the payload is run as it always was, and there is no
+// status to read back.
+func TestPopupCommand_ExitCode_notRequested(t *testing.T) {
+	launcher := &PopupLauncher{Backend: &shellBackend{}}
+
+	popup, err := launcher.Exec(t.Context(), PopupSpec{Script: "exit 3"}, PopupStreams{})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	_ = popup.Wait()
+	if code, ok := popup.ExitCode(); ok {
+		t.Errorf("ExitCode = %d, want nothing reported: no status was asked for", code)
+	}
+}
+
 // A caller-provided workspace is where the pinentry handshake's FIFOs go, so a
 // directory anyone else could write into — swapping a FIFO for their own — is
 // refused before anything is placed in it. Only ownership and the directory's
@@ -946,6 +1041,23 @@ func TestPopupLauncher_Exec_geometryReachesTheBackend(t *testing.T) {
 	if want := [4]string{"C", "10", "80%", "20"}; got != want {
 		t.Errorf("geometry = %q, want %q", got, want)
 	}
+
+	// An anchor too: it is the backend that has something to measure it by.
+	popup, err = launcher.Exec(
+		t.Context(),
+		PopupSpec{Anchor: "top-right", Margin: "2", Command: []string{"true"}},
+		PopupStreams{},
+	)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := popup.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if spec := backend.launched[1]; spec.Anchor != "top-right" || spec.Margin != "2" {
+		t.Errorf("Anchor, Margin = %q, %q, want %q, %q",
+			spec.Anchor, spec.Margin, "top-right", "2")
+	}
 }
 
 // A geometry nobody can act on is a typo, and finding out must cost no popup:
@@ -965,6 +1077,25 @@ func TestPopupLauncher_Exec_malformedGeometryOpensNothing(t *testing.T) {
 			name: "a specifier on a size",
 			spec: PopupSpec{Height: "C"}, field: "Height", value: "C",
 		},
+		{
+			// Fit sizes a popup; it places nothing.
+			name: "fit on a position",
+			spec: PopupSpec{X: "fit"}, field: "X", value: "fit",
+		},
+		{name: "anchor", spec: PopupSpec{Anchor: "north"}, field: "Anchor", value: "north"},
+		{
+			name: "margin",
+			spec: PopupSpec{Anchor: "top", Margin: "C"}, field: "Margin", value: "C",
+		},
+		{
+			// Two placements at once leave one of them unused.
+			name: "an anchor beside a position",
+			spec: PopupSpec{Anchor: "top", X: "10"}, field: "Anchor", value: "top",
+		},
+		{
+			name: "a margin off nothing",
+			spec: PopupSpec{Margin: "2"}, field: "Margin", value: "2",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			backend := &shellBackend{}
@@ -0,0 +1,363 @@
+package runinpopup
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A lingering popup outlives the pinentry exchange it was opened for, so the
+// next one draws in it instead of opening a popup of its own: signing a run of
+// commits then shows one popup rather than one flickering in and out per
+// prompt.
+//
+// Nothing that answers gpg-agent can keep it, because gpg-agent waits for its
+// pinentry to exit before it asks for the next passphrase. A PopupHost does
+// instead: a process of its own that opens the popup, hands its terminal to each
+// exchange that asks over a unix socket, and dismisses it once nobody has asked
+// for a while. Each exchange leases the terminal for as long as its pinentry
+// runs; the host serves one lease at a time, so a second exchange waits its turn
+// rather than sharing the screen.
+//
+// The conversation on the socket is one line each way: the exchange asks with
+// popupHostLease, and the host answers with the popup's announcement, as
+// TTYAnnounceScript writes it, or with popupHostErr and what went wrong. The
+// lease lasts until the exchange closes its end.
+
+const (
+	popupHostLease = "lease"
+	popupHostErr   = "ERR "
+)
+
+// popupRenewTimeout bounds a lingering popup's answer to being asked for its
+// terminal again. A live one answers at once, and one that is gone never does,
+// so the wait is kept short: it is the delay before the popup is replaced.
+const popupRenewTimeout = 2 * time.Second
+
+// errPopupHostRunning is a host finding the socket already served.
+var errPopupHostRunning = errors.New("a popup host is already serving the socket")
+
+// PinentryLinger is where a PinentryLauncher finds the PopupHost keeping a
+// popup between exchanges, and how it gets one when there is none.
+type PinentryLinger struct {
+	// Socket is the host's rendezvous socket. It must be private to the
+	// session: whoever serves it is handed the passphrase prompt. The CLI keeps
+	// it under $XDG_RUNTIME_DIR, named after the session the popups are for.
+	Socket string
+	// StartHost starts a process serving a PopupHost on Socket and returns
+	// without waiting for it, which has to outlive this one. Required. A host
+	// that finds the socket already served exits quietly, so starting one too
+	// many is harmless.
+	StartHost func(ctx context.Context) error
+}
+
+// PopupHost keeps one handshake popup open for a sequence of pinentry
+// exchanges, each a PinentryLauncher with Linger pointing at Socket.
+//
+// The popup is opened for the first lease and asked for its terminal again for
+// each one after it, which is also how a popup closed by hand in the meantime is
+// noticed and replaced. Once no lease has been asked for in Timeouts.Linger, the
+// popup is dismissed and Serve returns.
+type PopupHost struct {
+	// Popup opens the popup, as for PinentryLauncher. Required, and its Backend
+	// must implement TTYHandshaker.
+	Popup *PopupLauncher
+	// Socket is the rendezvous socket to serve. Its directory is created when
+	// missing and must be private to the user, as a workspace must.
+	Socket string
+	// Timeouts bounds the handshake as for PinentryLauncher, and Linger is the
+	// idle period. Zero fields fall back to DefaultConfig().Timeouts, whose
+	// Linger of zero dismisses the popup as soon as its first lease ends.
+	Timeouts TimeoutsConfig
+}
+
+// Serve runs the host until it has been idle for Timeouts.Linger or ctx is
+// done, and dismisses the popup on the way out. It returns nil at once when
+// another host already serves the socket.
+func (h *PopupHost) Serve(ctx context.Context) error {
+	if h.Popup == nil || h.Popup.Backend == nil {
+		return errors.New("PopupHost.Popup and its Backend must be set")
+	}
+	handshaker, ok := h.Popup.Backend.(TTYHandshaker)
+	if !ok {
+		return fmt.Errorf(
+			"backend %q does not implement runinpopup.TTYHandshaker:"+
+				" it cannot host the pinentry tty handshake",
+			h.Popup.Backend.Name(),
+		)
+	}
+	def := DefaultConfig()
+	logger := loggerOrDiscard(h.Popup.Logger)
+
+	listener, err := listenPopupHost(h.Socket)
+	if errors.Is(err, errPopupHostRunning) {
+		logger.Debug("popup host already running", slog.String("socket", h.Socket))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Closing the listener removes the socket, so a host that is gone is never
+	// mistaken for one that is only slow to answer.
+	defer listener.Close()
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	dir, releaseWorkspace, err := h.Popup.Workspace.open(logger)
+	if err != nil {
+		return err
+	}
+	defer releaseWorkspace()
+
+	popup := &lingeringPopup{
+		backend:        handshaker,
+		launcher:       h.Popup,
+		logger:         logger,
+		dir:            dir,
+		readTimeout:    cmp.Or(h.Timeouts.TTYRead, def.Timeouts.TTYRead),
+		dismissTimeout: cmp.Or(h.Timeouts.DoneWrite, def.Timeouts.DoneWrite),
+	}
+	defer popup.close()
+
+	// A host is started by the exchange that wants the first lease, which is
+	// already on its way: that one is waited for as long as an announcement
+	// would be, and only the ones after it are up to the idle period.
+	wait := popup.readTimeout
+	for {
+		_ = listener.SetDeadline(time.Now().Add(wait))
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				logger.Debug("popup host idle; dismissing the popup")
+				return nil
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accepting a lease: %w", err)
+		}
+		popup.lease(ctx, conn)
+		wait = cmp.Or(h.Timeouts.Linger, def.Timeouts.Linger)
+	}
+}
+
+// listenPopupHost binds socket, taking it over from a host that died without
+// removing it, but never from one still serving it.
+func listenPopupHost(socket string) (*net.UnixListener, error) {
+	dir := filepath.Dir(socket)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := checkWorkspace(dir); err != nil {
+		return nil, err
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unix"}
+	l, err := net.ListenUnix("unix", addr)
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return l, err
+	}
+	// A connection that asks for nothing is no lease, so probing a live host
+	// costs it nothing.
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err == nil {
+		conn.Close()
+		return nil, errPopupHostRunning
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, err
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.ListenUnix("unix", addr)
+}
+
+// lingeringPopup is the host's popup across launches: the handshake of the one
+// currently open, if any, and what it takes to open the next.
+type lingeringPopup struct {
+	backend  TTYHandshaker
+	launcher *PopupLauncher
+	logger   *slog.Logger
+	// dir is the host's workspace. Each launch gets a directory of its own in
+	// it, so a replacement popup never meets the FIFOs of the one it replaces.
+	dir                         string
+	readTimeout, dismissTimeout time.Duration
+
+	launches  int
+	handshake *popupTTYHandshake
+	// cancel ends the current launch's context, which closes a popup the done
+	// FIFO can no longer reach.
+	cancel context.CancelFunc
+}
+
+// lease serves one connection: it reads the request, answers with the popup's
+// terminal and returns once the exchange has closed its end.
+func (p *lingeringPopup) lease(ctx context.Context, conn *net.UnixConn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	r := bufio.NewReader(conn)
+	req, err := r.ReadString('\n')
+	if strings.TrimSpace(req) != popupHostLease {
+		// A probe, or something that is not an exchange at all.
+		p.logger.Debug("not a lease", slog.String("request", req), slog.Any("err", err))
+		return
+	}
+
+	term, err := p.terminal(ctx)
+	if err != nil {
+		p.logger.Warn("no popup to lease", slog.Any("err", err))
+		fmt.Fprintf(conn, "%s%s\n", popupHostErr, strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	_, err = fmt.Fprintf(conn, "%s\t%s\t%s\t%s\n", term.TTY, term.Term, term.LCCtype, term.LCMessages)
+	if err != nil {
+		p.logger.Debug("answering the lease", slog.Any("err", err))
+		return
+	}
+	p.logger.Debug("leased", slog.String("tty", term.TTY))
+	// Nothing more is said: the lease is over when the exchange hangs up, which
+	// the kernel does for it when it dies.
+	_, _ = io.Copy(io.Discard, r)
+	p.logger.Debug("lease ended", slog.String("tty", term.TTY))
+}
+
+// terminal returns the terminal of a popup that is open right now: the current
+// one when it still answers, a freshly opened one otherwise.
+func (p *lingeringPopup) terminal(ctx context.Context) (popupTerminal, error) {
+	if p.handshake != nil {
+		term, err := p.handshake.renew(min(popupRenewTimeout, p.readTimeout))
+		if err == nil {
+			return term, nil
+		}
+		p.logger.Debug("the lingering popup is gone; opening another", slog.Any("err", err))
+		p.close()
+	}
+
+	p.launches++
+	dir := filepath.Join(p.dir, strconv.Itoa(p.launches))
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return popupTerminal{}, err
+	}
+	launchCtx, cancel := context.WithCancel(ctx)
+	p.handshake = &popupTTYHandshake{
+		backend:        p.backend,
+		launcher:       p.launcher,
+		logger:         p.logger,
+		dir:            dir,
+		readTimeout:    p.readTimeout,
+		dismissTimeout: p.dismissTimeout,
+	}
+	p.cancel = cancel
+	term, err := p.handshake.acquire(launchCtx)
+	if err != nil {
+		p.close()
+		return popupTerminal{}, err
+	}
+	return term, nil
+}
+
+// close dismisses the current popup, if there is one. The launch's context is
+// canceled only afterwards: a popup that heard the dismissal closes itself, and
+// one that did not — gone already, or stuck — is then closed by the backend.
+func (p *lingeringPopup) close() {
+	if p.handshake == nil {
+		return
+	}
+	if err := p.handshake.dismiss(); err != nil {
+		p.logger.Warn("dismissing the popup failed", slog.Any("err", err))
+	}
+	p.cancel()
+	p.handshake, p.cancel = nil, nil
+}
+
+// lingerRendezvous is an exchange's end of a lease: the terminal comes from a
+// PopupHost, starting one first when nobody serves the socket, and dismissing
+// it only hands it back.
+type lingerRendezvous struct {
+	linger *PinentryLinger
+	logger *slog.Logger
+	// startTimeout bounds waiting for a host just started to serve the socket.
+	startTimeout time.Duration
+
+	conn net.Conn
+}
+
+func (r *lingerRendezvous) acquire(ctx context.Context) (popupTerminal, error) {
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return popupTerminal{}, err
+	}
+	r.conn = conn
+	// The host may have a popup to open before it can answer, which it bounds
+	// itself; this end is bounded by the exchange.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := io.WriteString(conn, popupHostLease+"\n"); err != nil {
+		return popupTerminal{}, fmt.Errorf("asking the popup host for a lease: %w", err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return popupTerminal{}, fmt.Errorf(
+			"reading the popup host's answer: %w", cmp.Or(ctx.Err(), err),
+		)
+	}
+	if msg, ok := strings.CutPrefix(line, popupHostErr); ok {
+		return popupTerminal{}, fmt.Errorf("popup host: %s", strings.TrimSpace(msg))
+	}
+	term, err := parseTTYAnnouncement(line, nil)
+	if err != nil {
+		return popupTerminal{}, err
+	}
+	r.logger.Debug("leased a lingering popup", slog.String("tty", term.TTY))
+	return term, nil
+}
+
+// dial connects to the host, starting one when nobody is listening and waiting
+// for it to be.
+func (r *lingerRendezvous) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", r.linger.Socket)
+	if err == nil {
+		return conn, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, fmt.Errorf("reaching the popup host: %w", err)
+	}
+
+	r.logger.Debug("starting a popup host", slog.String("socket", r.linger.Socket))
+	if err := r.linger.StartHost(ctx); err != nil {
+		return nil, fmt.Errorf("starting the popup host: %w", err)
+	}
+	deadline := time.Now().Add(r.startTimeout)
+	for {
+		conn, err := d.DialContext(ctx, "unix", r.linger.Socket)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			return nil, fmt.Errorf("the popup host never started serving: %w", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (r *lingerRendezvous) dismiss() error {
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
@@ -0,0 +1,224 @@
+package runinpopup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/internal/shellargv"
+)
+
+// announceUntilDone is TTYHandshakeScript's protocol with popupTTY for a
+// terminal: it announces again on every "again" and ends on anything else.
+func announceUntilDone(ttyFifo, doneFifo string) string {
+	return fmt.Sprintf(`while echo %s >> %s && read done < %s && [ "$done" = again ]; do :; done`,
+		shellargv.Quote(popupTTY), shellargv.Quote(ttyFifo), shellargv.Quote(doneFifo))
+}
+
+// popupHostRun is a PopupHost serving in the background on a popup that touches
+// no multiplexer.
+type popupHostRun struct {
+	host    *PopupHost
+	backend *ttyHandshakeBackend
+	served  chan error
+}
+
+func newPopupHost(t *testing.T, script func(ttyFifo, doneFifo string) string) *popupHostRun {
+	t.Helper()
+	dir := t.TempDir()
+	b := &ttyHandshakeBackend{script: script}
+	return &popupHostRun{
+		host: &PopupHost{
+			Popup:  &PopupLauncher{Backend: b, Workspace: WorkspaceOptions{Dir: dir}},
+			Socket: filepath.Join(dir, "host", "popup.sock"),
+			Timeouts: TimeoutsConfig{
+				TTYRead:   3 * time.Second,
+				DoneWrite: time.Second,
+				Linger:    300 * time.Millisecond,
+			},
+		},
+		backend: b,
+		served:  make(chan error, 1),
+	}
+}
+
+func (h *popupHostRun) start(ctx context.Context) error {
+	go func() { h.served <- h.host.Serve(ctx) }()
+	return nil
+}
+
+// wait returns what Serve returned, once the host has gone idle.
+func (h *popupHostRun) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-h.served:
+		return err
+	case <-time.After(20 * time.Second):
+		t.Fatal("the popup host never went idle")
+		return nil
+	}
+}
+
+// lingering points a fresh exchange at the host, counting the hosts it starts.
+func (h *popupHostRun) lingering(t *testing.T, started *int) *pinentryProxy {
+	t.Helper()
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.launcher.Linger = &PinentryLinger{
+		Socket: h.host.Socket,
+		StartHost: func(context.Context) error {
+			*started++
+			// The host outlives the exchange that started it, as the detached
+			// process the CLI starts does.
+			return h.start(t.Context())
+		},
+	}
+	p.feed(t, "OPTION ttyname=/dev/pts/9\nGETPIN\nBYE\n")
+	return p
+}
+
+// Consecutive exchanges draw in one popup: the first starts the host, which
+// opens it, the second finds the host serving and is handed the same terminal,
+// and the popup goes away only once the host has been idle.
+func TestPinentryLauncher_Call_reusesALingeringPopup(t *testing.T) {
+	h := newPopupHost(t, announceUntilDone)
+	var started int
+	for i := range 2 {
+		p := h.lingering(t, &started)
+		if err := p.launcher.Call(t.Context()); err != nil {
+			t.Fatalf("Call #%d: %v", i+1, err)
+		}
+		if got := p.forwarded(t); !strings.Contains(got, "OPTION ttyname="+popupTTY+"\n") {
+			t.Errorf("Call #%d forwarded %q, want the lingering popup's tty", i+1, got)
+		}
+		if len(p.backend.launched) != 0 {
+			t.Errorf("Call #%d launched a popup of its own", i+1)
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d hosts were started, want 1", started)
+	}
+
+	if err := h.wait(t); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if n := len(h.backend.launched); n != 1 {
+		t.Errorf("the host opened %d popups, want 1", n)
+	}
+	if _, err := os.Stat(h.host.Socket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the socket outlived the host: %v", err)
+	}
+}
+
+// A popup that went away between two leases — closed by hand, say — does not
+// answer being asked for its terminal again, and is replaced.
+func TestPopupHost_replacesAPopupThatIsGone(t *testing.T) {
+	h := newPopupHost(t, announceThenExit)
+	var started int
+	for i := range 2 {
+		if err := h.lingering(t, &started).launcher.Call(t.Context()); err != nil {
+			t.Fatalf("Call #%d: %v", i+1, err)
+		}
+	}
+	if err := h.wait(t); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if n := len(h.backend.launched); n != 2 {
+		t.Errorf("the host opened %d popups, want 2", n)
+	}
+}
+
+// A popup the host cannot open fails the exchange that asked for it, with the
+// reason the host ran into.
+func TestPopupHost_reportsAPopupItCannotOpen(t *testing.T) {
+	h := newPopupHost(t, nil)
+	h.backend.launchErr = errors.New("no server running")
+	var started int
+	err := h.lingering(t, &started).launcher.Call(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "popup host: ") ||
+		!strings.Contains(err.Error(), "no server running") {
+		t.Fatalf("Call = %v, want the host's launch failure", err)
+	}
+	if err := h.wait(t); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+}
+
+// An exchange that cannot get a host started says so instead of waiting for a
+// socket nobody will serve.
+func TestPinentryLauncher_Call_hostThatCannotStart(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.launcher.Linger = &PinentryLinger{
+		Socket:    filepath.Join(t.TempDir(), "popup.sock"),
+		StartHost: func(context.Context) error { return errors.New("no such file") },
+	}
+	err := p.launcher.Call(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "starting the popup host: no such file") {
+		t.Fatalf("Call = %v, want the start failure", err)
+	}
+}
+
+func TestListenPopupHost(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "host", "popup.sock")
+
+	l, err := listenPopupHost(socket)
+	if err != nil {
+		t.Fatalf("listenPopupHost: %v", err)
+	}
+	if _, err := listenPopupHost(socket); !errors.Is(err, errPopupHostRunning) {
+		t.Errorf("listenPopupHost on a served socket = %v, want errPopupHostRunning", err)
+	}
+
+	// A host that died leaves its socket behind, with nobody listening on it.
+	l.SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listenPopupHost(socket)
+	if err != nil {
+		t.Fatalf("listenPopupHost over a stale socket: %v", err)
+	}
+	l.Close()
+
+	// The directory is made private, and refused when it is not.
+	info, err := os.Stat(filepath.Dir(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("socket directory mode = %o, want 700", perm)
+	}
+	if err := os.Chmod(filepath.Dir(socket), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenPopupHost(socket); err == nil {
+		t.Error("listenPopupHost accepted a world-writable directory")
+	}
+}
+
+// A connection that asks for nothing is not a lease: probing the host opens no
+// popup, and the next exchange is served as usual.
+func TestPopupHost_ignoresAProbe(t *testing.T) {
+	h := newPopupHost(t, announceUntilDone)
+	var started int
+	if err := h.lingering(t, &started).launcher.Call(t.Context()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	conn, err := net.Dial("unix", h.host.Socket)
+	if err != nil {
+		t.Fatalf("probing the host: %v", err)
+	}
+	conn.Close()
+	if err := h.lingering(t, &started).launcher.Call(t.Context()); err != nil {
+		t.Fatalf("Call after the probe: %v", err)
+	}
+	if err := h.wait(t); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if n := len(h.backend.launched); n != 1 {
+		t.Errorf("the host opened %d popups, want 1", n)
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -21,8 +24,10 @@ import (
 // It opens a popup whose only job is to report the terminal it runs on and stay
 // alive, runs pinentry outside the popup on that terminal, and rewrites the
 // "OPTION ttyname=" line gpg-agent sends so the prompt appears there instead of
-// on whichever terminal gpg-agent happened to pick. The popup is dismissed once
-// pinentry exits.
+// on whichever terminal gpg-agent happened to pick — along with ttytype,
+// lc-ctype and lc-messages, so pinentry draws for the popup's terminal rather
+// than the agent's. The popup is dismissed once pinentry exits, unless Linger
+// hands it to a PopupHost to keep for the next exchange.
 //
 // A launcher is one-shot in the exec.Cmd sense: fill the fields in, call Call
 // once.
@@ -39,8 +44,19 @@ type PinentryLauncher struct {
 	// arguments as gpg-agent invoked them.
 	PinentryArgs []string
 	// Timeouts bounds each stage of the exchange. Zero fields fall back to
-	// DefaultConfig().Timeouts.
+	// DefaultConfig().Timeouts. Linger is the host's business, not the
+	// exchange's, and is not read here.
 	Timeouts TimeoutsConfig
+	// Linger, when set, leases the terminal of a popup a PopupHost keeps open
+	// instead of opening one: the host is started when none is serving yet, and
+	// the popup outlives the exchange. nil opens a popup for this exchange alone.
+	Linger *PinentryLinger
+	// Fallback is tried in order when Popup's backend cannot open a popup, or
+	// its popup never announces a terminal: the next hop starts the exchange over,
+	// on a popup of its own or, for a direct hop, on no popup at all. Popup's
+	// Backend may be nil when Fallback is set, and the chain then starts at its
+	// first hop. Only the first hop lingers.
+	Fallback []PinentryFallback
 
 	// The process stdio the exchange runs on, nil meaning os.Stdin, os.Stdout and
 	// os.Stderr: the input is relayed through a pipe the exchange may close, the
@@ -52,23 +68,51 @@ type PinentryLauncher struct {
 	stdout, stderr io.Writer
 }
 
+// PinentryFallback is one hop of PinentryLauncher.Fallback: another popup
+// backend to try the exchange on, or no popup at all.
+type PinentryFallback struct {
+	// Backend opens the popup, as PinentryLauncher.Popup's own Backend does, and
+	// must implement TTYHandshaker likewise. nil makes the hop a direct one.
+	Backend Backend
+	// PinentryPath is the binary a direct hop hands the Assuan stream to exactly
+	// as gpg-agent sent it, so it draws wherever gpg-agent asked: on the agent's
+	// terminal, or in a window of its own for a graphical pinentry. Empty means
+	// the launcher's PinentryPath. A popup hop ignores it and runs that one.
+	PinentryPath string
+}
+
+// name is how a hop is told apart in the log and in errors.
+func (f PinentryFallback) name() string {
+	if f.Backend != nil {
+		return f.Backend.Name()
+	}
+	return "pinentry " + f.PinentryPath
+}
+
+// popupUnavailableError is an exchange that never got a terminal to run
+// pinentry on: the popup could not be opened, or never announced one. Pinentry
+// has not been started by then, and gpg-agent waits for its greeting before it
+// sends anything, so none of the Assuan stream has been read either — which is
+// what lets the next hop of a fallback chain start the exchange over.
+type popupUnavailableError struct{ err error }
+
+func (e *popupUnavailableError) Error() string { return e.err.Error() }
+func (e *popupUnavailableError) Unwrap() error { return e.err }
+
 // Call runs the exchange: it returns once pinentry has exited and the popup has
 // been told to go away, or once the whole exchange has run past
-// Timeouts.Overall.
+// Timeouts.Overall. A popup that cannot be opened, or never announces its
+// terminal, moves the exchange on to the next hop of Fallback; the error of
+// every hop is returned when none of them got as far as starting pinentry.
 func (l *PinentryLauncher) Call(ctx context.Context) (err error) {
 	if l.Popup == nil {
 		return errors.New("PinentryLauncher.Popup must be set")
 	}
-	if l.Popup.Backend == nil {
+	if l.Popup.Backend == nil && len(l.Fallback) == 0 {
 		return errors.New("PinentryLauncher.Popup.Backend must be set")
 	}
-	handshaker, ok := l.Popup.Backend.(TTYHandshaker)
-	if !ok {
-		return fmt.Errorf(
-			"backend %q does not implement runinpopup.TTYHandshaker:"+
-				" it cannot host the pinentry tty handshake",
-			l.Popup.Backend.Name(),
-		)
+	if l.Linger != nil && l.Linger.StartHost == nil {
+		return errors.New("PinentryLauncher.Linger.StartHost must be set")
 	}
 
 	def := DefaultConfig()
@@ -102,27 +146,110 @@ func (l *PinentryLauncher) Call(ctx context.Context) (err error) {
 		}
 	}()
 
-	exchange := &pinentryExchange{
-		rendezvous: &popupTTYHandshake{
-			backend:        handshaker,
-			launcher:       l.Popup,
-			logger:         logger,
-			dir:            dir,
-			readTimeout:    timeouts.TTYRead,
-			dismissTimeout: timeouts.DoneWrite,
-		},
-		pinentry: &pinentryCommand{
-			path:   cmp.Or(l.PinentryPath, def.PinentryPath),
-			args:   l.PinentryArgs,
-			stdout: cmp.Or[io.Writer](l.stdout, os.Stdout),
-			stderr: cmp.Or[io.Writer](l.stderr, os.Stderr),
-		},
-		input:  input.end,
-		logger: logger,
+	hops := l.Fallback
+	if l.Popup.Backend != nil {
+		hops = slices.Concat([]PinentryFallback{{Backend: l.Popup.Backend}}, l.Fallback)
+	}
+	var failures []error
+	for i, hop := range hops {
+		path := cmp.Or(l.PinentryPath, def.PinentryPath)
+		if hop.Backend == nil {
+			path = cmp.Or(hop.PinentryPath, path)
+		}
+		rendezvous, err := l.rendezvous(hop, i, dir, timeouts, logger)
+		if err == nil {
+			exchange := &pinentryExchange{
+				rendezvous: rendezvous,
+				pinentry: &pinentryCommand{
+					path:   path,
+					args:   l.PinentryArgs,
+					stdout: cmp.Or[io.Writer](l.stdout, os.Stdout),
+					stderr: cmp.Or[io.Writer](l.stderr, os.Stderr),
+				},
+				input:  input.end,
+				logger: logger,
+			}
+			err = exchange.run(ctx)
+			if _, unavailable := errors.AsType[*popupUnavailableError](err); !unavailable {
+				return err
+			}
+		}
+		failures = append(failures, fmt.Errorf("%s: %w", hop.name(), err))
+		if i+1 < len(hops) && ctx.Err() == nil {
+			logger.Warn(
+				"no popup to run pinentry on; falling back",
+				slog.String("failed", hop.name()),
+				slog.String("next", hops[i+1].name()),
+				slog.Any("err", err),
+			)
+			continue
+		}
+		break
+	}
+	if len(failures) == 1 {
+		return errors.Unwrap(failures[0])
+	}
+	return errors.Join(failures...)
+}
+
+// rendezvous is where the i-th hop gets its terminal from. The launcher's own
+// popup lingers when Linger says so; every other popup is opened for this
+// exchange alone, the ones after the first in a directory of their own, since
+// the one before may have left its FIFOs behind.
+func (l *PinentryLauncher) rendezvous(
+	hop PinentryFallback,
+	i int,
+	dir string,
+	timeouts TimeoutsConfig,
+	logger *slog.Logger,
+) (ttyRendezvous, error) {
+	if hop.Backend == nil {
+		return directRendezvous{}, nil
+	}
+	handshaker, ok := hop.Backend.(TTYHandshaker)
+	if !ok {
+		return nil, &popupUnavailableError{fmt.Errorf(
+			"backend %q does not implement runinpopup.TTYHandshaker:"+
+				" it cannot host the pinentry tty handshake",
+			hop.Backend.Name(),
+		)}
 	}
-	return exchange.run(ctx)
+	if i == 0 && l.Popup.Backend != nil && l.Linger != nil {
+		return &lingerRendezvous{
+			linger:       l.Linger,
+			logger:       logger,
+			startTimeout: timeouts.TTYRead,
+		}, nil
+	}
+	if i > 0 {
+		dir = filepath.Join(dir, "fallback-"+strconv.Itoa(i))
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	launcher := *l.Popup
+	launcher.Backend = hop.Backend
+	return &popupTTYHandshake{
+		backend:        handshaker,
+		launcher:       &launcher,
+		logger:         logger,
+		dir:            dir,
+		readTimeout:    timeouts.TTYRead,
+		dismissTimeout: timeouts.DoneWrite,
+	}, nil
 }
 
+// directRendezvous is a hop with no popup: it announces no terminal, so the
+// Assuan stream reaches pinentry with nothing rewritten, and has nothing to
+// dismiss.
+type directRendezvous struct{}
+
+func (directRendezvous) acquire(context.Context) (popupTerminal, error) {
+	return popupTerminal{}, nil
+}
+
+func (directRendezvous) dismiss() error { return nil }
+
 // pinentryExchange is one proxied Assuan exchange: the popup announcing a
 // terminal, the pinentry process drawing on it, and the rewriting that points
 // the one at the other.
@@ -140,7 +267,7 @@ type pinentryExchange struct {
 }
 
 func (e *pinentryExchange) run(ctx context.Context) (err error) {
-	tty, acquireErr := e.rendezvous.acquire(ctx)
+	term, acquireErr := e.rendezvous.acquire(ctx)
 	// Registered even when the acquisition failed: a popup that is open but never
 	// announced anything still has to be told to go away, or it lingers until the
 	// overall timeout kills it. Failing to dismiss it is worth reporting — but
@@ -153,19 +280,19 @@ func (e *pinentryExchange) run(ctx context.Context) (err error) {
 		}
 	}()
 	if acquireErr != nil {
-		return acquireErr
+		return &popupUnavailableError{acquireErr}
 	}
 
 	pinentryInput, err := e.pinentry.start(ctx)
 	if err != nil {
 		return err
 	}
-	e.logger.Debug("pinentry started", slog.String("tty", tty))
+	e.logger.Debug("pinentry started", slog.String("tty", term.TTY))
 
 	relay := new(errgroup.Group)
 	relay.Go(func() error {
 		defer pinentryInput.Close()
-		return rewriteAssuanTTY(e.input, pinentryInput, tty)
+		return rewriteAssuanOptions(e.input, pinentryInput, term)
 	})
 
 	waitErr := e.pinentry.wait()
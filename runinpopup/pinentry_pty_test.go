@@ -0,0 +1,111 @@
+package runinpopup_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngicks/run-in-tmux-popup/runinpopup"
+	"github.com/ngicks/run-in-tmux-popup/runinpopup/backend"
+)
+
+// The whole pinentry proxy on the pty backend, with no multiplexer anywhere: a
+// real popup announces a real terminal, the test binary stands in for pinentry
+// and prompts on that terminal, and the test types the PIN at its master side
+// the way a user types at a popup.
+func TestPinentryLauncher_Call_onPty(t *testing.T) {
+	dir := t.TempDir()
+	b, err := backend.NewPty(backend.Options{})
+	if err != nil {
+		t.Fatalf("NewPty: %v", err)
+	}
+
+	stdin, feed, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating the assuan stdin pipe: %v", err)
+	}
+	answers, stdout, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("creating the assuan stdout pipe: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, f := range []*os.File{stdin, feed, answers, stdout} {
+			f.Close()
+		}
+	})
+
+	transcript := filepath.Join(dir, "transcript")
+	launcher := &runinpopup.PinentryLauncher{
+		Popup: &runinpopup.PopupLauncher{
+			Backend:   b,
+			Workspace: runinpopup.WorkspaceOptions{Dir: dir},
+		},
+		PinentryPath: os.Args[0],
+		PinentryArgs: []string{
+			runinpopup.FakePinentryCommand,
+			transcript,
+			filepath.Join(dir, "pinentry.pid"),
+			runinpopup.PinentryPromptsOnTTY,
+		},
+		Timeouts: runinpopup.TimeoutsConfig{
+			Overall:   20 * time.Second,
+			TTYRead:   10 * time.Second,
+			DoneWrite: time.Second,
+		},
+	}
+	launcher.SetStdio(stdin, stdout, io.Discard)
+
+	if _, err := feed.WriteString(
+		"OPTION ttyname=/dev/pts/9\nSETPROMPT PIN:\nGETPIN\nBYE\n",
+	); err != nil {
+		t.Fatalf("feeding the assuan stream: %v", err)
+	}
+	called := make(chan error, 1)
+	go func() { called <- launcher.Call(t.Context()) }()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+	term, err := b.Next(ctx)
+	if err != nil {
+		t.Skipf("no pty popup was opened: %v; Call reported %v", err, <-called)
+	}
+	if err := term.WaitFor(ctx, "PIN: "); err != nil {
+		t.Fatalf("%v; the popup shows %q", err, term.Screen())
+	}
+	if _, err := term.Write([]byte("hunter2\r")); err != nil {
+		t.Fatalf("typing at the popup: %v", err)
+	}
+
+	select {
+	case err := <-called:
+		if err != nil {
+			t.Fatalf("Call: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the exchange never ended")
+	}
+	// The handshake payload exits once dismissed, which is the popup closing.
+	if err := term.Wait(); err != nil {
+		t.Errorf("the popup's payload: %v", err)
+	}
+
+	stdout.Close()
+	got, err := io.ReadAll(answers)
+	if err != nil {
+		t.Fatalf("reading what pinentry answered: %v", err)
+	}
+	if want := "OK\nOK\nD hunter2\nOK\nOK\n"; string(got) != want {
+		t.Errorf("pinentry answered %q, want %q", got, want)
+	}
+	forwarded, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatalf("reading what was forwarded to pinentry: %v", err)
+	}
+	if want := "OPTION ttyname=" + term.Name() + "\n"; !strings.HasPrefix(string(forwarded), want) {
+		t.Errorf("pinentry was forwarded %q, want it pointed at %s", forwarded, term.Name())
+	}
+}
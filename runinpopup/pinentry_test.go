@@ -39,6 +39,10 @@ const (
 	pinentryReadsUntilEOF = "read-until-eof"
 	// pinentryHangs never exits on its own, so only cancellation can end it.
 	pinentryHangs = "hang"
+	// pinentryPromptsOnTTY answers the exchange the way a real pinentry does:
+	// GETPIN prompts on the terminal "OPTION ttyname=" named and answers with the
+	// line typed there, everything else with OK.
+	pinentryPromptsOnTTY = "prompt-on-tty"
 )
 
 // runFakePinentry answers the argv newPinentryProxy builds:
@@ -66,6 +70,13 @@ func runFakePinentry() (int, bool) {
 		time.Sleep(time.Hour)
 		return 0, true
 	}
+	if mode == pinentryPromptsOnTTY {
+		if err := promptOnTTY(transcript); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1, true
+		}
+		return 0, true
+	}
 
 	var forwarded bytes.Buffer
 	r := bufio.NewReader(os.Stdin)
@@ -83,6 +94,66 @@ func runFakePinentry() (int, bool) {
 	return 0, true
 }
 
+// promptOnTTY is the pinentryPromptsOnTTY side of the exchange. It records the
+// forwarded stream like the other modes, so a test can also check the ttyname
+// it was handed.
+func promptOnTTY(transcript string) error {
+	var (
+		forwarded bytes.Buffer
+		ttyname   string
+	)
+	r := bufio.NewReader(os.Stdin)
+	for {
+		line, err := r.ReadString('\n')
+		forwarded.WriteString(line)
+		if err != nil {
+			break
+		}
+		command := strings.TrimSuffix(line, "\n")
+		if l := parseAssuanLine(command); l.verb == assuanVerbOption {
+			opt, err := parseAssuanOption(l.args)
+			if err != nil {
+				return err
+			}
+			if opt.name == "ttyname" {
+				ttyname = opt.value
+			}
+		}
+		reply := "OK\n"
+		if command == "GETPIN" {
+			pin, err := readPIN(ttyname)
+			if err != nil {
+				return err
+			}
+			reply = assuanVerbData + " " + assuanEscape(pin) + "\nOK\n"
+		}
+		if _, err := os.Stdout.WriteString(reply); err != nil {
+			return err
+		}
+		if command == "BYE" {
+			break
+		}
+	}
+	return os.WriteFile(transcript, forwarded.Bytes(), 0o600)
+}
+
+// readPIN prompts on the terminal and reads the line typed at it.
+func readPIN(ttyname string) (string, error) {
+	tty, err := os.OpenFile(ttyname, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("opening the terminal to prompt on: %w", err)
+	}
+	defer tty.Close()
+	if _, err := tty.WriteString("PIN: "); err != nil {
+		return "", err
+	}
+	pin, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("reading the PIN off %s: %w", ttyname, err)
+	}
+	return strings.TrimSpace(pin), nil
+}
+
 // ttyHandshakeBackend is shellBackend hosting the tty handshake, so the whole
 // exchange can be driven without a terminal multiplexer: its popup payload runs
 // in a local shell and speaks the FIFO protocol the real backends' payloads
@@ -582,8 +653,8 @@ type fakeRendezvous struct {
 	dismissed  int
 }
 
-func (f *fakeRendezvous) acquire(context.Context) (string, error) {
-	return f.tty, f.acquireErr
+func (f *fakeRendezvous) acquire(context.Context) (popupTerminal, error) {
+	return popupTerminal{TTY: f.tty}, f.acquireErr
 }
 
 func (f *fakeRendezvous) dismiss() error {
@@ -763,3 +834,155 @@ func TestPinentryExchange_run(t *testing.T) {
 		}
 	})
 }
+
+// The announcement is the tty, then whatever else the payload reported about
+// its terminal; an older payload reporting only the tty still announces one.
+func TestParseTTYAnnouncement(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		line    string
+		want    popupTerminal
+		wantErr string
+	}{
+		{name: "tty only", line: "/dev/pts/3\n", want: popupTerminal{TTY: "/dev/pts/3"}},
+		{
+			name: "everything",
+			line: "/dev/pts/3\txterm-kitty\tC.UTF-8\tde_DE.UTF-8\n",
+			want: popupTerminal{
+				TTY:        "/dev/pts/3",
+				Term:       "xterm-kitty",
+				LCCtype:    "C.UTF-8",
+				LCMessages: "de_DE.UTF-8",
+			},
+		},
+		{
+			name: "a locale nobody set",
+			line: "/dev/pts/3\tscreen\t\t\n",
+			want: popupTerminal{TTY: "/dev/pts/3", Term: "screen"},
+		},
+		{name: "no tty", line: "\tscreen\tC\tC\n", wantErr: "empty tty"},
+		{name: "nothing", line: "", wantErr: "empty tty"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTTYAnnouncement(tc.line, nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("parseTTYAnnouncement = %+v, %v; want an error containing %q",
+						got, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTTYAnnouncement: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("parseTTYAnnouncement = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// A popup that cannot be opened hands the exchange to the next hop of the
+// fallback chain, which starts it over on a popup of its own: nothing of the
+// Assuan stream was read by then, so the pinentry it starts sees all of it.
+func TestPinentryLauncher_Call_fallsBackToTheNextPopup(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.backend.launchErr = errors.New("no server running")
+	next := new(ttyHandshakeBackend)
+	p.launcher.Fallback = []PinentryFallback{{Backend: next}}
+	p.feed(t, "OPTION ttyname=/dev/pts/9\nGETPIN\nBYE\n")
+
+	if err := p.launcher.Call(t.Context()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	want := "OPTION ttyname=" + popupTTY + "\nGETPIN\nBYE\n"
+	if got := p.forwarded(t); got != want {
+		t.Errorf("forwarded to pinentry:\n%q\nwant:\n%q", got, want)
+	}
+	if len(next.launched) != 1 {
+		t.Errorf("the fallback opened %d popups, want 1", len(next.launched))
+	}
+}
+
+// A direct hop has no popup to point pinentry at, so the stream reaches it as
+// gpg-agent sent it: a terminal pinentry draws where the agent asked, a
+// graphical one in a window of its own.
+func TestPinentryLauncher_Call_fallsBackToAPinentryOfItsOwn(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.backend.script = staysSilent
+	p.launcher.Timeouts.TTYRead = 150 * time.Millisecond
+	p.launcher.Fallback = []PinentryFallback{{}}
+	stream := "OPTION ttyname=/dev/pts/9\nOPTION ttytype=xterm\nGETPIN\nBYE\n"
+	p.feed(t, stream)
+
+	if err := p.launcher.Call(t.Context()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := p.forwarded(t); got != stream {
+		t.Errorf("forwarded to pinentry:\n%q\nwant it untouched:\n%q", got, stream)
+	}
+}
+
+// The chain may start at its first hop, when there was no backend to begin
+// with.
+func TestPinentryLauncher_Call_fallbackWithoutABackend(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.launcher.Popup.Backend = nil
+	p.launcher.Fallback = []PinentryFallback{{Backend: p.backend}}
+	p.feed(t, "OPTION ttyname=/dev/pts/9\nBYE\n")
+
+	if err := p.launcher.Call(t.Context()); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := p.forwarded(t); !strings.Contains(got, "ttyname="+popupTTY) {
+		t.Errorf("forwarded %q, want the fallback popup's tty", got)
+	}
+}
+
+// When no hop gets as far as a terminal, the error names every one of them and
+// what stopped it.
+func TestPinentryLauncher_Call_everyHopFails(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.backend.launchErr = errors.New("no server running")
+	next := &ttyHandshakeBackend{handshakeErr: errors.New("no fifo channel")}
+	p.launcher.Fallback = []PinentryFallback{{Backend: next}}
+	p.feed(t, "BYE\n")
+
+	err := p.launcher.Call(t.Context())
+
+	for _, want := range []error{p.backend.launchErr, next.handshakeErr} {
+		if !errors.Is(err, want) {
+			t.Errorf("err = %v, want it to wrap %v", err, want)
+		}
+	}
+	if err != nil {
+		lines := strings.Split(err.Error(), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "shell: ") ||
+			!strings.HasPrefix(lines[1], "shell: ") {
+			t.Errorf("err = %v, want one line for each hop, naming it", err)
+		}
+	}
+	if _, err := os.Stat(p.pidfile); err == nil {
+		t.Error("pinentry was started although no hop had a terminal")
+	}
+}
+
+// Once pinentry has been started it has read the stream, and no other hop can
+// have it again: its failure is the exchange's, and the chain ends there.
+func TestPinentryLauncher_Call_noFallbackOncePinentryRan(t *testing.T) {
+	p := newPinentryProxy(t, pinentryReadsUntilBye)
+	p.backend.script = announceThenExit
+	p.launcher.PinentryPath = filepath.Join(p.dir, "no-such-pinentry")
+	next := new(ttyHandshakeBackend)
+	p.launcher.Fallback = []PinentryFallback{{Backend: next}, {}}
+	p.feed(t, "BYE\n")
+
+	err := p.launcher.Call(t.Context())
+
+	if err == nil || !strings.Contains(err.Error(), "failed to start") {
+		t.Fatalf("err = %v, want the pinentry start failure surfaced", err)
+	}
+	if len(next.launched) != 0 {
+		t.Error("the chain fell back after pinentry had been started")
+	}
+}
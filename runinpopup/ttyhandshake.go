@@ -16,16 +16,42 @@ import (
 
 // TTYHandshake is how one backend's popup announces the terminal it runs on.
 type TTYHandshake struct {
-	// Spec is the popup payload: it must write the popup's tty name as a single
-	// line to the tty FIFO, then block reading the done FIFO so the popup stays
-	// open until the caller is finished with that terminal.
+	// Spec is the popup payload: it must write a single line to the tty FIFO,
+	// then block reading the done FIFO so the popup stays open until the caller
+	// is finished with that terminal. The line is the popup's tty name, followed,
+	// tab-separated, by its $TERM and the locale it resolves for LC_CTYPE and for
+	// LC_MESSAGES, any of which may be empty or missing; see TTYAnnounceScript.
+	// What arrives on the done FIFO is a line of its own: "again" asks for the
+	// announcement anew and the wait to start over, anything else ends the
+	// payload. TTYHandshakeScript does all of it.
 	Spec PopupSpec
-	// ValidateTTY extracts the tty name from the line read off the tty FIFO,
-	// rejecting anything the popup would not have written. nil accepts the line
-	// as-is, minus surrounding space.
+	// ValidateTTY extracts the tty name from the line's first field, rejecting
+	// anything the popup would not have written. nil accepts the field as-is,
+	// minus surrounding space.
 	ValidateTTY func(line string) (string, error)
 }
 
+// TTYAnnounceScript is the shell command a handshake payload announces its
+// terminal with, on stdout: the tty name, $TERM, and the locale the C library
+// would resolve for LC_CTYPE and LC_MESSAGES, tab-separated on one line.
+// Pinentry draws on that terminal from outside the popup, so everything it needs
+// to know about it has to be reported from inside.
+const TTYAnnounceScript = `printf '%s\t%s\t%s\t%s\n' "$(tty)" "$TERM"` +
+	` "${LC_ALL:-${LC_CTYPE:-$LANG}}" "${LC_ALL:-${LC_MESSAGES:-$LANG}}"`
+
+// TTYHandshakeScript is a whole handshake payload as one shell command, for the
+// backends whose popups run a script: announce the terminal on ttyFifo, wait for
+// a line on doneFifo, and start over when that line is "again". A popup that
+// lingers between pinentry exchanges is told "again" by each one it is handed
+// to, which both re-reads its terminal and proves it is still there to read.
+//
+// The paths are spliced in as given, unquoted, so a backend that hands them over
+// in the environment passes "${TTY_FIFO_FILE}" rather than a path.
+func TTYHandshakeScript(ttyFifo, doneFifo string) string {
+	return "while " + TTYAnnounceScript + " >> " + ttyFifo +
+		" && read done < " + doneFifo + ` && [ "$done" = again ]; do :; done`
+}
+
 // TTYHandshaker is a Backend whose popups can report the terminal they run on
 // and stay alive until they are dismissed.
 //
@@ -42,7 +68,7 @@ type TTYHandshaker interface {
 // popup once the caller is done with it.
 type ttyRendezvous interface {
 	// acquire opens a popup and blocks until it announces its terminal.
-	acquire(ctx context.Context) (tty string, err error)
+	acquire(ctx context.Context) (popupTerminal, error)
 	// dismiss releases the terminal back to the popup and gives back what the
 	// launch took. It does nothing when no popup was ever opened.
 	dismiss() error
@@ -67,13 +93,21 @@ type popupTTYHandshake struct {
 	// dismissal.
 	readTimeout, dismissTimeout time.Duration
 
-	// popup and doneFifo are set once the popup is open — the point from which
-	// there is something to dismiss.
-	popup    *PopupCommand
-	doneFifo string
+	// done is the done FIFO, held open from before the launch until the
+	// dismissal. Read-write, so the open never waits for the payload, and held,
+	// so a line written between two of the payload's reads stays in the pipe
+	// instead of being dropped along with the last descriptor: a popup that is
+	// handed to the next exchange is told so while it may still be on its way
+	// back to the read.
+	done *os.File
+	// popup, ttyFifo and validateTTY are set once the popup is open — the point
+	// from which there is something to dismiss, and to ask for its terminal again.
+	popup       *PopupCommand
+	ttyFifo     string
+	validateTTY func(line string) (string, error)
 }
 
-func (h *popupTTYHandshake) acquire(ctx context.Context) (string, error) {
+func (h *popupTTYHandshake) acquire(ctx context.Context) (popupTerminal, error) {
 	ttyFifo := filepath.Join(h.dir, "tty")
 	doneFifo := filepath.Join(h.dir, "done")
 
@@ -82,15 +116,23 @@ func (h *popupTTYHandshake) acquire(ctx context.Context) (string, error) {
 	// there yet fails the payload instead of making it wait.
 	for _, s := range []string{ttyFifo, doneFifo} {
 		if err := fifo.Mkfifo(s); err != nil {
-			return "", err
+			return popupTerminal{}, err
 		}
 	}
 
 	h.logger.Debug("tty fifo created")
 
+	done, err := os.OpenFile(doneFifo, os.O_RDWR, 0)
+	if err != nil {
+		return popupTerminal{}, fmt.Errorf("opening done fifo: %w", err)
+	}
+	h.done = done
+
 	handshake, err := h.backend.NewTTYHandshake(ttyFifo, doneFifo)
 	if err != nil {
-		return "", fmt.Errorf("backend %s: building tty handshake: %w", h.backend.Name(), err)
+		return popupTerminal{}, fmt.Errorf(
+			"backend %s: building tty handshake: %w", h.backend.Name(), err,
+		)
 	}
 
 	// No payload stdio is allocated: the handshake payload announces its terminal
@@ -98,25 +140,44 @@ func (h *popupTTYHandshake) acquire(ctx context.Context) (string, error) {
 	// that terminal is the whole point of the exchange.
 	popup, err := h.launcher.Exec(ctx, handshake.Spec, PopupStreams{})
 	if err != nil {
-		return "", err
+		return popupTerminal{}, err
 	}
-	h.popup, h.doneFifo = popup, doneFifo
+	h.popup, h.ttyFifo, h.validateTTY = popup, ttyFifo, handshake.ValidateTTY
+
+	return h.readAnnouncement(h.readTimeout)
+}
+
+// renew asks a popup that already announced its terminal to announce it again,
+// and waits at most timeout for it to. A payload that does not answer is one
+// that is gone — closed by hand, or killed along with its multiplexer — and
+// renew failing is how a lingering popup's keeper finds out.
+func (h *popupTTYHandshake) renew(timeout time.Duration) (popupTerminal, error) {
+	if h.popup == nil {
+		return popupTerminal{}, errors.New("no popup to renew")
+	}
+	if err := h.writeDone("again\n", h.dismissTimeout); err != nil {
+		return popupTerminal{}, err
+	}
+	return h.readAnnouncement(timeout)
+}
 
+// readAnnouncement reads the next line the payload writes to the tty FIFO.
+func (h *popupTTYHandshake) readAnnouncement(timeout time.Duration) (popupTerminal, error) {
 	h.logger.Debug("opening tty fifo")
 	// Read-write rather than read-only: this end is then a writer too, so the open
 	// returns at once instead of blocking until the payload arrives, and the read
 	// below cannot end in an EOF the moment the payload closes its end. Nothing
 	// but the deadline ends the wait, which is what turns a popup that never
 	// announces anything into a timeout rather than an empty answer.
-	f, err := os.OpenFile(ttyFifo, os.O_RDWR, 0)
+	f, err := os.OpenFile(h.ttyFifo, os.O_RDWR, 0)
 	if err != nil {
-		return "", fmt.Errorf("failed to open tty: %w", err)
+		return popupTerminal{}, fmt.Errorf("failed to open tty: %w", err)
 	}
 	// The announcement is a single line, so this end has nothing left to do once
 	// it has arrived; what keeps the popup waiting is the done FIFO, not this one.
 	defer f.Close()
 
-	_ = f.SetReadDeadline(time.Now().Add(h.readTimeout))
+	_ = f.SetReadDeadline(time.Now().Add(timeout))
 
 	scanner := bufio.NewScanner(f)
 
@@ -124,29 +185,57 @@ func (h *popupTTYHandshake) acquire(ctx context.Context) (string, error) {
 	scanner.Scan()
 	line := scanner.Text()
 	if scanner.Err() != nil {
-		return "", fmt.Errorf("scan failed: %w", scanner.Err())
+		return popupTerminal{}, fmt.Errorf("scan failed: %w", scanner.Err())
 	}
 
-	validateTTY := handshake.ValidateTTY
+	term, err := parseTTYAnnouncement(line, h.validateTTY)
+	if err != nil {
+		return popupTerminal{}, err
+	}
+
+	h.logger.Debug(
+		"got TTY from popup",
+		slog.String("tty", term.TTY),
+		slog.String("term", term.Term),
+		slog.String("lc-ctype", term.LCCtype),
+		slog.String("lc-messages", term.LCMessages),
+	)
+	return term, nil
+}
+
+// parseTTYAnnouncement splits the line a popup announced its terminal with, as
+// TTYAnnounceScript writes it. Only the tty is required: an announcement with
+// nothing after it is a payload that reports nothing else, and what it left out
+// is left as gpg-agent said it.
+func parseTTYAnnouncement(
+	line string,
+	validateTTY func(line string) (string, error),
+) (popupTerminal, error) {
+	fields := strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	fields = append(fields, make([]string, 4)...)
 	if validateTTY == nil {
 		validateTTY = func(line string) (string, error) { return strings.TrimSpace(line), nil }
 	}
-	tty, err := validateTTY(line)
+	tty, err := validateTTY(fields[0])
 	if err != nil {
-		return "", err
+		return popupTerminal{}, err
 	}
-
-	h.logger.Debug("popup started")
-
 	if tty == "" {
-		return "", errors.New("the popup announced an empty tty")
+		return popupTerminal{}, errors.New("the popup announced an empty tty")
 	}
-
-	h.logger.Debug("got TTY from popup")
-	return tty, nil
+	return popupTerminal{
+		TTY:        tty,
+		Term:       strings.TrimSpace(fields[1]),
+		LCCtype:    strings.TrimSpace(fields[2]),
+		LCMessages: strings.TrimSpace(fields[3]),
+	}, nil
 }
 
 func (h *popupTTYHandshake) dismiss() error {
+	if h.done == nil {
+		return nil
+	}
+	defer h.done.Close()
 	if h.popup == nil {
 		return nil
 	}
@@ -157,16 +246,15 @@ func (h *popupTTYHandshake) dismiss() error {
 	defer h.popup.release()
 
 	h.logger.Debug("waiting to done fifo")
-	// Read-write again: a popup the user dismissed by hand is already gone, and a
-	// write-only open would block forever waiting for a reader that never comes.
-	done, err := os.OpenFile(h.doneFifo, os.O_RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("opening done fifo: %w", err)
-	}
-	defer done.Close()
+	return h.writeDone("done\n", h.dismissTimeout)
+}
 
-	_ = done.SetWriteDeadline(time.Now().Add(h.dismissTimeout))
-	if _, err := done.Write([]byte("done\n")); err != nil {
+// writeDone writes one line to the done FIFO. A popup the user dismissed by hand
+// is already gone, and the line then sits in the pipe unread rather than failing
+// anything: the read-write descriptor is the reader it would otherwise wait for.
+func (h *popupTTYHandshake) writeDone(line string, timeout time.Duration) error {
+	_ = h.done.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := h.done.Write([]byte(line)); err != nil {
 		return fmt.Errorf("writing done fifo: %w", err)
 	}
 	return nil
@@ -1,33 +1,66 @@
 package runinpopup
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // PinentryUserData is the parsed form of the PINENTRY_USER_DATA environment
 // variable — the wire format gpg-agent forwards verbatim from the invoking
-// environment to pinentry. Fields are positional and colon-separated:
+// environment to pinentry. It comes in two encodings. The original one is
+// positional and colon-separated:
 //
 //	KIND:path:session_id:client_id:session_meta[:rest...]
 //
 // e.g. "TMUX_POPUP:/usr/bin/tmux:$1:%1:/run/user/1000/tmux-1000/default,111,0".
 //
+// It cannot carry a field holding a colon — a tmux socket under a directory
+// named with one — nor grow a field without shifting every one after it, which
+// wrappers and the legacy binaries written against it would misread. So a
+// value starting with "RIP1;" is read as the versioned one instead, keyed and
+// semicolon-separated in any order:
+//
+//	RIP1;kind=TMUX_POPUP;bin=/usr/bin/tmux;session=$1;client=%251;socket=/a:b/default,111,0
+//
+// Its values are percent-escaped: '%', ';', spaces and control characters are
+// written as "%XX". The keys are kind, bin, session, client and socket, for
+// Kind, Path, SessionId, ClientId and SessionMeta; a key given twice takes its
+// last value.
+//
+// A "_DYNAMIC" kind leaves session_id and client_id out, carrying only where
+// the multiplexer's server is, and has them looked up when the popup is opened:
+// "TMUX_POPUP_DYNAMIC:/usr/bin/tmux:::/run/user/1000/tmux-1000/default,111,0".
+//
 // Every field is optional: a short value simply leaves the trailing fields
 // empty, and callers validate the fields they actually need.
 type PinentryUserData struct {
-	// Kind names the host program, "TMUX_POPUP", "TMUX_FLOATING_PANE" or
-	// "ZELLIJ_POPUP". A "_DEBUG" suffix additionally requests debug logging.
+	// Kind names the host program, "TMUX_POPUP", "TMUX_FLOATING_PANE",
+	// "ZELLIJ_POPUP", "SCREEN_POPUP", "NVIM_POPUP", "WEZTERM_POPUP", "KITTY_POPUP"
+	// or "KITTY_OS_WINDOW". A "_DYNAMIC" suffix asks for the session and the
+	// client to be resolved at call time, which the tmux kinds and
+	// "ZELLIJ_POPUP" support; a "_DEBUG" suffix, after it when both are given,
+	// additionally requests debug logging.
 	Kind string
-	// Path is the multiplexer binary to invoke (tmux / zellij).
+	// Path is the multiplexer binary to invoke (tmux / zellij / screen / wezterm /
+	// kitty). nvim has none: its requests go to the server socket directly.
 	Path string
-	// SessionId is the multiplexer session hosting the popup.
+	// SessionId is the multiplexer session hosting the popup — for wezterm,
+	// which addresses panes, the pane the popup is split off, and for kitty the
+	// window an overlay covers.
 	SessionId string
 	// ClientId is the multiplexer client to display the popup on. tmux only —
 	// zellij cannot target a client.
 	ClientId string
 	// SessionMeta is the multiplexer's $TMUX value,
-	// "socket_path,server_pid,session_index".
+	// "socket_path,server_pid,session_index" — or screen's $SCREENDIR, Neovim's
+	// server socket $NVIM, wezterm's $WEZTERM_UNIX_SOCKET, or kitty's
+	// $KITTY_LISTEN_ON, "unix:" and all: String switches to the keyed encoding
+	// for a colon, and a bare path is still taken for a unix socket.
 	SessionMeta string
-	// Rest holds any further colon-separated fields, kept so an unrecognized
-	// tail is visible to the caller instead of silently dropped.
+	// Rest holds what the parser did not recognise, kept so it is visible to the
+	// caller instead of silently dropped, and written back by String: any
+	// further colon-separated fields, or the "key=value" entries of unknown keys
+	// as they were written, still escaped.
 	Rest []string
 }
 
@@ -39,12 +72,85 @@ func (p PinentryUserData) Debug() bool {
 	return strings.HasSuffix(strings.ToUpper(strings.TrimSpace(p.Kind)), "_DEBUG")
 }
 
-// ParsePinentryUserData parses the PINENTRY_USER_DATA wire format. It takes the
-// value as an argument and never reads the environment itself, so the caller
-// decides where the string comes from (env, flag, test fixture).
+// Dynamic reports whether the kind carries the "_DYNAMIC" suffix, before any
+// "_DEBUG" one ("TMUX_POPUP_DYNAMIC_DEBUG"): the session and client fields are
+// then not a snapshot to trust but left for the caller to resolve.
+func (p PinentryUserData) Dynamic() bool {
+	kind := strings.ToUpper(strings.TrimSpace(p.Kind))
+	return strings.HasSuffix(strings.TrimSuffix(kind, "_DEBUG"), "_DYNAMIC")
+}
+
+// String renders p in the wire format ParsePinentryUserData reads, the inverse
+// of it: parsing the result gives p back. The positional encoding is written
+// whenever it can carry p, so a value keeps working with wrappers and legacy
+// binaries that know no other; trailing empty fields are left off, as a short
+// value parses to the same thing, unless Rest follows them. A field holding a
+// colon, or one the surrounding whitespace would be trimmed off, is written in
+// the versioned encoding instead. A hand-built Rest holding both a colon and a
+// semicolon fits neither and does not survive the round trip.
+func (p PinentryUserData) String() string {
+	fields := append([]string{p.Kind, p.Path, p.SessionId, p.ClientId, p.SessionMeta}, p.Rest...)
+	if len(p.Rest) == 0 {
+		for len(fields) > 1 && fields[len(fields)-1] == "" {
+			fields = fields[:len(fields)-1]
+		}
+	}
+	positional := strings.Join(fields, ":")
+	if strings.Count(positional, ":") == len(fields)-1 &&
+		strings.TrimSpace(positional) == positional &&
+		!strings.HasPrefix(positional, userDataV1Prefix) {
+		return positional
+	}
+	return p.keyed()
+}
+
+// userDataV1Prefix opens the versioned encoding. Positional kinds are upper-case
+// words, so no value written for the old parser starts with it.
+const userDataV1Prefix = "RIP1;"
+
+// keyed renders p in the versioned encoding, known keys first in a fixed order
+// and Rest after them as it was read.
+func (p PinentryUserData) keyed() string {
+	var b strings.Builder
+	b.WriteString(userDataV1Prefix)
+	sep := ""
+	for _, kv := range []struct{ key, value string }{
+		{"kind", p.Kind},
+		{"bin", p.Path},
+		{"session", p.SessionId},
+		{"client", p.ClientId},
+		{"socket", p.SessionMeta},
+	} {
+		if kv.value != "" {
+			b.WriteString(sep + kv.key + "=" + escapeUserData(kv.value))
+			sep = ";"
+		}
+	}
+	for _, entry := range p.Rest {
+		b.WriteString(sep + entry)
+		sep = ";"
+	}
+	out := b.String()
+	// An unknown entry ending in whitespace would be trimmed off by the parser;
+	// an empty entry after it is skipped and keeps it whole.
+	if strings.TrimSpace(out) != out {
+		out += ";"
+	}
+	return out
+}
+
+// ParsePinentryUserData parses the PINENTRY_USER_DATA wire format, in either
+// encoding. It takes the value as an argument and never reads the environment
+// itself, so the caller decides where the string comes from (env, flag, test
+// fixture). It never fails: a malformed escape is kept as written, and an
+// entry it cannot place goes to Rest.
 func ParsePinentryUserData(pinentryUserData string) PinentryUserData {
+	pinentryUserData = strings.TrimSpace(pinentryUserData)
+	if keyed, ok := strings.CutPrefix(pinentryUserData, userDataV1Prefix); ok {
+		return parseKeyedUserData(keyed)
+	}
 	var p PinentryUserData
-	s := strings.Split(strings.TrimSpace(pinentryUserData), ":")
+	s := strings.Split(pinentryUserData, ":")
 	if len(s) > 0 {
 		p.Kind = s[0]
 	}
@@ -65,3 +171,78 @@ func ParsePinentryUserData(pinentryUserData string) PinentryUserData {
 	}
 	return p
 }
+
+func parseKeyedUserData(s string) PinentryUserData {
+	var p PinentryUserData
+	for entry := range strings.SplitSeq(s, ";") {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "=")
+		switch key {
+		case "kind":
+			p.Kind = unescapeUserData(value)
+		case "bin":
+			p.Path = unescapeUserData(value)
+		case "session":
+			p.SessionId = unescapeUserData(value)
+		case "client":
+			p.ClientId = unescapeUserData(value)
+		case "socket":
+			p.SessionMeta = unescapeUserData(value)
+		default:
+			p.Rest = append(p.Rest, entry)
+		}
+	}
+	return p
+}
+
+// escapeUserData percent-escapes the bytes the versioned encoding cannot carry
+// as they are: its own separator and escape character, and the spaces and
+// control characters a shell or gpg-agent's Assuan line would mangle.
+func escapeUserData(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%' || c == ';' || c <= ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeUserData undoes escapeUserData. A '%' not followed by two hex digits
+// is taken literally rather than failing the whole value: it is what a
+// hand-written value most likely meant.
+func unescapeUserData(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10
+	default:
+		return c - 'a' + 10
+	}
+}
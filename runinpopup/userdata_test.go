@@ -65,3 +65,168 @@ func TestPinentryUserData_Debug(t *testing.T) {
 		}
 	}
 }
+
+func TestPinentryUserData_Dynamic(t *testing.T) {
+	for _, tc := range []struct {
+		kind string
+		want bool
+	}{
+		{"TMUX_POPUP_DYNAMIC", true},
+		{"ZELLIJ_POPUP_DYNAMIC_DEBUG", true},
+		{" tmux_floating_pane_dynamic ", true},
+		{"TMUX_POPUP", false},
+		{"TMUX_POPUP_DEBUG", false},
+		{"", false},
+	} {
+		if got := (PinentryUserData{Kind: tc.kind}).Dynamic(); got != tc.want {
+			t.Errorf("Kind %q: Dynamic() = %t, want %t", tc.kind, got, tc.want)
+		}
+	}
+}
+
+func TestPinentryUserData_String(t *testing.T) {
+	for _, tc := range []struct {
+		data PinentryUserData
+		want string
+	}{
+		{
+			data: PinentryUserData{
+				Kind:        "TMUX_POPUP",
+				Path:        "/usr/bin/tmux",
+				SessionId:   "$1",
+				ClientId:    "/dev/pts/3",
+				SessionMeta: "/tmp/tmux-1000/default,111,0",
+			},
+			want: "TMUX_POPUP:/usr/bin/tmux:$1:/dev/pts/3:/tmp/tmux-1000/default,111,0",
+		},
+		{
+			data: PinentryUserData{
+				Kind:        "TMUX_FLOATING_PANE",
+				Path:        "/usr/bin/tmux",
+				SessionId:   "$1",
+				SessionMeta: "/tmp/tmux-1000/default,111,0",
+			},
+			want: "TMUX_FLOATING_PANE:/usr/bin/tmux:$1::/tmp/tmux-1000/default,111,0",
+		},
+		{
+			data: PinentryUserData{Kind: "ZELLIJ_POPUP", Path: "/usr/bin/zellij", SessionId: "work"},
+			want: "ZELLIJ_POPUP:/usr/bin/zellij:work",
+		},
+		{
+			data: PinentryUserData{Kind: "NVIM_POPUP", SessionMeta: "/run/nvim.1"},
+			want: "NVIM_POPUP::::/run/nvim.1",
+		},
+		{data: PinentryUserData{Kind: "X", Rest: []string{"", "tail"}}, want: "X::::::tail"},
+		{data: PinentryUserData{}, want: ""},
+		{
+			data: PinentryUserData{
+				Kind:        "TMUX_POPUP",
+				Path:        "/usr/bin/tmux",
+				SessionId:   "$1",
+				ClientId:    "%1",
+				SessionMeta: "/tmp/a:b/default,111,0",
+			},
+			want: "RIP1;kind=TMUX_POPUP;bin=/usr/bin/tmux;session=$1;client=%251" +
+				";socket=/tmp/a:b/default,111,0",
+		},
+		{
+			data: PinentryUserData{Kind: "ZELLIJ_POPUP", SessionId: "my work; really "},
+			want: "RIP1;kind=ZELLIJ_POPUP;session=my%20work%3B%20really%20",
+		},
+		{
+			data: PinentryUserData{Kind: "RIP1;"},
+			want: "RIP1;kind=RIP1%3B",
+		},
+	} {
+		got := tc.data.String()
+		if got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+		if back := ParsePinentryUserData(got); !reflect.DeepEqual(back, tc.data) {
+			t.Errorf("ParsePinentryUserData(%q) = %#v, want %#v back", got, back, tc.data)
+		}
+	}
+}
+
+func TestParsePinentryUserData_keyed(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  PinentryUserData
+	}{
+		{
+			name: "every key, in any order",
+			input: "RIP1;socket=/tmp/a:b/default,111,0;client=/dev/pts/3;session=$1" +
+				";bin=/usr/bin/tmux;kind=TMUX_POPUP_DYNAMIC\n",
+			want: PinentryUserData{
+				Kind:        "TMUX_POPUP_DYNAMIC",
+				Path:        "/usr/bin/tmux",
+				SessionId:   "$1",
+				ClientId:    "/dev/pts/3",
+				SessionMeta: "/tmp/a:b/default,111,0",
+			},
+		},
+		{
+			name:  "escapes",
+			input: "RIP1;kind=ZELLIJ_POPUP;session=a%20b%3bc%25d",
+			want:  PinentryUserData{Kind: "ZELLIJ_POPUP", SessionId: "a b;c%d"},
+		},
+		{
+			name:  "a malformed escape is kept",
+			input: "RIP1;session=100%;client=%zz",
+			want:  PinentryUserData{SessionId: "100%", ClientId: "%zz"},
+		},
+		{
+			name:  "unknown keys are kept as written",
+			input: "RIP1;kind=NVIM_POPUP;theme=dark%20blue;;bare;kind=KITTY_POPUP",
+			want: PinentryUserData{
+				Kind: "KITTY_POPUP",
+				Rest: []string{"theme=dark%20blue", "bare"},
+			},
+		},
+		{
+			name:  "nothing",
+			input: "RIP1;",
+			want:  PinentryUserData{},
+		},
+		{
+			name:  "not the prefix",
+			input: "RIP1:x",
+			want:  PinentryUserData{Kind: "RIP1", Path: "x"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParsePinentryUserData(tc.input)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParsePinentryUserData(%q) = %#v, want %#v", tc.input, got, tc.want)
+			}
+			if back := ParsePinentryUserData(got.String()); !reflect.DeepEqual(back, got) {
+				t.Errorf("round trip through %q = %#v, want %#v", got.String(), back, got)
+			}
+		})
+	}
+}
+
+// Whatever a value parses to, String writes something that parses to the same
+// thing, in whichever encoding it picks.
+func FuzzParsePinentryUserData(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"TMUX_POPUP:/usr/bin/tmux:$1:/dev/pts/3:/tmp/tmux-1000/default,111,0",
+		"NVIM_POPUP::::/run/nvim.1:extra:",
+		"a :",
+		"RIP1;kind=TMUX_POPUP;socket=/a:b;client=%251",
+		"RIP1;x= ;kind=a",
+		"RIP1;session=%;;unknown\u00a0",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		p := ParsePinentryUserData(input)
+		out := p.String()
+		if back := ParsePinentryUserData(out); !reflect.DeepEqual(back, p) {
+			t.Errorf("ParsePinentryUserData(%q) = %#v\nbut its String %q parses to %#v",
+				input, p, out, back)
+		}
+	})
+}